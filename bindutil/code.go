@@ -0,0 +1,125 @@
+package bindutil
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// Code identifies the compiled contract that a set of bindings was generated from. genABI
+// generates one for each contract, e.g. abi.ManagerCode.
+type Code struct {
+	Contract string // Contract name, e.g. "Manager".
+
+	// Runtime is the contract's runtime bytecode, as hex, as solc's bin-runtime output reports it.
+	// Unlinked library addresses appear as placeholders of 40 non-hex characters.
+	Runtime string
+
+	// InputHash is the hash of the ABI and bytecode the bindings were generated from, as also
+	// written at the top of each generated file.
+	InputHash string
+}
+
+// ErrNoCode is returned by VerifyDeployedCode if there is no contract at the address.
+var ErrNoCode = errors.New("no contract code at address")
+
+// CodeMismatchError is returned by VerifyDeployedCode if the code deployed at an address is not
+// the code the bindings were generated from.
+type CodeMismatchError struct {
+	Contract string
+	Address  common.Address
+	Reason   string
+}
+
+func (e *CodeMismatchError) Error() string {
+	return fmt.Sprintf("%v at %v: deployed code differs from the bindings: %v", e.Contract, e.Address.Hex(), e.Reason)
+}
+
+// VerifyDeployedCode checks that the runtime code of the contract at address is c.Runtime.
+//
+// The metadata that solc appends to runtime code, which includes a hash of the source files and
+// changes with comments and paths, is ignored. So are linked library addresses, and the address
+// a library embeds in its own code when deployed.
+func (c Code) VerifyDeployedCode(ctx context.Context, client bind.ContractCaller, address common.Address) error {
+	deployed, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return errors.Wrapf(err, "getting code of %v at %v", c.Contract, address.Hex())
+	}
+	if len(deployed) == 0 {
+		return errors.Wrapf(ErrNoCode, "%v at %v", c.Contract, address.Hex())
+	}
+
+	expected, wildcard := decodeCodePattern(c.Runtime)
+	deployed, expected = stripMetadata(deployed), stripMetadata(expected)
+	if len(deployed) != len(expected) {
+		return &CodeMismatchError{c.Contract, address, fmt.Sprintf(
+			"%v bytes deployed, %v bytes expected", len(deployed), len(expected),
+		)}
+	}
+	for i := range expected {
+		if deployed[i] != expected[i] && !wildcard[i] {
+			return &CodeMismatchError{c.Contract, address, fmt.Sprintf("first difference at byte %v", i)}
+		}
+	}
+	return nil
+}
+
+// decodeCodePattern decodes bytecode given as hex, marking the bytes that a deployed copy may
+// differ in as wildcards: unlinked library placeholders, and the PUSH20 of a library's own address
+// that begins a library's runtime code.
+func decodeCodePattern(code string) (decoded []byte, wildcard []bool) {
+	code = strings.TrimPrefix(code, "0x")
+	decoded = make([]byte, len(code)/2)
+	wildcard = make([]bool, len(decoded))
+	for i := 0; i < len(decoded); i++ {
+		if strings.HasPrefix(code[2*i:], "__") && 2*i+40 <= len(code) {
+			// A library placeholder, like __$<34 hex digits>$__, holds a 20-byte address.
+			for j := i; j < i+20; j++ {
+				wildcard[j] = true
+			}
+			i += 19
+			continue
+		}
+		b, err := hex.DecodeString(code[2*i : 2*i+2])
+		if err != nil {
+			wildcard[i] = true
+			continue
+		}
+		decoded[i] = b[0]
+	}
+
+	if len(decoded) > 21 && decoded[0] == 0x73 && isZero(decoded[1:21]) {
+		for i := 1; i < 21; i++ {
+			wildcard[i] = true
+		}
+	}
+	return decoded, wildcard
+}
+
+// stripMetadata removes the CBOR-encoded metadata that solc appends to code. Its length is given
+// by the code's last two bytes, and it starts with a CBOR map header.
+func stripMetadata(code []byte) []byte {
+	if len(code) < 2 {
+		return code
+	}
+	length := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	start := len(code) - 2 - length
+	if length == 0 || start < 0 || code[start]&0xe0 != 0xa0 {
+		return code
+	}
+	return code[:start]
+}
+
+func isZero(b []byte) bool {
+	for _, x := range b {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package bindutil
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// deployedCode is a bind.ContractCaller whose contracts have fixed code.
+type deployedCode map[common.Address]string
+
+func (d deployedCode) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return hexutil.MustDecode("0x" + d[contract]), nil
+}
+
+func (d deployedCode) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
+
+const (
+	// runtime is a contract's code: PUSH1 0x80, PUSH20 <unlinked library>, STOP.
+	runtime = "6080" + "73__$e8a7e3d5a2d5a5b5f4e5e2f1c1c1b5a5a5$__" + "00"
+
+	// metadataA and metadataB are solc metadata suffixes, which differ between compiles of the
+	// same code with different comments.
+	metadataA = "a165627a7a72305820" + "1111111111111111111111111111111111111111111111111111111111111111" + "0029"
+	metadataB = "a165627a7a72305820" + "2222222222222222222222222222222222222222222222222222222222222222" + "0029"
+
+	linked = "6080" + "73" + "5409ed021d9299bf6814279a6a1411a7e866a631" + "00"
+)
+
+func TestVerifyDeployedCode(t *testing.T) {
+	code := Code{Contract: "Pinger", Runtime: runtime + metadataA}
+	chain := deployedCode{
+		{1}: linked + metadataB,
+		{2}: "6081" + linked[4:] + metadataA,
+		{3}: linked + "00" + metadataA,
+	}
+	ctx := context.Background()
+
+	assert.NoError(t, code.VerifyDeployedCode(ctx, chain, common.Address{1}))
+	assert.EqualError(t, code.VerifyDeployedCode(ctx, chain, common.Address{2}),
+		"Pinger at 0x0200000000000000000000000000000000000000: deployed code differs from the bindings: first difference at byte 1")
+	assert.EqualError(t, code.VerifyDeployedCode(ctx, chain, common.Address{3}),
+		"Pinger at 0x0300000000000000000000000000000000000000: deployed code differs from the bindings: 25 bytes deployed, 24 bytes expected")
+	assert.Equal(t, ErrNoCode, errors.Cause(code.VerifyDeployedCode(ctx, chain, common.Address{4})))
+}
+
+func TestVerifyDeployedLibraryCode(t *testing.T) {
+	// A library's code starts by pushing its own address, which is zero until it is deployed.
+	library := Code{Contract: "Lib", Runtime: "73" + "0000000000000000000000000000000000000000" + "3014" + metadataA}
+	chain := deployedCode{{1}: "73" + "0100000000000000000000000000000000000000" + "3014" + metadataB}
+	assert.NoError(t, library.VerifyDeployedCode(context.Background(), chain, common.Address{1}))
+}
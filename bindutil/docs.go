@@ -0,0 +1,52 @@
+package bindutil
+
+import "strings"
+
+// ContractDocs is a contract's NatSpec documentation, as solc reports it in its userdoc and devdoc
+// outputs. genABI generates one for each contract, e.g. abi.ManagerDocs.
+type ContractDocs struct {
+	Title   string // @title
+	Author  string // @author
+	Notice  string // @notice, or an untagged /// comment
+	Details string // @dev
+
+	Methods map[string]MemberDocs // Keyed by signature, e.g. "issue(uint256)".
+	Events  map[string]MemberDocs // Keyed by signature, e.g. "Issuance(address,uint256)".
+}
+
+// MemberDocs is the NatSpec documentation of a single function or event.
+type MemberDocs struct {
+	Notice  string            // @notice, or an untagged /// comment
+	Details string            // @dev
+	Params  map[string]string // @param, keyed by parameter name
+	Return  string            // @return
+}
+
+// Method returns the documentation for the named method. name is either a full signature, like
+// "proposeSwap(address[],uint256[],bool[])", or just a method name, like "proposeSwap", which
+// matches if the contract has exactly one documented method by that name.
+func (d ContractDocs) Method(name string) (signature string, docs MemberDocs, ok bool) {
+	return lookupMember(d.Methods, name)
+}
+
+// Event returns the documentation for the named event, looked up like Method does.
+func (d ContractDocs) Event(name string) (signature string, docs MemberDocs, ok bool) {
+	return lookupMember(d.Events, name)
+}
+
+// lookupMember finds name in members, by signature or by unambiguous name.
+func lookupMember(members map[string]MemberDocs, name string) (string, MemberDocs, bool) {
+	if docs, ok := members[name]; ok {
+		return name, docs, true
+	}
+	var found []string
+	for signature := range members {
+		if strings.HasPrefix(signature, name+"(") {
+			found = append(found, signature)
+		}
+	}
+	if len(found) != 1 {
+		return "", MemberDocs{}, false
+	}
+	return found[0], members[found[0]], true
+}
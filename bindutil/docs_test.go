@@ -0,0 +1,33 @@
+package bindutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var managerDocs = ContractDocs{
+	Methods: map[string]MemberDocs{
+		"issue(uint256)": {Notice: "Handles issuance."},
+		"proposeSwap(address[],uint256[],bool[])": {Notice: "Propose a swap."},
+		"setOperator(address)":                    {Notice: "Set the operator."},
+		"setOperator(address,bool)":               {Notice: "Set or clear an operator."},
+	},
+}
+
+func TestContractDocsMethod(t *testing.T) {
+	signature, docs, ok := managerDocs.Method("proposeSwap")
+	assert.True(t, ok)
+	assert.Equal(t, "proposeSwap(address[],uint256[],bool[])", signature)
+	assert.Equal(t, "Propose a swap.", docs.Notice)
+
+	_, docs, ok = managerDocs.Method("setOperator(address,bool)")
+	assert.True(t, ok)
+	assert.Equal(t, "Set or clear an operator.", docs.Notice)
+
+	// Overloaded and undocumented methods can't be found by name.
+	_, _, ok = managerDocs.Method("setOperator")
+	assert.False(t, ok)
+	_, _, ok = managerDocs.Method("issu")
+	assert.False(t, ok)
+}
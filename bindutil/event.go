@@ -0,0 +1,165 @@
+package bindutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+// Event is implemented by every event type genABI generates, such as abi.ManagerIssuance.
+//
+// Each contract also gets its own <Contract>Event interface that only that contract's events
+// implement, so a type switch over one covers every event the contract can emit.
+type Event interface {
+	fmt.Stringer
+
+	// Contract returns the name of the contract that emits the event, e.g. "Manager".
+	Contract() string
+
+	// EventName returns the event's name as declared in Solidity, e.g. "Issuance".
+	EventName() string
+
+	// Schema describes the event's arguments and their JSON encoding.
+	Schema() EventSchema
+}
+
+// ContractKind identifies one contract type to a Router. genABI generates one for each contract,
+// e.g. abi.ManagerKind.
+type ContractKind struct {
+	Name       string                             // Contract name, e.g. "Manager".
+	ParseEvent func(log types.Log) (Event, error) // Decodes a log emitted by this kind of contract.
+}
+
+// ErrUnknownAddress is returned by Router.ParseLog for a log from an address that was never
+// registered.
+var ErrUnknownAddress = errors.New("log from an unregistered contract address")
+
+// Router decodes logs from many contracts into typed events.
+//
+// Register each deployed contract's address with its kind; ParseLog then looks up the kind of the
+// contract that emitted a log and decodes the log into that contract's concrete event type.
+// A Router is safe for concurrent use.
+type Router struct {
+	mu    sync.RWMutex
+	kinds map[common.Address]ContractKind
+}
+
+// NewRouter returns a Router with no registered contracts.
+func NewRouter() *Router {
+	return &Router{kinds: make(map[common.Address]ContractKind)}
+}
+
+// Register records that the contract at address is of the given kind, replacing any earlier
+// registration for that address.
+func (r *Router) Register(address common.Address, kind ContractKind) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds[address] = kind
+}
+
+// Kind returns the kind registered for address.
+func (r *Router) Kind(address common.Address) (ContractKind, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	kind, ok := r.kinds[address]
+	return kind, ok
+}
+
+// Addresses returns every registered address, in no particular order.
+func (r *Router) Addresses() []common.Address {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	addresses := make([]common.Address, 0, len(r.kinds))
+	for address := range r.kinds {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// ParseLog decodes log into the typed event of the contract registered at log.Address.
+// It returns an error wrapping ErrUnknownAddress if no contract is registered there.
+func (r *Router) ParseLog(log types.Log) (Event, error) {
+	kind, ok := r.Kind(log.Address)
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownAddress, log.Address.Hex())
+	}
+	return kind.ParseEvent(log)
+}
+
+// ParseLogs decodes each of logs, as from a transaction receipt, with ParseLog.
+func (r *Router) ParseLogs(logs []*types.Log) ([]Event, error) {
+	events := make([]Event, len(logs))
+	for i, log := range logs {
+		event, err := r.ParseLog(*log)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing log %v", i)
+		}
+		events[i] = event
+	}
+	return events, nil
+}
+
+// FilterLogs retrieves the logs matching query and returns an iterator over their typed events.
+// If query does not restrict the addresses to search, it is restricted to every registered address.
+func (r *Router) FilterLogs(ctx context.Context, filterer ethereum.LogFilterer, query ethereum.FilterQuery) (*EventIterator, error) {
+	if len(query.Addresses) == 0 {
+		query.Addresses = r.Addresses()
+	}
+	logs, err := filterer.FilterLogs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &EventIterator{router: r, logs: logs}, nil
+}
+
+// EventIterator is returned from Router.FilterLogs and is used to iterate over the raw logs and
+// typed events it found.
+type EventIterator struct {
+	Event Event     // Event containing the contract specifics, or nil before the first call to Next
+	Raw   types.Log // Blockchain specific contextual infos of Event
+
+	router *Router
+	logs   []types.Log
+	err    error
+}
+
+// Next advances the iterator to the subsequent event, returning whether there are any more
+// events found. In case of a decoding error, false is returned and Error() can be queried for
+// the exact failure.
+func (it *EventIterator) Next() bool {
+	if it.err != nil || len(it.logs) == 0 {
+		return false
+	}
+	it.Raw, it.logs = it.logs[0], it.logs[1:]
+	it.Event, it.err = it.router.ParseLog(it.Raw)
+	return it.err == nil
+}
+
+// Error returns any decoding error encountered by Next.
+func (it *EventIterator) Error() error {
+	return it.err
+}
+
+// Close releases the iterator's logs.
+func (it *EventIterator) Close() error {
+	it.logs = nil
+	return nil
+}
+
+// NewLogUnpacker returns a contract binding with no backend, which generated code uses only to
+// unpack logs. It panics if abiJSON is invalid, which cannot happen for generated ABI constants.
+func NewLogUnpacker(abiJSON string) *bind.BoundContract {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		panic(err)
+	}
+	return bind.NewBoundContract(common.Address{}, parsed, nil, nil, nil)
+}
@@ -0,0 +1,90 @@
+package bindutil
+
+import (
+	"context"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pinged is a stand-in for a generated event type.
+type pinged struct {
+	Raw types.Log
+}
+
+func (e pinged) String() string  { return "Pinger.Pinged()" }
+func (pinged) Contract() string  { return "Pinger" }
+func (pinged) EventName() string { return "Pinged" }
+func (pinged) Schema() EventSchema {
+	return EventSchema{Contract: "Pinger", Event: "Pinged", Signature: "Pinged()"}
+}
+
+var pingerKind = ContractKind{
+	Name: "Pinger",
+	ParseEvent: func(log types.Log) (Event, error) {
+		return &pinged{Raw: log}, nil
+	},
+}
+
+// logs is an ethereum.LogFilterer that returns a fixed set of logs.
+type logs []types.Log
+
+func (l logs) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return l, nil
+}
+
+func (l logs) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestRouterParseLog(t *testing.T) {
+	router := NewRouter()
+	pinger := common.Address{1}
+	router.Register(pinger, pingerKind)
+
+	event, err := router.ParseLog(types.Log{Address: pinger})
+	require.NoError(t, err)
+	assert.Equal(t, "Pinger", event.Contract())
+	assert.Equal(t, "Pinged", event.EventName())
+
+	_, err = router.ParseLog(types.Log{Address: common.Address{2}})
+	assert.Equal(t, ErrUnknownAddress, errors.Cause(err))
+}
+
+func TestRouterParseLogs(t *testing.T) {
+	router := NewRouter()
+	router.Register(common.Address{1}, pingerKind)
+
+	events, err := router.ParseLogs([]*types.Log{{Address: common.Address{1}}, {Address: common.Address{1}}})
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	_, err = router.ParseLogs([]*types.Log{{Address: common.Address{1}}, {Address: common.Address{3}}})
+	assert.Error(t, err)
+}
+
+func TestRouterFilterLogs(t *testing.T) {
+	router := NewRouter()
+	router.Register(common.Address{1}, pingerKind)
+
+	it, err := router.FilterLogs(
+		context.Background(),
+		logs{{Address: common.Address{1}, Index: 0}, {Address: common.Address{1}, Index: 1}, {Address: common.Address{4}}},
+		ethereum.FilterQuery{},
+	)
+	require.NoError(t, err)
+	defer it.Close()
+
+	var indexes []uint
+	for it.Next() {
+		assert.Equal(t, "Pinged", it.Event.EventName())
+		indexes = append(indexes, it.Raw.Index)
+	}
+	assert.Equal(t, []uint{0, 1}, indexes)
+	assert.Equal(t, ErrUnknownAddress, errors.Cause(it.Error()))
+}
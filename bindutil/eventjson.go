@@ -0,0 +1,247 @@
+package bindutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+// EventSchema describes an event type and its JSON encoding. genABI generates one for every event,
+// available from the event's Schema method.
+//
+// An event encodes as
+//
+//	{"contract": "Manager", "event": "Issuance", "args": {"user": ..., "amount": ...}, "raw": {...}}
+//
+// where "args" holds the fields in declaration order and "raw" is the types.Log the event was
+// decoded from, omitted if the event was not decoded from a log.
+type EventSchema struct {
+	Contract  string        // Name of the emitting contract, e.g. "Manager".
+	Event     string        // Event name, e.g. "Issuance".
+	Signature string        // Canonical signature, e.g. "Issuance(address,uint256)".
+	Topic     common.Hash   // Keccak-256 hash of Signature; the log's first topic.
+	Fields    []FieldSchema // The event's arguments, in declaration order.
+}
+
+// FieldSchema describes one event argument.
+type FieldSchema struct {
+	Name     string // JSON key, as named in Solidity, e.g. "user".
+	GoName   string // Field name in the generated Go struct, e.g. "User".
+	Type     string // Solidity type, e.g. "address" or "uint256[]".
+	Indexed  bool   // Whether the argument is stored in a topic rather than the log data.
+	Encoding string // How the value is written in JSON; one of the Encoding* constants.
+}
+
+// Values of FieldSchema.Encoding. Arrays use the encoding of their elements, wrapped in a JSON array.
+const (
+	EncodingAddress = "address" // Checksummed 0x-prefixed hex string.
+	EncodingDecimal = "decimal" // Decimal string, for integers too large for a JSON number.
+	EncodingNumber  = "number"  // JSON number, for integers of at most 64 bits.
+	EncodingHex     = "hex"     // 0x-prefixed hex string, for bytes, bytesN, and hashed topics.
+	EncodingBool    = "bool"    // JSON boolean.
+	EncodingString  = "string"  // JSON string.
+)
+
+// eventJSON is the JSON form of an event.
+type eventJSON struct {
+	Contract string          `json:"contract"`
+	Event    string          `json:"event"`
+	Args     json.RawMessage `json:"args"`
+	Raw      *types.Log      `json:"raw,omitempty"`
+}
+
+// MarshalEvent encodes event, which must be a generated event struct (or a pointer to one),
+// according to schema. Generated MarshalJSON methods call it.
+func MarshalEvent(event interface{}, schema EventSchema) ([]byte, error) {
+	v := reflect.Indirect(reflect.ValueOf(event))
+
+	args := new(bytes.Buffer)
+	args.WriteByte('{')
+	for i, field := range schema.Fields {
+		value, err := encodeValue(v.FieldByName(field.GoName))
+		if err != nil {
+			return nil, errors.Wrapf(err, "encoding %v.%v.%v", schema.Contract, schema.Event, field.Name)
+		}
+		key, _ := json.Marshal(field.Name)
+		if i > 0 {
+			args.WriteByte(',')
+		}
+		args.Write(key)
+		args.WriteByte(':')
+		args.Write(value)
+	}
+	args.WriteByte('}')
+
+	out := eventJSON{Contract: schema.Contract, Event: schema.Event, Args: args.Bytes()}
+	if raw, ok := v.FieldByName("Raw").Interface().(types.Log); ok && len(raw.Topics) > 0 {
+		out.Raw = &raw
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalEvent decodes data, as written by MarshalEvent, into event, which must be a pointer to
+// a generated event struct. Generated UnmarshalJSON methods call it.
+func UnmarshalEvent(data []byte, event interface{}, schema EventSchema) error {
+	var in eventJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	if in.Contract != schema.Contract || in.Event != schema.Event {
+		return fmt.Errorf(
+			"cannot decode a %v.%v event into %v.%v",
+			in.Contract, in.Event, schema.Contract, schema.Event,
+		)
+	}
+	var args map[string]json.RawMessage
+	if err := json.Unmarshal(in.Args, &args); err != nil {
+		return errors.Wrapf(err, "decoding %v.%v args", schema.Contract, schema.Event)
+	}
+
+	v := reflect.ValueOf(event).Elem()
+	for _, field := range schema.Fields {
+		value, ok := args[field.Name]
+		if !ok {
+			return fmt.Errorf("%v.%v: missing arg %q", schema.Contract, schema.Event, field.Name)
+		}
+		if err := decodeValue(value, v.FieldByName(field.GoName)); err != nil {
+			return errors.Wrapf(err, "decoding %v.%v.%v", schema.Contract, schema.Event, field.Name)
+		}
+	}
+	raw := v.FieldByName("Raw")
+	if in.Raw != nil {
+		raw.Set(reflect.ValueOf(*in.Raw))
+	} else {
+		raw.Set(reflect.Zero(raw.Type()))
+	}
+	return nil
+}
+
+// LogContext returns event's arguments as alternating keys and values, encoded as in its JSON
+// form, for structured loggers such as go-ethereum's log package:
+//
+//	log.Info("event", bindutil.LogContext(event)...)
+//
+// The first pair is always "event" and "<Contract>.<Event>".
+func LogContext(event Event) []interface{} {
+	schema := event.Schema()
+	v := reflect.Indirect(reflect.ValueOf(event))
+	ctx := []interface{}{"event", schema.Contract + "." + schema.Event}
+	for _, field := range schema.Fields {
+		var value interface{}
+		if encoded, err := encodeValue(v.FieldByName(field.GoName)); err != nil {
+			value = err.Error()
+		} else if err := json.Unmarshal(encoded, &value); err != nil {
+			value = err.Error()
+		}
+		ctx = append(ctx, field.Name, value)
+	}
+	return ctx
+}
+
+var (
+	addressType = reflect.TypeOf(common.Address{})
+	bigIntType  = reflect.TypeOf((*big.Int)(nil))
+)
+
+// encodeValue writes v, a value of one of the Go types bind.Bind uses, as JSON.
+func encodeValue(v reflect.Value) ([]byte, error) {
+	switch {
+	case v.Type() == addressType:
+		return json.Marshal(v.Interface().(common.Address).Hex())
+	case v.Type() == bigIntType:
+		if v.IsNil() {
+			return []byte("null"), nil
+		}
+		return json.Marshal(v.Interface().(*big.Int).String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return json.Marshal(hexutil.Encode(v.Bytes()))
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		b := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(b), v)
+		return json.Marshal(hexutil.Encode(b))
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		elems := make([]json.RawMessage, v.Len())
+		for i := range elems {
+			elem, err := encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = elem
+		}
+		return json.Marshal(elems)
+	case v.Kind() == reflect.Bool || v.Kind() == reflect.String:
+		return json.Marshal(v.Interface())
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Uint64:
+		return json.Marshal(v.Interface())
+	}
+	return nil, fmt.Errorf("unsupported type %v", v.Type())
+}
+
+// decodeValue reads data, as written by encodeValue, into v.
+func decodeValue(data json.RawMessage, v reflect.Value) error {
+	switch {
+	case v.Type() == addressType:
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if !common.IsHexAddress(s) {
+			return fmt.Errorf("invalid address %q", s)
+		}
+		v.Set(reflect.ValueOf(common.HexToAddress(s)))
+	case v.Type() == bigIntType:
+		var s *string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		n, ok := new(big.Int).SetString(*s, 10)
+		if !ok {
+			return fmt.Errorf("invalid decimal integer %q", *s)
+		}
+		v.Set(reflect.ValueOf(n))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		var b hexutil.Bytes
+		if err := json.Unmarshal(data, &b); err != nil {
+			return err
+		}
+		v.SetBytes(b)
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		var b hexutil.Bytes
+		if err := json.Unmarshal(data, &b); err != nil {
+			return err
+		}
+		if len(b) != v.Len() {
+			return fmt.Errorf("got %v bytes, want %v", len(b), v.Len())
+		}
+		reflect.Copy(v, reflect.ValueOf([]byte(b)))
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return err
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), len(elems), len(elems)))
+		} else if len(elems) != v.Len() {
+			return fmt.Errorf("got %v elements, want %v", len(elems), v.Len())
+		}
+		for i, elem := range elems {
+			if err := decodeValue(elem, v.Index(i)); err != nil {
+				return errors.Wrapf(err, "element %v", i)
+			}
+		}
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package bindutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// transferForwarded mirrors the struct genABI generates for Relayer.TransferForwarded,
+// plus an array field to cover nested encodings.
+type transferForwarded struct {
+	Sig     []byte
+	From    common.Address
+	Amount  *big.Int
+	Amounts []*big.Int
+	Ok      bool
+	Raw     types.Log
+}
+
+var transferForwardedSchema = EventSchema{
+	Contract:  "Relayer",
+	Event:     "TransferForwarded",
+	Signature: "TransferForwarded(bytes,address,uint256,uint256[],bool)",
+	Fields: []FieldSchema{
+		{Name: "sig", GoName: "Sig", Type: "bytes", Encoding: EncodingHex},
+		{Name: "from", GoName: "From", Type: "address", Indexed: true, Encoding: EncodingAddress},
+		{Name: "amount", GoName: "Amount", Type: "uint256", Indexed: true, Encoding: EncodingDecimal},
+		{Name: "amounts", GoName: "Amounts", Type: "uint256[]", Encoding: EncodingDecimal},
+		{Name: "ok", GoName: "Ok", Type: "bool", Encoding: EncodingBool},
+	},
+}
+
+func (e transferForwarded) String() string               { return "Relayer.TransferForwarded" }
+func (transferForwarded) Contract() string               { return "Relayer" }
+func (transferForwarded) EventName() string              { return "TransferForwarded" }
+func (transferForwarded) Schema() EventSchema            { return transferForwardedSchema }
+func (e transferForwarded) MarshalJSON() ([]byte, error) { return MarshalEvent(e, e.Schema()) }
+func (e *transferForwarded) UnmarshalJSON(data []byte) error {
+	return UnmarshalEvent(data, e, e.Schema())
+}
+
+var sampleTransfer = transferForwarded{
+	Sig:     []byte{0xde, 0xad, 0xbe, 0xef},
+	From:    common.HexToAddress("0x5409ed021d9299bf6814279a6a1411a7e866a631"),
+	Amount:  new(big.Int).Lsh(big.NewInt(1), 100),
+	Amounts: []*big.Int{big.NewInt(1), big.NewInt(2)},
+	Ok:      true,
+}
+
+func TestMarshalEvent(t *testing.T) {
+	got, err := json.Marshal(sampleTransfer)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"contract": "Relayer",
+		"event": "TransferForwarded",
+		"args": {
+			"sig": "0xdeadbeef",
+			"from": "0x5409ED021D9299bf6814279A6A1411A7e866A631",
+			"amount": "1267650600228229401496703205376",
+			"amounts": ["1", "2"],
+			"ok": true
+		}
+	}`, string(got))
+}
+
+func TestUnmarshalEventRoundTrip(t *testing.T) {
+	event := sampleTransfer
+	event.Raw = types.Log{
+		Address: common.Address{1},
+		Topics:  []common.Hash{{2}},
+		Data:    []byte{3},
+		TxHash:  common.Hash{4},
+		Index:   5,
+	}
+	encoded, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	var decoded transferForwarded
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, event.Sig, decoded.Sig)
+	assert.Equal(t, event.From, decoded.From)
+	assert.Equal(t, event.Amount.String(), decoded.Amount.String())
+	assert.Equal(t, "[1 2]", fmt.Sprint(decoded.Amounts))
+	assert.Equal(t, event.Ok, decoded.Ok)
+	assert.Equal(t, event.Raw, decoded.Raw)
+}
+
+func TestUnmarshalEventWrongType(t *testing.T) {
+	var decoded transferForwarded
+	err := json.Unmarshal([]byte(`{"contract":"Manager","event":"Issuance","args":{}}`), &decoded)
+	assert.EqualError(t, err, "cannot decode a Manager.Issuance event into Relayer.TransferForwarded")
+}
+
+func TestLogContext(t *testing.T) {
+	assert.Equal(t, []interface{}{
+		"event", "Relayer.TransferForwarded",
+		"sig", "0xdeadbeef",
+		"from", "0x5409ED021D9299bf6814279A6A1411A7e866A631",
+		"amount", "1267650600228229401496703205376",
+		"amounts", []interface{}{"1", "2"},
+		"ok", true,
+	}, LogContext(sampleTransfer))
+}
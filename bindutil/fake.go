@@ -0,0 +1,295 @@
+package bindutil
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/pkg/errors"
+)
+
+// Fake is the in-memory contract behind the <Contract>Fake types that genABI generates, such as
+// abi.ManagerFake. It records every call made to the fake, builds the transactions the fake's
+// mutators return, and holds the events that tests script with Emit, for the fake's Filter and
+// Watch methods to deliver.
+//
+// A Fake is safe for concurrent use.
+type Fake struct {
+	contract string
+	address  common.Address
+	abi      abi.ABI
+
+	mu       sync.Mutex
+	calls    []FakeCall
+	logs     []types.Log
+	nonce    uint64
+	block    uint64
+	watchers []*fakeWatcher
+}
+
+// FakeCall is a call recorded by a Fake.
+type FakeCall struct {
+	// Method is the Solidity name of the method called, e.g. "proposeSwap", or, for filter and
+	// watch methods, the Go method name, e.g. "FilterIssuance".
+	Method string
+
+	// Args holds the Go arguments of the call, excluding its options.
+	Args []interface{}
+}
+
+// NewFake returns a Fake for the named contract, with the given JSON ABI, that pretends to be
+// deployed at address. It panics if abiJSON is invalid, which cannot happen for generated ABI
+// constants.
+func NewFake(contract string, abiJSON string, address common.Address) *Fake {
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		panic(err)
+	}
+	return &Fake{contract: contract, address: address, abi: parsed}
+}
+
+// Address returns the address the fake pretends to be deployed at.
+func (f *Fake) Address() common.Address {
+	return f.address
+}
+
+// Record records a call to method with args.
+func (f *Fake) Record(method string, args ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, FakeCall{Method: method, Args: args})
+}
+
+// Calls returns every call recorded so far, in order.
+func (f *Fake) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// CallsTo returns the recorded calls to method, in order.
+func (f *Fake) CallsTo(method string) []FakeCall {
+	var calls []FakeCall
+	for _, call := range f.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets every recorded call and emitted event.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls, f.logs = nil, nil
+}
+
+// Transaction returns the unsigned transaction that calling method with args would send to the
+// fake, as a stand-in result for mutators that have no scripted behavior.
+func (f *Fake) Transaction(opts *bind.TransactOpts, method string, args ...interface{}) (*types.Transaction, error) {
+	input, err := f.abi.Pack(method, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "packing %v.%v", f.contract, method)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	nonce := f.nonce
+	if opts.Nonce != nil {
+		nonce = opts.Nonce.Uint64()
+	}
+	f.nonce = nonce + 1
+	return types.NewTransaction(nonce, f.address, opts.Value, opts.GasLimit, opts.GasPrice, input), nil
+}
+
+// Emit records events as emitted by the fake, all in a single new block, and delivers them to
+// any matching Watch subscriptions. Each event must be one of the fake contract's event types.
+func (f *Fake) Emit(events ...Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.block++
+	for _, e := range events {
+		log, err := f.encodeLog(e)
+		if err != nil {
+			return err
+		}
+		log.BlockNumber = f.block
+		log.Index = uint(len(f.logs))
+		f.logs = append(f.logs, log)
+		for _, w := range f.watchers {
+			if w.matches(log) {
+				w.push(log)
+			}
+		}
+	}
+	return nil
+}
+
+// encodeLog builds the log that the contract would emit for e.
+func (f *Fake) encodeLog(e Event) (types.Log, error) {
+	schema := e.Schema()
+	declared, ok := f.abi.Events[schema.Event]
+	if schema.Contract != f.contract || !ok {
+		return types.Log{}, fmt.Errorf("cannot emit %v.%v from a %v", schema.Contract, schema.Event, f.contract)
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(e))
+	log := types.Log{Address: f.address, Topics: []common.Hash{declared.Id()}}
+	var data []interface{}
+	for _, field := range schema.Fields {
+		value := v.FieldByName(field.GoName).Interface()
+		if !field.Indexed {
+			data = append(data, value)
+			continue
+		}
+		topic, err := topicOf(value)
+		if err != nil {
+			return types.Log{}, errors.Wrapf(err, "encoding %v.%v.%v", schema.Contract, schema.Event, field.Name)
+		}
+		log.Topics = append(log.Topics, topic)
+	}
+
+	var err error
+	log.Data, err = declared.Inputs.NonIndexed().Pack(data...)
+	return log, errors.Wrapf(err, "encoding %v.%v", schema.Contract, schema.Event)
+}
+
+// FilterLogs returns the emitted logs of the named event that match opts and query, in the same
+// form as bind.BoundContract.FilterLogs, for generated Filter methods to iterate over.
+func (f *Fake) FilterLogs(opts *bind.FilterOpts, name string, query ...[]interface{}) (chan types.Log, event.Subscription, error) {
+	if opts == nil {
+		opts = new(bind.FilterOpts)
+	}
+	w, err := f.newWatcher(name, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f.mu.Lock()
+	var found []types.Log
+	for _, log := range f.logs {
+		if log.BlockNumber >= opts.Start && (opts.End == nil || log.BlockNumber <= *opts.End) && w.matches(log) {
+			found = append(found, log)
+		}
+	}
+	f.mu.Unlock()
+
+	logs := make(chan types.Log, len(found))
+	for _, log := range found {
+		logs <- log
+	}
+	return logs, event.NewSubscription(func(quit <-chan struct{}) error { return nil }), nil
+}
+
+// WatchLogs subscribes to the logs of the named event that match query, in the same form as
+// bind.BoundContract.WatchLogs, for generated Watch methods to deliver. It delivers every
+// matching log emitted after the call, and, if opts.Start is set, those emitted since that
+// block.
+func (f *Fake) WatchLogs(opts *bind.WatchOpts, name string, query ...[]interface{}) (chan types.Log, event.Subscription, error) {
+	if opts == nil {
+		opts = new(bind.WatchOpts)
+	}
+	w, err := f.newWatcher(name, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f.mu.Lock()
+	if opts.Start != nil {
+		for _, log := range f.logs {
+			if log.BlockNumber >= *opts.Start && w.matches(log) {
+				w.push(log)
+			}
+		}
+	}
+	f.watchers = append(f.watchers, w)
+	f.mu.Unlock()
+
+	logs := make(chan types.Log)
+	sub := event.NewSubscription(func(quit <-chan struct{}) error {
+		defer f.removeWatcher(w)
+		for {
+			for _, log := range w.pop() {
+				select {
+				case logs <- log:
+				case <-quit:
+					return nil
+				}
+			}
+			select {
+			case <-w.wake:
+			case <-quit:
+				return nil
+			}
+		}
+	})
+	return logs, sub, nil
+}
+
+// newWatcher returns a watcher for the named event and filter query.
+func (f *Fake) newWatcher(name string, query [][]interface{}) (*fakeWatcher, error) {
+	declared, ok := f.abi.Events[name]
+	if !ok {
+		return nil, fmt.Errorf("%v has no event %v", f.contract, name)
+	}
+	topics, err := MakeTopics(append([][]interface{}{{declared.Id()}}, query...)...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "filtering %v.%v", f.contract, name)
+	}
+	return &fakeWatcher{topics: topics, wake: make(chan struct{}, 1)}, nil
+}
+
+// removeWatcher stops delivering logs to w.
+func (f *Fake) removeWatcher(w *fakeWatcher) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.watchers {
+		if f.watchers[i] == w {
+			f.watchers = append(f.watchers[:i], f.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+// fakeWatcher queues the logs that match one filter query, so that Emit never blocks on a slow
+// subscriber.
+type fakeWatcher struct {
+	topics [][]common.Hash // Accepted values for each topic; nil accepts anything.
+	wake   chan struct{}
+
+	mu    sync.Mutex
+	queue []types.Log
+}
+
+// matches reports whether log matches the watcher's topics.
+func (w *fakeWatcher) matches(log types.Log) bool {
+	return topicsMatch(w.topics, log.Topics)
+}
+
+// push queues log for delivery.
+func (w *fakeWatcher) push(log types.Log) {
+	w.mu.Lock()
+	w.queue = append(w.queue, log)
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pop takes every queued log.
+func (w *fakeWatcher) pop() []types.Log {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	logs := w.queue
+	w.queue = nil
+	return logs
+}
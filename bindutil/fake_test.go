@@ -0,0 +1,125 @@
+package bindutil
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const payerABI = `[
+	{"type": "function", "name": "pay", "constant": false, "inputs": [{"name": "to", "type": "address"}], "outputs": []},
+	{"type": "event", "name": "Paid", "anonymous": false, "inputs": [
+		{"name": "to", "type": "address", "indexed": true},
+		{"name": "amount", "type": "uint256", "indexed": false}
+	]}
+]`
+
+// paid is a stand-in for a generated event type.
+type paid struct {
+	To     common.Address
+	Amount *big.Int
+	Raw    types.Log
+}
+
+func (e paid) String() string  { return "Payer.Paid" }
+func (paid) Contract() string  { return "Payer" }
+func (paid) EventName() string { return "Paid" }
+func (paid) Schema() EventSchema {
+	return EventSchema{
+		Contract:  "Payer",
+		Event:     "Paid",
+		Signature: "Paid(address,uint256)",
+		Fields: []FieldSchema{
+			{Name: "to", GoName: "To", Type: "address", Indexed: true, Encoding: EncodingAddress},
+			{Name: "amount", GoName: "Amount", Type: "uint256", Encoding: EncodingDecimal},
+		},
+	}
+}
+
+var (
+	payer = common.Address{0xaa}
+	alice = common.Address{1}
+	bob   = common.Address{2}
+)
+
+func TestFakeTransaction(t *testing.T) {
+	fake := NewFake("Payer", payerABI, payer)
+	fake.Record("pay", alice)
+	tx, err := fake.Transaction(&bind.TransactOpts{Value: big.NewInt(7)}, "pay", alice)
+	require.NoError(t, err)
+	assert.Equal(t, payer, *tx.To())
+	assert.Equal(t, "7", tx.Value().String())
+	assert.Equal(t, uint64(0), tx.Nonce())
+	assert.Len(t, tx.Data(), 4+32)
+
+	tx, err = fake.Transaction(&bind.TransactOpts{}, "pay", alice)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), tx.Nonce())
+
+	assert.Equal(t, []FakeCall{{Method: "pay", Args: []interface{}{alice}}}, fake.CallsTo("pay"))
+}
+
+func TestFakeFilterLogs(t *testing.T) {
+	fake := NewFake("Payer", payerABI, payer)
+	require.NoError(t, fake.Emit(paid{To: alice, Amount: big.NewInt(1)}, paid{To: bob, Amount: big.NewInt(2)}))
+	require.NoError(t, fake.Emit(paid{To: alice, Amount: big.NewInt(3)}))
+
+	collect := func(opts *bind.FilterOpts, query ...[]interface{}) []types.Log {
+		logs, sub, err := fake.FilterLogs(opts, "Paid", query...)
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+		var found []types.Log
+		for len(logs) > 0 {
+			found = append(found, <-logs)
+		}
+		return found
+	}
+
+	assert.Len(t, collect(nil), 3)
+	toAlice := collect(nil, []interface{}{alice})
+	require.Len(t, toAlice, 2)
+	assert.Equal(t, payer, toAlice[0].Address)
+	assert.Equal(t, common.BytesToHash(alice[:]), toAlice[0].Topics[1])
+	assert.Equal(t, common.BigToHash(big.NewInt(3)).Bytes(), toAlice[1].Data)
+	assert.Equal(t, uint64(2), toAlice[1].BlockNumber)
+
+	assert.Len(t, collect(&bind.FilterOpts{Start: 2}), 1)
+	assert.Len(t, collect(nil, []interface{}{alice, bob}), 3)
+
+	_, _, err := fake.FilterLogs(nil, "Unpaid")
+	assert.Error(t, err)
+}
+
+func TestFakeWatchLogs(t *testing.T) {
+	fake := NewFake("Payer", payerABI, payer)
+	require.NoError(t, fake.Emit(paid{To: bob, Amount: big.NewInt(1)}))
+
+	logs, sub, err := fake.WatchLogs(nil, "Paid", []interface{}{bob})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// Emit must not block while nobody is reading logs.
+	require.NoError(t, fake.Emit(paid{To: alice, Amount: big.NewInt(2)}))
+	require.NoError(t, fake.Emit(paid{To: bob, Amount: big.NewInt(3)}))
+	require.NoError(t, fake.Emit(paid{To: bob, Amount: big.NewInt(4)}))
+
+	for _, want := range []int64{3, 4} {
+		select {
+		case log := <-logs:
+			assert.Equal(t, common.BigToHash(big.NewInt(want)).Bytes(), log.Data)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for log %v", want)
+		}
+	}
+}
+
+func TestFakeEmitWrongContract(t *testing.T) {
+	fake := NewFake("Pinger", payerABI, payer)
+	assert.EqualError(t, fake.Emit(paid{}), "cannot emit Payer.Paid from a Pinger")
+}
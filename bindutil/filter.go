@@ -0,0 +1,223 @@
+package bindutil
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"reflect"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TopicFilter is implemented by the event filter types genABI generates, such as
+// abi.ManagerIssuanceFilter, which select one contract event by the values of its indexed
+// arguments.
+type TopicFilter interface {
+	// Topics returns the filter's topic set, in the form of ethereum.FilterQuery.Topics.
+	Topics() ([][]common.Hash, error)
+}
+
+// LogQuery selects logs matching any of several TopicFilters, each optionally restricted to
+// some contract addresses, so that a single eth_getLogs request can fetch, say, both
+// Manager.Issuance and Relayer.TransferForwarded events.
+//
+// A log filter can only match each topic position against a set of values, so the
+// ethereum.FilterQuery a LogQuery compiles to can match logs that no single filter selects.
+// FilterLogs removes those; callers running FilterQuery themselves should check Matches.
+type LogQuery struct {
+	FromBlock *big.Int // Start of the queried range; nil means the genesis block.
+	ToBlock   *big.Int // End of the queried range; nil means the latest block.
+
+	clauses []logClause
+}
+
+// logClause is one filter added to a LogQuery.
+type logClause struct {
+	addresses []common.Address // nil matches any address.
+	topics    [][]common.Hash
+}
+
+// Add adds the events that filter selects to q, restricted to those emitted by one of
+// addresses, if any are given.
+func (q *LogQuery) Add(filter TopicFilter, addresses ...common.Address) error {
+	topics, err := filter.Topics()
+	if err != nil {
+		return err
+	}
+	q.clauses = append(q.clauses, logClause{addresses: addresses, topics: topics})
+	return nil
+}
+
+// FilterQuery compiles q to a single ethereum.FilterQuery that matches every log q selects.
+//
+// A LogQuery with no filters added selects no logs, but compiles to a query with no addresses or
+// topics, which matches every log in the range. FilterLogs doesn't run such a query at all.
+func (q *LogQuery) FilterQuery() ethereum.FilterQuery {
+	query := ethereum.FilterQuery{FromBlock: q.FromBlock, ToBlock: q.ToBlock}
+
+	anyAddress := false
+	positions := 0
+	for _, c := range q.clauses {
+		anyAddress = anyAddress || len(c.addresses) == 0
+		query.Addresses = appendUnique(query.Addresses, c.addresses...)
+		if len(c.topics) > positions {
+			positions = len(c.topics)
+		}
+	}
+	if anyAddress {
+		query.Addresses = nil
+	}
+
+	// Each topic position accepts the union of what the clauses accept there, unless some clause
+	// accepts anything there. Trailing positions that accept anything are dropped.
+	for i := 0; i < positions; i++ {
+		var accepted []common.Hash
+		for _, c := range q.clauses {
+			if i >= len(c.topics) || len(c.topics[i]) == 0 {
+				accepted = nil
+				break
+			}
+			accepted = appendUniqueHash(accepted, c.topics[i]...)
+		}
+		query.Topics = append(query.Topics, accepted)
+	}
+	for len(query.Topics) > 0 && query.Topics[len(query.Topics)-1] == nil {
+		query.Topics = query.Topics[:len(query.Topics)-1]
+	}
+	return query
+}
+
+// Matches reports whether log was emitted by the addresses of, and matches the topics of, any
+// of the filters added to q. It does not check the block range.
+func (q *LogQuery) Matches(log types.Log) bool {
+	for _, c := range q.clauses {
+		if (len(c.addresses) == 0 || containsAddress(c.addresses, log.Address)) && topicsMatch(c.topics, log.Topics) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterLogs runs q against filterer, returning exactly the logs that q selects. It returns no
+// logs, without querying filterer, if no filters have been added to q.
+func (q *LogQuery) FilterLogs(ctx context.Context, filterer ethereum.LogFilterer) ([]types.Log, error) {
+	if len(q.clauses) == 0 {
+		return nil, nil
+	}
+	logs, err := filterer.FilterLogs(ctx, q.FilterQuery())
+	if err != nil {
+		return nil, err
+	}
+	matched := logs[:0]
+	for _, log := range logs {
+		if q.Matches(log) {
+			matched = append(matched, log)
+		}
+	}
+	return matched, nil
+}
+
+// MakeTopics converts filter rules, one list of accepted values per topic position, into a
+// topic set, encoding each value as topicOf does. An empty list accepts any value. Generated
+// event filters use it to implement Topics.
+func MakeTopics(query ...[]interface{}) ([][]common.Hash, error) {
+	topics := make([][]common.Hash, len(query))
+	for i, rules := range query {
+		for _, rule := range rules {
+			topic, err := topicOf(rule)
+			if err != nil {
+				return nil, err
+			}
+			topics[i] = append(topics[i], topic)
+		}
+	}
+	return topics, nil
+}
+
+// topicsMatch reports whether a log's topics match a topic set.
+func topicsMatch(query [][]common.Hash, topics []common.Hash) bool {
+	if len(topics) < len(query) {
+		return false
+	}
+	for i, accepted := range query {
+		if len(accepted) > 0 && !containsHash(accepted, topics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsHash(hashes []common.Hash, hash common.Hash) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAddress(addresses []common.Address, address common.Address) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(addresses []common.Address, more ...common.Address) []common.Address {
+	for _, a := range more {
+		if !containsAddress(addresses, a) {
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses
+}
+
+func appendUniqueHash(hashes []common.Hash, more ...common.Hash) []common.Hash {
+	for _, h := range more {
+		if !containsHash(hashes, h) {
+			hashes = append(hashes, h)
+		}
+	}
+	return hashes
+}
+
+// topicOf encodes value, an indexed event argument or filter rule, as a log topic. Dynamic
+// values, like strings and byte slices, are stored as their Keccak-256 hash.
+func topicOf(value interface{}) (common.Hash, error) {
+	switch value := value.(type) {
+	case common.Hash:
+		return value, nil
+	case common.Address:
+		return common.BytesToHash(value[:]), nil
+	case *big.Int:
+		return common.BigToHash(math.U256(new(big.Int).Set(value))), nil
+	case bool:
+		if value {
+			return common.BigToHash(common.Big1), nil
+		}
+		return common.Hash{}, nil
+	case string:
+		return crypto.Keccak256Hash([]byte(value)), nil
+	case []byte:
+		return crypto.Keccak256Hash(value), nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		return topicOf(big.NewInt(v.Int()))
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		return topicOf(new(big.Int).SetUint64(v.Uint()))
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		var topic common.Hash
+		reflect.Copy(reflect.ValueOf(topic[:]), v)
+		return topic, nil
+	}
+	return common.Hash{}, fmt.Errorf("unsupported indexed type %T", value)
+}
@@ -0,0 +1,106 @@
+package bindutil
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// topicFilter is a TopicFilter with a fixed topic set.
+type topicFilter [][]common.Hash
+
+func (f topicFilter) Topics() ([][]common.Hash, error) { return f, nil }
+
+var (
+	paidTopic   = common.Hash{0xf1}
+	pingedTopic = common.Hash{0xf2}
+	pinger      = common.Address{0xbb}
+)
+
+func TestMakeTopics(t *testing.T) {
+	topics, err := MakeTopics([]interface{}{paidTopic}, nil, []interface{}{alice, bob})
+	require.NoError(t, err)
+	assert.Equal(t, [][]common.Hash{
+		{paidTopic},
+		nil,
+		{common.BytesToHash(alice[:]), common.BytesToHash(bob[:])},
+	}, topics)
+
+	_, err = MakeTopics([]interface{}{struct{}{}})
+	assert.Error(t, err)
+}
+
+func TestLogQuery(t *testing.T) {
+	q := LogQuery{FromBlock: big.NewInt(5)}
+	require.NoError(t, q.Add(topicFilter{{paidTopic}, {common.BytesToHash(alice[:])}}, payer))
+	require.NoError(t, q.Add(topicFilter{{pingedTopic}}, pinger))
+
+	assert.Equal(t, ethereum.FilterQuery{
+		FromBlock: big.NewInt(5),
+		Addresses: []common.Address{payer, pinger},
+		Topics:    [][]common.Hash{{paidTopic, pingedTopic}},
+	}, q.FilterQuery())
+
+	paidToAlice := types.Log{Address: payer, Topics: []common.Hash{paidTopic, common.BytesToHash(alice[:])}}
+	paidToBob := types.Log{Address: payer, Topics: []common.Hash{paidTopic, common.BytesToHash(bob[:])}}
+	pinged := types.Log{Address: pinger, Topics: []common.Hash{pingedTopic}}
+	pingedByPayer := types.Log{Address: payer, Topics: []common.Hash{pingedTopic}}
+
+	assert.True(t, q.Matches(paidToAlice))
+	assert.True(t, q.Matches(pinged))
+	assert.False(t, q.Matches(paidToBob))
+	assert.False(t, q.Matches(pingedByPayer))
+
+	found, err := q.FilterLogs(context.Background(), logs{paidToAlice, paidToBob, pinged, pingedByPayer})
+	require.NoError(t, err)
+	assert.Equal(t, []types.Log{paidToAlice, pinged}, found)
+}
+
+func TestLogQueryEmpty(t *testing.T) {
+	q := LogQuery{FromBlock: big.NewInt(5)}
+	assert.Equal(t, ethereum.FilterQuery{FromBlock: big.NewInt(5)}, q.FilterQuery())
+	assert.False(t, q.Matches(types.Log{Address: pinger, Topics: []common.Hash{pingedTopic}}))
+
+	// A nil filterer would panic if FilterLogs queried it.
+	found, err := q.FilterLogs(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestLogQueryAnyAddress(t *testing.T) {
+	var q LogQuery
+	require.NoError(t, q.Add(topicFilter{{paidTopic}, {common.BytesToHash(alice[:])}}))
+	require.NoError(t, q.Add(topicFilter{{paidTopic}, {common.BytesToHash(bob[:])}}, payer))
+
+	assert.Equal(t, ethereum.FilterQuery{
+		Topics: [][]common.Hash{{paidTopic}, {common.BytesToHash(alice[:]), common.BytesToHash(bob[:])}},
+	}, q.FilterQuery())
+	assert.True(t, q.Matches(types.Log{Address: pinger, Topics: []common.Hash{paidTopic, common.BytesToHash(alice[:])}}))
+	assert.False(t, q.Matches(types.Log{Address: pinger, Topics: []common.Hash{paidTopic, common.BytesToHash(bob[:])}}))
+}
+
+func TestTopicOf(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		want  common.Hash
+	}{
+		{alice, common.BytesToHash(alice[:])},
+		{big.NewInt(-1), common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")},
+		{uint8(5), common.BigToHash(big.NewInt(5))},
+		{true, common.BigToHash(big.NewInt(1))},
+		{[4]byte{1, 2, 3, 4}, common.HexToHash("0x0102030400000000000000000000000000000000000000000000000000000000")},
+	}
+	for _, c := range cases {
+		got, err := topicOf(c.value)
+		require.NoError(t, err)
+		assert.Equal(t, c.want, got, "%T %v", c.value, c.value)
+	}
+	_, err := topicOf(struct{}{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+package bindutil
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// MulticallABI is the ABI of the aggregate function of contracts/test/Multicall.sol, the helper
+// contract that a Multicall sends its calls through.
+const MulticallABI = `[{"constant":true,"inputs":[{"name":"targets","type":"address[]"},{"name":"data","type":"bytes[]"}],"name":"aggregate","outputs":[{"name":"blockNumber","type":"uint256"},{"name":"success","type":"bool[]"},{"name":"results","type":"bytes[]"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+var multicallABI = func() abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(MulticallABI))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}()
+
+// Multicall batches calls to contracts' view methods into a single eth_call to a Multicall
+// helper contract, so that they are made in one round trip and all read the same block. Calls
+// are queued with the <Contract>Batch types that genABI generates, such as abi.BasketBatch, and
+// made by Do.
+//
+// A Multicall is not safe for concurrent use.
+type Multicall struct {
+	caller  bind.ContractCaller
+	address common.Address
+	calls   []queuedCall
+}
+
+// queuedCall is a call queued on a Multicall.
+type queuedCall struct {
+	contract string
+	method   string
+	target   common.Address
+	abi      abi.ABI
+	input    []byte
+	out      interface{}
+}
+
+// NewMulticall returns a Multicall that makes its calls through caller, to the Multicall helper
+// contract deployed at address.
+func NewMulticall(caller bind.ContractCaller, address common.Address) *Multicall {
+	return &Multicall{caller: caller, address: address}
+}
+
+// Add queues a call to method of the named contract, deployed at target, with the given ABI and
+// arguments. When the calls are made, the method's results are unpacked into out as by
+// bind.BoundContract.Call.
+func (m *Multicall) Add(contract string, parsed abi.ABI, target common.Address, out interface{}, method string, args ...interface{}) error {
+	input, err := parsed.Pack(method, args...)
+	if err != nil {
+		return errors.Wrapf(err, "packing %v.%v", contract, method)
+	}
+	m.calls = append(m.calls, queuedCall{
+		contract: contract, method: method, target: target, abi: parsed, input: input, out: out,
+	})
+	return nil
+}
+
+// Len returns the number of queued calls.
+func (m *Multicall) Len() int {
+	return len(m.calls)
+}
+
+// Do makes every queued call in a single eth_call, as of blockNumber, or the latest block if that
+// is nil, and unpacks their results. It returns the number of the block the calls read, which
+// can be passed to later calls to Do to read the same state.
+//
+// Do returns the first error of any call, such as a *RevertError if it reverted with a reason,
+// after unpacking the results of the others. The queue is emptied either way.
+func (m *Multicall) Do(ctx context.Context, blockNumber *big.Int) (*big.Int, error) {
+	calls := m.calls
+	m.calls = nil
+
+	targets := make([]common.Address, len(calls))
+	data := make([][]byte, len(calls))
+	for i, call := range calls {
+		targets[i], data[i] = call.target, call.input
+	}
+	input, err := multicallABI.Pack("aggregate", targets, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "packing multicall")
+	}
+	output, err := m.caller.CallContract(ctx, ethereum.CallMsg{To: &m.address, Data: input}, blockNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "making %v calls through the Multicall at %v", len(calls), m.address.Hex())
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("no Multicall contract at %v", m.address.Hex())
+	}
+
+	var result struct {
+		BlockNumber *big.Int
+		Success     []bool
+		Results     [][]byte
+	}
+	if err := multicallABI.Unpack(&result, "aggregate", output); err != nil {
+		return nil, errors.Wrap(err, "unpacking multicall results")
+	}
+	if len(result.Success) != len(calls) || len(result.Results) != len(calls) {
+		return nil, fmt.Errorf("made %v calls, but got %v results", len(calls), len(result.Results))
+	}
+
+	var firstErr error
+	for i, call := range calls {
+		err := call.unpack(result.Success[i], result.Results[i])
+		if err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "call %v of %v", i, len(calls))
+		}
+	}
+	return result.BlockNumber, firstErr
+}
+
+// unpack unpacks the return data of call into call.out.
+func (call queuedCall) unpack(success bool, data []byte) error {
+	if !success {
+		if err := DecodeRevert(call.contract, data); err != nil {
+			return errors.Wrapf(err, "calling %v.%v", call.contract, call.method)
+		}
+		return fmt.Errorf("calling %v.%v at %v: execution reverted", call.contract, call.method, call.target.Hex())
+	}
+	if len(data) == 0 {
+		return errors.Wrapf(bind.ErrNoCode, "calling %v.%v at %v", call.contract, call.method, call.target.Hex())
+	}
+	return errors.Wrapf(call.abi.Unpack(call.out, call.method, data), "unpacking %v.%v", call.contract, call.method)
+}
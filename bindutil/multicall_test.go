@@ -0,0 +1,117 @@
+package bindutil
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// basketABI has a view method with an argument, one with several named outputs, and one that
+// reverts.
+const basketABI = `[
+	{"constant":true,"inputs":[{"name":"","type":"address"}],"name":"weights","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"state","outputs":[{"name":"size","type":"uint256"},{"name":"paused","type":"bool"}],"type":"function"},
+	{"constant":true,"inputs":[],"name":"broken","outputs":[{"name":"","type":"uint256"}],"type":"function"}
+]`
+
+// multicaller is a bind.ContractCaller that runs aggregate calls against fake contracts, which
+// map call data to return data. Calls with no return data listed revert with pausedRevert.
+type multicaller struct {
+	block     int64
+	contracts map[common.Address]map[string][]byte
+	calls     int
+}
+
+func (m *multicaller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return []byte{1}, nil
+}
+
+func (m *multicaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	m.calls++
+	if blockNumber != nil && blockNumber.Int64() != m.block {
+		return nil, errors.New("unknown block")
+	}
+	method := multicallABI.Methods["aggregate"]
+	values, err := method.Inputs.UnpackValues(call.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	targets, data := values[0].([]common.Address), values[1].([][]byte)
+
+	success := make([]bool, len(targets))
+	results := make([][]byte, len(targets))
+	for i, target := range targets {
+		results[i], success[i] = m.contracts[target][string(data[i])]
+		if !success[i] {
+			results[i] = pausedRevert
+		}
+	}
+	return method.Outputs.Pack(big.NewInt(m.block), success, results)
+}
+
+func TestMulticall(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(basketABI))
+	require.NoError(t, err)
+	pack := func(method string, args ...interface{}) string {
+		input, err := parsed.Pack(method, args...)
+		require.NoError(t, err)
+		return string(input)
+	}
+	result := func(method string, values ...interface{}) []byte {
+		output, err := parsed.Methods[method].Outputs.Pack(values...)
+		require.NoError(t, err)
+		return output
+	}
+
+	basket, token := common.Address{1}, common.Address{2}
+	caller := &multicaller{block: 7, contracts: map[common.Address]map[string][]byte{
+		basket: {
+			pack("weights", token): result("weights", big.NewInt(3)),
+			pack("state"):          result("state", big.NewInt(2), true),
+		},
+	}}
+	multicall := NewMulticall(caller, common.Address{0xca})
+
+	var weight *big.Int
+	var state struct {
+		Size   *big.Int
+		Paused bool
+	}
+	require.NoError(t, multicall.Add("Basket", parsed, basket, &weight, "weights", token))
+	require.NoError(t, multicall.Add("Basket", parsed, basket, &state, "state"))
+	assert.Equal(t, 2, multicall.Len())
+
+	block, err := multicall.Do(context.Background(), big.NewInt(7))
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), block.Int64())
+	assert.Equal(t, int64(3), weight.Int64())
+	assert.Equal(t, int64(2), state.Size.Int64())
+	assert.True(t, state.Paused)
+	assert.Equal(t, 1, caller.calls)
+	assert.Equal(t, 0, multicall.Len())
+
+	// A reverting call fails Do, but the other calls' results are still unpacked.
+	var broken *big.Int
+	weight = nil
+	require.NoError(t, multicall.Add("Basket", parsed, basket, &broken, "broken"))
+	require.NoError(t, multicall.Add("Basket", parsed, basket, &weight, "weights", token))
+	_, err = multicall.Do(context.Background(), nil)
+	assert.EqualError(t, err, "call 0 of 2: calling Basket.broken: Basket: execution reverted: contract is paused")
+	reason, ok := RevertReason(err)
+	assert.True(t, ok)
+	assert.Equal(t, "contract is paused", reason)
+	assert.Equal(t, int64(3), weight.Int64())
+
+	_, err = multicall.Do(context.Background(), big.NewInt(6))
+	assert.EqualError(t, err, "making 0 calls through the Multicall at 0xCA00000000000000000000000000000000000000: unknown block")
+
+	assert.EqualError(t, multicall.Add("Basket", parsed, basket, &weight, "weights"), "packing Basket.weights: argument count mismatch: 0 for 1")
+}
@@ -0,0 +1,110 @@
+// Package bindutil provides runtime support for the Go contract bindings that genABI generates
+// into the abi package.
+//
+// The generated code is kept thin: anything that does not depend on a particular contract's ABI
+// lives here instead, so that it is written (and tested) once.
+package bindutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+)
+
+// revertSelector is the 4-byte selector of `Error(string)`. solc prefixes the return data of
+// every `require` or `revert` that carries a reason string with it.
+var revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+
+// reasonArguments unpacks the ABI-encoded string that follows revertSelector.
+var reasonArguments = func() abi.Arguments {
+	stringType, err := abi.NewType("string", nil)
+	if err != nil {
+		panic(err)
+	}
+	return abi.Arguments{{Type: stringType}}
+}()
+
+// RevertError is returned when a contract call reverts with a reason string.
+type RevertError struct {
+	Contract string // Name of the contract that reverted, e.g. "Manager".
+	Reason   string // The message given to `require` or `revert`, e.g. "contract is paused".
+}
+
+// Error implements the error interface.
+func (e *RevertError) Error() string {
+	return fmt.Sprintf("%v: execution reverted: %v", e.Contract, e.Reason)
+}
+
+// DecodeRevert decodes the return data of a call to `contract`.
+//
+// If data is an `Error(string)` revert payload, DecodeRevert returns a *RevertError holding the
+// reason string. Otherwise it returns nil: the data is ordinary return data, or the call reverted
+// without a reason, which is indistinguishable from an empty return.
+func DecodeRevert(contract string, data []byte) error {
+	if len(data) < len(revertSelector) || !bytes.Equal(data[:len(revertSelector)], revertSelector) {
+		return nil
+	}
+	var reason string
+	if err := reasonArguments.Unpack(&reason, data[len(revertSelector):]); err != nil {
+		return errors.Wrapf(err, "decoding %v revert reason", contract)
+	}
+	return &RevertError{Contract: contract, Reason: reason}
+}
+
+// RevertReason returns the reason string carried by err, if err is, or wraps, a *RevertError.
+func RevertReason(err error) (string, bool) {
+	if revertErr, ok := errors.Cause(err).(*RevertError); ok {
+		return revertErr.Reason, true
+	}
+	return "", false
+}
+
+// SimulateTransact runs the transaction that a binding would send for `method` as an eth_call
+// against `address`, before it is signed or broadcast. If the call reverts with a reason string,
+// SimulateTransact returns the corresponding *RevertError.
+//
+// The call is made against the pending state when `caller` supports it, since that is the state
+// the real transaction will execute against.
+func SimulateTransact(
+	opts *bind.TransactOpts,
+	caller bind.ContractCaller,
+	contract string,
+	address common.Address,
+	parsed abi.ABI,
+	method string,
+	params ...interface{},
+) error {
+	input, err := parsed.Pack(method, params...)
+	if err != nil {
+		return err
+	}
+	msg := ethereum.CallMsg{
+		From:     opts.From,
+		To:       &address,
+		Gas:      opts.GasLimit,
+		GasPrice: opts.GasPrice,
+		Value:    opts.Value,
+		Data:     input,
+	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var output []byte
+	if pending, ok := caller.(bind.PendingContractCaller); ok {
+		output, err = pending.PendingCallContract(ctx, msg)
+	} else {
+		output, err = caller.CallContract(ctx, msg, nil)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "simulating %v.%v", contract, method)
+	}
+	return DecodeRevert(contract, output)
+}
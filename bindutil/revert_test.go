@@ -0,0 +1,99 @@
+package bindutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pausedRevert is the return data of `require(!emergency, "contract is paused")` when it fails.
+var pausedRevert = common.FromHex(
+	"0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000012" +
+		"636f6e7472616374206973207061757365640000000000000000000000000000",
+)
+
+func TestDecodeRevert(t *testing.T) {
+	err := DecodeRevert("Manager", pausedRevert)
+	require.Error(t, err)
+	assert.Equal(t, &RevertError{Contract: "Manager", Reason: "contract is paused"}, err)
+	assert.Equal(t, "Manager: execution reverted: contract is paused", err.Error())
+}
+
+func TestDecodeRevertIgnoresReturnData(t *testing.T) {
+	assert.NoError(t, DecodeRevert("Manager", nil))
+	assert.NoError(t, DecodeRevert("Manager", common.FromHex(
+		"0x0000000000000000000000000000000000000000000000000000000000000001",
+	)))
+}
+
+func TestDecodeRevertMalformed(t *testing.T) {
+	err := DecodeRevert("Manager", pausedRevert[:40])
+	require.Error(t, err)
+	_, ok := RevertReason(err)
+	assert.False(t, ok)
+}
+
+func TestRevertReason(t *testing.T) {
+	err := errors.Wrap(DecodeRevert("Relayer", pausedRevert), "forwarding transfer")
+	reason, ok := RevertReason(err)
+	assert.True(t, ok)
+	assert.Equal(t, "contract is paused", reason)
+}
+
+// deploy deploys a contract whose runtime code is runtime to backend, from key's account.
+func deploy(t *testing.T, backend *backends.SimulatedBackend, key *ecdsa.PrivateKey, runtime []byte) common.Address {
+	// PUSH1 len(runtime), PUSH1 12, PUSH1 0, CODECOPY, PUSH1 len(runtime), PUSH1 0, RETURN, then
+	// runtime itself, at offset 12.
+	n := byte(len(runtime))
+	code := append([]byte{0x60, n, 0x60, 12, 0x60, 0, 0x39, 0x60, n, 0x60, 0, 0xf3}, runtime...)
+	address, _, _, err := bind.DeployContract(bind.NewKeyedTransactor(key), abi.ABI{}, code, backend)
+	require.NoError(t, err)
+	backend.Commit()
+	return address
+}
+
+func TestSimulateTransact(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{from: {Balance: big.NewInt(1e18)}}, 8e6)
+
+	// One contract reverts with pausedRevert, as `issue` does in an emergency: PUSH1 100,
+	// PUSH1 12, PUSH1 0, CODECOPY, PUSH1 100, PUSH1 0, REVERT, then pausedRevert, at offset 12.
+	// The other succeeds with STOP.
+	reverting := deploy(t, backend, key,
+		append([]byte{0x60, 100, 0x60, 12, 0x60, 0, 0x39, 0x60, 100, 0x60, 0, 0xfd}, pausedRevert...))
+	succeeding := deploy(t, backend, key, []byte{0x00})
+	parsed, err := abi.JSON(strings.NewReader(
+		`[{"constant":false,"inputs":[{"name":"rsvAmount","type":"uint256"}],"name":"issue","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"}]`,
+	))
+	require.NoError(t, err)
+	nonce, err := backend.PendingNonceAt(context.Background(), from)
+	require.NoError(t, err)
+
+	opts := bind.NewKeyedTransactor(key)
+	err = SimulateTransact(opts, backend, "Manager", reverting, parsed, "issue", big.NewInt(1))
+	assert.Equal(t, &RevertError{Contract: "Manager", Reason: "contract is paused"}, err)
+	assert.NoError(t, SimulateTransact(opts, backend, "Manager", succeeding, parsed, "issue", big.NewInt(1)))
+	err = SimulateTransact(opts, backend, "Manager", succeeding, parsed, "issue")
+	assert.EqualError(t, err, "argument count mismatch: 0 for 1")
+
+	// Simulating sends nothing.
+	after, err := backend.PendingNonceAt(context.Background(), from)
+	require.NoError(t, err)
+	assert.Equal(t, nonce, after)
+}
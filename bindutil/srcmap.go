@@ -0,0 +1,189 @@
+package bindutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// SourceMap maps program counters in a contract's runtime bytecode back to the Solidity source
+// that produced them. genABI generates one for each contract, e.g. abi.ManagerSourceMap, from
+// solc's srcmap-runtime output.
+//
+// Given the PC at which a transaction reverted, as reported by a debug_traceTransaction trace,
+// Position reports which line of which Solidity file -- typically a `require` -- fired.
+type SourceMap struct {
+	Contract string   // Contract name, e.g. "Manager".
+	Bytecode string   // Runtime bytecode, as hex.
+	Srcmap   string   // solc's compressed srcmap-runtime.
+	Sources  []string // solc's source list; source map file indexes refer to it.
+
+	// Lines holds, for each entry of Sources, the byte offset at which each line of the file
+	// starts. An entry is nil if the file was not available when the bindings were generated,
+	// in which case positions in it have no line or column.
+	Lines [][]int
+
+	once         sync.Once
+	instructions map[uint64]int // PC -> instruction index, for PCs that start an instruction.
+	entries      []srcmapEntry  // One per instruction.
+	err          error
+}
+
+// srcmapEntry is one decompressed source map entry.
+type srcmapEntry struct {
+	offset, length, file int
+	jump                 string
+}
+
+// Position is a location in Solidity source.
+type Position struct {
+	File   string // Source file, e.g. "contracts/Manager.sol", or "" for compiler-generated code.
+	Offset int    // Byte offset of the start of the source range.
+	Length int    // Length in bytes of the source range.
+	Line   int    // 1-based line of Offset, or 0 if unknown.
+	Column int    // 1-based column of Offset, or 0 if unknown, like solc's and editors' columns.
+
+	// Jump is "i" if the instruction jumps into a function, "o" if it returns from one,
+	// and "-" otherwise.
+	Jump string
+}
+
+// String formats p as file:line:column, or as file:offset if the line is unknown.
+func (p Position) String() string {
+	file := p.File
+	if file == "" {
+		file = "<compiler-generated>"
+	}
+	if p.Line == 0 {
+		return fmt.Sprintf("%v:@%v", file, p.Offset)
+	}
+	return fmt.Sprintf("%v:%v:%v", file, p.Line, p.Column)
+}
+
+// Position returns the source position of the instruction at pc.
+func (m *SourceMap) Position(pc uint64) (Position, error) {
+	m.once.Do(m.parse)
+	if m.err != nil {
+		return Position{}, m.err
+	}
+
+	index, ok := m.instructions[pc]
+	if !ok || index >= len(m.entries) {
+		return Position{}, fmt.Errorf("%v: no instruction at pc %v", m.Contract, pc)
+	}
+	return m.position(m.entries[index]), nil
+}
+
+// Positions returns the source position of every instruction in the bytecode, keyed by PC.
+func (m *SourceMap) Positions() (map[uint64]Position, error) {
+	m.once.Do(m.parse)
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	positions := make(map[uint64]Position, len(m.instructions))
+	for pc, index := range m.instructions {
+		if index < len(m.entries) {
+			positions[pc] = m.position(m.entries[index])
+		}
+	}
+	return positions, nil
+}
+
+// position resolves entry's file, line, and column.
+func (m *SourceMap) position(entry srcmapEntry) Position {
+	position := Position{Offset: entry.offset, Length: entry.length, Jump: entry.jump}
+	if entry.file < 0 || entry.file >= len(m.Sources) {
+		return position
+	}
+	position.File = m.Sources[entry.file]
+	if entry.file < len(m.Lines) && m.Lines[entry.file] != nil {
+		lines := m.Lines[entry.file]
+		line := sort.Search(len(lines), func(i int) bool { return lines[i] > entry.offset })
+		if line > 0 {
+			position.Line = line
+			position.Column = entry.offset - lines[line-1] + 1
+		}
+	}
+	return position
+}
+
+// LineStarts returns the byte offset at which each line of source starts, in the form of
+// SourceMap.Lines. A final newline doesn't start another line.
+func LineStarts(source []byte) []int {
+	lines := []int{0}
+	for i, b := range source {
+		if b == '\n' && i+1 < len(source) {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+// parse decodes Bytecode and Srcmap.
+func (m *SourceMap) parse() {
+	if m.Bytecode == "" || m.Srcmap == "" {
+		m.err = fmt.Errorf("%v: no runtime source map", m.Contract)
+		return
+	}
+	m.instructions = instructionIndexes(m.Bytecode)
+	m.entries, m.err = decompressSrcmap(m.Srcmap)
+	m.err = errors.Wrapf(m.err, "%v: parsing source map", m.Contract)
+}
+
+// instructionIndexes maps the PC of each instruction in bytecode, given as hex, to its index
+// among the instructions. Unlinked library placeholders in bytecode only appear in PUSH20
+// arguments, so any character that is not hex is treated as a zero.
+func instructionIndexes(bytecode string) map[uint64]int {
+	bytecode = strings.TrimPrefix(bytecode, "0x")
+	code := make([]byte, len(bytecode)/2)
+	for i := range code {
+		b, _ := strconv.ParseUint(bytecode[2*i:2*i+2], 16, 8)
+		code[i] = byte(b)
+	}
+
+	indexes := make(map[uint64]int)
+	for pc, index := 0, 0; pc < len(code); pc, index = pc+1, index+1 {
+		indexes[uint64(pc)] = index
+		if op := code[pc]; op >= 0x60 && op <= 0x7f { // PUSH1 through PUSH32
+			pc += int(op - 0x5f)
+		}
+	}
+	return indexes
+}
+
+// decompressSrcmap decodes solc's compressed source map format, in which entries are separated
+// by ";" and each entry's "offset:length:file:jump" fields default to the previous entry's.
+func decompressSrcmap(srcmap string) ([]srcmapEntry, error) {
+	var entries []srcmapEntry
+	var current srcmapEntry
+	for i, entry := range strings.Split(srcmap, ";") {
+		for j, field := range strings.Split(entry, ":") {
+			if field == "" {
+				continue
+			}
+			if j == 3 {
+				current.jump = field
+				continue
+			}
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, errors.Wrapf(err, "entry %v", i)
+			}
+			switch j {
+			case 0:
+				current.offset = n
+			case 1:
+				current.length = n
+			case 2:
+				current.file = n
+			}
+		}
+		entries = append(entries, current)
+	}
+	return entries, nil
+}
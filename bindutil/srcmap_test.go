@@ -0,0 +1,75 @@
+package bindutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sourceMap maps into a source file of three lines: "abc\n", "defg\n", and "hi".
+var sourceMap = &SourceMap{
+	Contract: "Pinger",
+	// PUSH1 0x80, PUSH2 0x0102, JUMPDEST, PUSH20 <unlinked library>, REVERT
+	Bytecode: "6080610102" + "5b" + "73__$e8a7e3d5a2d5a5b5f4e5e2f1c1c1b5a5a5$__" + "fd",
+	Srcmap:   "0:3:0:-;4:4;:::i;;5:1:-1:o",
+	Sources:  []string{"contracts/Pinger.sol"},
+	Lines:    [][]int{{0, 4, 9}},
+}
+
+func TestSourceMapPosition(t *testing.T) {
+	cases := []struct {
+		pc   uint64
+		want string
+		jump string
+	}{
+		{0, "contracts/Pinger.sol:1:1", "-"},
+		{2, "contracts/Pinger.sol:2:1", "-"},
+		{5, "contracts/Pinger.sol:2:1", "i"},
+		{6, "contracts/Pinger.sol:2:1", "i"},
+		{27, "<compiler-generated>:@5", "o"},
+	}
+	for _, c := range cases {
+		position, err := sourceMap.Position(c.pc)
+		require.NoError(t, err, "pc %v", c.pc)
+		assert.Equal(t, c.want, position.String(), "pc %v", c.pc)
+		assert.Equal(t, c.jump, position.Jump, "pc %v", c.pc)
+	}
+
+	// PCs inside PUSH arguments, or past the end of the code, are not instructions.
+	for _, pc := range []uint64{1, 3, 7, 28} {
+		_, err := sourceMap.Position(pc)
+		assert.Error(t, err, "pc %v", pc)
+	}
+}
+
+func TestSourceMapPositionWithoutLines(t *testing.T) {
+	m := &SourceMap{Contract: "Pinger", Bytecode: "00", Srcmap: "9:3:0:-", Sources: []string{"Pinger.sol"}}
+	position, err := m.Position(0)
+	require.NoError(t, err)
+	assert.Equal(t, Position{File: "Pinger.sol", Offset: 9, Length: 3, Jump: "-"}, position)
+	assert.Equal(t, "Pinger.sol:@9", position.String())
+}
+
+func TestSourceMapEmpty(t *testing.T) {
+	_, err := (&SourceMap{Contract: "IERC20"}).Position(0)
+	assert.EqualError(t, err, "IERC20: no runtime source map")
+}
+
+func TestSourceMapPositions(t *testing.T) {
+	positions, err := sourceMap.Positions()
+	require.NoError(t, err)
+	assert.Len(t, positions, 5)
+	for pc, position := range positions {
+		want, err := sourceMap.Position(pc)
+		require.NoError(t, err, "pc %v", pc)
+		assert.Equal(t, want, position, "pc %v", pc)
+	}
+}
+
+func TestLineStarts(t *testing.T) {
+	assert.Equal(t, []int{0}, LineStarts(nil))
+	assert.Equal(t, []int{0, 4, 9}, LineStarts([]byte("abc\ndefg\nhi")))
+	assert.Equal(t, []int{0, 4}, LineStarts([]byte("abc\ndefg\n")))
+	assert.Equal(t, []int{0, 1, 2}, LineStarts([]byte("\n\n\n")))
+}
@@ -0,0 +1,252 @@
+package bindutil
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// StorageLayout describes where a contract keeps its state variables, as solc's storage-layout
+// output reports it. genABI generates one for each contract whose compiled output includes a
+// storage layout, e.g. abi.ReserveEternalStorageStorageLayout.
+type StorageLayout struct {
+	Contract  string                 // Contract name, e.g. "ReserveEternalStorage".
+	Variables []StorageVariable      // State variables, in declaration order.
+	Types     map[string]StorageType // Keyed by solc's type identifiers, e.g. "t_mapping(t_address,t_uint256)".
+}
+
+// StorageVariable is a state variable, or a member of a struct.
+type StorageVariable struct {
+	Label  string // Variable name, e.g. "balance".
+	Slot   int64  // Storage slot, relative to the enclosing struct for members.
+	Offset int    // Byte offset within the slot, for variables packed into a shared slot.
+	Type   string // Type identifier, a key of StorageLayout.Types.
+}
+
+// StorageType describes a type that state variables have.
+type StorageType struct {
+	Label         string            // Solidity type, e.g. "mapping(address => uint256)".
+	Encoding      string            // One of "inplace", "mapping", "dynamic_array", or "bytes".
+	NumberOfBytes int               // Bytes the type occupies in its slot; for "inplace" types only.
+	Key           string            // Key type identifier, for mappings.
+	Value         string            // Value type identifier, for mappings.
+	Base          string            // Element type identifier, for arrays.
+	Members       []StorageVariable // Members, for structs.
+}
+
+// ErrNoStorageLayout is returned by the methods of a nil *StorageLayout, which genABI generates
+// for contracts compiled without a storage layout.
+var ErrNoStorageLayout = errors.New("no storage layout: contract was compiled without solc's storage-layout output")
+
+// Variable returns the state variable with the given label.
+func (l *StorageLayout) Variable(label string) (StorageVariable, bool) {
+	if l == nil {
+		return StorageVariable{}, false
+	}
+	for _, v := range l.Variables {
+		if v.Label == label {
+			return v, true
+		}
+	}
+	return StorageVariable{}, false
+}
+
+// Slot returns the storage slot holding the state variable labeled label, indexed by keys.
+// Each key indexes one level of mapping or dynamic array, so for ReserveEternalStorage,
+//
+//	layout.Slot("balance", holder)
+//	layout.Slot("allowed", holder, spender)
+//
+// return the slots of balance[holder] and allowed[holder][spender]. Mapping keys have the Go
+// types that bindings use for their Solidity types, like common.Address and *big.Int; array
+// indexes may be any integer type. The value's byte offset within the slot is returned too.
+func (l *StorageLayout) Slot(label string, keys ...interface{}) (slot common.Hash, offset int, err error) {
+	slot, offset, _, err = l.locate(label, keys)
+	return slot, offset, err
+}
+
+// locate implements Slot, additionally returning the type identifier of the indexed value.
+func (l *StorageLayout) locate(label string, keys []interface{}) (slot common.Hash, offset int, typeID string, err error) {
+	if l == nil {
+		return common.Hash{}, 0, "", ErrNoStorageLayout
+	}
+	v, ok := l.Variable(label)
+	if !ok {
+		return common.Hash{}, 0, "", fmt.Errorf("%v has no state variable %q", l.Contract, label)
+	}
+
+	slot, offset, typeID = common.BigToHash(big.NewInt(v.Slot)), v.Offset, v.Type
+	for i, key := range keys {
+		t := l.Types[typeID]
+		switch t.Encoding {
+		case "mapping":
+			slot, err = MappingSlot(slot, key)
+			typeID = t.Value
+		case "dynamic_array":
+			slot, offset, err = l.arrayElementSlot(slot, t.Base, key)
+			typeID = t.Base
+		default:
+			err = fmt.Errorf("%v is not a mapping or dynamic array", t.Label)
+		}
+		if err != nil {
+			return common.Hash{}, 0, "", errors.Wrapf(err, "%v.%v key %v", l.Contract, label, i)
+		}
+	}
+	return slot, offset, typeID, nil
+}
+
+// StorageReader reads contract storage. It is implemented by *ethclient.Client and
+// *backends.SimulatedBackend.
+type StorageReader interface {
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+}
+
+// Read reads the value of the state variable labeled label, indexed by keys as for Slot, from
+// the contract at address, as of blockNumber, or the latest block if that is nil. The value must
+// fit in a single slot, as integers, addresses and bools do; it is returned as the unsigned
+// integer its bytes encode, so signed integers must be converted by the caller.
+func (l *StorageLayout) Read(
+	ctx context.Context, reader StorageReader, address common.Address, blockNumber *big.Int,
+	label string, keys ...interface{},
+) (*big.Int, error) {
+	slot, offset, typeID, err := l.locate(label, keys)
+	if err != nil {
+		return nil, err
+	}
+	t := l.Types[typeID]
+	if t.Encoding != "inplace" || t.NumberOfBytes == 0 || offset+t.NumberOfBytes > 32 {
+		return nil, fmt.Errorf("cannot read %v.%v: %v does not fit in a slot", l.Contract, label, t.Label)
+	}
+
+	word, err := reader.StorageAt(ctx, address, slot, blockNumber)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading %v.%v", l.Contract, label)
+	}
+	word = common.LeftPadBytes(word, 32)
+	end := 32 - offset
+	return new(big.Int).SetBytes(word[end-t.NumberOfBytes : end]), nil
+}
+
+// arrayElementSlot returns the slot and byte offset of the element at index of the dynamic array
+// of base elements whose length is stored at slot.
+func (l *StorageLayout) arrayElementSlot(slot common.Hash, base string, index interface{}) (common.Hash, int, error) {
+	i, ok := toBig(index)
+	if !ok || i.Sign() < 0 {
+		return common.Hash{}, 0, fmt.Errorf("invalid array index %v", index)
+	}
+	start := new(big.Int).SetBytes(crypto.Keccak256(slot[:]))
+
+	size := l.Types[base].NumberOfBytes
+	if size == 0 || size > 32 {
+		// Elements take whole slots; non-"inplace" elements take one slot for their header.
+		slots := int64(1)
+		if size > 32 {
+			slots = int64((size + 31) / 32)
+		}
+		return common.BigToHash(start.Add(start, i.Mul(i, big.NewInt(slots)))), 0, nil
+	}
+	// Smaller elements are packed, as many as fit, into each slot.
+	perSlot := big.NewInt(int64(32 / size))
+	slotIndex, position := new(big.Int).DivMod(i, perSlot, new(big.Int))
+	return common.BigToHash(start.Add(start, slotIndex)), int(position.Int64()) * size, nil
+}
+
+// MappingSlot returns the slot of the value for key in the mapping whose declaration occupies slot.
+// Value-type keys are padded to 32 bytes, and string and []byte keys are used as is, before
+// being hashed together with the slot.
+func MappingSlot(slot common.Hash, key interface{}) (common.Hash, error) {
+	var encoded []byte
+	switch key := key.(type) {
+	case string:
+		encoded = []byte(key)
+	case []byte:
+		encoded = key
+	default:
+		topic, err := topicOf(key)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		encoded = topic[:]
+	}
+	return crypto.Keccak256Hash(encoded, slot[:]), nil
+}
+
+// toBig converts an integer of any Go type to a *big.Int.
+func toBig(n interface{}) (*big.Int, bool) {
+	switch n := n.(type) {
+	case *big.Int:
+		return new(big.Int).Set(n), true
+	case int:
+		return big.NewInt(int64(n)), true
+	case int64:
+		return big.NewInt(n), true
+	case uint64:
+		return new(big.Int).SetUint64(n), true
+	}
+	topic, err := topicOf(n)
+	if err != nil {
+		return nil, false
+	}
+	return topic.Big(), true
+}
+
+// Changes lists the ways in which newer, a later version of the contract, stores the state
+// variables of l differently: variables that moved, changed type, or were removed. Variables
+// that newer adds are only reported if they overlap l's. An upgrade that keeps the contract's
+// storage must have no changes.
+func (l *StorageLayout) Changes(newer *StorageLayout) []string {
+	if l == nil || newer == nil {
+		return []string{ErrNoStorageLayout.Error()}
+	}
+
+	var changes []string
+	for _, old := range l.Variables {
+		updated, ok := newer.Variable(old.Label)
+		oldType := l.Types[old.Type].Label
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%v (%v) removed from slot %v", old.Label, oldType, old.Slot))
+		case updated.Slot != old.Slot || updated.Offset != old.Offset:
+			changes = append(changes, fmt.Sprintf(
+				"%v moved from slot %v offset %v to slot %v offset %v",
+				old.Label, old.Slot, old.Offset, updated.Slot, updated.Offset,
+			))
+		case newer.Types[updated.Type].Label != oldType:
+			changes = append(changes, fmt.Sprintf(
+				"%v changed type from %v to %v", old.Label, oldType, newer.Types[updated.Type].Label,
+			))
+		}
+	}
+
+	for _, added := range newer.Variables {
+		if _, ok := l.Variable(added.Label); ok {
+			continue
+		}
+		for _, old := range l.Variables {
+			if old.Slot == added.Slot && old.Offset == added.Offset {
+				changes = append(changes, fmt.Sprintf(
+					"%v added in slot %v offset %v, which held %v", added.Label, added.Slot, added.Offset, old.Label,
+				))
+			}
+		}
+	}
+	return changes
+}
+
+// String describes the layout, one state variable per line.
+func (l *StorageLayout) String() string {
+	if l == nil {
+		return "<no storage layout>"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v storage:", l.Contract)
+	for _, v := range l.Variables {
+		fmt.Fprintf(&b, "\n  slot %v offset %v: %v %v", v.Slot, v.Offset, l.Types[v.Type].Label, v.Label)
+	}
+	return b.String()
+}
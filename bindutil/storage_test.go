@@ -0,0 +1,156 @@
+package bindutil
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eternalStorage is the layout of a contract like ReserveEternalStorage, with an extra packed
+// slot and an array to exercise the less common encodings.
+var eternalStorage = &StorageLayout{
+	Contract: "ReserveEternalStorage",
+	Variables: []StorageVariable{
+		{Label: "owner", Slot: 0, Offset: 0, Type: "t_address"},
+		{Label: "paused", Slot: 0, Offset: 20, Type: "t_bool"},
+		{Label: "balance", Slot: 1, Offset: 0, Type: "t_mapping(t_address,t_uint256)"},
+		{Label: "allowed", Slot: 2, Offset: 0, Type: "t_mapping(t_address,t_mapping(t_address,t_uint256))"},
+		{Label: "weights", Slot: 3, Offset: 0, Type: "t_array(t_uint64)dyn_storage"},
+	},
+	Types: map[string]StorageType{
+		"t_address": {Label: "address", Encoding: "inplace", NumberOfBytes: 20},
+		"t_bool":    {Label: "bool", Encoding: "inplace", NumberOfBytes: 1},
+		"t_uint64":  {Label: "uint64", Encoding: "inplace", NumberOfBytes: 8},
+		"t_uint256": {Label: "uint256", Encoding: "inplace", NumberOfBytes: 32},
+		"t_mapping(t_address,t_uint256)": {
+			Label: "mapping(address => uint256)", Encoding: "mapping", NumberOfBytes: 32,
+			Key: "t_address", Value: "t_uint256",
+		},
+		"t_mapping(t_address,t_mapping(t_address,t_uint256))": {
+			Label: "mapping(address => mapping(address => uint256))", Encoding: "mapping", NumberOfBytes: 32,
+			Key: "t_address", Value: "t_mapping(t_address,t_uint256)",
+		},
+		"t_array(t_uint64)dyn_storage": {
+			Label: "uint64[]", Encoding: "dynamic_array", NumberOfBytes: 32, Base: "t_uint64",
+		},
+	},
+}
+
+// word returns n as a 32-byte storage word.
+func word(n int64) []byte {
+	return common.BigToHash(big.NewInt(n)).Bytes()
+}
+
+func TestStorageSlot(t *testing.T) {
+	holder, spender := common.Address{1}, common.Address{2}
+	pad := func(a common.Address) []byte { return common.LeftPadBytes(a[:], 32) }
+
+	slot, offset, err := eternalStorage.Slot("paused")
+	require.NoError(t, err)
+	assert.Equal(t, common.Hash{}, slot)
+	assert.Equal(t, 20, offset)
+
+	slot, _, err = eternalStorage.Slot("balance", holder)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.Keccak256Hash(pad(holder), word(1)), slot)
+
+	slot, _, err = eternalStorage.Slot("allowed", holder, spender)
+	require.NoError(t, err)
+	inner := crypto.Keccak256(pad(holder), word(2))
+	assert.Equal(t, crypto.Keccak256Hash(pad(spender), inner), slot)
+
+	// Four uint64s fit in each slot, so element 5 is the second in the second slot.
+	slot, offset, err = eternalStorage.Slot("weights", 5)
+	require.NoError(t, err)
+	start := new(big.Int).SetBytes(crypto.Keccak256(word(3)))
+	assert.Equal(t, common.BigToHash(start.Add(start, big.NewInt(1))), slot)
+	assert.Equal(t, 8, offset)
+
+	_, _, err = eternalStorage.Slot("balance", holder, spender)
+	assert.EqualError(t, err, "ReserveEternalStorage.balance key 1: uint256 is not a mapping or dynamic array")
+	_, _, err = eternalStorage.Slot("totalSupply")
+	assert.EqualError(t, err, `ReserveEternalStorage has no state variable "totalSupply"`)
+	_, _, err = (*StorageLayout)(nil).Slot("balance", holder)
+	assert.Equal(t, ErrNoStorageLayout, err)
+}
+
+// storage is a StorageReader for a single contract.
+type storage map[common.Hash][]byte
+
+func (s storage) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	if value, ok := s[key]; ok {
+		return value, nil
+	}
+	return make([]byte, 32), nil
+}
+
+func TestStorageRead(t *testing.T) {
+	owner, holder := common.Address{0xaa}, common.Address{1}
+	balanceSlot, _, err := eternalStorage.Slot("balance", holder)
+	require.NoError(t, err)
+
+	// Slot 0 packs paused after owner, right to left.
+	slot0 := make([]byte, 32)
+	slot0[11] = 1
+	copy(slot0[12:], owner[:])
+	chain := storage{{}: slot0, balanceSlot: word(1000)}
+
+	read := func(label string, keys ...interface{}) *big.Int {
+		value, err := eternalStorage.Read(context.Background(), chain, common.Address{}, nil, label, keys...)
+		require.NoError(t, err)
+		return value
+	}
+	assert.Equal(t, owner, common.BigToAddress(read("owner")))
+	assert.Equal(t, big.NewInt(1), read("paused"))
+	assert.Equal(t, big.NewInt(1000), read("balance", holder))
+	assert.Zero(t, read("balance", common.Address{2}).Sign())
+
+	_, err = eternalStorage.Read(context.Background(), chain, common.Address{}, nil, "allowed", holder)
+	assert.EqualError(t, err, "cannot read ReserveEternalStorage.allowed: mapping(address => uint256) does not fit in a slot")
+}
+
+func TestStorageChanges(t *testing.T) {
+	assert.Empty(t, eternalStorage.Changes(eternalStorage))
+
+	upgraded := &StorageLayout{
+		Contract: "ReserveEternalStorageV2",
+		Variables: []StorageVariable{
+			{Label: "owner", Slot: 0, Offset: 0, Type: "t_address"},
+			{Label: "frozen", Slot: 0, Offset: 20, Type: "t_bool"},
+			{Label: "balance", Slot: 2, Offset: 0, Type: "t_mapping(t_address,t_uint256)"},
+			{Label: "allowed", Slot: 3, Offset: 0, Type: "t_mapping(t_address,t_mapping(t_address,t_uint256))"},
+			{Label: "weights", Slot: 4, Offset: 0, Type: "t_array(t_uint256)dyn_storage"},
+			{Label: "version", Slot: 5, Offset: 0, Type: "t_uint256"},
+		},
+		Types: map[string]StorageType{},
+	}
+	for id, t := range eternalStorage.Types {
+		upgraded.Types[id] = t
+	}
+	upgraded.Types["t_array(t_uint256)dyn_storage"] = StorageType{
+		Label: "uint256[]", Encoding: "dynamic_array", NumberOfBytes: 32, Base: "t_uint256",
+	}
+
+	assert.Equal(t, []string{
+		"paused (bool) removed from slot 0",
+		"balance moved from slot 1 offset 0 to slot 2 offset 0",
+		"allowed moved from slot 2 offset 0 to slot 3 offset 0",
+		"weights moved from slot 3 offset 0 to slot 4 offset 0",
+		"frozen added in slot 0 offset 20, which held paused",
+	}, eternalStorage.Changes(upgraded))
+
+	upgraded.Variables[4].Slot = 3
+	upgraded.Variables = upgraded.Variables[4:5]
+	assert.Equal(t, []string{
+		"owner (address) removed from slot 0",
+		"paused (bool) removed from slot 0",
+		"balance (mapping(address => uint256)) removed from slot 1",
+		"allowed (mapping(address => mapping(address => uint256))) removed from slot 2",
+		"weights changed type from uint64[] to uint256[]",
+	}, eternalStorage.Changes(upgraded))
+}
@@ -0,0 +1,28 @@
+pragma solidity 0.5.7;
+pragma experimental ABIEncoderV2;
+
+
+/**
+ * Multicall makes many view calls in a single call, so that off-chain readers can read a
+ * consistent snapshot of several contracts, from a single block, in one round trip.
+ * It is a test and tooling helper, and is only meant to be called with eth_call.
+ */
+contract Multicall {
+
+    /// Makes each call `data[i]` to `targets[i]` with `staticcall`, and returns the current block
+    /// number along with whether each call succeeded and its return data, or revert data.
+    function aggregate(address[] memory targets, bytes[] memory data)
+        public
+        view
+        returns (uint256 blockNumber, bool[] memory success, bytes[] memory results)
+    {
+        require(targets.length == data.length, "targets and data must have the same length");
+
+        blockNumber = block.number;
+        success = new bool[](targets.length);
+        results = new bytes[](targets.length);
+        for (uint256 i = 0; i < targets.length; i++) {
+            (success[i], results[i]) = targets[i].staticcall(data[i]);
+        }
+    }
+}
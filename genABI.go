@@ -1,184 +1,112 @@
+// Command genABI generates the Go bindings in abi/ from solc's combined-json output in evm/.
+// It is a thin wrapper around the genabi package:
+//
+//	genABI <contract names...>           generate bindings for contracts in evm/<Name>.json
+//	genABI -combined <file or directory> generate bindings for every contract, and index.go
+//	genABI [flags] verify [names...]     check that abi/ is what genABI would generate
+//	genABI [flags] compat <old> <new>    report ABI changes between two versions of a contract
+//
+// genABI exits with status 0 on success, 1 if verify finds out-of-date files or compat finds
+// breaking changes, and 2 if it is misused or fails.
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"go/format"
-	"io/ioutil"
-	"log"
+	"io"
 	"os"
-	"path/filepath"
-	"strings"
-	"text/template"
 
-	"github.com/ethereum/go-ethereum/accounts/abi"
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/reserve-protocol/rsv-beta/genabi"
 )
 
-func outputGoFile(contractName string) string {
-	return fmt.Sprintf("abi/%v.go", contractName)
-}
-
-const combinedJsonDir = "evm"
-
-func combinedJsonFilename(contractName string) string {
-	return fmt.Sprintf("%v/%v.json", combinedJsonDir, contractName)
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
 }
 
-func main() {
-	if len(os.Args) <= 1 {
-		log.Fatal("genABI: requires at least one argument, got \"%v\"", os.Args[1:])
+// run runs genABI with the command-line arguments args, and returns its exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	var opts genabi.Options
+	flags := flag.NewFlagSet("genABI", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.Combined, "combined", "",
+		"generate bindings for every contract in this solc combined-json file, "+
+			"or in every .json file in this directory")
+	flags.StringVar(&opts.InputDir, "in", "evm", "read named contracts from <Name>.json in this directory")
+	flags.StringVar(&opts.SourceDir, "sources", ".", "the directory solc ran in, which its source paths are relative to")
+	flags.StringVar(&opts.LayoutDir, "layouts", "layouts",
+		"read the storage layouts of contracts whose solc output has none from <Name>.json in this directory")
+	flags.StringVar(&opts.OutputDir, "out", "abi", "write the bindings to this directory")
+	flags.StringVar(&opts.Package, "package", "abi", "name the generated Go package this")
+	flags.StringVar(&opts.TemplatesDir, "templates", "",
+		"also execute every *.tmpl file in this directory, as described in genabi/plugin.go")
+	flags.StringVar(&opts.TemplatesOutputDir, "templates-out", "generated", "write the output of -templates to this directory")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: genABI [flags] <contract names...>")
+		fmt.Fprintln(stderr, "       genABI [flags] -combined <file or directory>")
+		fmt.Fprintln(stderr, "       genABI [flags] verify [contract names...]")
+		fmt.Fprintln(stderr, "       genABI [flags] compat <old contract> <new contract>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	usageError := func(format string, a ...interface{}) int {
+		fmt.Fprintf(stderr, "genABI: "+format+"\n", a...)
+		flags.Usage()
+		return 2
+	}
+	failed := func(err error) int {
+		fmt.Fprintln(stderr, "genABI:", err)
+		return 2
 	}
 
-	for _, contractName := range os.Args[1:] {
-		type compiledOutput struct {
-			ABI           string
-			Bin           string
-			BinRuntime    string `json:"bin-runtime"`
-			Srcmap        string
-			SrcmapRuntime string `json:"srcmap-runtime"`
+	switch flags.Arg(0) {
+	case "compat":
+		if flags.NArg() != 3 {
+			return usageError("compat requires two arguments, got %q", flags.Args()[1:])
 		}
-		jsonName := combinedJsonFilename(contractName)
-		combinedJson, err := os.Open(jsonName)
-		check(err, "Opening combined json file")
-
-		// Parse the combined-json outputs from solc.
-		var compilationResult struct {
-			Contracts  map[string]compiledOutput
-			SourceList []string
+		report, err := genabi.Compat(opts, flags.Arg(1), flags.Arg(2))
+		if err != nil {
+			return failed(err)
 		}
+		report.Write(stdout)
+		if report.Breaking() {
+			return 1
+		}
+		return 0
 
-		check(
-			json.NewDecoder(combinedJson).Decode(&compilationResult),
-			"parsing solc output in "+jsonName)
-		combinedJson.Close()
-
-		// The compilationResult keys have the format <.sol filename>.sol:<contract name>
-		// We're treating all the contracts as if they're in one namespace, so we're just
-		// referring to them by their contract name (and we only know the contract name)
-		// Given that, find the contract key from contractName.
-		contractKey := ""
-		for k := range compilationResult.Contracts {
-			index := strings.LastIndex(k, ":")
-			tail := k[index+1:]
-			if tail == contractName {
-				if contractKey != "" {
-					log.Fatal("multiple $v instances in evm/%v.json", contractName, contractName)
-				}
-				contractKey = k
-			}
+	case "verify":
+		opts.Contracts = flags.Args()[1:]
+		if opts.Combined == "" && len(opts.Contracts) == 0 {
+			return usageError("verify requires -combined or contract names")
 		}
-		if contractKey == "" {
-			log.Fatal("no $v instances in evm/%s.json.", contractName, contractName)
+		problems, generated, err := genabi.Verify(opts)
+		if err != nil {
+			return failed(err)
 		}
-		output := compilationResult.Contracts[contractKey]
-
-		// Generate bindings.
-		check(os.MkdirAll("abi", 0755), "creating abi directory")
-		code, err := bind.Bind(
-			[]string{contractName},
-			[]string{output.ABI},
-			[]string{output.Bin},
-			"abi",
-			bind.LangGo)
-		check(err, "generating Go bindings")
-
-		// Write to .go file.
-		name := outputGoFile(contractName)
-		check(ioutil.WriteFile(name, []byte(code), 0644), "writing "+name)
-
-		// Generate event bindings.
-		//
-		// We generate a String() function for each event and a
-		// Parse<ContractName>Log(*types.Log) function for each contract.
-		buf := new(bytes.Buffer)
-		parsedABI, err := abi.JSON(bytes.NewReader([]byte(output.ABI)))
-		check(err, "parsing ABI JSON")
-		check(template.Must(template.New("").Funcs(
-			template.FuncMap{
-				"flags": func(inputs abi.Arguments) string {
-					result := make([]string, len(inputs))
-					for i := range result {
-						switch inputs[i].Type.String() {
-						case "string":
-							result[i] = "%q"
-						default:
-							result[i] = "%v"
-						}
-					}
-					return strings.Join(result, ", ")
-				},
-				"format": func(inputs abi.Arguments) string {
-					result := make([]string, len(inputs))
-					for i := range result {
-						arg := "e." + abi.ToCamelCase(inputs[i].Name)
-						switch inputs[i].Type.String() {
-						case "address":
-							arg = arg + ".Hex()"
-						}
-						result[i] = arg
-					}
-					return strings.Join(result, ",")
-				},
-			},
-		).Parse(`
-        // This file is auto-generated. Do not edit.
-
-        package abi
-
-        import (
-            "fmt"
-
-            "github.com/ethereum/go-ethereum/core/types"
-        )
-
-        {{$contract := .Contract}}
-
-        func (c *{{$contract}}Filterer) ParseLog(log *types.Log) (fmt.Stringer, error) {
-            var event fmt.Stringer
-            var eventName string
-            switch log.Topics[0].Hex() {
-            {{- range .Events}}
-            case {{with .Id}}{{printf "%q" .Hex}}{{end}}: // {{.Name}}
-                event = new({{$contract}}{{.Name}})
-                eventName = "{{.Name}}"
-            {{- end}}
-            default:
-                return nil, fmt.Errorf("no such event hash for {{$contract}}: %v", log.Topics[0])
-            }
-
-            err := c.contract.UnpackLog(event, eventName, *log)
-            if err != nil {
-                return nil, err
-            }
-            return event, nil
-        }
-
-        {{range .Events}}
-        func (e {{$contract}}{{.Name}}) String() string {
-            return fmt.Sprintf("{{$contract}}.{{.Name}}({{flags .Inputs}})",{{format .Inputs}})
-        }
-        {{end}}
-        `)).Execute(buf, map[string]interface{}{
-			"Contract": contractName,
-			"Events":   parsedABI.Events,
-		}), "generating event bindings")
-		eventCode, err := format.Source(buf.Bytes())
-		check(err, "running gofmt")
-		check(
-			ioutil.WriteFile(
-				filepath.Join("abi", contractName+"Events.go"),
-				eventCode,
-				0644,
-			),
-			"writing event bindings to disk",
-		)
+		for _, p := range problems {
+			fmt.Fprintln(stdout, p)
+		}
+		if len(problems) > 0 {
+			fmt.Fprintf(stdout, "%v of %v generated files are out of date; regenerate them with `make abi`\n", len(problems), generated)
+			return 1
+		}
+		fmt.Fprintf(stdout, "all %v generated files are up to date\n", generated)
+		return 0
 	}
-}
 
-func check(err error, msg string) {
+	opts.Contracts = flags.Args()
+	if opts.Combined == "" && len(opts.Contracts) == 0 {
+		return usageError("requires -combined or at least one contract name")
+	}
+	files, err := genabi.Generate(opts)
 	if err != nil {
-		log.Fatal(msg, ": ", err)
+		return failed(err)
+	}
+	if err := genabi.WriteFiles(files); err != nil {
+		return failed(err)
 	}
+	return 0
 }
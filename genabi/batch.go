@@ -0,0 +1,163 @@
+package genabi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// loadBatch finds every contract in path, which is either a single solc combined-json file or a
+// directory of them, such as evm/.
+//
+// Each of our evm/<Name>.json files holds <Name> together with everything it imports, and
+// evm/all.json holds every contract, so shared contracts like the zeppelin ERC20 show up in many
+// files. Copies with identical ABIs are de-duplicated, preferring the copy from evm/<Name>.json
+// since that one was compiled with the optimizer settings intended for it. Two different
+// contracts with the same name are an error, because their bindings would collide in the
+// generated package.
+//
+// Contracts with an empty ABI, such as libraries, have nothing to bind and are skipped.
+// The result is sorted by contract name.
+func loadBatch(path string) ([]contract, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading "+path)
+	}
+
+	jsonNames := []string{path}
+	if info.IsDir() {
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "listing "+path)
+		}
+		jsonNames = nil
+		for _, file := range files {
+			if !file.IsDir() && filepath.Ext(file.Name()) == ".json" {
+				jsonNames = append(jsonNames, filepath.Join(path, file.Name()))
+			}
+		}
+	}
+
+	found := make(map[string]contract)
+	foundIn := make(map[string]string) // contract name -> json file it was taken from
+	for _, jsonName := range jsonNames {
+		compilationResult, err := readCombinedJSON(jsonName)
+		if err != nil {
+			return nil, err
+		}
+
+		// Visit keys in a fixed order, so that which copy of a contract we keep is deterministic.
+		keys := make([]string, 0, len(compilationResult.Contracts))
+		for k := range compilationResult.Contracts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			source, name := splitContractKey(k)
+			output := compilationResult.Contracts[k]
+			if isEmptyABI(output.ABI) {
+				continue
+			}
+			c := contract{
+				Name:           name,
+				Source:         source,
+				compiledOutput: output,
+				SourceList:     compilationResult.SourceList,
+			}
+
+			previous, ok := found[name]
+			if !ok {
+				found[name], foundIn[name] = c, jsonName
+				continue
+			}
+			if previous.Source != source || !sameABI(previous.ABI, output.ABI) {
+				return nil, fmt.Errorf(
+					"multiple %v instances: %v in %v and %v in %v",
+					name, previous.Source, foundIn[name], source, jsonName,
+				)
+			}
+			if isOwnFile(jsonName, name) {
+				found[name], foundIn[name] = c, jsonName
+			}
+		}
+	}
+
+	contracts := make([]contract, 0, len(found))
+	for _, c := range found {
+		contracts = append(contracts, c)
+	}
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].Name < contracts[j].Name })
+	return contracts, nil
+}
+
+// isEmptyABI reports whether abiJSON describes no functions, events, or constructor.
+func isEmptyABI(abiJSON string) bool {
+	return strings.TrimSpace(abiJSON) == "" || strings.TrimSpace(abiJSON) == "[]"
+}
+
+// sameABI reports whether two ABI JSON strings are the same, ignoring whitespace.
+func sameABI(a, b string) bool {
+	return strings.Join(strings.Fields(a), "") == strings.Join(strings.Fields(b), "")
+}
+
+// isOwnFile reports whether jsonName is the combined-json file named after contractName.
+func isOwnFile(jsonName, contractName string) bool {
+	return filepath.Base(jsonName) == contractName+".json"
+}
+
+// indexTemplate generates index.go, which lists every contract generated in batch mode.
+var indexTemplate = newTemplate(`
+// This file is auto-generated. Do not edit.
+
+package {{.Package}}
+
+import "github.com/reserve-protocol/rsv-beta/bindutil"
+
+// ContractInfo describes a contract that this package has bindings for.
+type ContractInfo struct {
+    Name   string // Contract name, e.g. "Manager".
+    Source string // Solidity source file, e.g. "contracts/Manager.sol".
+    ABI    string // JSON ABI, the same as the <Name>ABI constant.
+    Bin    string // Deployment bytecode, or "" if the contract cannot be deployed on its own.
+
+    // SourceMap maps PCs in the contract's runtime bytecode to Solidity source lines.
+    SourceMap *bindutil.SourceMap
+
+    // Code identifies the compiled contract, to check deployed contracts against.
+    Code bindutil.Code
+
+    // StorageLayout locates the contract's state variables in storage. It is nil if the
+    // contract has no storage layout, from solc or layouts/.
+    StorageLayout *bindutil.StorageLayout
+}
+
+// Contracts lists every contract in this package, keyed by contract name.
+var Contracts = map[string]ContractInfo{
+    {{- range .Contracts}}
+    "{{.Name}}": {
+        Name:   "{{.Name}}",
+        Source: "{{.Source}}",
+        ABI:    {{.Name}}ABI,
+        Bin:    {{if .Bin}}{{.Name}}Bin{{else}}""{{end}},
+
+        SourceMap: {{.Name}}SourceMap,
+        Code:      {{.Name}}Code,
+
+        StorageLayout: {{.Name}}StorageLayout,
+    },
+    {{- end}}
+}
+
+// Docs holds the NatSpec documentation of every contract in this package, keyed by contract name.
+var Docs = map[string]bindutil.ContractDocs{
+    {{- range .Contracts}}
+    "{{.Name}}": {{.Name}}Docs,
+    {{- end}}
+}
+`)
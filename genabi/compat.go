@@ -0,0 +1,372 @@
+package genabi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// CompatReport is the result of Compat: how a contract's ABI and storage layout changed between
+// two versions.
+type CompatReport struct {
+	Old, New string   // Names of the old and new versions, e.g. "Reserve" and "ReserveV2".
+	Changes  []Change // Breaking changes first.
+}
+
+// Breaking reports whether any of r.Changes breaks integrators.
+func (r CompatReport) Breaking() bool {
+	for _, c := range r.Changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes a summary line, then each change on a line of its own, to w.
+func (r CompatReport) Write(w io.Writer) {
+	fmt.Fprintf(w, "%v -> %v: %v changes\n", r.Old, r.New, len(r.Changes))
+	for _, c := range r.Changes {
+		fmt.Fprintln(w, c)
+	}
+}
+
+// Compat reports how the ABI of a contract changed between two versions, e.g. from Reserve to
+// ReserveV2, and whether each change is backwards-compatible for integrators. If both versions
+// have storage layouts, from solc or opts.LayoutDir, state variables that moved are reported as
+// breaking too.
+//
+// Each of oldArg and newArg is either a contract name, to read <opts.InputDir>/<name>.json; a
+// solc combined-json file, optionally followed by ":<contract name>" if the contract is not
+// named after the file; or a file holding just a JSON ABI, such as a committed baseline.
+func Compat(opts Options, oldArg, newArg string) (*CompatReport, error) {
+	opts = opts.withDefaults()
+	oldName, oldOutput, err := loadABI(opts, oldArg)
+	if err != nil {
+		return nil, err
+	}
+	newName, newOutput, err := loadABI(opts, newArg)
+	if err != nil {
+		return nil, err
+	}
+	oldABI, err := parseABIEntries(oldName, oldOutput.ABI)
+	if err != nil {
+		return nil, err
+	}
+	newABI, err := parseABIEntries(newName, newOutput.ABI)
+	if err != nil {
+		return nil, err
+	}
+	storageChanges, err := compareStorage(
+		contract{Name: oldName, compiledOutput: oldOutput},
+		contract{Name: newName, compiledOutput: newOutput},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &CompatReport{
+		Old:     oldName,
+		New:     newName,
+		Changes: append(storageChanges, compareABIs(oldABI, newABI)...),
+	}, nil
+}
+
+// loadABI loads the compiled contract that arg, an argument to Compat, refers to. Only its ABI
+// is set if arg is a file holding just a JSON ABI. A contract named by arg gets the storage layout
+// in opts.LayoutDir if solc didn't output one; a file, which may be of an older version of the
+// contract, never does.
+func loadABI(opts Options, arg string) (name string, output compiledOutput, err error) {
+	path := arg
+	if i := strings.LastIndex(arg, ":"); i >= 0 && strings.HasSuffix(arg[:i], ".json") {
+		path, name = arg[:i], arg[i+1:]
+	}
+	if !strings.HasSuffix(path, ".json") {
+		c, err := loadContract(opts.InputDir, arg)
+		if err == nil {
+			err = addLayout(opts.LayoutDir, &c)
+		}
+		return arg, c.compiledOutput, err
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", compiledOutput{}, errors.Wrap(err, "reading "+path)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return name, compiledOutput{ABI: string(data)}, nil
+	}
+	var compilationResult combinedJSON
+	if err := json.Unmarshal(data, &compilationResult); err != nil {
+		return "", compiledOutput{}, errors.Wrap(err, "parsing solc output in "+path)
+	}
+	for k, output := range compilationResult.Contracts {
+		if _, contractName := splitContractKey(k); contractName == name {
+			return name, output, nil
+		}
+	}
+	return "", compiledOutput{}, fmt.Errorf("no %v instances in %v", name, path)
+}
+
+// abiEntry is one function, event, constructor, or fallback function in a JSON ABI.
+//
+// We parse ABIs ourselves, rather than with go-ethereum's abi package, because it discards the
+// payable and stateMutability fields.
+type abiEntry struct {
+	Type            string
+	Name            string
+	Inputs          []abiParam
+	Outputs         []abiParam
+	Constant        bool
+	Payable         bool
+	StateMutability string
+	Anonymous       bool
+}
+
+type abiParam struct {
+	Name       string
+	Type       string
+	Indexed    bool
+	Components []abiParam
+}
+
+// parseABIEntries parses abiJSON, the ABI of the named contract.
+func parseABIEntries(name, abiJSON string) ([]abiEntry, error) {
+	var entries []abiEntry
+	if err := json.Unmarshal([]byte(abiJSON), &entries); err != nil {
+		return nil, errors.Wrap(err, "parsing ABI of "+name)
+	}
+	for i := range entries {
+		if entries[i].Type == "" {
+			entries[i].Type = "function"
+		}
+	}
+	return entries, nil
+}
+
+// mutability returns e's state mutability, deriving it from the older constant and payable
+// fields if the compiler didn't report it.
+func (e abiEntry) mutability() string {
+	switch {
+	case e.StateMutability != "":
+		return e.StateMutability
+	case e.Constant:
+		return "view"
+	case e.Payable:
+		return "payable"
+	default:
+		return "nonpayable"
+	}
+}
+
+// signature returns e's canonical signature, e.g. "transfer(address,uint256)".
+func (e abiEntry) signature() string {
+	return e.Name + typeList(e.Inputs)
+}
+
+// typeList renders the canonical types of params as a parenthesized list.
+func typeList(params []abiParam) string {
+	types := make([]string, len(params))
+	for i, p := range params {
+		types[i] = p.canonicalType()
+	}
+	return "(" + strings.Join(types, ",") + ")"
+}
+
+// canonicalType returns p's type as it appears in signatures, expanding tuples.
+func (p abiParam) canonicalType() string {
+	if strings.HasPrefix(p.Type, "tuple") {
+		return typeList(p.Components) + strings.TrimPrefix(p.Type, "tuple")
+	}
+	return p.Type
+}
+
+// indexedList renders which of an event's params are indexed, e.g. "(indexed,_,indexed)".
+func indexedList(params []abiParam) string {
+	flags := make([]string, len(params))
+	for i, p := range params {
+		flags[i] = "_"
+		if p.Indexed {
+			flags[i] = "indexed"
+		}
+	}
+	return "(" + strings.Join(flags, ",") + ")"
+}
+
+// Change is one difference between two versions of a contract's ABI or storage layout.
+type Change struct {
+	Breaking bool
+	Kind     string // What changed, e.g. "removed function".
+	Subject  string // The function or event that changed, e.g. "issue(uint256)".
+	Detail   string // How it changed, if Kind doesn't say.
+}
+
+// compareABIs lists the differences between oldABI and newABI, sorted with breaking changes first.
+func compareABIs(oldABI, newABI []abiEntry) []Change {
+	var changes []Change
+	add := func(breaking bool, kind, subject, detailFormat string, a ...interface{}) {
+		changes = append(changes, Change{breaking, kind, subject, fmt.Sprintf(detailFormat, a...)})
+	}
+
+	oldFuncs, oldEvents, oldOthers := indexEntries(oldABI)
+	newFuncs, newEvents, newOthers := indexEntries(newABI)
+
+	for sig, old := range oldFuncs {
+		updated, ok := newFuncs[sig]
+		if !ok {
+			add(true, "removed function", sig, "%v", overloadsOf(old.Name, newFuncs))
+			continue
+		}
+		if typeList(old.Outputs) != typeList(updated.Outputs) {
+			add(true, "changed outputs", sig, "returns%v -> returns%v", typeList(old.Outputs), typeList(updated.Outputs))
+		}
+		if from, to := old.mutability(), updated.mutability(); from != to {
+			add(breaksCallers(from, to), "changed mutability", sig, "%v -> %v", from, to)
+		}
+	}
+	for sig := range newFuncs {
+		if _, ok := oldFuncs[sig]; !ok {
+			add(false, "added function", sig, "")
+		}
+	}
+
+	// An event whose parameters changed has a new topic, so it is as good as removed, and its
+	// replacement added.
+	for sig, old := range oldEvents {
+		updated, ok := newEvents[sig]
+		switch {
+		case !ok:
+			detail := "topic " + topic(old)
+			if overloads := overloadsOf(old.Name, newEvents); overloads != "" {
+				detail += "; " + overloads
+			}
+			add(true, "removed event", sig, "%v", detail)
+		case indexedList(old.Inputs) != indexedList(updated.Inputs):
+			add(true, "changed indexing", sig, "%v -> %v", indexedList(old.Inputs), indexedList(updated.Inputs))
+		case old.Anonymous != updated.Anonymous:
+			add(true, "changed anonymity", sig, "anonymous %v -> %v", old.Anonymous, updated.Anonymous)
+		}
+	}
+	for sig, updated := range newEvents {
+		if _, ok := oldEvents[sig]; !ok {
+			add(false, "added event", sig, "topic %v", topic(updated))
+		}
+	}
+
+	// Constructors only matter to deployers, so changing one never breaks integrators.
+	if old, updated := oldOthers["constructor"], newOthers["constructor"]; typeList(old.Inputs) != typeList(updated.Inputs) {
+		add(false, "changed constructor", "constructor", "%v -> %v", typeList(old.Inputs), typeList(updated.Inputs))
+	}
+	old, hadFallback := oldOthers["fallback"]
+	updated, hasFallback := newOthers["fallback"]
+	switch {
+	case hadFallback && !hasFallback:
+		add(true, "removed fallback", "fallback", "")
+	case !hadFallback && hasFallback:
+		add(false, "added fallback", "fallback", "")
+	case hadFallback && old.mutability() != updated.mutability():
+		add(breaksCallers(old.mutability(), updated.mutability()), "changed mutability", "fallback",
+			"%v -> %v", old.mutability(), updated.mutability())
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Breaking != changes[j].Breaking {
+			return changes[i].Breaking
+		}
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].Subject < changes[j].Subject
+	})
+	return changes
+}
+
+// indexEntries sorts the entries of an ABI into functions and events, keyed by signature, as
+// their selectors and topics are computed, so that overloads are told apart; and everything else,
+// keyed by type.
+func indexEntries(entries []abiEntry) (funcs, events, others map[string]abiEntry) {
+	funcs, events, others = make(map[string]abiEntry), make(map[string]abiEntry), make(map[string]abiEntry)
+	for _, e := range entries {
+		switch e.Type {
+		case "function":
+			funcs[e.signature()] = e
+		case "event":
+			events[e.signature()] = e
+		default:
+			others[e.Type] = e
+		}
+	}
+	return funcs, events, others
+}
+
+// overloadsOf describes the functions or events in entries that are named name, to explain a
+// removed one that might have only had its parameters changed.
+func overloadsOf(name string, entries map[string]abiEntry) string {
+	var sigs []string
+	for sig, f := range entries {
+		if f.Name == name {
+			sigs = append(sigs, sig)
+		}
+	}
+	if len(sigs) == 0 {
+		return ""
+	}
+	sort.Strings(sigs)
+	return "now " + strings.Join(sigs, ", ")
+}
+
+// breaksCallers reports whether changing a function's mutability from `from` to `to` breaks
+// existing callers. Reads that become transactions break callers that use eth_call, and payable
+// functions that stop accepting ether break callers that send it. Everything else is compatible.
+func breaksCallers(from, to string) bool {
+	isRead := func(m string) bool { return m == "view" || m == "pure" }
+	return (isRead(from) && !isRead(to)) || (from == "payable" && to != "payable")
+}
+
+// topic returns the first log topic of event.
+func topic(event abiEntry) string {
+	return crypto.Keccak256Hash([]byte(event.signature())).Hex()
+}
+
+// compareStorage lists the state variables that moved, changed type, or were removed between the
+// storage layouts of oldContract and newContract, all of which are breaking for upgrades that
+// keep the old contract's storage. Storage is only compared if both contracts have layouts.
+func compareStorage(oldContract, newContract contract) ([]Change, error) {
+	oldLayout, err := parseStorageLayout(oldContract)
+	if err != nil {
+		return nil, err
+	}
+	newLayout, err := parseStorageLayout(newContract)
+	if err != nil || oldLayout == nil || newLayout == nil {
+		return nil, err
+	}
+	var changes []Change
+	for _, change := range oldLayout.Changes(newLayout) {
+		changes = append(changes, Change{Breaking: true, Kind: "storage layout", Subject: change})
+	}
+	return changes, nil
+}
+
+// String describes c on one line, e.g.
+// "BREAKING  removed function      issue(uint256): now issue(uint256,address)".
+func (c Change) String() string {
+	severity := "ok      "
+	if c.Breaking {
+		severity = "BREAKING"
+	}
+	line := fmt.Sprintf("%v  %-18v  %v", severity, c.Kind, c.Subject)
+	if c.Detail != "" {
+		line += ": " + c.Detail
+	}
+	return line
+}
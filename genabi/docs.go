@@ -0,0 +1,216 @@
+package genabi
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/pkg/errors"
+
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+// natspec mirrors the parts of solc's userdoc and devdoc outputs that we use. Both outputs have
+// the same shape, each filling in different fields.
+type natspec struct {
+	Title   string
+	Author  string
+	Notice  string
+	Details string
+	Methods map[string]natspecMember
+	Events  map[string]natspecMember
+}
+
+type natspecMember struct {
+	Notice  string
+	Details string
+	Params  map[string]string
+	Return  string
+}
+
+// parseDocs merges c's userdoc and devdoc into a bindutil.ContractDocs.
+func parseDocs(c contract) (bindutil.ContractDocs, error) {
+	var user, dev natspec
+	if err := decodeEmbedded(c.Userdoc, &user); err != nil {
+		return bindutil.ContractDocs{}, errors.Wrap(err, "parsing userdoc of "+c.Name)
+	}
+	if err := decodeEmbedded(c.Devdoc, &dev); err != nil {
+		return bindutil.ContractDocs{}, errors.Wrap(err, "parsing devdoc of "+c.Name)
+	}
+	return bindutil.ContractDocs{
+		Title:   dev.Title,
+		Author:  dev.Author,
+		Notice:  user.Notice,
+		Details: dev.Details,
+		Methods: mergeMembers(user.Methods, dev.Methods),
+		Events:  mergeMembers(user.Events, dev.Events),
+	}, nil
+}
+
+// decodeEmbedded decodes a userdoc, devdoc, or storage-layout output into v. solc 0.5 writes these
+// outputs into combined-json as JSON-encoded strings rather than objects; we accept either.
+// A missing output leaves v empty.
+func decodeEmbedded(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		raw = json.RawMessage(s)
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// mergeMembers combines the user and dev documentation of a contract's methods or events.
+func mergeMembers(user, dev map[string]natspecMember) map[string]bindutil.MemberDocs {
+	result := make(map[string]bindutil.MemberDocs)
+	for signature, docs := range user {
+		result[signature] = bindutil.MemberDocs{Notice: docs.Notice}
+	}
+	for signature, docs := range dev {
+		merged := result[signature]
+		merged.Details = docs.Details
+		merged.Params = docs.Params
+		merged.Return = docs.Return
+		result[signature] = merged
+	}
+	return result
+}
+
+// docComment renders docs as the lines of a Go comment, each starting with "//", to follow the
+// "// Solidity: ..." line of a generated binding. It returns nothing if docs is empty.
+func docComment(docs bindutil.MemberDocs, inputs abi.Arguments) []string {
+	var lines []string
+	paragraph := func(text string) {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return
+		}
+		lines = append(lines, "//")
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimRight("// "+line, " "))
+		}
+	}
+
+	paragraph(docs.Notice)
+	paragraph(docs.Details)
+	var params []string
+	for _, input := range inputs {
+		if text, ok := docs.Params[input.Name]; ok {
+			params = append(params, "  - "+input.Name+": "+strings.TrimSpace(text))
+		}
+	}
+	if len(params) > 0 {
+		paragraph("Parameters:\n" + strings.Join(params, "\n"))
+	}
+	if docs.Return != "" {
+		paragraph("Returns: " + docs.Return)
+	}
+	return lines
+}
+
+// annotate adds the NatSpec documentation in docs to code, the output of bind.Bind, by inserting
+// it after the "// Solidity: ..." line that bind.Bind writes above each method and event binding,
+// and after the comment on each event struct.
+func annotate(code string, contractName string, parsedABI abi.ABI, docs bindutil.ContractDocs) string {
+	comments := make(map[string][]string)
+	for _, method := range parsedABI.Methods {
+		if lines := docComment(docs.Methods[method.Sig()], method.Inputs); lines != nil {
+			comments["// Solidity: "+method.String()] = lines
+		}
+	}
+	for _, event := range parsedABI.Events {
+		if lines := docComment(docs.Events[signature(event)], event.Inputs); lines != nil {
+			comments["// Solidity: "+event.String()] = lines
+			comments["// "+contractName+event.Name+" represents a "+event.Name+
+				" event raised by the "+contractName+" contract."] = lines
+		}
+	}
+
+	var result []string
+	for _, line := range strings.Split(code, "\n") {
+		result = append(result, line)
+		if lines, ok := comments[strings.TrimSpace(line)]; ok {
+			indent := line[:strings.Index(line, "//")]
+			for _, comment := range lines {
+				result = append(result, indent+comment)
+			}
+		}
+	}
+	return strings.Join(result, "\n")
+}
+
+// methodDoc renders the documentation for method from docs, for templates to place after a
+// "// Solidity: ..." line.
+func methodDoc(docs bindutil.ContractDocs, method abi.Method) string {
+	result := ""
+	for _, line := range docComment(docs.Methods[method.Sig()], method.Inputs) {
+		result += "\n" + line
+	}
+	return result
+}
+
+// quote renders s as a Go string literal.
+func quote(s string) string {
+	return strconv.Quote(s)
+}
+
+// docsTemplate generates abi/<Contract>Docs.go, which holds the contract's NatSpec documentation
+// as a bindutil.ContractDocs value.
+var docsTemplate = newTemplate(`
+// This file is auto-generated. Do not edit.
+// Input hash: {{.InputHash}}
+
+package {{.Package}}
+
+import "github.com/reserve-protocol/rsv-beta/bindutil"
+
+{{define "member"}}{
+            {{- with .Notice}}
+            Notice: {{quote .}},
+            {{- end}}
+            {{- with .Details}}
+            Details: {{quote .}},
+            {{- end}}
+            {{- with .Params}}
+            Params: map[string]string{
+                {{- range $name, $text := .}}
+                {{quote $name}}: {{quote $text}},
+                {{- end}}
+            },
+            {{- end}}
+            {{- with .Return}}
+            Return: {{quote .}},
+            {{- end}}
+        }{{end}}
+
+// {{.Contract}}Docs is the NatSpec documentation of the {{.Contract}} contract.
+var {{.Contract}}Docs = bindutil.ContractDocs{
+    {{- with .Docs.Title}}
+    Title: {{quote .}},
+    {{- end}}
+    {{- with .Docs.Author}}
+    Author: {{quote .}},
+    {{- end}}
+    {{- with .Docs.Notice}}
+    Notice: {{quote .}},
+    {{- end}}
+    {{- with .Docs.Details}}
+    Details: {{quote .}},
+    {{- end}}
+    Methods: map[string]bindutil.MemberDocs{
+        {{- range $signature, $docs := .Docs.Methods}}
+        {{quote $signature}}: {{template "member" $docs}},
+        {{- end}}
+    },
+    Events: map[string]bindutil.MemberDocs{
+        {{- range $signature, $docs := .Docs.Events}}
+        {{quote $signature}}: {{template "member" $docs}},
+        {{- end}}
+    },
+}
+`)
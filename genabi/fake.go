@@ -0,0 +1,267 @@
+package genabi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// callResults renders the results of the Go binding bind.Bind generates for a constant method:
+// a struct if the outputs are all distinctly named, and a flat list otherwise, followed by an
+// error. If named is set, the results are named so that a bare return yields zero values.
+func callResults(method abi.Method, named bool) string {
+	var results []string
+	if structured(method.Outputs) {
+		fields := make([]string, len(method.Outputs))
+		for i, output := range method.Outputs {
+			fields[i] = abi.ToCamelCase(output.Name) + " " + goType(output.Type)
+		}
+		results = append(results, "struct{ "+strings.Join(fields, "; ")+" }")
+		if named {
+			results[0] = "out " + results[0]
+		}
+	} else {
+		for i, output := range method.Outputs {
+			result := goType(output.Type)
+			if named {
+				result = fmt.Sprintf("out%d %v", i, result)
+			}
+			results = append(results, result)
+		}
+	}
+	if named {
+		results = append(results, "err error")
+	} else {
+		results = append(results, "error")
+	}
+	return "(" + strings.Join(results, ", ") + ")"
+}
+
+// structured reports whether bind.Bind returns method outputs as a struct, which it does when
+// there are several and they all have distinct names.
+func structured(outputs abi.Arguments) bool {
+	if len(outputs) < 2 {
+		return false
+	}
+	exists := make(map[string]bool)
+	for _, output := range outputs {
+		field := abi.ToCamelCase(output.Name)
+		if output.Name == "" || field == "" || exists[field] {
+			return false
+		}
+		exists[field] = true
+	}
+	return true
+}
+
+// filterParams renders the indexed inputs of an event as the parameters of its Filter and Watch
+// bindings, each preceded by a comma.
+func filterParams(inputs abi.Arguments) string {
+	result := ""
+	for i, input := range inputs {
+		if input.Indexed {
+			result += fmt.Sprintf(", %v []%v", argName(i, input), goType(input.Type))
+		}
+	}
+	return result
+}
+
+// filterArgs renders the indexed inputs of an event as an argument list, each preceded by a
+// comma, using the names given to them by filterParams. suffix is appended to each name.
+func filterArgs(inputs abi.Arguments, suffix string) string {
+	result := ""
+	for i, input := range inputs {
+		if input.Indexed {
+			result += ", " + argName(i, input) + suffix
+		}
+	}
+	return result
+}
+
+// fakeTemplate generates, for each contract, interfaces covering its caller, transactor and
+// filterer bindings, and a <Contract>Fake implementing them in memory, so that code built on the
+// bindings can be unit tested without deploying contracts.
+var fakeTemplate = newTemplate(`
+// This file is auto-generated. Do not edit.
+// Input hash: {{.InputHash}}
+
+package {{.Package}}
+
+import (
+    "math/big"
+
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/event"
+
+    "github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+    _ = big.NewInt
+    _ = bind.Bind
+    _ = common.Big1
+    _ = types.BloomLookup
+    _ = event.NewSubscription
+)
+
+{{$contract := .Contract}}
+
+// {{$contract}}CallerAPI is the read-only part of the {{$contract}} binding. It is implemented by
+// {{$contract}}Caller and {{$contract}}Fake.
+type {{$contract}}CallerAPI interface {
+    {{- range .Methods}}{{if .Const}}
+    {{capitalise .Name}}(opts *bind.CallOpts{{params .Inputs}}) {{callresults . false}}
+    {{- end}}{{end}}
+}
+
+// {{$contract}}TransactorAPI is the write-only part of the {{$contract}} binding. It is implemented by
+// {{$contract}}Transactor, {{$contract}}Checked, and {{$contract}}Fake.
+type {{$contract}}TransactorAPI interface {
+    {{- range .Methods}}{{if not .Const}}
+    {{capitalise .Name}}(opts *bind.TransactOpts{{params .Inputs}}) (*types.Transaction, error)
+    {{- end}}{{end}}
+}
+
+// {{$contract}}FiltererAPI is the log filtering part of the {{$contract}} binding. It is implemented by
+// {{$contract}}Filterer and {{$contract}}Fake.
+type {{$contract}}FiltererAPI interface {
+    {{- range .Events}}{{if not .Anonymous}}
+    Filter{{.Name}}(opts *bind.FilterOpts{{filterparams .Inputs}}) (*{{$contract}}{{.Name}}Iterator, error)
+    Watch{{.Name}}(opts *bind.WatchOpts, sink chan<- *{{$contract}}{{.Name}}{{filterparams .Inputs}}) (event.Subscription, error)
+    {{- end}}{{end}}
+}
+
+// {{$contract}}API is the whole {{$contract}} binding. Code that depends on {{$contract}}API rather
+// than *{{$contract}} can be tested against a {{$contract}}Fake.
+type {{$contract}}API interface {
+    {{$contract}}CallerAPI
+    {{$contract}}TransactorAPI
+    {{$contract}}FiltererAPI
+}
+
+var (
+    _ {{$contract}}API = (*{{$contract}})(nil)
+    _ {{$contract}}API = (*{{$contract}}Checked)(nil)
+    _ {{$contract}}API = (*{{$contract}}Fake)(nil)
+)
+
+// {{$contract}}Fake is an in-memory implementation of {{$contract}}API for unit tests.
+//
+// Every call is recorded, and can be inspected with Calls and CallsTo. A method returns the
+// result of its <Method>Func field if that is set. Otherwise, constant methods return zero
+// values, and mutators return the unsigned transaction they would have sent. Events scripted
+// with Emit are delivered by the Filter and Watch methods.
+type {{$contract}}Fake struct {
+    *bindutil.Fake
+    {{range .Methods}}
+    {{- if .Const}}
+    {{capitalise .Name}}Func func(opts *bind.CallOpts{{params .Inputs}}) {{callresults . false}}
+    {{- else}}
+    {{capitalise .Name}}Func func(opts *bind.TransactOpts{{params .Inputs}}) (*types.Transaction, error)
+    {{- end}}
+    {{- end}}
+}
+
+// New{{$contract}}Fake returns a {{$contract}}Fake that pretends to be deployed at address.
+func New{{$contract}}Fake(address common.Address) *{{$contract}}Fake {
+    return &{{$contract}}Fake{Fake: bindutil.NewFake("{{$contract}}", {{$contract}}ABI, address)}
+}
+
+{{range .Methods}}
+{{- if .Const}}
+// {{capitalise .Name}} records the call, then returns the result of {{capitalise .Name}}Func, or
+// zero values if it is nil.
+//
+// Solidity: {{.String}}
+func (_{{$contract}} *{{$contract}}Fake) {{capitalise .Name}}(opts *bind.CallOpts{{params .Inputs}}) {{callresults . true}} {
+    _{{$contract}}.Record("{{.Name}}"{{args .Inputs}})
+    if _{{$contract}}.{{capitalise .Name}}Func != nil {
+        return _{{$contract}}.{{capitalise .Name}}Func(opts{{args .Inputs}})
+    }
+    return
+}
+{{- else}}
+// {{capitalise .Name}} records the call, then returns the result of {{capitalise .Name}}Func, or
+// the unsigned transaction it would send if that is nil.
+//
+// Solidity: {{.String}}
+func (_{{$contract}} *{{$contract}}Fake) {{capitalise .Name}}(opts *bind.TransactOpts{{params .Inputs}}) (*types.Transaction, error) {
+    _{{$contract}}.Record("{{.Name}}"{{args .Inputs}})
+    if _{{$contract}}.{{capitalise .Name}}Func != nil {
+        return _{{$contract}}.{{capitalise .Name}}Func(opts{{args .Inputs}})
+    }
+    return _{{$contract}}.Transaction(opts, "{{.Name}}"{{args .Inputs}})
+}
+{{- end}}
+{{end}}
+
+{{range .Events}}{{if not .Anonymous}}
+// Filter{{.Name}} records the call, then iterates over the emitted {{.Name}} events that match
+// opts and the given indexed values.
+//
+// Solidity: {{.String}}
+func (_{{$contract}} *{{$contract}}Fake) Filter{{.Name}}(opts *bind.FilterOpts{{filterparams .Inputs}}) (*{{$contract}}{{.Name}}Iterator, error) {
+    _{{$contract}}.Record("Filter{{.Name}}"{{filterargs .Inputs ""}})
+    {{range $i, $input := .Inputs}}{{if .Indexed}}
+    var {{argname $i $input}}Rule []interface{}
+    for _, {{argname $i $input}}Item := range {{argname $i $input}} {
+        {{argname $i $input}}Rule = append({{argname $i $input}}Rule, {{argname $i $input}}Item)
+    }
+    {{- end}}{{end}}
+
+    logs, sub, err := _{{$contract}}.FilterLogs(opts, "{{.Name}}"{{filterargs .Inputs "Rule"}})
+    if err != nil {
+        return nil, err
+    }
+    return &{{$contract}}{{.Name}}Iterator{contract: logUnpacker{{$contract}}, event: "{{.Name}}", logs: logs, sub: sub}, nil
+}
+
+// Watch{{.Name}} records the call, then delivers the {{.Name}} events emitted from now on
+// that match the given indexed values to sink.
+//
+// Solidity: {{.String}}
+func (_{{$contract}} *{{$contract}}Fake) Watch{{.Name}}(opts *bind.WatchOpts, sink chan<- *{{$contract}}{{.Name}}{{filterparams .Inputs}}) (event.Subscription, error) {
+    _{{$contract}}.Record("Watch{{.Name}}"{{filterargs .Inputs ""}})
+    {{range $i, $input := .Inputs}}{{if .Indexed}}
+    var {{argname $i $input}}Rule []interface{}
+    for _, {{argname $i $input}}Item := range {{argname $i $input}} {
+        {{argname $i $input}}Rule = append({{argname $i $input}}Rule, {{argname $i $input}}Item)
+    }
+    {{- end}}{{end}}
+
+    logs, sub, err := _{{$contract}}.WatchLogs(opts, "{{.Name}}"{{filterargs .Inputs "Rule"}})
+    if err != nil {
+        return nil, err
+    }
+    return event.NewSubscription(func(quit <-chan struct{}) error {
+        defer sub.Unsubscribe()
+        for {
+            select {
+            case log := <-logs:
+                event := new({{$contract}}{{.Name}})
+                if err := logUnpacker{{$contract}}.UnpackLog(event, "{{.Name}}", log); err != nil {
+                    return err
+                }
+                event.Raw = log
+
+                select {
+                case sink <- event:
+                case err := <-sub.Err():
+                    return err
+                case <-quit:
+                    return nil
+                }
+            case err := <-sub.Err():
+                return err
+            case <-quit:
+                return nil
+            }
+        }
+    }), nil
+}
+{{end}}{{end}}
+`)
@@ -0,0 +1,80 @@
+package genabi
+
+// filterTemplate generates, for each event, its topic hash and a <Contract><Event>Filter struct
+// that selects events by their indexed arguments, for use on its own or combined with other
+// filters in a bindutil.LogQuery.
+var filterTemplate = newTemplate(`
+// This file is auto-generated. Do not edit.
+// Input hash: {{.InputHash}}
+
+package {{.Package}}
+
+import (
+    "math/big"
+
+    ethereum "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/event"
+
+    "github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+    _ = big.NewInt
+    _ = ethereum.NotFound
+    _ = bind.Bind
+    _ = common.Big1
+    _ = event.NewSubscription
+    _ = bindutil.MakeTopics
+)
+
+{{$contract := .Contract}}
+
+{{range .Events}}{{if not .Anonymous}}
+// {{$contract}}{{.Name}}Topic is the first topic of every {{.Name}} log, the hash of "{{signature .}}".
+var {{$contract}}{{.Name}}Topic = common.HexToHash("{{.Id.Hex}}")
+
+// {{$contract}}{{.Name}}Filter selects {{$contract}}.{{.Name}} events by their indexed arguments.
+// Each field lists the values to accept for that argument; an empty field accepts any value.
+//
+// Solidity: {{.String}}
+type {{$contract}}{{.Name}}Filter struct {
+    {{- range $i, $input := .Inputs}}{{if .Indexed}}
+    {{capitalise (argname $i $input)}} []{{bindtype .Type}}
+    {{- end}}{{end}}
+}
+
+// Topics returns the filter's topic set, in the form of ethereum.FilterQuery.Topics.
+func (f {{$contract}}{{.Name}}Filter) Topics() ([][]common.Hash, error) {
+    {{- range $i, $input := .Inputs}}{{if .Indexed}}
+    var {{argname $i $input}}Rule []interface{}
+    for _, {{argname $i $input}}Item := range f.{{capitalise (argname $i $input)}} {
+        {{argname $i $input}}Rule = append({{argname $i $input}}Rule, {{argname $i $input}}Item)
+    }
+    {{- end}}{{end}}
+    return bindutil.MakeTopics([]interface{}{ {{- $contract}}{{.Name}}Topic}{{filterargs .Inputs "Rule"}})
+}
+
+// Query returns an ethereum.FilterQuery for the events f selects, emitted by any of addresses,
+// or by any contract if none are given.
+func (f {{$contract}}{{.Name}}Filter) Query(addresses ...common.Address) (ethereum.FilterQuery, error) {
+    topics, err := f.Topics()
+    if err != nil {
+        return ethereum.FilterQuery{}, err
+    }
+    return ethereum.FilterQuery{Addresses: addresses, Topics: topics}, nil
+}
+
+// Filter iterates over the events f selects, using filterer's Filter{{.Name}}.
+func (f {{$contract}}{{.Name}}Filter) Filter(opts *bind.FilterOpts, filterer {{$contract}}FiltererAPI) (*{{$contract}}{{.Name}}Iterator, error) {
+    return filterer.Filter{{.Name}}(opts{{range $i, $input := .Inputs}}{{if .Indexed}}, f.{{capitalise (argname $i $input)}}{{end}}{{end}})
+}
+
+// Watch delivers the events f selects to sink, using filterer's Watch{{.Name}}.
+func (f {{$contract}}{{.Name}}Filter) Watch(opts *bind.WatchOpts, filterer {{$contract}}FiltererAPI, sink chan<- *{{$contract}}{{.Name}}) (event.Subscription, error) {
+    return filterer.Watch{{.Name}}(opts, sink{{range $i, $input := .Inputs}}{{if .Indexed}}, f.{{capitalise (argname $i $input)}}{{end}}{{end}})
+}
+{{end}}{{end}}
+`)
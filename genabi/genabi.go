@@ -0,0 +1,557 @@
+// Package genabi generates Go bindings for Solidity contracts from solc's --combined-json
+// output: go-ethereum's bind.Bind bindings, plus event, JSON, revert, documentation, source
+// map, fake, filter, code, storage layout and multicall bindings for each contract. The genABI
+// command in the repository root is a thin wrapper around it, which generates abi/ from evm/.
+package genabi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/pkg/errors"
+)
+
+// Options says which contracts to generate bindings for, and where the generated files belong.
+// The zero value of each field is replaced by its default.
+type Options struct {
+	// InputDir holds a solc combined-json file for each named contract, <InputDir>/<Name>.json.
+	// It defaults to "evm".
+	InputDir string
+
+	// Combined is a solc combined-json file, or a directory of them. If it is set, bindings are
+	// generated for every contract in it rather than for Contracts, along with a package index,
+	// index.go, that lists them.
+	Combined string
+
+	// Contracts names the contracts to generate bindings for, when Combined is not set.
+	Contracts []string
+
+	// SourceDir is the directory solc ran in, which the source file paths in its output are
+	// relative to. Source maps are generated from the files there. It defaults to ".".
+	SourceDir string
+
+	// OutputDir is the directory the generated Go files belong in. It defaults to "abi".
+	OutputDir string
+
+	// Package is the name of the generated Go package. It defaults to "abi".
+	Package string
+
+	// LayoutDir holds storage layouts, <LayoutDir>/<Name>.json in solc's storage-layout format,
+	// for contracts whose solc output has none, as the output of the solc 0.5.7 that the Makefile
+	// pins never does. It defaults to "layouts".
+	LayoutDir string
+
+	// TemplatesDir, if set, is a directory of text/template plugins to execute too, as
+	// described in plugin.go. Their output belongs in TemplatesOutputDir, which defaults to
+	// "generated".
+	TemplatesDir       string
+	TemplatesOutputDir string
+}
+
+// withDefaults returns opts with each unset field set to its default.
+func (opts Options) withDefaults() Options {
+	if opts.InputDir == "" {
+		opts.InputDir = "evm"
+	}
+	if opts.SourceDir == "" {
+		opts.SourceDir = "."
+	}
+	if opts.LayoutDir == "" {
+		opts.LayoutDir = "layouts"
+	}
+	if opts.OutputDir == "" {
+		opts.OutputDir = "abi"
+	}
+	if opts.Package == "" {
+		opts.Package = "abi"
+	}
+	if opts.TemplatesOutputDir == "" {
+		opts.TemplatesOutputDir = "generated"
+	}
+	return opts
+}
+
+// GeneratedFile is a file that Generate generated.
+type GeneratedFile struct {
+	Path    string // Where the file belongs, e.g. "abi/Manager.go".
+	Content []byte
+}
+
+// Generate generates the bindings, and plugin output, for the contracts that opts describe. It
+// doesn't write anything; use WriteFiles for that.
+func Generate(opts Options) ([]GeneratedFile, error) {
+	opts = opts.withDefaults()
+	contracts, err := loadContracts(opts)
+	if err != nil {
+		return nil, err
+	}
+	return generateAll(opts, contracts)
+}
+
+// WriteFiles writes each of files to its path, creating directories as needed.
+func WriteFiles(files []GeneratedFile) error {
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+			return errors.Wrap(err, "creating "+filepath.Dir(f.Path))
+		}
+		if err := ioutil.WriteFile(f.Path, f.Content, 0644); err != nil {
+			return errors.Wrap(err, "writing "+f.Path)
+		}
+	}
+	return nil
+}
+
+// compiledOutput is the per-contract section of solc's --combined-json output.
+type compiledOutput struct {
+	ABI           string
+	Bin           string
+	BinRuntime    string `json:"bin-runtime"`
+	Srcmap        string
+	SrcmapRuntime string `json:"srcmap-runtime"`
+	Userdoc       json.RawMessage
+	Devdoc        json.RawMessage
+	StorageLayout json.RawMessage `json:"storage-layout"`
+}
+
+// contract is a single contract found in solc's output, ready to have bindings generated for it.
+type contract struct {
+	Name   string // Contract name, e.g. "Manager".
+	Source string // Solidity source file the contract is defined in, e.g. "contracts/Manager.sol".
+	compiledOutput
+
+	// SourceList is the source list of the combined-json file the contract was found in,
+	// which the file indexes in its source maps refer to.
+	SourceList []string
+}
+
+// combinedJSON is the top-level structure of solc's --combined-json output.
+type combinedJSON struct {
+	Contracts  map[string]compiledOutput
+	SourceList []string
+}
+
+// loadContracts finds the contracts to generate bindings for: every contract in opts.Combined,
+// if it is set, and otherwise the named contracts. Each has the storage layout in opts.LayoutDir
+// if solc didn't output one.
+func loadContracts(opts Options) ([]contract, error) {
+	var contracts []contract
+	switch {
+	case opts.Combined != "":
+		var err error
+		if contracts, err = loadBatch(opts.Combined); err != nil {
+			return nil, err
+		}
+	case len(opts.Contracts) == 0:
+		return nil, errors.New("no contracts to generate bindings for")
+	default:
+		for _, contractName := range opts.Contracts {
+			c, err := loadContract(opts.InputDir, contractName)
+			if err != nil {
+				return nil, err
+			}
+			contracts = append(contracts, c)
+		}
+	}
+	for i := range contracts {
+		if err := addLayout(opts.LayoutDir, &contracts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return contracts, nil
+}
+
+// generateAll generates the bindings for each of contracts, plus the package index in batch
+// mode, and the output of any plugin templates.
+func generateAll(opts Options, contracts []contract) ([]GeneratedFile, error) {
+	g := &generator{opts: opts}
+	for _, c := range contracts {
+		if err := g.generate(c); err != nil {
+			return nil, errors.Wrap(err, "generating bindings for "+c.Name)
+		}
+	}
+	if opts.Combined != "" {
+		data := map[string]interface{}{"Package": opts.Package, "Contracts": contracts}
+		if err := g.addGoFile("index.go", indexTemplate, data, "package index"); err != nil {
+			return nil, err
+		}
+	}
+	if opts.TemplatesDir != "" {
+		files, err := executeTemplates(opts.TemplatesDir, opts.TemplatesOutputDir, contracts)
+		if err != nil {
+			return nil, err
+		}
+		g.files = append(g.files, files...)
+	}
+	return g.files, nil
+}
+
+// readCombinedJSON parses a file of solc --combined-json output.
+func readCombinedJSON(jsonName string) (combinedJSON, error) {
+	var compilationResult combinedJSON
+	combinedJson, err := os.Open(jsonName)
+	if err != nil {
+		return compilationResult, errors.Wrap(err, "opening combined json file")
+	}
+	defer combinedJson.Close()
+
+	err = json.NewDecoder(combinedJson).Decode(&compilationResult)
+	return compilationResult, errors.Wrap(err, "parsing solc output in "+jsonName)
+}
+
+// splitContractKey splits a combined-json contract key, which has the format
+// <.sol filename>.sol:<contract name>, into its source file and contract name.
+func splitContractKey(key string) (source, name string) {
+	index := strings.LastIndex(key, ":")
+	return key[:index], key[index+1:]
+}
+
+// loadContract finds contractName in <inputDir>/<contractName>.json.
+func loadContract(inputDir, contractName string) (contract, error) {
+	jsonName := filepath.Join(inputDir, contractName+".json")
+	compilationResult, err := readCombinedJSON(jsonName)
+	if err != nil {
+		return contract{}, err
+	}
+
+	// We're treating all the contracts as if they're in one namespace, so we're just
+	// referring to them by their contract name (and we only know the contract name)
+	// Given that, find the contract key from contractName.
+	contractKey := ""
+	for k := range compilationResult.Contracts {
+		if _, name := splitContractKey(k); name == contractName {
+			if contractKey != "" {
+				return contract{}, fmt.Errorf("multiple %v instances in %v", contractName, jsonName)
+			}
+			contractKey = k
+		}
+	}
+	if contractKey == "" {
+		return contract{}, fmt.Errorf("no %v instances in %v", contractName, jsonName)
+	}
+	source, _ := splitContractKey(contractKey)
+	return contract{
+		Name:           contractName,
+		Source:         source,
+		compiledOutput: compilationResult.Contracts[contractKey],
+		SourceList:     compilationResult.SourceList,
+	}, nil
+}
+
+// generator accumulates the files that Generate generates.
+type generator struct {
+	opts  Options
+	files []GeneratedFile
+}
+
+// generate generates all of the bindings for c.
+func (g *generator) generate(c contract) error {
+	contractName := c.Name
+	output := c.compiledOutput
+
+	// Generate bindings.
+	code, err := bind.Bind(
+		[]string{contractName},
+		[]string{output.ABI},
+		[]string{output.Bin},
+		g.opts.Package,
+		bind.LangGo)
+	if err != nil {
+		return errors.Wrap(err, "generating Go bindings")
+	}
+
+	parsedABI, err := abi.JSON(bytes.NewReader([]byte(output.ABI)))
+	if err != nil {
+		return errors.Wrap(err, "parsing ABI JSON")
+	}
+	docs, err := parseDocs(c)
+	if err != nil {
+		return err
+	}
+	layout, err := parseStorageLayout(c)
+	if err != nil {
+		return err
+	}
+
+	// Add NatSpec documentation and the input hash to the bindings.
+	hash := inputHash(c)
+	packageLine := "\n\npackage " + g.opts.Package
+	code = annotate(code, contractName, parsedABI, docs)
+	code = strings.Replace(code, packageLine, "\n// Input hash: "+hash+packageLine, 1)
+	g.files = append(g.files, GeneratedFile{
+		Path:    filepath.Join(g.opts.OutputDir, contractName+".go"),
+		Content: []byte(code),
+	})
+
+	data := map[string]interface{}{
+		"Package":    g.opts.Package,
+		"Contract":   contractName,
+		"Events":     parsedABI.Events,
+		"Methods":    parsedABI.Methods,
+		"Docs":       docs,
+		"InputHash":  hash,
+		"BinRuntime": output.BinRuntime,
+		"SourceMap":  newSourceMapData(c, g.opts.SourceDir),
+
+		"StorageLayout": storageLiteral(layout),
+	}
+
+	for _, file := range []struct {
+		suffix string
+		tmpl   *template.Template
+		what   string
+	}{
+		// String(), Contract() and EventName() functions for each event, and for each contract
+		// a <ContractName>Event sum type, a Parse<ContractName>Event(types.Log) function, and a
+		// <ContractName>Kind to register contracts with a bindutil.Router.
+		{"Events.go", eventsTemplate, "event bindings"},
+
+		// JSON encoders and schemas for each event.
+		{"EventsJSON.go", eventJSONTemplate, "event JSON encoders"},
+
+		// Revert-reason decoding and the checked (call-then-send) transactor.
+		{"Revert.go", revertTemplate, "revert bindings"},
+
+		// The <ContractName>Docs table of NatSpec documentation.
+		{"Docs.go", docsTemplate, "documentation table"},
+
+		// The <ContractName>SourceMap, which maps runtime PCs to Solidity source lines.
+		{"SourceMap.go", sourceMapTemplate, "source map"},
+
+		// The <ContractName>API interfaces, and the in-memory <ContractName>Fake.
+		{"Fake.go", fakeTemplate, "interfaces and fake"},
+
+		// Event topics and <ContractName><EventName>Filter builders.
+		{"Filters.go", filterTemplate, "event filters"},
+
+		// <ContractName>Code, to check deployed contracts against.
+		{"Code.go", codeTemplate, "deployed code check"},
+
+		// <ContractName>StorageLayout, to locate state variables in storage.
+		{"Storage.go", storageTemplate, "storage layout"},
+
+		// The <ContractName>Batch and <ContractName>Snapshot multicall readers.
+		{"Multicall.go", multicallTemplate, "multicall readers"},
+	} {
+		if err := g.addGoFile(contractName+file.suffix, file.tmpl, data, file.what); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addGoFile renders tmpl with data, runs the result through gofmt, and adds it to g.files as
+// <OutputDir>/<name>. `what` describes the file in error messages.
+func (g *generator) addGoFile(name string, tmpl *template.Template, data interface{}, what string) error {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return errors.Wrap(err, "generating "+what)
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "running gofmt on "+what)
+	}
+	g.files = append(g.files, GeneratedFile{Path: filepath.Join(g.opts.OutputDir, name), Content: code})
+	return nil
+}
+
+// templateFuncs are the helpers available to every template genabi renders.
+var templateFuncs = template.FuncMap{
+	"bindtype":     goType,
+	"capitalise":   abi.ToCamelCase,
+	"params":       params,
+	"args":         args,
+	"signature":    signature,
+	"encoding":     encoding,
+	"methoddoc":    methodDoc,
+	"quote":        quote,
+	"intlist":      intList,
+	"argname":      argName,
+	"callresults":  callResults,
+	"filterparams": filterParams,
+	"filterargs":   filterArgs,
+	"batchouts":    batchOuts,
+	"batchtarget":  batchTarget,
+	"snapshotted":  snapshotted,
+	"snapshottype": snapshotType,
+}
+
+// newTemplate parses one of genabi's templates, panicking if it is malformed.
+func newTemplate(source string) *template.Template {
+	return template.Must(template.New("").Funcs(templateFuncs).Parse(source))
+}
+
+// params renders a method's inputs as a Go parameter list, each preceded by a comma, naming
+// anonymous inputs the same way bind.Bind does.
+func params(inputs abi.Arguments) string {
+	result := ""
+	for i, input := range inputs {
+		result += fmt.Sprintf(", %v %v", argName(i, input), goType(input.Type))
+	}
+	return result
+}
+
+// args renders a method's inputs as a Go argument list, each preceded by a comma, using the names
+// given to them by params.
+func args(inputs abi.Arguments) string {
+	result := ""
+	for i, input := range inputs {
+		result += ", " + argName(i, input)
+	}
+	return result
+}
+
+// argName is the Go identifier bind.Bind uses for a method input.
+func argName(i int, input abi.Argument) string {
+	if input.Name == "" {
+		return fmt.Sprintf("arg%d", i)
+	}
+	return input.Name
+}
+
+// goType converts a Solidity type to the Go type bind.Bind uses for it. Sizes that Go has no
+// native integer for become *big.Int, and arrays and slices nest around their element type.
+func goType(kind abi.Type) string {
+	stringKind := kind.String()
+	inner := regexp.MustCompile(`^[a-z]+[0-9]*`).FindString(stringKind)
+
+	var mapped string
+	switch {
+	case inner == "address":
+		mapped = "common.Address"
+	case inner == "bool" || inner == "string":
+		mapped = inner
+	case strings.HasPrefix(inner, "bytes"):
+		mapped = fmt.Sprintf("[%v]byte", strings.TrimPrefix(inner, "bytes"))
+	case strings.HasPrefix(inner, "int") || strings.HasPrefix(inner, "uint"):
+		switch strings.TrimPrefix(strings.TrimPrefix(inner, "u"), "int") {
+		case "8", "16", "32", "64":
+			mapped = inner
+		default:
+			mapped = "*big.Int"
+		}
+	default:
+		mapped = inner
+	}
+
+	// Array sizes are listed innermost first in Solidity and outermost first in Go.
+	sizes := regexp.MustCompile(`\[(\d*)\]`).FindAllStringSubmatch(stringKind[len(inner):], -1)
+	for i := len(sizes) - 1; i >= 0; i-- {
+		mapped = "[" + sizes[i][1] + "]" + mapped
+	}
+	return mapped
+}
+
+var eventsTemplate = template.Must(template.New("").Funcs(
+	template.FuncMap{
+		"flags": func(inputs abi.Arguments) string {
+			result := make([]string, len(inputs))
+			for i := range result {
+				switch inputs[i].Type.String() {
+				case "string":
+					result[i] = "%q"
+				default:
+					result[i] = "%v"
+				}
+			}
+			return strings.Join(result, ", ")
+		},
+		"format": func(inputs abi.Arguments) string {
+			result := make([]string, len(inputs))
+			for i := range result {
+				arg := "e." + abi.ToCamelCase(inputs[i].Name)
+				switch inputs[i].Type.String() {
+				case "address":
+					arg = arg + ".Hex()"
+				}
+				result[i] = arg
+			}
+			return strings.Join(result, ",")
+		},
+	},
+).Parse(`
+// This file is auto-generated. Do not edit.
+// Input hash: {{.InputHash}}
+
+package {{.Package}}
+
+import (
+    "fmt"
+
+    "github.com/ethereum/go-ethereum/core/types"
+
+    "github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+{{$contract := .Contract}}
+
+// {{$contract}}Event is implemented by every event the {{$contract}} contract emits.
+type {{$contract}}Event interface {
+    bindutil.Event
+    is{{$contract}}Event()
+}
+
+// {{$contract}}Kind identifies {{$contract}} contracts to a bindutil.Router.
+var {{$contract}}Kind = bindutil.ContractKind{
+    Name: "{{$contract}}",
+    ParseEvent: func(log types.Log) (bindutil.Event, error) {
+        return Parse{{$contract}}Event(log)
+    },
+}
+
+// logUnpacker{{$contract}} unpacks {{$contract}} logs for Parse{{$contract}}Event.
+var logUnpacker{{$contract}} = bindutil.NewLogUnpacker({{$contract}}ABI)
+
+// Parse{{$contract}}Event decodes log, which must have been emitted by a {{$contract}} contract,
+// into the corresponding {{$contract}}<Event> type.
+func Parse{{$contract}}Event(log types.Log) ({{$contract}}Event, error) {
+    if len(log.Topics) == 0 {
+        return nil, fmt.Errorf("anonymous log for {{$contract}}")
+    }
+    switch log.Topics[0] {
+    {{- range .Events}}
+    case {{$contract}}{{.Name}}Topic:
+        event := new({{$contract}}{{.Name}})
+        if err := logUnpacker{{$contract}}.UnpackLog(event, "{{.Name}}", log); err != nil {
+            return nil, err
+        }
+        event.Raw = log
+        return event, nil
+    {{- end}}
+    default:
+        return nil, fmt.Errorf("no such event hash for {{$contract}}: %v", log.Topics[0])
+    }
+}
+
+// ParseLog decodes log like Parse{{$contract}}Event does.
+func (c *{{$contract}}Filterer) ParseLog(log *types.Log) (fmt.Stringer, error) {
+    event, err := Parse{{$contract}}Event(*log)
+    if err != nil {
+        return nil, err
+    }
+    return event, nil
+}
+
+{{range .Events}}
+func (e {{$contract}}{{.Name}}) String() string {
+    return fmt.Sprintf("{{$contract}}.{{.Name}}({{flags .Inputs}})",{{format .Inputs}})
+}
+
+// Contract returns "{{$contract}}".
+func ({{$contract}}{{.Name}}) Contract() string { return "{{$contract}}" }
+
+// EventName returns "{{.Name}}".
+func ({{$contract}}{{.Name}}) EventName() string { return "{{.Name}}" }
+
+func ({{$contract}}{{.Name}}) is{{$contract}}Event() {}
+{{end}}
+`))
@@ -0,0 +1,335 @@
+package genabi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+// counterABI is the ABI of a small contract with a view method, a transaction, and an event.
+const counterABI = `[
+	{"constant":true,"inputs":[],"name":"count","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},
+	{"constant":false,"inputs":[{"name":"by","type":"uint256"}],"name":"increment","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},
+	{"anonymous":false,"inputs":[{"indexed":true,"name":"by","type":"address"},{"indexed":false,"name":"amount","type":"uint256"}],"name":"Incremented","type":"event"}
+]`
+
+// writeCounter writes solc combined-json output for a Counter contract with the given ABI, and
+// NatSpec for increment, to <dir>/Counter.json.
+func writeCounter(t *testing.T, dir, abiJSON string) {
+	quoted, err := json.Marshal(abiJSON)
+	require.NoError(t, err)
+	output := `{
+		"contracts": {"contracts/Counter.sol:Counter": {
+			"abi": ` + string(quoted) + `,
+			"bin": "6080604052",
+			"bin-runtime": "60806040",
+			"srcmap-runtime": "",
+			"userdoc": "{\"methods\":{\"increment(uint256)\":{\"notice\":\"Adds by to the count.\"}},\"notice\":\"Counts.\"}",
+			"devdoc": "{\"methods\":{},\"title\":\"A counter\"}"
+		}},
+		"sourceList": ["contracts/Counter.sol"]
+	}`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Counter.json"), []byte(output), 0644))
+}
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genabi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "evm"), filepath.Join(dir, "bindings")
+	require.NoError(t, os.Mkdir(in, 0755))
+	writeCounter(t, in, counterABI)
+
+	opts := Options{Combined: in, OutputDir: out, Package: "bindings"}
+	files, err := Generate(opts)
+	require.NoError(t, err)
+
+	paths := make(map[string][]byte)
+	for _, f := range files {
+		paths[f.Path] = f.Content
+	}
+	for _, name := range []string{"Counter.go", "CounterEvents.go", "CounterMulticall.go", "index.go"} {
+		content, ok := paths[filepath.Join(out, name)]
+		if assert.True(t, ok, name) {
+			assert.Contains(t, string(content), "\npackage bindings\n", name)
+		}
+	}
+	_, err = os.Stat(out)
+	assert.True(t, os.IsNotExist(err), "Generate should not write anything")
+
+	// Once written, the bindings verify, until one is edited or an unexpected file appears.
+	require.NoError(t, WriteFiles(files))
+	problems, generated, err := Verify(opts)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+	assert.Equal(t, len(files), generated)
+
+	edited := filepath.Join(out, "CounterDocs.go")
+	lastLine := strconv.Itoa(bytes.Count(paths[edited], []byte("\n")) + 1)
+	require.NoError(t, ioutil.WriteFile(edited, append(paths[edited], "// edited\n"...), 0644))
+	extra := filepath.Join(out, "Extra.go")
+	require.NoError(t, ioutil.WriteFile(extra, []byte("package bindings\n"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(out, "CounterCode.go")))
+
+	problems, _, err = Verify(opts)
+	require.NoError(t, err)
+	assert.Equal(t, []Problem{
+		{filepath.Join(out, "CounterCode.go"), "missing"},
+		{edited, "edited, or generated by a different genABI: first difference at line " + lastLine},
+		{extra, "not generated from any contract in " + in},
+	}, problems)
+
+	// Named contracts are read from InputDir, and get no package index.
+	files, err = Generate(Options{InputDir: in, Contracts: []string{"Counter"}, OutputDir: out})
+	require.NoError(t, err)
+	for _, f := range files {
+		assert.NotEqual(t, filepath.Join(out, "index.go"), f.Path)
+		assert.Contains(t, string(f.Content), "\npackage abi\n", f.Path)
+	}
+
+	_, err = Generate(Options{InputDir: in, Contracts: []string{"Missing"}})
+	assert.Error(t, err)
+	_, err = Generate(Options{})
+	assert.EqualError(t, err, "no contracts to generate bindings for")
+}
+
+func TestCompat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genabi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeCounter(t, dir, counterABI)
+	baseline := filepath.Join(dir, "baseline.json")
+	require.NoError(t, ioutil.WriteFile(baseline, []byte(`[
+		{"constant":true,"inputs":[],"name":"count","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+		{"constant":false,"inputs":[],"name":"reset","outputs":[],"type":"function"}
+	]`), 0644))
+
+	report, err := Compat(Options{InputDir: dir}, baseline, "Counter")
+	require.NoError(t, err)
+	assert.Equal(t, "baseline", report.Old)
+	assert.Equal(t, "Counter", report.New)
+	assert.True(t, report.Breaking())
+
+	var buf bytes.Buffer
+	report.Write(&buf)
+	assert.Equal(t, `baseline -> Counter: 3 changes
+BREAKING  removed function    reset()
+ok        added event         Incremented(address,uint256): topic 0x38ac789ed44572701765277c4d0970f2db1c1a571ed39e84358095ae4eaa5420
+ok        added function      increment(uint256)
+`, buf.String())
+
+	report, err = Compat(Options{InputDir: dir}, "Counter", filepath.Join(dir, "Counter.json"))
+	require.NoError(t, err)
+	assert.Empty(t, report.Changes)
+	assert.False(t, report.Breaking())
+
+	_, err = Compat(Options{InputDir: dir}, "Counter", filepath.Join(dir, "Counter.json:Other"))
+	assert.EqualError(t, err, "no Other instances in "+filepath.Join(dir, "Counter.json"))
+
+	// Events are told apart by signature, like their topics: of two overloads, only the one whose
+	// indexing changed is reported, and an event whose parameters changed is removed, with its
+	// replacement added.
+	event := func(name string, indexed ...bool) string {
+		var inputs []string
+		for i, indexed := range indexed {
+			inputs = append(inputs, `{"indexed":`+strconv.FormatBool(indexed)+`,"name":"a`+strconv.Itoa(i)+`","type":"address"}`)
+		}
+		return `{"anonymous":false,"inputs":[` + strings.Join(inputs, ",") + `],"name":"` + name + `","type":"event"}`
+	}
+	oldEvents := filepath.Join(dir, "old.json")
+	require.NoError(t, ioutil.WriteFile(oldEvents, []byte(
+		"["+event("Moved", true)+","+event("Moved", true, true)+","+event("Named", true)+"]",
+	), 0644))
+	newEvents := filepath.Join(dir, "new.json")
+	require.NoError(t, ioutil.WriteFile(newEvents, []byte(
+		"["+event("Moved", true)+","+event("Moved", true, false)+","+event("Named", true, true)+"]",
+	), 0644))
+	report, err = Compat(Options{InputDir: dir}, oldEvents, newEvents)
+	require.NoError(t, err)
+	topic := func(sig string) string { return crypto.Keccak256Hash([]byte(sig)).Hex() }
+	assert.Equal(t, []Change{
+		{true, "changed indexing", "Moved(address,address)", "(indexed,indexed) -> (indexed,_)"},
+		{true, "removed event", "Named(address)", "topic " + topic("Named(address)") + "; now Named(address,address)"},
+		{false, "added event", "Named(address,address)", "topic " + topic("Named(address,address)")},
+	}, report.Changes)
+}
+
+func TestLayouts(t *testing.T) {
+	load := func(name string) *bindutil.StorageLayout {
+		c := contract{Name: name}
+		require.NoError(t, addLayout(filepath.Join("..", "layouts"), &c))
+		layout, err := parseStorageLayout(c)
+		require.NoError(t, err)
+		require.NotNil(t, layout, name)
+		return layout
+	}
+	pad := func(a common.Address) []byte { return common.LeftPadBytes(a[:], 32) }
+	word := func(n int64) []byte { return common.BigToHash(big.NewInt(n)).Bytes() }
+
+	// ReserveEternalStorage keeps balance and allowed after Ownable's two addresses and
+	// reserveAddress.
+	eternalStorage := load("ReserveEternalStorage")
+	holder, spender := common.Address{1}, common.Address{2}
+	slot, _, err := eternalStorage.Slot("balance", holder)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.Keccak256Hash(pad(holder), word(3)), slot)
+	slot, _, err = eternalStorage.Slot("allowed", holder, spender)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.Keccak256Hash(pad(spender), crypto.Keccak256(pad(holder), word(4))), slot)
+
+	// Reserve packs minter in with paused, and ReserveV2 keeps Reserve's storage.
+	reserve := load("Reserve")
+	slot, offset, err := reserve.Slot("minter")
+	require.NoError(t, err)
+	assert.Equal(t, common.BytesToHash(word(7)), slot)
+	assert.Equal(t, 1, offset)
+	assert.Empty(t, reserve.Changes(load("ReserveV2")))
+
+	// A checked-in layout doesn't replace solc's, and a contract with neither has none.
+	fromSolc := json.RawMessage(`{"storage":[],"types":{}}`)
+	c := contract{Name: "Reserve", compiledOutput: compiledOutput{StorageLayout: fromSolc}}
+	require.NoError(t, addLayout(filepath.Join("..", "layouts"), &c))
+	assert.Equal(t, fromSolc, c.StorageLayout)
+	c = contract{Name: "Manager"}
+	require.NoError(t, addLayout(filepath.Join("..", "layouts"), &c))
+	assert.Nil(t, c.StorageLayout)
+
+	// Generated bindings include the checked-in layout.
+	dir, err := ioutil.TempDir("", "genabi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeCounter(t, dir, counterABI)
+	layouts := filepath.Join(dir, "layouts")
+	require.NoError(t, os.Mkdir(layouts, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(layouts, "Counter.json"), []byte(`{
+		"storage": [{"label": "count", "offset": 0, "slot": "0", "type": "t_uint256"}],
+		"types": {"t_uint256": {"encoding": "inplace", "label": "uint256", "numberOfBytes": "32"}}
+	}`), 0644))
+	files, err := Generate(Options{InputDir: dir, Contracts: []string{"Counter"}, LayoutDir: layouts, OutputDir: dir})
+	require.NoError(t, err)
+	found := false
+	for _, f := range files {
+		if f.Path == filepath.Join(dir, "CounterStorage.go") {
+			found = true
+			assert.Contains(t, string(f.Content), `{Label: "count", Slot: 0, Offset: 0, Type: "t_uint256"}`)
+		}
+	}
+	assert.True(t, found, "no CounterStorage.go")
+}
+
+func TestLoadBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genabi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	const erc20ABI = `[{"constant":true,"inputs":[],"name":"totalSupply","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"}]`
+	abis := map[string]string{"ERC20": erc20ABI, "Counter": counterABI, "SafeMath": "[]"}
+
+	// write writes combined-json output to <dir>/<name>, of a contract for each key, each with
+	// the ABI in abis of the contract it names, and bin as its bytecode.
+	write := func(name, bin string, keys ...string) string {
+		contracts := make(map[string]compiledOutput)
+		for _, key := range keys {
+			_, contractName := splitContractKey(key)
+			contracts[key] = compiledOutput{ABI: abis[contractName], Bin: bin}
+		}
+		output, err := json.Marshal(map[string]interface{}{"contracts": contracts, "sourceList": []string{}})
+		require.NoError(t, err)
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, output, 0644))
+		return path
+	}
+	const erc20 = "contracts/zeppelin/token/ERC20/ERC20.sol:ERC20"
+
+	// Both files define ERC20, from the same source. It is bound once, from ERC20.json, which was
+	// compiled for it, and the SafeMath library, which has no ABI, not at all.
+	write("Counter.json", "c0", "contracts/Counter.sol:Counter", erc20, "contracts/zeppelin/math/SafeMath.sol:SafeMath")
+	write("ERC20.json", "e0", erc20)
+	contracts, err := loadBatch(dir)
+	require.NoError(t, err)
+	require.Len(t, contracts, 2)
+	assert.Equal(t, "Counter", contracts[0].Name)
+	assert.Equal(t, "ERC20", contracts[1].Name)
+	assert.Equal(t, "contracts/zeppelin/token/ERC20/ERC20.sol", contracts[1].Source)
+	assert.Equal(t, "e0", contracts[1].Bin)
+
+	// A single file is loaded on its own.
+	contracts, err = loadBatch(filepath.Join(dir, "Counter.json"))
+	require.NoError(t, err)
+	require.Len(t, contracts, 2)
+	assert.Equal(t, "c0", contracts[1].Bin)
+
+	// An ERC20 from another source, or with another ABI, would collide with it.
+	other := write("Other.json", "o0", "contracts/other/ERC20.sol:ERC20")
+	_, err = loadBatch(dir)
+	assert.EqualError(t, err, "multiple ERC20 instances: contracts/zeppelin/token/ERC20/ERC20.sol in "+
+		filepath.Join(dir, "ERC20.json")+" and contracts/other/ERC20.sol in "+other)
+	require.NoError(t, os.Remove(other))
+	abis["ERC20"] = counterABI
+	write("Other.json", "o0", erc20)
+	_, err = loadBatch(dir)
+	assert.Error(t, err)
+}
+
+func TestTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genabi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	in, templates, out := filepath.Join(dir, "evm"), filepath.Join(dir, "templates"), filepath.Join(dir, "generated")
+	require.NoError(t, os.Mkdir(in, 0755))
+	require.NoError(t, os.Mkdir(templates, 0755))
+	writeCounter(t, in, counterABI)
+	for name, source := range map[string]string{
+		// Executed for each contract.
+		"Summary.txt.tmpl": `{{.Name}} {{.Source}} {{.Bin}} {{.BinRuntime}} {{.Docs.Title}}: {{.Docs.Notice}}
+{{range .Methods}}{{.Signature}} {{.Selector}} {{.Mutability}} {{.Const}} {{.GoName}}: {{.Docs.Notice}}
+{{end}}{{range .Events}}{{.Signature}} {{.Topic}} {{.GoName}}{{range .Inputs}} {{snake .GoName}}:{{.Type}}:{{.Indexed}}{{end}}
+{{end}}`,
+		// Executed once.
+		"_contracts.txt.tmpl": `{{range .Contracts}}{{.Name}} {{end}}`,
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(templates, name), []byte(source), 0644))
+	}
+
+	files, err := Generate(Options{Combined: in, OutputDir: dir, TemplatesDir: templates, TemplatesOutputDir: out})
+	require.NoError(t, err)
+	paths := make(map[string]string)
+	for _, f := range files {
+		paths[f.Path] = string(f.Content)
+	}
+	assert.Equal(t, `Counter contracts/Counter.sol 6080604052 60806040 A counter: Counts.
+count() 0x06661abd view true Count: 
+increment(uint256) 0x7cf5dab0 nonpayable false Increment: Adds by to the count.
+Incremented(address,uint256) `+crypto.Keccak256Hash([]byte("Incremented(address,uint256)")).Hex()+` CounterIncremented by:address:true amount:uint256:false
+`, paths[filepath.Join(out, "CounterSummary.txt")])
+	assert.Equal(t, "Counter ", paths[filepath.Join(out, "contracts.txt")])
+
+	// Of overloaded functions, the one that is bound has its own mutability.
+	writeCounter(t, in, `[
+		{"constant":true,"inputs":[{"name":"of","type":"address"}],"name":"count","outputs":[{"name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},
+		{"constant":false,"inputs":[],"name":"count","outputs":[],"payable":true,"stateMutability":"payable","type":"function"}
+	]`)
+	files, err = Generate(Options{Combined: in, OutputDir: dir, TemplatesDir: templates, TemplatesOutputDir: out})
+	require.NoError(t, err)
+	found := false
+	for _, f := range files {
+		if f.Path == filepath.Join(out, "CounterSummary.txt") {
+			found = true
+			assert.Contains(t, string(f.Content), "\ncount() 0x06661abd payable false Count: \n")
+		}
+	}
+	assert.True(t, found, "no CounterSummary.txt")
+}
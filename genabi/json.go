@@ -0,0 +1,90 @@
+package genabi
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// eventJSONTemplate generates, for each event, a Schema method describing it and
+// MarshalJSON/UnmarshalJSON methods that encode it according to that schema, so that events
+// can be exported losslessly.
+var eventJSONTemplate = newTemplate(`
+// This file is auto-generated. Do not edit.
+// Input hash: {{.InputHash}}
+
+package {{.Package}}
+
+import "github.com/reserve-protocol/rsv-beta/bindutil"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = bindutil.MarshalEvent
+
+{{$contract := .Contract}}
+
+{{range .Events}}
+// Schema describes {{$contract}}{{.Name}} and its JSON encoding.
+func ({{$contract}}{{.Name}}) Schema() bindutil.EventSchema {
+    return schema{{$contract}}{{.Name}}
+}
+
+// MarshalJSON implements json.Marshaler, encoding the event as described by its Schema.
+func (e {{$contract}}{{.Name}}) MarshalJSON() ([]byte, error) {
+    return bindutil.MarshalEvent(e, e.Schema())
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding the encoding described by the event's Schema.
+func (e *{{$contract}}{{.Name}}) UnmarshalJSON(data []byte) error {
+    return bindutil.UnmarshalEvent(data, e, e.Schema())
+}
+
+var schema{{$contract}}{{.Name}} = bindutil.EventSchema{
+    Contract:  "{{$contract}}",
+    Event:     "{{.Name}}",
+    Signature: "{{signature .}}",
+    Topic:     {{$contract}}{{.Name}}Topic,
+    Fields: []bindutil.FieldSchema{
+        {{- range .Inputs}}
+        {Name: "{{.Name}}", GoName: "{{capitalise .Name}}", Type: "{{.Type}}", Indexed: {{.Indexed}}, Encoding: bindutil.{{encoding .}}},
+        {{- end}}
+    },
+}
+{{end}}
+`)
+
+// signature is the canonical signature of event, whose Keccak-256 hash is its first log topic.
+func signature(event abi.Event) string {
+	types := make([]string, len(event.Inputs))
+	for i, input := range event.Inputs {
+		types[i] = input.Type.String()
+	}
+	return fmt.Sprintf("%v(%v)", event.Name, strings.Join(types, ","))
+}
+
+// encoding names the bindutil.Encoding* constant that describes how bindutil.MarshalEvent writes
+// an event argument.
+func encoding(arg abi.Argument) string {
+	// Indexed strings and byte strings are only available as the hash stored in their topic.
+	bound := goType(arg.Type)
+	if arg.Indexed && (bound == "string" || bound == "[]byte") {
+		return "EncodingHex"
+	}
+
+	element := regexp.MustCompile(`^[a-z]+[0-9]*`).FindString(arg.Type.String())
+	switch {
+	case element == "address":
+		return "EncodingAddress"
+	case element == "bool":
+		return "EncodingBool"
+	case element == "string":
+		return "EncodingString"
+	case strings.HasPrefix(element, "bytes"):
+		return "EncodingHex"
+	case strings.HasSuffix(bound, "*big.Int"):
+		return "EncodingDecimal"
+	default:
+		return "EncodingNumber"
+	}
+}
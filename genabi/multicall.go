@@ -0,0 +1,147 @@
+package genabi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// batchOuts renders the result parameters of the batched binding of a constant method: a
+// pointer to the struct bind.Bind returns if the outputs are structured, and a pointer to each
+// output otherwise.
+func batchOuts(method abi.Method) string {
+	if structured(method.Outputs) {
+		return "out *" + strings.TrimSuffix(strings.TrimPrefix(callResults(method, false), "("), ", error)")
+	}
+	if len(method.Outputs) == 1 {
+		return "out *" + goType(method.Outputs[0].Type)
+	}
+	outs := make([]string, len(method.Outputs))
+	for i, output := range method.Outputs {
+		outs[i] = fmt.Sprintf("out%d *%v", i, goType(output.Type))
+	}
+	return strings.Join(outs, ", ")
+}
+
+// batchTarget renders the value that the results of a constant method are unpacked into, using
+// the parameters that batchOuts declares.
+func batchTarget(method abi.Method) string {
+	if structured(method.Outputs) || len(method.Outputs) == 1 {
+		return "out"
+	}
+	outs := make([]string, len(method.Outputs))
+	for i := range method.Outputs {
+		outs[i] = fmt.Sprintf("out%d", i)
+	}
+	return "&[]interface{}{" + strings.Join(outs, ", ") + "}"
+}
+
+// snapshotted reports whether a method's result is included in its contract's snapshot: it must
+// be a constant method that takes no arguments and returns a single value, or a struct.
+func snapshotted(method abi.Method) bool {
+	return method.Const && len(method.Inputs) == 0 && (len(method.Outputs) == 1 || structured(method.Outputs))
+}
+
+// snapshotType renders the Go type of a snapshotted method's result.
+func snapshotType(method abi.Method) string {
+	return strings.TrimPrefix(batchOuts(method), "out *")
+}
+
+// multicallTemplate generates, for each contract, a <Contract>Batch binding that queues calls to
+// the contract's view methods on a bindutil.Multicall, and a <Contract>Snapshot of every view
+// method without arguments, so that many values can be read from one block in one round trip.
+var multicallTemplate = newTemplate(`
+// This file is auto-generated. Do not edit.
+// Input hash: {{.InputHash}}
+
+package {{.Package}}
+
+import (
+    "context"
+    "math/big"
+    "strings"
+
+    "github.com/ethereum/go-ethereum/accounts/abi"
+    "github.com/ethereum/go-ethereum/common"
+
+    "github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+    _ = context.Background
+    _ = big.NewInt
+    _ = common.Big1
+)
+
+{{$contract := .Contract}}
+
+// {{$contract}}Batch queues calls to the view methods of a deployed {{$contract}} contract on a
+// bindutil.Multicall. Each method unpacks its results into the given pointers once the
+// Multicall's calls are made, by its Do method.
+type {{$contract}}Batch struct {
+    multicall *bindutil.Multicall
+    address   common.Address
+    abi       abi.ABI
+}
+
+// New{{$contract}}Batch creates a {{$contract}}Batch that queues calls to the {{$contract}} at
+// address on multicall.
+func New{{$contract}}Batch(address common.Address, multicall *bindutil.Multicall) (*{{$contract}}Batch, error) {
+    parsed, err := abi.JSON(strings.NewReader({{$contract}}ABI))
+    if err != nil {
+        return nil, err
+    }
+    return &{{$contract}}Batch{multicall: multicall, address: address, abi: parsed}, nil
+}
+
+{{range .Methods}}{{if and .Const .Outputs}}
+// {{capitalise .Name}} queues a call to the contract method 0x{{printf "%x" .Id}}.
+//
+// Solidity: {{.String}}
+func (_{{$contract}} *{{$contract}}Batch) {{capitalise .Name}}({{batchouts .}}{{params .Inputs}}) error {
+    return _{{$contract}}.multicall.Add("{{$contract}}", _{{$contract}}.abi, _{{$contract}}.address, {{batchtarget .}}, "{{.Name}}"{{args .Inputs}})
+}
+{{end}}{{end}}
+
+// {{$contract}}Snapshot holds the results of every view method of a {{$contract}} contract that
+// takes no arguments, read from a single block.
+type {{$contract}}Snapshot struct {
+    // BlockNumber is the number of the block the snapshot was read from.
+    BlockNumber *big.Int
+    {{range .Methods}}{{if snapshotted .}}
+    {{capitalise .Name}} {{snapshottype .}}
+    {{- end}}{{end}}
+}
+
+// Snapshot queues the calls that fill in every field of out but BlockNumber, which is the block
+// number that the Multicall's Do method returns.
+func (_{{$contract}} *{{$contract}}Batch) Snapshot(out *{{$contract}}Snapshot) error {
+    {{- range .Methods}}{{if snapshotted .}}
+    if err := _{{$contract}}.{{capitalise .Name}}(&out.{{capitalise .Name}}); err != nil {
+        return err
+    }
+    {{- end}}{{end}}
+    return nil
+}
+
+// Read{{$contract}}Snapshot reads a {{$contract}}Snapshot of the {{$contract}} at address in a
+// single eth_call through multicall, as of blockNumber, or the latest block if that is nil.
+// Calls already queued on multicall are made too.
+func Read{{$contract}}Snapshot(ctx context.Context, multicall *bindutil.Multicall, address common.Address, blockNumber *big.Int) (*{{$contract}}Snapshot, error) {
+    batch, err := New{{$contract}}Batch(address, multicall)
+    if err != nil {
+        return nil, err
+    }
+    snapshot := new({{$contract}}Snapshot)
+    if err := batch.Snapshot(snapshot); err != nil {
+        return nil, err
+    }
+    snapshot.BlockNumber, err = multicall.Do(ctx, blockNumber)
+    if err != nil {
+        return nil, err
+    }
+    return snapshot, nil
+}
+`)
@@ -0,0 +1,275 @@
+package genabi
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/format"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+// Template plugins let teams generate their own artifacts, such as GraphQL schemas, SQL tables
+// for events, or TypeScript types, in the same pass that generates the Go bindings:
+//
+//	go run . -combined evm -templates graphql/ -templates-out graphql/generated
+//
+// Every *.tmpl file in Options.TemplatesDir is a text/template. Most are executed once per
+// contract, with a templateContract, and written to <TemplatesOutputDir>/<Contract><name>, where
+// name is the file name without ".tmpl"; for example, Events.graphql.tmpl writes
+// ManagerEvents.graphql. Templates whose file names start with "_" are instead executed once,
+// with a templateIndex of every contract, and written to <TemplatesOutputDir>/<name> without the
+// "_"; for example, _schema.sql.tmpl writes schema.sql. Output that is only whitespace is not
+// written, so a template can skip contracts, and output to .go files is run through gofmt.
+//
+// Templates can use the functions genabi's own templates use, such as bindtype and capitalise,
+// plus lower, upper, snake, join, replace, hasPrefix, hasSuffix, trimPrefix, and json.
+
+// templateIndex is the data that "_"-prefixed templates are executed with.
+type templateIndex struct {
+	Contracts []templateContract // Every contract, sorted by name.
+}
+
+// templateContract is the data that per-contract templates are executed with.
+type templateContract struct {
+	Name       string // Contract name, e.g. "Manager".
+	Source     string // Solidity source file, e.g. "contracts/Manager.sol".
+	ABI        string // JSON ABI.
+	Bin        string // Deployment bytecode, in hex without 0x, or "" for abstract contracts.
+	BinRuntime string // Runtime bytecode, in hex without 0x, as deployed on chain.
+	InputHash  string // Hash of the ABI, bytecode, and storage layout, as in generated Go files.
+
+	Constructor []templateArg         // Constructor parameters.
+	Methods     []templateMethod      // Functions, sorted by name; of overloads, only the last, as bound in Go.
+	Events      []templateEvent       // Events, sorted by name.
+	Docs        bindutil.ContractDocs // Contract-level NatSpec; member docs are on each method and event.
+
+	// StorageLayout is the contract's storage layout, or nil if it has none, from solc or
+	// Options.LayoutDir.
+	StorageLayout *bindutil.StorageLayout
+}
+
+// templateMethod describes a contract function.
+type templateMethod struct {
+	Name       string // Solidity name, e.g. "proposeSwap".
+	GoName     string // Name of the Go binding method, e.g. "ProposeSwap".
+	Signature  string // Canonical signature, e.g. "proposeSwap(address[],uint256[],bool[])".
+	Selector   string // 4-byte selector, in hex with 0x.
+	Mutability string // "pure", "view", "nonpayable", or "payable".
+	Const      bool   // Whether the function is pure or view, and so called rather than sent.
+	Inputs     []templateArg
+	Outputs    []templateArg
+	Docs       bindutil.MemberDocs
+}
+
+// templateEvent describes a contract event.
+type templateEvent struct {
+	Name      string // Solidity name, e.g. "Issuance".
+	GoName    string // Name of the Go event struct, e.g. "ManagerIssuance".
+	Signature string // Canonical signature, e.g. "Issuance(address,uint256)".
+	Topic     string // Hash of the signature, in hex with 0x; the first topic of non-anonymous events.
+	Anonymous bool
+	Inputs    []templateArg
+	Docs      bindutil.MemberDocs
+}
+
+// templateArg describes a parameter, return value, or event field.
+type templateArg struct {
+	Name    string // Solidity name, or arg<i> for unnamed parameters.
+	GoName  string // Name of the field that holds it in Go structs, e.g. "Amount".
+	Type    string // Canonical Solidity type, e.g. "uint256" or "address[]".
+	GoType  string // Go type of its binding, e.g. "*big.Int" or "[]common.Address".
+	Indexed bool   // Whether an event field is indexed, and so stored in a topic.
+}
+
+// templateExtraFuncs are the helpers plugin templates can use beyond templateFuncs.
+var templateExtraFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"snake":      snakeCase,
+	"join":       strings.Join,
+	"replace":    strings.Replace,
+	"hasPrefix":  strings.HasPrefix,
+	"hasSuffix":  strings.HasSuffix,
+	"trimPrefix": strings.TrimPrefix,
+	"json": func(v interface{}) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+var snakeBoundary = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// snakeCase converts a camelCase or PascalCase name to snake_case, e.g. "proposeSwap" to
+// "propose_swap".
+func snakeCase(name string) string {
+	return strings.ToLower(snakeBoundary.ReplaceAllString(name, "${1}_${2}"))
+}
+
+// executeTemplates executes the plugin templates in dir for contracts, and returns their output,
+// which belongs in outDir.
+func executeTemplates(dir, outDir string, contracts []contract) ([]GeneratedFile, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing templates in "+dir)
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	index := templateIndex{}
+	for _, c := range contracts {
+		data, err := newTemplateContract(c)
+		if err != nil {
+			return nil, err
+		}
+		index.Contracts = append(index.Contracts, data)
+	}
+	sort.Slice(index.Contracts, func(i, j int) bool { return index.Contracts[i].Name < index.Contracts[j].Name })
+
+	var files []GeneratedFile
+	add := func(path string, tmpl *template.Template, data interface{}) error {
+		file, err := executeTemplate(path, tmpl, data)
+		if err == nil && file != nil {
+			files = append(files, *file)
+		}
+		return err
+	}
+	for _, path := range paths {
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading "+path)
+		}
+		tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Funcs(templateExtraFuncs).Parse(string(source))
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing "+path)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+		if strings.HasPrefix(name, "_") {
+			if err := add(filepath.Join(outDir, strings.TrimPrefix(name, "_")), tmpl, index); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, c := range index.Contracts {
+			if err := add(filepath.Join(outDir, c.Name+name), tmpl, c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// executeTemplate executes tmpl with data, into a file that belongs at path. It returns nil if
+// the output is only whitespace.
+func executeTemplate(path string, tmpl *template.Template, data interface{}) (*GeneratedFile, error) {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, errors.Wrap(err, "executing template "+tmpl.Name())
+	}
+	output := buf.Bytes()
+	if len(bytes.TrimSpace(output)) == 0 {
+		return nil, nil
+	}
+	if strings.HasSuffix(path, ".go") {
+		var err error
+		output, err = format.Source(output)
+		if err != nil {
+			return nil, errors.Wrap(err, "running gofmt on the output of template "+tmpl.Name())
+		}
+	}
+	return &GeneratedFile{Path: path, Content: output}, nil
+}
+
+// newTemplateContract builds the data that plugin templates are executed with for c.
+func newTemplateContract(c contract) (templateContract, error) {
+	parsed, err := abi.JSON(strings.NewReader(c.ABI))
+	if err != nil {
+		return templateContract{}, errors.Wrap(err, "parsing ABI of "+c.Name)
+	}
+	docs, err := parseDocs(c)
+	if err != nil {
+		return templateContract{}, err
+	}
+	layout, err := parseStorageLayout(c)
+	if err != nil {
+		return templateContract{}, err
+	}
+	entries, err := parseABIEntries(c.Name, c.ABI)
+	if err != nil {
+		return templateContract{}, err
+	}
+
+	// Keyed by signature, so that an overloaded function gets its own mutability.
+	mutability := make(map[string]string)
+	for _, entry := range entries {
+		if entry.Type == "function" {
+			mutability[entry.signature()] = entry.mutability()
+		}
+	}
+
+	data := templateContract{
+		Name:          c.Name,
+		Source:        c.Source,
+		ABI:           c.ABI,
+		Bin:           c.Bin,
+		BinRuntime:    c.BinRuntime,
+		InputHash:     inputHash(c),
+		Constructor:   templateArgs(parsed.Constructor.Inputs),
+		Docs:          bindutil.ContractDocs{Title: docs.Title, Author: docs.Author, Notice: docs.Notice, Details: docs.Details},
+		StorageLayout: layout,
+	}
+	for _, method := range parsed.Methods {
+		data.Methods = append(data.Methods, templateMethod{
+			Name:       method.Name,
+			GoName:     abi.ToCamelCase(method.Name),
+			Signature:  method.Sig(),
+			Selector:   hexutil.Encode(method.Id()),
+			Mutability: mutability[method.Sig()],
+			Const:      method.Const,
+			Inputs:     templateArgs(method.Inputs),
+			Outputs:    templateArgs(method.Outputs),
+			Docs:       docs.Methods[method.Sig()],
+		})
+	}
+	for _, event := range parsed.Events {
+		data.Events = append(data.Events, templateEvent{
+			Name:      event.Name,
+			GoName:    c.Name + event.Name,
+			Signature: signature(event),
+			Topic:     event.Id().Hex(),
+			Anonymous: event.Anonymous,
+			Inputs:    templateArgs(event.Inputs),
+			Docs:      docs.Events[signature(event)],
+		})
+	}
+	sort.Slice(data.Methods, func(i, j int) bool { return data.Methods[i].Name < data.Methods[j].Name })
+	sort.Slice(data.Events, func(i, j int) bool { return data.Events[i].Name < data.Events[j].Name })
+	return data, nil
+}
+
+// templateArgs describes arguments for plugin templates.
+func templateArgs(args abi.Arguments) []templateArg {
+	var result []templateArg
+	for i, arg := range args {
+		name := argName(i, arg)
+		result = append(result, templateArg{
+			Name:    name,
+			GoName:  abi.ToCamelCase(name),
+			Type:    arg.Type.String(),
+			GoType:  goType(arg.Type),
+			Indexed: arg.Indexed,
+		})
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package genabi
+
+// revertTemplate generates, for each contract, a DecodeRevert method that turns `Error(string)`
+// revert payloads into *bindutil.RevertError values, and a <Contract>Checked binding whose
+// mutators simulate each transaction before sending it.
+var revertTemplate = newTemplate(`
+// This file is auto-generated. Do not edit.
+// Input hash: {{.InputHash}}
+
+package {{.Package}}
+
+import (
+    "math/big"
+    "strings"
+
+    "github.com/ethereum/go-ethereum/accounts/abi"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+
+    "github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+    _ = big.NewInt
+    _ = common.Big1
+    _ = types.BloomLookup
+)
+
+{{$contract := .Contract}}
+
+// DecodeRevert decodes the return data of a reverted call to the {{$contract}} contract.
+// It returns a *bindutil.RevertError carrying the require message if data is an Error(string)
+// payload, and nil otherwise.
+func (_{{$contract}} *{{$contract}}Transactor) DecodeRevert(data []byte) error {
+    return bindutil.DecodeRevert("{{$contract}}", data)
+}
+
+// {{$contract}}Checked is a {{$contract}} binding whose mutators simulate each transaction with
+// eth_call before broadcasting it. A transaction that would revert with a reason is never sent;
+// the mutator returns a *bindutil.RevertError instead.
+type {{$contract}}Checked struct {
+    *{{$contract}}
+    address common.Address
+    caller  bind.ContractCaller
+    abi     abi.ABI
+}
+
+// New{{$contract}}Checked creates a new checked instance of {{$contract}}, bound to a specific
+// deployed contract.
+func New{{$contract}}Checked(address common.Address, backend bind.ContractBackend) (*{{$contract}}Checked, error) {
+    parsed, err := abi.JSON(strings.NewReader({{$contract}}ABI))
+    if err != nil {
+        return nil, err
+    }
+    contract, err := New{{$contract}}(address, backend)
+    if err != nil {
+        return nil, err
+    }
+    return &{{$contract}}Checked{ {{- $contract}}: contract, address: address, caller: backend, abi: parsed}, nil
+}
+
+{{range .Methods}}{{if not .Const}}
+// {{capitalise .Name}} simulates, then sends, a paid mutator transaction binding the contract
+// method 0x{{printf "%x" .Id}}.
+//
+// Solidity: {{.String}}
+{{- methoddoc $.Docs .}}
+func (_{{$contract}} *{{$contract}}Checked) {{capitalise .Name}}(opts *bind.TransactOpts{{params .Inputs}}) (*types.Transaction, error) {
+    err := bindutil.SimulateTransact(opts, _{{$contract}}.caller, "{{$contract}}", _{{$contract}}.address, _{{$contract}}.abi, "{{.Name}}"{{args .Inputs}})
+    if err != nil {
+        return nil, err
+    }
+    return _{{$contract}}.{{$contract}}.{{capitalise .Name}}(opts{{args .Inputs}})
+}
+{{end}}{{end}}
+`)
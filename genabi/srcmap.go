@@ -0,0 +1,96 @@
+package genabi
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+// sourceMapData is the data sourceMapTemplate renders a bindutil.SourceMap from.
+type sourceMapData struct {
+	Srcmap  string
+	Sources []string
+	Lines   [][]int
+}
+
+// newSourceMapData collects c's runtime source map, and the line offsets of the source files
+// it refers to.
+//
+// Source list entries are paths relative to the directory solc ran in, sourceDir. A file that
+// can't be read gets no line offsets; positions in it are then only reported as byte offsets.
+func newSourceMapData(c contract, sourceDir string) sourceMapData {
+	data := sourceMapData{
+		Srcmap:  c.SrcmapRuntime,
+		Sources: c.SourceList,
+		Lines:   make([][]int, len(c.SourceList)),
+	}
+	for _, file := range srcmapFiles(c.SrcmapRuntime) {
+		if file < 0 || file >= len(c.SourceList) {
+			continue
+		}
+		source, err := ioutil.ReadFile(filepath.Join(sourceDir, c.SourceList[file]))
+		if err != nil {
+			continue
+		}
+		data.Lines[file] = bindutil.LineStarts(source)
+	}
+	return data
+}
+
+// srcmapFiles returns the file indexes that srcmap refers to, in order of first use.
+func srcmapFiles(srcmap string) []int {
+	var files []int
+	seen := make(map[int]bool)
+	for _, match := range regexp.MustCompile(`(?:^|;)[^:;]*:[^:;]*:(-?\d+)`).FindAllStringSubmatch(srcmap, -1) {
+		file, _ := strconv.Atoi(match[1])
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// intList renders ints as the body of a Go []int literal.
+func intList(ints []int) string {
+	result := make([]string, len(ints))
+	for i, n := range ints {
+		result[i] = strconv.Itoa(n)
+	}
+	return strings.Join(result, ", ")
+}
+
+// sourceMapTemplate generates abi/<Contract>SourceMap.go, which holds the contract's runtime
+// bytecode and source map as a bindutil.SourceMap.
+var sourceMapTemplate = newTemplate(`
+// This file is auto-generated. Do not edit.
+// Input hash: {{.InputHash}}
+
+package {{.Package}}
+
+import "github.com/reserve-protocol/rsv-beta/bindutil"
+
+{{$contract := .Contract}}
+
+// {{$contract}}SourceMap maps PCs in {{$contract}}BinRuntime to the Solidity source that
+// produced them.
+var {{$contract}}SourceMap = &bindutil.SourceMap{
+    Contract: "{{$contract}}",
+    Bytecode: {{$contract}}BinRuntime,
+    Srcmap:   ` + "`{{.SourceMap.Srcmap}}`" + `,
+    Sources: []string{
+        {{- range .SourceMap.Sources}}
+        {{quote .}},
+        {{- end}}
+    },
+    Lines: [][]int{
+        {{- range .SourceMap.Lines}}
+        {{if .}}{ {{- intlist .}}}{{else}}nil{{end}},
+        {{- end}}
+    },
+}
+`)
@@ -0,0 +1,174 @@
+package genabi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+// solcStorageLayout is solc's storage-layout output.
+type solcStorageLayout struct {
+	Storage []solcStorageVariable
+	Types   map[string]struct {
+		Encoding      string
+		Label         string
+		NumberOfBytes string
+		Key           string
+		Value         string
+		Base          string
+		Members       []solcStorageVariable
+	}
+}
+
+type solcStorageVariable struct {
+	Label  string
+	Offset int
+	Slot   string
+	Type   string
+}
+
+// addLayout gives c the storage layout checked in at <dir>/<c.Name>.json, if solc didn't output
+// one for it. The solc 0.5.7 that the Makefile pins predates the storage-layout output, so the
+// layouts of the contracts whose storage we read, like ReserveEternalStorage, are kept in layouts/
+// instead, written by hand in the same format. Contracts with neither keep no layout.
+func addLayout(dir string, c *contract) error {
+	if len(c.StorageLayout) != 0 {
+		return nil
+	}
+	layout, err := ioutil.ReadFile(filepath.Join(dir, c.Name+".json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "reading storage layout of "+c.Name)
+	}
+	c.StorageLayout = layout
+	return nil
+}
+
+// parseStorageLayout parses the storage layout of c, or returns nil if it has none.
+func parseStorageLayout(c contract) (*bindutil.StorageLayout, error) {
+	var parsed solcStorageLayout
+	if err := decodeEmbedded(c.StorageLayout, &parsed); err != nil {
+		return nil, errors.Wrap(err, "parsing storage layout of "+c.Name)
+	}
+	if parsed.Storage == nil && parsed.Types == nil {
+		return nil, nil
+	}
+
+	variables, err := storageVariables(c.Name, parsed.Storage)
+	if err != nil {
+		return nil, err
+	}
+	layout := &bindutil.StorageLayout{
+		Contract:  c.Name,
+		Variables: variables,
+		Types:     make(map[string]bindutil.StorageType),
+	}
+	for id, t := range parsed.Types {
+		size, err := strconv.Atoi(t.NumberOfBytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing size of %v in storage layout of %v", id, c.Name)
+		}
+		members, err := storageVariables(c.Name, t.Members)
+		if err != nil {
+			return nil, err
+		}
+		layout.Types[id] = bindutil.StorageType{
+			Label:         t.Label,
+			Encoding:      t.Encoding,
+			NumberOfBytes: size,
+			Key:           t.Key,
+			Value:         t.Value,
+			Base:          t.Base,
+			Members:       members,
+		}
+	}
+	return layout, nil
+}
+
+// storageVariables converts the state variables or struct members of the named contract.
+func storageVariables(contractName string, vars []solcStorageVariable) ([]bindutil.StorageVariable, error) {
+	var result []bindutil.StorageVariable
+	for _, v := range vars {
+		slot, err := strconv.ParseInt(v.Slot, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing slot of %v in storage layout of %v", v.Label, contractName)
+		}
+		result = append(result, bindutil.StorageVariable{Label: v.Label, Slot: slot, Offset: v.Offset, Type: v.Type})
+	}
+	return result, nil
+}
+
+// storageLiteral renders layout as a Go expression, or returns "" if it is nil.
+func storageLiteral(layout *bindutil.StorageLayout) string {
+	if layout == nil {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "&bindutil.StorageLayout{\nContract: %q,\nVariables: %v,\nTypes: map[string]bindutil.StorageType{\n",
+		layout.Contract, storageVariablesLiteral(layout.Variables))
+
+	ids := make([]string, 0, len(layout.Types))
+	for id := range layout.Types {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		t := layout.Types[id]
+		fmt.Fprintf(&b, "%q: {Label: %q, Encoding: %q, NumberOfBytes: %d", id, t.Label, t.Encoding, t.NumberOfBytes)
+		for _, field := range []struct{ name, value string }{{"Key", t.Key}, {"Value", t.Value}, {"Base", t.Base}} {
+			if field.value != "" {
+				fmt.Fprintf(&b, ", %v: %q", field.name, field.value)
+			}
+		}
+		if len(t.Members) > 0 {
+			fmt.Fprintf(&b, ", Members: %v", storageVariablesLiteral(t.Members))
+		}
+		b.WriteString("},\n")
+	}
+	b.WriteString("},\n}")
+	return b.String()
+}
+
+// storageVariablesLiteral renders vars as a Go expression.
+func storageVariablesLiteral(vars []bindutil.StorageVariable) string {
+	var b strings.Builder
+	b.WriteString("[]bindutil.StorageVariable{\n")
+	for _, v := range vars {
+		fmt.Fprintf(&b, "{Label: %q, Slot: %d, Offset: %d, Type: %q},\n", v.Label, v.Slot, v.Offset, v.Type)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// storageTemplate generates abi/<Contract>Storage.go, which locates the contract's state
+// variables in storage, so that they can be read with eth_getStorageAt.
+var storageTemplate = newTemplate(`
+// This file is auto-generated. Do not edit.
+// Input hash: {{.InputHash}}
+
+package {{.Package}}
+
+import "github.com/reserve-protocol/rsv-beta/bindutil"
+
+{{$contract := .Contract}}
+
+// {{$contract}}StorageLayout locates the state variables of the {{$contract}} contract in
+// storage. Use {{$contract}}StorageLayout.Slot to find the slot of a variable, or of a mapping
+// entry, and {{$contract}}StorageLayout.Read to read it. It is nil if solc didn't output the
+// contract's storage layout, and none is checked in at layouts/{{$contract}}.json.
+{{if .StorageLayout -}}
+var {{$contract}}StorageLayout = {{.StorageLayout}}
+{{- else -}}
+var {{$contract}}StorageLayout *bindutil.StorageLayout
+{{- end}}
+`)
@@ -0,0 +1,130 @@
+package genabi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// inputHash hashes everything in c that its bindings are generated from: its ABI, bytecode, and
+// storage layout.
+func inputHash(c contract) string {
+	h := sha256.New()
+	for _, input := range []string{c.ABI, c.Bin, c.BinRuntime, string(c.StorageLayout)} {
+		fmt.Fprintf(h, "%d:%v", len(input), input)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
+
+var inputHashLine = regexp.MustCompile(`(?m)^// Input hash: (\S+)$`)
+
+// Problem is a generated file that is missing, stale, edited, or shouldn't exist.
+type Problem struct {
+	Path   string // The file on disk, e.g. "abi/Manager.go".
+	Reason string // How it is out of date, e.g. "missing".
+}
+
+func (p Problem) String() string {
+	return p.Path + ": " + p.Reason
+}
+
+// Verify regenerates the Go bindings that opts describe and compares them with the files in
+// opts.OutputDir, reporting every file that is missing, stale, or edited. In batch mode, Go files
+// in OutputDir that Generate would not generate are reported too. Plugin templates are not
+// executed. Verify also returns the number of files it generated.
+func Verify(opts Options) (problems []Problem, generated int, err error) {
+	opts = opts.withDefaults()
+	opts.TemplatesDir = ""
+	files, err := Generate(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	expected := make(map[string]bool)
+	for _, file := range files {
+		expected[file.Path] = true
+		problem, err := compareGenerated(file)
+		if err != nil {
+			return nil, 0, err
+		}
+		if problem != "" {
+			problems = append(problems, Problem{file.Path, problem})
+		}
+	}
+
+	if opts.Combined != "" {
+		existing, err := filepath.Glob(filepath.Join(opts.OutputDir, "*.go"))
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "listing "+opts.OutputDir)
+		}
+		for _, path := range existing {
+			if !expected[path] {
+				problems = append(problems, Problem{path, "not generated from any contract in " + opts.Combined})
+			}
+		}
+	}
+	return problems, len(files), nil
+}
+
+// compareGenerated compares the freshly generated file with the existing one at file.Path, and
+// describes how they differ, or returns "" if they don't.
+func compareGenerated(file GeneratedFile) (string, error) {
+	want := file.Content
+	got, err := ioutil.ReadFile(file.Path)
+	if os.IsNotExist(err) {
+		return "missing", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "reading "+file.Path)
+	}
+	if bytes.Equal(got, want) {
+		return "", nil
+	}
+
+	wantHash, gotHash := inputHashLine.FindSubmatch(want), inputHashLine.FindSubmatch(got)
+	if wantHash != nil && (gotHash == nil || !bytes.Equal(gotHash[1], wantHash[1])) {
+		return "stale: generated from a different ABI, bytecode or storage layout than the solc output now holds", nil
+	}
+	gotLines, wantLines := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+	for i := range wantLines {
+		if i >= len(gotLines) || gotLines[i] != wantLines[i] {
+			return fmt.Sprintf("edited, or generated by a different genABI: first difference at line %v", i+1), nil
+		}
+	}
+	return fmt.Sprintf("edited, or generated by a different genABI: extra lines from line %v", len(wantLines)+1), nil
+}
+
+// codeTemplate generates abi/<Contract>Code.go, which holds the contract's runtime bytecode and
+// the hash of the inputs its bindings were generated from, to check deployed contracts against.
+var codeTemplate = newTemplate(`
+// This file is auto-generated. Do not edit.
+// Input hash: {{.InputHash}}
+
+package {{.Package}}
+
+import "github.com/reserve-protocol/rsv-beta/bindutil"
+
+{{$contract := .Contract}}
+
+// {{$contract}}BinRuntime is the runtime bytecode of the {{$contract}} contract, as it is stored
+// on chain once deployed.
+const {{$contract}}BinRuntime = ` + "`{{.BinRuntime}}`" + `
+
+// {{$contract}}Code identifies the compiled {{$contract}} contract that this package's bindings
+// were generated from. Use {{$contract}}Code.VerifyDeployedCode to check that a deployed contract
+// runs that code.
+var {{$contract}}Code = bindutil.Code{
+    Contract:  "{{$contract}}",
+    Runtime:   {{$contract}}BinRuntime,
+    InputHash: "{{.InputHash}}",
+}
+`)
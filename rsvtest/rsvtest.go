@@ -0,0 +1,598 @@
+// +build all fuzz
+
+// Package rsvtest deploys the RSV system, as the tests in tests/ use it, to a node for tests to
+// run against: Reserve, upgraded from PreviousReserve, with its eternal storage, and the Vault,
+// ProposalFactory, collateral tokens, Basket, and Manager, with the Manager in charge of Reserve
+// and the Vault.
+//
+// DeployFullSystem deploys all of it in one call. For anything else, make a System with
+// NewSystem and call its Deploy methods one at a time, in the order that DeployFullSystem does;
+// each deploys one part of the system, on top of the parts deployed before it.
+//
+// BindSystem binds a System to a system that is already deployed, such as on a fork of mainnet,
+// instead.
+package rsvtest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+
+	"github.com/reserve-protocol/rsv-beta/abi"
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+// Backend is a node to deploy the system to. System waits for each of its transactions to be
+// mined, so a node that only mines when told to, such as go-ethereum's SimulatedBackend, must be
+// wrapped to mine after each transaction.
+type Backend interface {
+	bind.ContractBackend
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// Account is an account that sends transactions, by its private key.
+type Account struct {
+	Key *ecdsa.PrivateKey
+}
+
+// Address returns a's address.
+func (a Account) Address() common.Address {
+	return crypto.PubkeyToAddress(a.Key.PublicKey)
+}
+
+// Signer returns a *bind.TransactOpts that uses a's private key to sign transactions.
+func (a Account) Signer() *bind.TransactOpts {
+	return bind.NewKeyedTransactor(a.Key)
+}
+
+// Options configures a System.
+type Options struct {
+	// Owner deploys every contract, and owns them. It is required.
+	Owner Account
+
+	// Operator is the Manager's operator. It defaults to Owner.
+	Operator Account
+
+	// Weights is the weights of the Basket that DeployFullSystem deploys, one for each of the
+	// collateral tokens that it deploys for it. It defaults to DefaultWeights.
+	Weights []*big.Int
+
+	// Seigniorage is the Manager's seigniorage, in basis points. It defaults to 0.
+	Seigniorage *big.Int
+
+	// Relayer makes DeployFullSystem deploy a Relayer too, as Reserve's trusted relayer.
+	Relayer bool
+
+	// Router is the router to register every contract in, for decoding their events. It defaults
+	// to a new one.
+	Router *bindutil.Router
+}
+
+// DefaultWeights returns the weights of the Basket that DeployFullSystem deploys by default: three
+// tokens, with weights 1e36, 2e36, and 3e36.
+func DefaultWeights() []*big.Int {
+	e36 := new(big.Int).Exp(big.NewInt(10), big.NewInt(36), nil)
+	return []*big.Int{
+		new(big.Int).Mul(big.NewInt(1), e36),
+		new(big.Int).Mul(big.NewInt(2), e36),
+		new(big.Int).Mul(big.NewInt(3), e36),
+	}
+}
+
+// System is the RSV system, as deployed so far. Each contract's fields are set by the method that
+// deploys it.
+type System struct {
+	Backend Backend
+
+	// Router has every contract of the system registered in it, to decode their events.
+	Router *bindutil.Router
+
+	Owner    Account
+	Operator Account
+
+	// PreviousReserve is the Reserve that Reserve was upgraded from. It is no longer in use.
+	PreviousReserve        *abi.PreviousReserve
+	PreviousReserveAddress common.Address
+
+	Reserve               *abi.Reserve
+	ReserveAddress        common.Address
+	EternalStorage        *abi.ReserveEternalStorage
+	EternalStorageAddress common.Address
+
+	Vault        *abi.Vault
+	VaultAddress common.Address
+
+	ProposalFactory        *abi.ProposalFactory
+	ProposalFactoryAddress common.Address
+
+	// ERC20s are the collateral tokens, all of whose supply the owner holds.
+	ERC20s         []*abi.BasicERC20
+	ERC20Addresses []common.Address
+
+	Basket        *abi.Basket
+	BasketAddress common.Address
+	Weights       []*big.Int // The Basket's weights, one for each of ERC20s.
+
+	Manager        *abi.Manager
+	ManagerAddress common.Address
+
+	Relayer        *abi.Relayer
+	RelayerAddress common.Address
+}
+
+// NewSystem returns a System to deploy to backend as opts says, with nothing deployed yet.
+func NewSystem(backend Backend, opts Options) *System {
+	sys := &System{
+		Backend:  backend,
+		Router:   opts.Router,
+		Owner:    opts.Owner,
+		Operator: opts.Operator,
+	}
+	if sys.Router == nil {
+		sys.Router = bindutil.NewRouter()
+	}
+	if sys.Operator.Key == nil {
+		sys.Operator = sys.Owner
+	}
+	return sys
+}
+
+// DeployFullSystem deploys the whole system to backend, as opts says: Reserve, the Vault, the
+// ProposalFactory, a collateral token for each of opts.Weights, the Basket, and the Manager, to
+// which it then hands Reserve and the Vault over, and the Relayer if opts.Relayer is set.
+func DeployFullSystem(ctx context.Context, backend Backend, opts Options) (*System, error) {
+	if opts.Owner.Key == nil {
+		return nil, errors.New("rsvtest: Options.Owner is required")
+	}
+	weights := opts.Weights
+	if weights == nil {
+		weights = DefaultWeights()
+	}
+	seigniorage := opts.Seigniorage
+	if seigniorage == nil {
+		seigniorage = new(big.Int)
+	}
+
+	sys := NewSystem(backend, opts)
+	steps := []func() error{
+		func() error { return sys.DeployReserve(ctx) },
+		func() error { return sys.DeployVault(ctx) },
+		func() error { return sys.DeployProposalFactory(ctx) },
+		func() error { return sys.DeployCollateral(ctx, len(weights)) },
+		func() error { return sys.DeployBasket(ctx, weights) },
+		func() error { return sys.DeployManager(ctx, seigniorage) },
+		func() error { return sys.HandOverToManager(ctx) },
+	}
+	if opts.Relayer {
+		steps = append(steps, func() error { return sys.DeployRelayer(ctx) })
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+	return sys, nil
+}
+
+// BindSystem binds a System to the system already deployed on backend, from Reserve at
+// reserveAddress and, unless managerAddress is zero, the Manager at managerAddress: each contract's
+// field is set from the contracts' own records of each other, and checked against them, and
+// registered in opts.Router. Only Reserve and its eternal storage are bound without a Manager;
+// PreviousReserve never is.
+//
+// opts.Owner and opts.Operator are only needed to send transactions as them, for which their keys
+// must be known; the Deploy methods can't be used on a bound System.
+func BindSystem(ctx context.Context, backend Backend, opts Options, reserveAddress, managerAddress common.Address) (*System, error) {
+	sys := NewSystem(backend, opts)
+	call := &bind.CallOpts{Context: ctx}
+
+	reserve, err := abi.NewReserve(reserveAddress, backend)
+	if err != nil {
+		return nil, err
+	}
+	sys.Router.Register(reserveAddress, abi.ReserveKind)
+	sys.Reserve, sys.ReserveAddress = reserve, reserveAddress
+
+	eternalStorageAddress, err := reserve.GetEternalStorageAddress(call)
+	if err != nil {
+		return nil, errors.Wrap(err, "rsvtest: reading Reserve's eternal storage address")
+	}
+	eternalStorage, err := abi.NewReserveEternalStorage(eternalStorageAddress, backend)
+	if err != nil {
+		return nil, err
+	}
+	sys.Router.Register(eternalStorageAddress, abi.ReserveEternalStorageKind)
+	sys.EternalStorage, sys.EternalStorageAddress = eternalStorage, eternalStorageAddress
+	storageReserve, err := eternalStorage.ReserveAddress(call)
+	if err != nil {
+		return nil, errors.Wrap(err, "rsvtest: reading the eternal storage's Reserve")
+	}
+	if storageReserve != reserveAddress {
+		return nil, errors.Errorf("rsvtest: the eternal storage belongs to %v, not Reserve", storageReserve.Hex())
+	}
+
+	relayerAddress, err := reserve.TrustedRelayer(call)
+	if err != nil {
+		return nil, errors.Wrap(err, "rsvtest: reading Reserve's trusted relayer")
+	}
+	if relayerAddress != (common.Address{}) {
+		relayer, err := abi.NewRelayer(relayerAddress, backend)
+		if err != nil {
+			return nil, err
+		}
+		sys.Router.Register(relayerAddress, abi.RelayerKind)
+		sys.Relayer, sys.RelayerAddress = relayer, relayerAddress
+	}
+
+	if managerAddress == (common.Address{}) {
+		return sys, nil
+	}
+	manager, err := abi.NewManager(managerAddress, backend)
+	if err != nil {
+		return nil, err
+	}
+	sys.Router.Register(managerAddress, abi.ManagerKind)
+	sys.Manager, sys.ManagerAddress = manager, managerAddress
+	trusted, err := manager.TrustedRSV(call)
+	if err != nil {
+		return nil, errors.Wrap(err, "rsvtest: reading the Manager's trusted RSV")
+	}
+	if trusted != reserveAddress {
+		return nil, errors.Errorf("rsvtest: the Manager trusts %v, not Reserve", trusted.Hex())
+	}
+
+	if sys.VaultAddress, err = manager.TrustedVault(call); err != nil {
+		return nil, errors.Wrap(err, "rsvtest: reading the Manager's trusted Vault")
+	}
+	if sys.Vault, err = abi.NewVault(sys.VaultAddress, backend); err != nil {
+		return nil, err
+	}
+	sys.Router.Register(sys.VaultAddress, abi.VaultKind)
+
+	if sys.ProposalFactoryAddress, err = manager.TrustedProposalFactory(call); err != nil {
+		return nil, errors.Wrap(err, "rsvtest: reading the Manager's trusted ProposalFactory")
+	}
+	if sys.ProposalFactory, err = abi.NewProposalFactory(sys.ProposalFactoryAddress, backend); err != nil {
+		return nil, err
+	}
+	sys.Router.Register(sys.ProposalFactoryAddress, abi.ProposalFactoryKind)
+
+	if sys.BasketAddress, err = manager.TrustedBasket(call); err != nil {
+		return nil, errors.Wrap(err, "rsvtest: reading the Manager's trusted Basket")
+	}
+	if sys.Basket, err = abi.NewBasket(sys.BasketAddress, backend); err != nil {
+		return nil, err
+	}
+	sys.Router.Register(sys.BasketAddress, abi.BasketKind)
+
+	// The collateral tokens are whatever ERC20s the Basket holds, bound as BasicERC20s for their
+	// ERC20 methods.
+	if sys.ERC20Addresses, err = sys.Basket.GetTokens(call); err != nil {
+		return nil, errors.Wrap(err, "rsvtest: reading the Basket's tokens")
+	}
+	for _, erc20Address := range sys.ERC20Addresses {
+		erc20, err := abi.NewBasicERC20(erc20Address, backend)
+		if err != nil {
+			return nil, err
+		}
+		sys.Router.Register(erc20Address, abi.BasicERC20Kind)
+		weight, err := sys.Basket.Weights(call, erc20Address)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rsvtest: reading the Basket's weight of %v", erc20Address.Hex())
+		}
+		sys.ERC20s = append(sys.ERC20s, erc20)
+		sys.Weights = append(sys.Weights, weight)
+	}
+	return sys, nil
+}
+
+// signer returns a *bind.TransactOpts that sends transactions from a, with ctx.
+func signer(ctx context.Context, a Account) *bind.TransactOpts {
+	opts := a.Signer()
+	opts.Context = ctx
+	return opts
+}
+
+// DeployReserve deploys PreviousReserve, upgrades it to Reserve, and has the owner accept
+// ownership of the eternal storage that Reserve takes over. Reserve ends up unpaused, and owned by
+// the owner.
+func (sys *System) DeployReserve(ctx context.Context) error {
+	owner := sys.Owner.Address()
+	call := &bind.CallOpts{Context: ctx}
+
+	oldReserveAddress, tx, oldReserve, err := abi.DeployPreviousReserve(signer(ctx, sys.Owner), sys.Backend)
+	sys.Router.Register(oldReserveAddress, abi.PreviousReserveKind)
+	err = sys.mined(ctx)(tx, err)(
+		abi.PreviousReserveOwnershipTransferred{PreviousOwner: common.Address{}, NewOwner: owner},
+	)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: deploying PreviousReserve")
+	}
+	sys.PreviousReserve, sys.PreviousReserveAddress = oldReserve, oldReserveAddress
+
+	oldMaxSupply, err := oldReserve.MaxSupply(call)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: reading PreviousReserve's maxSupply")
+	}
+	eternalStorageAddress, err := oldReserve.GetEternalStorageAddress(call)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: reading PreviousReserve's eternal storage address")
+	}
+	eternalStorage, err := abi.NewReserveEternalStorage(eternalStorageAddress, sys.Backend)
+	if err != nil {
+		return err
+	}
+	sys.Router.Register(eternalStorageAddress, abi.ReserveEternalStorageKind)
+	sys.EternalStorage, sys.EternalStorageAddress = eternalStorage, eternalStorageAddress
+
+	reserveAddress, tx, reserve, err := abi.DeployReserve(signer(ctx, sys.Owner), sys.Backend)
+	sys.Router.Register(reserveAddress, abi.ReserveKind)
+	if err := sys.mined(ctx)(tx, err)(); err != nil {
+		return errors.Wrap(err, "rsvtest: deploying Reserve")
+	}
+	sys.Reserve, sys.ReserveAddress = reserve, reserveAddress
+
+	// Reserve starts out paused, until it takes over from PreviousReserve.
+	paused, err := reserve.Paused(call)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: reading whether Reserve is paused")
+	}
+	if !paused {
+		return errors.New("rsvtest: Reserve didn't start out paused")
+	}
+
+	err = sys.minedExactly(ctx)(oldReserve.NominateNewOwner(signer(ctx, sys.Owner), reserveAddress))(
+		abi.PreviousReserveNewOwnerNominated{PreviousOwner: owner, Nominee: reserveAddress},
+	)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: nominating Reserve as PreviousReserve's owner")
+	}
+	err = sys.minedExactly(ctx)(reserve.AcceptUpgrade(signer(ctx, sys.Owner), oldReserveAddress))(
+		abi.ReserveMaxSupplyChanged{NewMaxSupply: oldMaxSupply},
+		abi.ReserveUnpaused{Account: owner},
+		abi.PreviousReserveOwnershipTransferred{PreviousOwner: owner, NewOwner: reserveAddress},
+		abi.PreviousReservePauserChanged{NewPauser: reserveAddress},
+		abi.PreviousReservePaused{Account: reserveAddress},
+		abi.PreviousReserveEternalStorageTransferred{NewReserveAddress: reserveAddress},
+		abi.ReserveEternalStorageReserveAddressTransferred{
+			OldReserveAddress: oldReserveAddress,
+			NewReserveAddress: reserveAddress,
+		},
+		abi.PreviousReserveMinterChanged{NewMinter: common.Address{}},
+		abi.PreviousReservePauserChanged{NewPauser: common.Address{}},
+		abi.PreviousReserveOwnershipTransferred{PreviousOwner: reserveAddress, NewOwner: common.Address{}},
+	)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: upgrading PreviousReserve to Reserve")
+	}
+
+	err = sys.minedExactly(ctx)(eternalStorage.AcceptOwnership(signer(ctx, sys.Owner)))(
+		abi.ReserveEternalStorageOwnershipTransferred{PreviousOwner: oldReserveAddress, NewOwner: owner},
+	)
+	return errors.Wrap(err, "rsvtest: accepting ownership of the eternal storage")
+}
+
+// DeployVault deploys the Vault, with the owner as its manager.
+func (sys *System) DeployVault(ctx context.Context) error {
+	owner := sys.Owner.Address()
+	vaultAddress, tx, vault, err := abi.DeployVault(signer(ctx, sys.Owner), sys.Backend)
+	sys.Router.Register(vaultAddress, abi.VaultKind)
+	err = sys.minedExactly(ctx)(tx, err)(
+		abi.VaultOwnershipTransferred{PreviousOwner: common.Address{}, NewOwner: owner},
+		abi.VaultManagerTransferred{PreviousManager: common.Address{}, NewManager: owner},
+	)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: deploying the Vault")
+	}
+	sys.Vault, sys.VaultAddress = vault, vaultAddress
+	return nil
+}
+
+// DeployProposalFactory deploys the ProposalFactory.
+func (sys *System) DeployProposalFactory(ctx context.Context) error {
+	factoryAddress, tx, factory, err := abi.DeployProposalFactory(signer(ctx, sys.Owner), sys.Backend)
+	sys.Router.Register(factoryAddress, abi.ProposalFactoryKind)
+	if err := sys.mined(ctx)(tx, err)(); err != nil {
+		return errors.Wrap(err, "rsvtest: deploying the ProposalFactory")
+	}
+	sys.ProposalFactory, sys.ProposalFactoryAddress = factory, factoryAddress
+	return nil
+}
+
+// DeployCollateral deploys n more collateral tokens, all of whose supply the owner holds.
+func (sys *System) DeployCollateral(ctx context.Context, n int) error {
+	for i := 0; i < n; i++ {
+		erc20Address, tx, erc20, err := abi.DeployBasicERC20(signer(ctx, sys.Owner), sys.Backend)
+		sys.Router.Register(erc20Address, abi.BasicERC20Kind)
+		if err := sys.mined(ctx)(tx, err)(); err != nil {
+			return errors.Wrapf(err, "rsvtest: deploying collateral token %v", len(sys.ERC20s))
+		}
+		sys.ERC20s = append(sys.ERC20s, erc20)
+		sys.ERC20Addresses = append(sys.ERC20Addresses, erc20Address)
+	}
+	return nil
+}
+
+// DeployBasket deploys the Basket of the collateral tokens, with weights.
+func (sys *System) DeployBasket(ctx context.Context, weights []*big.Int) error {
+	if len(weights) != len(sys.ERC20Addresses) {
+		return errors.Errorf("rsvtest: %v weights for %v collateral tokens", len(weights), len(sys.ERC20Addresses))
+	}
+	basketAddress, tx, basket, err := abi.DeployBasket(
+		signer(ctx, sys.Owner), sys.Backend, common.Address{}, sys.ERC20Addresses, weights,
+	)
+	sys.Router.Register(basketAddress, abi.BasketKind)
+	if err := sys.minedExactly(ctx)(tx, err)(); err != nil {
+		return errors.Wrap(err, "rsvtest: deploying the Basket")
+	}
+	sys.Basket, sys.BasketAddress, sys.Weights = basket, basketAddress, weights
+	return nil
+}
+
+// DeployManager deploys the Manager, of Reserve, the Vault, the ProposalFactory, and the Basket,
+// with seigniorage in basis points, and has the operator take it out of its initial emergency.
+func (sys *System) DeployManager(ctx context.Context, seigniorage *big.Int) error {
+	if sys.Reserve == nil || sys.Vault == nil || sys.ProposalFactory == nil || sys.Basket == nil {
+		return errors.New("rsvtest: the Manager needs Reserve, the Vault, the ProposalFactory, and the Basket deployed first")
+	}
+	managerAddress, tx, manager, err := abi.DeployManager(
+		signer(ctx, sys.Owner), sys.Backend,
+		sys.VaultAddress, sys.ReserveAddress, sys.ProposalFactoryAddress, sys.BasketAddress,
+		sys.Operator.Address(), seigniorage,
+	)
+	sys.Router.Register(managerAddress, abi.ManagerKind)
+	err = sys.mined(ctx)(tx, err)(
+		abi.ManagerOwnershipTransferred{PreviousOwner: common.Address{}, NewOwner: sys.Owner.Address()},
+	)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: deploying the Manager")
+	}
+	sys.Manager, sys.ManagerAddress = manager, managerAddress
+
+	// The Manager starts out in an emergency, until the operator ends it.
+	call := &bind.CallOpts{Context: ctx}
+	emergency, err := manager.Emergency(call)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: reading whether the Manager is in an emergency")
+	}
+	if !emergency {
+		return errors.New("rsvtest: the Manager didn't start out in an emergency")
+	}
+	err = sys.minedExactly(ctx)(manager.SetEmergency(signer(ctx, sys.Operator), false))(
+		abi.ManagerEmergencyChanged{OldVal: true, NewVal: false},
+	)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: ending the Manager's emergency")
+	}
+	if emergency, err = manager.Emergency(call); err != nil {
+		return errors.Wrap(err, "rsvtest: reading whether the Manager is in an emergency")
+	}
+	if emergency {
+		return errors.New("rsvtest: the Manager's emergency didn't end")
+	}
+	return nil
+}
+
+// HandOverToManager makes the Manager Reserve's minter and pauser, and the Vault's manager.
+func (sys *System) HandOverToManager(ctx context.Context) error {
+	if sys.Manager == nil {
+		return errors.New("rsvtest: the Manager must be deployed first")
+	}
+	err := sys.minedExactly(ctx)(sys.Reserve.ChangeMinter(signer(ctx, sys.Owner), sys.ManagerAddress))(
+		abi.ReserveMinterChanged{NewMinter: sys.ManagerAddress},
+	)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: making the Manager Reserve's minter")
+	}
+	err = sys.minedExactly(ctx)(sys.Reserve.ChangePauser(signer(ctx, sys.Owner), sys.ManagerAddress))(
+		abi.ReservePauserChanged{NewPauser: sys.ManagerAddress},
+	)
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: making the Manager Reserve's pauser")
+	}
+	err = sys.minedExactly(ctx)(sys.Vault.ChangeManager(signer(ctx, sys.Owner), sys.ManagerAddress))(
+		abi.VaultManagerTransferred{PreviousManager: sys.Owner.Address(), NewManager: sys.ManagerAddress},
+	)
+	return errors.Wrap(err, "rsvtest: making the Manager the Vault's manager")
+}
+
+// DeployRelayer deploys the Relayer, and makes it Reserve's trusted relayer.
+func (sys *System) DeployRelayer(ctx context.Context) error {
+	if sys.Reserve == nil {
+		return errors.New("rsvtest: the Relayer needs Reserve deployed first")
+	}
+	relayerAddress, tx, relayer, err := abi.DeployRelayer(signer(ctx, sys.Owner), sys.Backend, sys.ReserveAddress)
+	sys.Router.Register(relayerAddress, abi.RelayerKind)
+	if err := sys.mined(ctx)(tx, err)(); err != nil {
+		return errors.Wrap(err, "rsvtest: deploying the Relayer")
+	}
+	sys.Relayer, sys.RelayerAddress = relayer, relayerAddress
+
+	trusted, err := relayer.TrustedRSV(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return errors.Wrap(err, "rsvtest: reading the Relayer's trusted RSV")
+	}
+	if trusted != sys.ReserveAddress {
+		return errors.Errorf("rsvtest: the Relayer trusts %v, not Reserve", trusted.Hex())
+	}
+	err = sys.minedExactly(ctx)(sys.Reserve.ChangeRelayer(signer(ctx, sys.Owner), relayerAddress))(
+		abi.ReserveTrustedRelayerChanged{NewTrustedRelayer: relayerAddress},
+	)
+	return errors.Wrap(err, "rsvtest: making the Relayer Reserve's trusted relayer")
+}
+
+// mined(ctx)(tx, err)(events...) waits for tx, as returned with err by a binding's mutator, to be
+// mined, and checks that it succeeded and emitted each of events, among others. It takes ctx
+// first so that it can wrap a binding's mutator directly.
+func (sys *System) mined(ctx context.Context) func(tx *types.Transaction, err error) func(events ...fmt.Stringer) error {
+	return func(tx *types.Transaction, err error) func(events ...fmt.Stringer) error {
+		receipt, err := sys.wait(ctx, tx, err)
+		return func(events ...fmt.Stringer) error {
+			if err != nil {
+				return err
+			}
+			for _, want := range events {
+				found := false
+				for _, log := range receipt.Logs {
+					if got, err := sys.Router.ParseLog(*log); err == nil && got.String() == want.String() {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return errors.Errorf("no %v event", want)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// minedExactly(ctx)(tx, err)(events...) is like mined, but checks that tx emitted exactly events,
+// in order.
+func (sys *System) minedExactly(ctx context.Context) func(tx *types.Transaction, err error) func(events ...fmt.Stringer) error {
+	return func(tx *types.Transaction, err error) func(events ...fmt.Stringer) error {
+		receipt, err := sys.wait(ctx, tx, err)
+		return func(events ...fmt.Stringer) error {
+			if err != nil {
+				return err
+			}
+			if len(receipt.Logs) != len(events) {
+				return errors.Errorf("%v events, not %v", len(receipt.Logs), len(events))
+			}
+			for i, want := range events {
+				got, err := sys.Router.ParseLog(*receipt.Logs[i])
+				if err != nil {
+					return errors.Wrapf(err, "parsing event %v", i)
+				}
+				if got.String() != want.String() {
+					return errors.Errorf("event %v is %v, not %v", i, got, want)
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// wait waits for tx, as returned with err by a binding's mutator, to be mined, and checks that it
+// succeeded.
+func (sys *System) wait(ctx context.Context, tx *types.Transaction, err error) (*types.Receipt, error) {
+	if err != nil {
+		return nil, err
+	}
+	receipt, err := bind.WaitMined(ctx, sys.Backend, tx)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, errors.Errorf("transaction %v failed", tx.Hash().Hex())
+	}
+	return receipt, nil
+}
@@ -0,0 +1,142 @@
+// +build all
+
+package rsvtest
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// autoMining is a SimulatedBackend that mines each transaction as it is sent.
+type autoMining struct {
+	*backends.SimulatedBackend
+}
+
+func (b autoMining) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	defer b.Commit()
+	return b.SimulatedBackend.SendTransaction(ctx, tx)
+}
+
+func newAccount(t *testing.T) Account {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	return Account{Key: key}
+}
+
+func newBackend(accounts ...Account) Backend {
+	alloc := core.GenesisAlloc{}
+	for _, account := range accounts {
+		alloc[account.Address()] = core.GenesisAccount{Balance: big.NewInt(math.MaxInt64)}
+	}
+	return autoMining{backends.NewSimulatedBackend(alloc, 8e6)}
+}
+
+func TestDeployFullSystem(t *testing.T) {
+	owner, operator := newAccount(t), newAccount(t)
+	ctx := context.Background()
+	sys, err := DeployFullSystem(ctx, newBackend(owner, operator), Options{
+		Owner:    owner,
+		Operator: operator,
+		Weights:  DefaultWeights()[:2],
+		Relayer:  true,
+	})
+	require.NoError(t, err)
+
+	// Reserve and the Vault are in the Manager's hands.
+	minter, err := sys.Reserve.Minter(nil)
+	require.NoError(t, err)
+	assert.Equal(t, sys.ManagerAddress, minter)
+	pauser, err := sys.Reserve.Pauser(nil)
+	require.NoError(t, err)
+	assert.Equal(t, sys.ManagerAddress, pauser)
+	manager, err := sys.Vault.Manager(nil)
+	require.NoError(t, err)
+	assert.Equal(t, sys.ManagerAddress, manager)
+	relayer, err := sys.Reserve.TrustedRelayer(nil)
+	require.NoError(t, err)
+	assert.Equal(t, sys.RelayerAddress, relayer)
+
+	// The Manager has the operator, and the basket of the two tokens that were deployed for it.
+	managerOperator, err := sys.Manager.Operator(nil)
+	require.NoError(t, err)
+	assert.Equal(t, operator.Address(), managerOperator)
+	tokens, err := sys.Basket.GetTokens(nil)
+	require.NoError(t, err)
+	assert.Equal(t, sys.ERC20Addresses, tokens)
+	assert.Len(t, sys.ERC20s, 2)
+
+	// Every contract is registered in the router.
+	for _, address := range append(sys.ERC20Addresses, sys.PreviousReserveAddress, sys.ReserveAddress,
+		sys.EternalStorageAddress, sys.VaultAddress, sys.ProposalFactoryAddress, sys.BasketAddress,
+		sys.ManagerAddress, sys.RelayerAddress) {
+		_, ok := sys.Router.Kind(address)
+		assert.True(t, ok, "%v isn't registered", address.Hex())
+	}
+}
+
+func TestSystemSteps(t *testing.T) {
+	owner := newAccount(t)
+	ctx := context.Background()
+	_, err := DeployFullSystem(ctx, newBackend(owner), Options{})
+	assert.EqualError(t, err, "rsvtest: Options.Owner is required")
+
+	// Each step needs the ones before it.
+	sys := NewSystem(newBackend(owner), Options{Owner: owner})
+	assert.Equal(t, owner, sys.Operator)
+	assert.EqualError(t, sys.DeployManager(ctx, new(big.Int)), "rsvtest: the Manager needs Reserve, the Vault, the ProposalFactory, and the Basket deployed first")
+	assert.EqualError(t, sys.HandOverToManager(ctx), "rsvtest: the Manager must be deployed first")
+	assert.EqualError(t, sys.DeployRelayer(ctx), "rsvtest: the Relayer needs Reserve deployed first")
+	require.NoError(t, sys.DeployCollateral(ctx, 1))
+	assert.EqualError(t, sys.DeployBasket(ctx, DefaultWeights()), "rsvtest: 3 weights for 1 collateral tokens")
+	require.NoError(t, sys.DeployBasket(ctx, DefaultWeights()[:1]))
+	assert.Nil(t, sys.Manager)
+}
+
+func TestBindSystem(t *testing.T) {
+	owner := newAccount(t)
+	ctx := context.Background()
+	backend := newBackend(owner)
+	deployed, err := DeployFullSystem(ctx, backend, Options{Owner: owner, Relayer: true})
+	require.NoError(t, err)
+
+	// Bound from Reserve and the Manager, the system is the one that was deployed, but for
+	// PreviousReserve, which nothing records.
+	sys, err := BindSystem(ctx, backend, Options{}, deployed.ReserveAddress, deployed.ManagerAddress)
+	require.NoError(t, err)
+	assert.Equal(t, deployed.EternalStorageAddress, sys.EternalStorageAddress)
+	assert.Equal(t, deployed.VaultAddress, sys.VaultAddress)
+	assert.Equal(t, deployed.ProposalFactoryAddress, sys.ProposalFactoryAddress)
+	assert.Equal(t, deployed.BasketAddress, sys.BasketAddress)
+	assert.Equal(t, deployed.ERC20Addresses, sys.ERC20Addresses)
+	assert.Equal(t, deployed.Weights, sys.Weights)
+	assert.Equal(t, deployed.RelayerAddress, sys.RelayerAddress)
+	assert.Nil(t, sys.PreviousReserve)
+	for _, address := range append(sys.ERC20Addresses, sys.ReserveAddress, sys.EternalStorageAddress,
+		sys.VaultAddress, sys.ProposalFactoryAddress, sys.BasketAddress, sys.ManagerAddress, sys.RelayerAddress) {
+		_, ok := sys.Router.Kind(address)
+		assert.True(t, ok, "%v isn't registered", address.Hex())
+	}
+
+	// Without the Manager, only Reserve's side is bound.
+	sys, err = BindSystem(ctx, backend, Options{}, deployed.ReserveAddress, common.Address{})
+	require.NoError(t, err)
+	assert.Equal(t, deployed.EternalStorageAddress, sys.EternalStorageAddress)
+	assert.Nil(t, sys.Manager)
+	assert.Nil(t, sys.Vault)
+
+	// A Manager of another Reserve doesn't bind.
+	other, err := DeployFullSystem(ctx, backend, Options{Owner: owner})
+	require.NoError(t, err)
+	_, err = BindSystem(ctx, backend, Options{}, deployed.ReserveAddress, other.ManagerAddress)
+	assert.EqualError(t, err, "rsvtest: the Manager trusts "+other.ReserveAddress.Hex()+", not Reserve")
+}
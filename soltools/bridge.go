@@ -13,111 +13,138 @@
 package soltools
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/hex"
-	"encoding/json"
-	"fmt"
-	"io"
-	"io/ioutil"
 	"math/big"
-	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/pkg/errors"
+
+	"github.com/reserve-protocol/rsv-beta/soltools/istanbul"
 )
 
 // Backend is a replacement for an *ethclient.Client that sends transactions through 0x's tracing
 // library in JavaScript.
+//
+// Every method of go-ethereum's bind.ContractBackend, as well as TransactionReceipt, goes through
+// the bridge, so that the tracing subproviders see everything; the other methods of the embedded
+// *ethclient.Client go straight to the node.
+//
+// Each Backend has its own Node.js process, listening on a port of its own, so several Backends
+// can be used at once, such as by test packages that run in parallel.
 type Backend struct {
 	*ethclient.Client
-	cmd           *exec.Cmd
-	waitForStdout sync.WaitGroup
+
+	opts         Options // To restart the bridge with.
+	contractsDir string  // Where to read sources to resolve the frames of RevertTraceErrors.
+
+	gasPolicy    GasPolicy
+	fixedGas     uint64
+	pollInterval time.Duration
+
+	mu                sync.Mutex
+	process           *bridgeProcess
+	journal           []traced  // What the bridge has traced since its checkpoint, to trace again after a restart.
+	checkpoint        *snapshot // The bridge's coverage and profile when the journal was last emptied.
+	checkpointing     bool      // Whether the journal is being emptied.
+	retryCheckpointAt int       // If a checkpoint failed, the journal's length at which to try again.
+	saved             snapshot  // The coverage and profile of the bridges that crashed, as of their checkpoints.
+	restarts          int
+	down              error // Why the bridge is down for good, if it is.
+
+	quit       chan struct{} // Closed to stop supervising the bridge.
+	supervised chan struct{} // Closed once the bridge is no longer supervised.
 }
 
+// listeningLine matches the line the Node.js process prints once its server is listening, and
+// captures the port that it was given by the OS.
+var listeningLine = regexp.MustCompile(`server listening on port (\d+)`)
+
 // NewBackend dials an ethereum node at nodeAddress and returns a *Backend client for that node.
 //
 // NewBackend also starts a Node.js process, which the caller is responsible for closing by calling
 // Backend.Close(). Example:
 //
-//	backend, err := NewBackend("http://localhost:8545", "project/artifacts", "project/contracts")
+//	backend, err := NewBackend("http://localhost:8545")
 //	// handle err
 //	defer backend.Close()
 //
+// The Node.js process sends everything through the same node, at nodeAddress, and serves the
+// Backend on a free port of its own.
+//
 // The client will add tracing to the Ethereum transactions and calls that are made through it.
-// It can also write a coverage report, which requires passing paths to artifacts and contracts
-// directories for the corresponding Solidity code.
+// It can also write a coverage report, for which NewBackend finds the artifacts and contracts
+// directories for the corresponding Solidity code in the repository root, $REPO_DIR. Use
+// NewBackendWithOptions to configure the Backend instead.
 func NewBackend(nodeAddress string) (*Backend, error) {
-	goBackend, err := ethclient.Dial(nodeAddress)
-	if err != nil {
-		return nil, err
-	}
-
 	repoDir := os.Getenv("REPO_DIR")
 	if repoDir == "" {
 		return nil, errors.New("REPO_DIR env var is not set -- need it to point to repo root")
 	}
-	bridgeJSPath := filepath.Join(repoDir, "soltools", "bridge.js")
-
-	artifactsDir := filepath.Join(repoDir, "artifacts")
-	contractsDir := filepath.Join(repoDir, "contracts")
+	return NewBackendWithOptions(context.Background(), Options{
+		NodeURL:      nodeAddress,
+		BridgeScript: filepath.Join(repoDir, "soltools", "bridge.js"),
+		ArtifactsDir: filepath.Join(repoDir, "artifacts"),
+		ContractsDir: filepath.Join(repoDir, "contracts"),
+	})
+}
 
-	// check that the current working directory is where we think it is
-	if _, err := os.Stat(bridgeJSPath); err != nil {
-		if os.IsNotExist(err) {
-			return nil, errors.Errorf("could not find %v -- make sure this command is running from the repo root", bridgeJSPath)
-		}
-		return nil, errors.Wrapf(err, "could not find %v", bridgeJSPath)
+// NewBackendWithOptions dials the ethereum node at opts.NodeURL and returns a *Backend client for
+// that node, as NewBackend does, but configured by opts rather than the environment.
+//
+// NewBackendWithOptions returns once the Node.js process is listening, and has answered a health
+// check. It fails if that takes longer than opts.StartupTimeout, or if ctx is done first; either
+// way, the process is killed. ctx has no effect once NewBackendWithOptions returns.
+//
+// From then on, the Backend supervises the process. If it exits, or stops answering health
+// checks, the Backend starts another, up to opts.MaxRestarts times, and traces every transaction
+// and call that the old one traced in it again, so that coverage isn't lost. (Past
+// opts.JournalLimit of them, it keeps the old one's coverage and profile instead.) Requests to the
+// bridge that fail because of the bridge itself, rather than the EVM, fail with a *BridgeError.
+func NewBackendWithOptions(ctx context.Context, opts Options) (*Backend, error) {
+	opts = opts.withDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, err
 	}
+	ctx, cancel := context.WithTimeout(ctx, opts.StartupTimeout)
+	defer cancel()
 
-	// copy to stdout and watch for starting line
-
-	cmd := exec.Command("node", bridgeJSPath, artifactsDir, contractsDir)
-	cmd.Stdin = os.Stdin
-	stdout, err := cmd.StdoutPipe()
+	goBackend, err := ethclient.DialContext(ctx, opts.NodeURL)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapf(err, "dialing %v", opts.NodeURL)
 	}
-	cmd.Stderr = os.Stderr
-	err = cmd.Start()
+	process, err := startBridge(ctx, opts)
 	if err != nil {
+		goBackend.Close()
 		return nil, err
 	}
 
 	result := &Backend{
-		Client: goBackend,
-		cmd:    cmd,
-	}
+		Client:       goBackend,
+		opts:         opts,
+		contractsDir: opts.ContractsDir,
 
-	bufferedStdout := bufio.NewReader(stdout)
-	for {
-		line, err := bufferedStdout.ReadString('\n')
-		fmt.Println(strings.TrimSpace(line))
-		if err != nil {
-			result.Close()
-			return nil, err
-		}
-		if strings.Contains(line, "server listening") {
-			break
-		}
-	}
-
-	result.waitForStdout.Add(1)
-	go func() {
-		defer result.waitForStdout.Done()
-		io.Copy(os.Stdout, bufferedStdout)
-	}()
+		gasPolicy:    opts.GasPolicy,
+		fixedGas:     opts.FixedGas,
+		pollInterval: opts.PollInterval,
 
+		process:    process,
+		quit:       make(chan struct{}),
+		supervised: make(chan struct{}),
+	}
+	go result.supervise(result.quit)
 	return result, nil
 }
 
@@ -125,118 +152,273 @@ func NewBackend(nodeAddress string) (*Backend, error) {
 //
 // In particular, it closes the backing JavaScript process and a network connection to the Ethereum node.
 func (b *Backend) Close() error {
-	b.Client.Close()
-	err := b.call(
-		"close",
-		true,      // ignored input
-		new(bool), // ignore output
-	)
-	if err != nil {
-		b.cmd.Process.Kill()
-		return err
-	}
-	b.waitForStdout.Wait()
-	return b.cmd.Wait()
-}
-
-// call makes HTTP calls to the Node.js process.
-func (*Backend) call(method string, in, out interface{}) error {
-	b, err := json.Marshal(map[string]interface{}{
-		"method": method,
-		"data":   in,
-	})
-	if err != nil {
-		return err
+	if b.quit != nil {
+		close(b.quit)
+		<-b.supervised
 	}
-	resp, err := http.Post("http://localhost:3000", "application/json", bytes.NewReader(b))
+	b.Client.Close()
+	err := b.Call(context.Background(), nil, "close")
+	b.mu.Lock()
+	p := b.process
+	b.mu.Unlock()
 	if err != nil {
+		p.kill()
 		return err
 	}
-	defer resp.Body.Close()
-	switch resp.StatusCode {
-	case 200:
-		return json.NewDecoder(resp.Body).Decode(out)
-	case 500:
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
-		return fmt.Errorf("%s", b)
-	default:
-		return fmt.Errorf("unexpected status from node.js: %q", resp.Status)
-	}
+	// The bridge exits once the connection is closed.
+	p.client.Close()
+	<-p.exited
+	return p.err
 }
 
 // CallContract overrides the same method in *ethclient.Client (and satisfies CallContract from
 // go-ethereum's bind.ContractCaller interface).  Instead of sending the call through the
 // underlying client, it sends it through 0x's library.
+//
+// If the Backend was made with Options.RevertTrace, calls that revert return a *RevertTraceError.
 func (b *Backend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
-	var result string
 	block := "latest"
 	if blockNumber != nil {
 		block = blockNumber.String()
 	}
+	return b.callContract(ctx, call, block)
+}
+
+// PendingCallContract overrides the same method in *ethclient.Client (and satisfies
+// PendingCallContract from go-ethereum's bind.PendingContractCaller interface). Like
+// CallContract, it sends the call through 0x's library, to run on the pending state.
+func (b *Backend) PendingCallContract(ctx context.Context, call ethereum.CallMsg) ([]byte, error) {
+	return b.callContract(ctx, call, "pending")
+}
+
+// callContract sends call through 0x's library, to run at block.
+func (b *Backend) callContract(ctx context.Context, call ethereum.CallMsg, block string) ([]byte, error) {
+	var result string
+	callObject := toCallObject(call)
+	err := b.Call(ctx, &result, "call", callObject, block)
+	b.record(traced{Call: callObject}, err)
+	if err != nil {
+		return nil, err
+	}
+	output, err := hex.DecodeString(strings.TrimPrefix(result, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
 
-	convertedCall := map[string]interface{}{
+// toCallObject converts call to the call object that web3 takes.
+func toCallObject(call ethereum.CallMsg) map[string]interface{} {
+	converted := map[string]interface{}{
 		"data": hexutil.Encode(call.Data),
 	}
 	if call.From != (common.Address{}) {
-		convertedCall["from"] = call.From
+		converted["from"] = call.From
 	}
 	if call.To != nil {
-		convertedCall["to"] = call.To
+		converted["to"] = call.To
 	}
 	if call.Value != nil {
-		convertedCall["value"] = call.Value
+		converted["value"] = call.Value
 	}
-
-	err := b.call(
-		"call",
-		map[string]interface{}{
-			"call":  convertedCall,
-			"block": block,
-		},
-		&result,
-	)
-	if err != nil {
-		return nil, err
+	if call.Gas != 0 {
+		converted["gas"] = call.Gas
 	}
-	output, err := hex.DecodeString(strings.TrimPrefix(result, "0x"))
-	if err != nil {
-		return nil, err
+	if call.GasPrice != nil {
+		converted["gasPrice"] = call.GasPrice
 	}
-	return output, nil
+	return converted
 }
 
 // EstimateGas overrides the same method in *ethclient.Client (and satisfies EstimateGas from
-// go-ethereum's bind.ContractTransactor interface). Instead of sending the call through the
-// underlying client, it returns a hard-coded result.
+// go-ethereum's bind.ContractTransactor interface). It estimates according to the Backend's
+// Options.GasPolicy: by default, GasFixed, it returns a fixed result without asking the node.
 //
-// The hard-coded result is used so that transactions never fail in the gas estimation stage.
+// The fixed result is used so that transactions never fail in the gas estimation stage.
 // Instead they will fail when the transaction is mined. This is assumed to be desirable behavior
 // because it causes the transaction to actually run, rather than not, which causes the
 // corresponding code to get traced for code coverage, rather than not.
 func (b *Backend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (gas uint64, err error) {
-	return 8000000000, nil
+	switch b.gasPolicy {
+	case GasEstimate:
+		return b.estimateGas(ctx, call)
+	case GasEstimateOrFixed:
+		if gas, err := b.estimateGas(ctx, call); err == nil {
+			return gas, nil
+		}
+	}
+	return b.fixedGas, nil
+}
+
+// estimateGas asks the node, through 0x's library, for the gas that call needs.
+func (b *Backend) estimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	var gas uint64
+	if err := b.Call(ctx, &gas, "estimateGas", toCallObject(call)); err != nil {
+		return 0, errors.Wrap(err, "estimating gas")
+	}
+	return gas, nil
+}
+
+// PendingNonceAt overrides the same method in *ethclient.Client (and satisfies PendingNonceAt
+// from go-ethereum's bind.ContractTransactor interface), asking through 0x's library.
+func (b *Backend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	var nonce hexutil.Uint64
+	err := b.Call(ctx, &nonce, "eth_getTransactionCount", account, "pending")
+	return uint64(nonce), err
+}
+
+// SuggestGasPrice overrides the same method in *ethclient.Client (and satisfies SuggestGasPrice
+// from go-ethereum's bind.ContractTransactor interface), asking through 0x's library.
+func (b *Backend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	var price hexutil.Big
+	if err := b.Call(ctx, &price, "eth_gasPrice"); err != nil {
+		return nil, err
+	}
+	return (*big.Int)(&price), nil
+}
+
+// TransactionReceipt overrides the same method in *ethclient.Client, asking through 0x's
+// library. Like *ethclient.Client, it returns ethereum.NotFound for transactions that haven't been
+// mined.
+func (b *Backend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	var receipt *types.Receipt
+	if err := b.Call(ctx, &receipt, "eth_getTransactionReceipt", txHash); err != nil {
+		return nil, err
+	}
+	if receipt == nil {
+		return nil, ethereum.NotFound
+	}
+	return receipt, nil
+}
+
+// FilterLogs overrides the same method in *ethclient.Client (and satisfies FilterLogs from
+// go-ethereum's bind.ContractFilterer interface), asking through 0x's library.
+func (b *Backend) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	arg, err := toFilterArg(q)
+	if err != nil {
+		return nil, err
+	}
+	var logs []types.Log
+	err = b.Call(ctx, &logs, "eth_getLogs", arg)
+	return logs, err
+}
+
+// SubscribeFilterLogs overrides the same method in *ethclient.Client (and satisfies
+// SubscribeFilterLogs from go-ethereum's bind.ContractFilterer interface). The bridge can't push
+// logs, so the subscription polls FilterLogs every Options.PollInterval for the logs of blocks
+// mined since the last poll, starting from the latest block when SubscribeFilterLogs is called.
+// q's block range is ignored.
+//
+// The subscription ends with an error if a poll fails.
+func (b *Backend) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	if q.BlockHash != nil {
+		return nil, errors.New("cannot subscribe to the logs of a single block")
+	}
+	latest, err := b.blockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		ticker := time.NewTicker(b.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-quit:
+				return nil
+			}
+
+			current, err := b.blockNumber(context.Background())
+			if err != nil {
+				return err
+			}
+			if current <= latest {
+				continue
+			}
+			q.FromBlock = new(big.Int).SetUint64(latest + 1)
+			q.ToBlock = new(big.Int).SetUint64(current)
+			logs, err := b.FilterLogs(context.Background(), q)
+			if err != nil {
+				return err
+			}
+			for _, log := range logs {
+				select {
+				case ch <- log:
+				case <-quit:
+					return nil
+				}
+			}
+			latest = current
+		}
+	}), nil
+}
+
+// blockNumber returns the number of the latest block, asking through 0x's library.
+func (b *Backend) blockNumber(ctx context.Context) (uint64, error) {
+	var number hexutil.Uint64
+	err := b.Call(ctx, &number, "eth_blockNumber")
+	return uint64(number), err
+}
+
+// toFilterArg converts q to the filter object of eth_getLogs, like *ethclient.Client does.
+func toFilterArg(q ethereum.FilterQuery) (map[string]interface{}, error) {
+	arg := map[string]interface{}{
+		"address": q.Addresses,
+		"topics":  q.Topics,
+	}
+	if q.BlockHash != nil {
+		if q.FromBlock != nil || q.ToBlock != nil {
+			return nil, errors.New("cannot specify both BlockHash and FromBlock/ToBlock")
+		}
+		arg["blockHash"] = *q.BlockHash
+		return arg, nil
+	}
+	arg["fromBlock"] = "0x0"
+	if q.FromBlock != nil {
+		arg["fromBlock"] = hexutil.EncodeBig(q.FromBlock)
+	}
+	arg["toBlock"] = "latest"
+	if q.ToBlock != nil {
+		arg["toBlock"] = hexutil.EncodeBig(q.ToBlock)
+	}
+	return arg, nil
 }
 
 // SendTransaction overrides the same method in *ethclient.Client (and satisfies SendTransaction
 // from go-ethereum's bind.ContractTransactor interface). Instead of sending the call through the
 // underlying client, it sends it through 0x's library.
+//
+// If the Backend was made with Options.RevertTrace, transactions that revert return a
+// *RevertTraceError, even though they have been mined.
 func (b *Backend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
 	buf := new(bytes.Buffer)
 	err := tx.EncodeRLP(buf)
 	if err != nil {
 		return err
 	}
-	return b.call("sendTransaction", "0x"+hex.EncodeToString(buf.Bytes()), new(string) /* ignore output */)
+	err = b.Call(ctx, nil, "sendTransaction", "0x"+hex.EncodeToString(buf.Bytes()))
+	hash := tx.Hash()
+	b.record(traced{TxHash: &hash, To: tx.To(), Data: hexutil.Encode(tx.Data())}, err)
+	return err
 }
 
 // WriteCoverage writes a coverage report in Istanbul format to $PWD/coverage/coverage.json.
 func (b *Backend) WriteCoverage() error {
-	return b.call(
-		"writeCoverage",
-		true,      // ignored input
-		new(bool), // ignore output
-	)
+	if err := b.Call(context.Background(), nil, "writeCoverage"); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	saved := b.saved.Coverage
+	b.mu.Unlock()
+	if len(saved) == 0 {
+		return nil
+	}
+
+	// Add the coverage of the bridges that crashed, which this one hasn't traced.
+	path := filepath.Join("coverage", "coverage.json")
+	coverage, err := istanbul.Load(path)
+	if err != nil {
+		return err
+	}
+	return istanbul.Merge(saved, coverage).WriteFile(path)
 }
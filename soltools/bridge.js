@@ -1,44 +1,76 @@
 // This is the JavaScript end of the Go-JavaScript bridge implemented in this package.
 
 // Imports
+const fs = require('fs');
+const path = require('path');
 const util = require('util');
-const http = require('http');
+const net = require('net');
+const readline = require('readline');
 const Web3 = require('web3');
 
-const { SolCompilerArtifactAdapter } = require('@0x/sol-trace');
+const { SolCompilerArtifactAdapter, RevertTraceSubprovider } = require('@0x/sol-trace');
 const { CoverageSubprovider } = require('@0x/sol-coverage');
+const { ProfilerSubprovider } = require('@0x/sol-profiler');
 const ProviderEngine = require('web3-provider-engine');
 const RpcSubprovider = require('web3-provider-engine/subproviders/rpc.js');
 
-// Command-line arguments.
-const [, , artifactsDir, contractsDir] = process.argv;
+// Command-line arguments. The bridge listens on port, or on a free port if that is 0, or talks
+// over stdin and stdout if port is 'stdio', and sends RPCs through to the Ethereum node at
+// nodeURL. If revertTrace is 'true', it also traces reverts, and if profile is 'true', it
+// profiles gas usage.
+const [
+  , , artifactsDir, contractsDir, nodeURL = 'http://localhost:8545', port = '0', revertTrace = 'false',
+  profile = 'false',
+] = process.argv;
+
+// Over stdio, stdout belongs to the Go end, so log to stderr.
+if (port === 'stdio') {
+  console.log = console.error;
+}
 
 // Create web3 provider chain.
 // We need an artifact adapter so the coverage subprovider knows how to map EVM traces source code.
 // We need a coverage subprovider so we can write a coverage report.
+// We optionally need a revert trace subprovider, to report the Solidity stack trace of reverts,
+// and a profiler subprovider, to attribute gas usage to source code.
 // We also need an RPC subprovider to handle everything else.
+const defaultFromAddress = '0x5409ed021d9299bf6814279a6a1411a7e866a631';
 const artifactAdapter = new SolCompilerArtifactAdapter(artifactsDir, contractsDir);
-const coverageSubprovider = new CoverageSubprovider(
-  artifactAdapter,
-  '0x5409ed021d9299bf6814279a6a1411a7e866a631'
-);
+const coverageSubprovider = new CoverageSubprovider(artifactAdapter, defaultFromAddress);
 const provider = new ProviderEngine();
 provider.addProvider(coverageSubprovider);
-provider.addProvider(new RpcSubprovider({rpcUrl: 'http://localhost:8545'}));
+
+// activeTrace is the array that collects what the revert trace subprovider logs, the stack trace
+// of any revert, for the request being traced, if there is one. sol-trace only logs its traces,
+// so to tell whose revert it logged, the requests that it traces are handled one at a time; see
+// withTrace.
+let activeTrace = null;
+if (revertTrace === 'true') {
+  const revertTraceSubprovider = new RevertTraceSubprovider(artifactAdapter, defaultFromAddress, false);
+  const logger = revertTraceSubprovider._logger;
+  const logError = logger.error.bind(logger);
+  logger.error = (...messages) => {
+    if (activeTrace) {
+      activeTrace.push(messages.join(' '));
+    }
+    logError(...messages);
+  };
+  provider.addProvider(revertTraceSubprovider);
+}
+const profilerSubprovider = profile === 'true' ?
+  new ProfilerSubprovider(artifactAdapter, defaultFromAddress, false) : null;
+if (profilerSubprovider) {
+  provider.addProvider(profilerSubprovider);
+}
+provider.addProvider(new RpcSubprovider({rpcUrl: nodeURL}));
+
+// tracers are the subproviders that collect traces, which a restarted bridge replays.
+const tracers = [coverageSubprovider, profilerSubprovider].filter(Boolean);
 provider.start();
 provider.stop();
 provider.send = provider.sendAsync.bind(provider);
 const web3 = new Web3(provider);
 
-// readFull returns a Promise that resolves to the contents of the entire stream.
-function readFull(stream) {
-  return new Promise((resolve, reject) => {
-    var content = '';
-    stream.on('data', (buf) => { content += buf.toString(); });
-    stream.on('end', () => { resolve(content) });
-  });
-}
-
 // promisify is a simple Promisify implementation.
 function promisify(f) {
   return new Promise((resolve, reject) => f((err, value) => {
@@ -46,45 +78,233 @@ function promisify(f) {
   }));
 }
 
-// rpcs contains implementations of all of the RPCs we support, keyed by
-// their "method name".
+// Error codes of JSON-RPC errors. Keep them in sync with jsonrpc.go.
+const codes = {
+  parseError: -32700,
+  invalidRequest: -32600,
+  methodNotFound: -32601,
+  internalError: -32603,
+  evmError: -32000,
+  reverted: -32001,
+};
+
+// RPCError is an error with a JSON-RPC error code, and optional data.
+class RPCError extends Error {
+  constructor(code, message, data) {
+    super(message);
+    this.code = code;
+    this.data = data;
+  }
+}
+
+// send makes a raw JSON-RPC request through the provider chain, and returns a Promise that
+// resolves to its result.
+function send(method, params) {
+  return promisify(cb => provider.sendAsync({jsonrpc: '2.0', id: 1, method, params}, cb))
+    .then(response => {
+      if (response.error) {
+        throw new RPCError(codes.evmError, response.error.message, response.error.data);
+      }
+      return response.result;
+    });
+}
+
+// readOutput calls write, which writes a report to coverage/coverage.json, as each of 0x's tools
+// does, and returns the report. Any coverage report that was there is moved out of its way, and
+// back again.
+async function readOutput(write) {
+  const output = path.join('coverage', 'coverage.json');
+  const saved = output + '.saved';
+  const hadCoverage = fs.existsSync(output);
+  if (hadCoverage) {
+    fs.renameSync(output, saved);
+  }
+  try {
+    await write();
+    return JSON.parse(fs.readFileSync(output, 'utf8'));
+  } finally {
+    if (fs.existsSync(output)) {
+      fs.unlinkSync(output);
+    }
+    if (hadCoverage) {
+      fs.renameSync(saved, output);
+    }
+  }
+}
+
+// passThrough matches the methods of the node's own API, which go through the provider chain as
+// they are.
+const passThrough = /^(eth|net|web3|evm|debug)_/;
+
+// tracedMethods are the bridge's methods whose reverts are traced. The node's own methods that
+// run code, which sol-trace traces too, are handled one at a time with them, so that their
+// reverts aren't taken for a traced request's, but their traces are dropped.
+const tracedMethods = new Set(['sendTransaction', 'call', 'estimateGas']);
+const runsCode = new Set(['eth_sendTransaction', 'eth_sendRawTransaction', 'eth_call', 'eth_estimateGas']);
+
+// tracing resolves once the traced request being handled, if any, has finished.
+let tracing = Promise.resolve();
+
+// withTrace calls f, once every traced request before it has finished, collecting what sol-trace
+// logs meanwhile into trace, and returns a Promise that resolves to f's result.
+function withTrace(trace, f) {
+  const run = tracing.then(async () => {
+    activeTrace = trace;
+    try {
+      return await f();
+    } finally {
+      activeTrace = null;
+    }
+  });
+  tracing = run.catch(() => undefined);
+  return run;
+}
+
+// rpcs contains implementations of the bridge's own methods, keyed by method name. Each takes the
+// request's params as its arguments.
 const rpcs = {
   // RPCs that wrap web3 calls.
-  pendingNonceAt: address => promisify(cb => web3.eth.getTransactionCount(address, 'pending', cb)),
   sendTransaction: tx => promisify(cb => web3.eth.sendRawTransaction(tx, cb)),
   estimateGas: callObject => promisify(cb => web3.eth.estimateGas(callObject, cb)),
-  call: ({call, block}) => promisify(cb => web3.eth.call(call, block, cb)),
+  call: (callObject, block) => promisify(cb => web3.eth.call(callObject, block, cb)),
 
   // Other RPCs.
-  writeCoverage: _ => coverageSubprovider.writeCoverageAsync().then(_ => true),
-	close: _ => {
-    setImmediate(server.close.bind(server), (err, value) => {
+  ping: () => true,
+
+  // replay traces the transactions and calls that an earlier bridge process traced before it
+  // crashed, so that the coverage and profile it collected aren't lost. Transactions are traced
+  // as they were mined; calls run again, on the latest state.
+  replay: async traced => {
+    for (const {txHash, to, data, call} of traced) {
+      for (const tracer of tracers) {
+        if (txHash) {
+          await tracer._recordTxTraceAsync(to || 'NEW_CONTRACT', data, txHash);
+        } else {
+          await tracer._recordCallOrGasEstimateTraceAsync(call);
+        }
+      }
+    }
+    return true;
+  },
+  writeCoverage: () => coverageSubprovider.writeCoverageAsync().then(_ => true),
+
+  // sol-profiler writes its profile to coverage/coverage.json, in Istanbul's format, with gas in
+  // place of hit counts. Return the profile, leaving any coverage report as it was.
+  profile: () => {
+    if (!profilerSubprovider) {
+      throw new RPCError(codes.internalError, 'the profiler is not enabled');
+    }
+    return readOutput(() => profilerSubprovider.writeProfilerOutputAsync());
+  },
+
+  // snapshot returns the coverage, and the profile, if it is enabled, of everything traced so
+  // far, so that the Go end can keep them when it empties its journal of what to replay.
+  snapshot: async () => ({
+    coverage: await readOutput(() => coverageSubprovider.writeCoverageAsync()),
+    profile: profilerSubprovider ? await readOutput(() => profilerSubprovider.writeProfilerOutputAsync()) : null,
+  }),
+
+  // The bridge exits once the Go end closes its connection, too.
+  close: () => {
+    setImmediate(() => {
+      if (server) {
+        server.close();
+      }
       provider.stop();
       console.log('javascript web3 server stopped');
-    })
-		return true;
-	},
+    });
+    return true;
+  },
 };
 
-// Create the web server and listen for requests.
-const port = 3000;
-const server = http.createServer(async (request, response) => {
+// handle handles one JSON-RPC request, and returns a Promise that resolves to its response, or
+// to undefined for notifications, which have no response.
+async function handle(request) {
+  const {id, method, params = []} = request || {};
+  const respond = fields => (id === undefined ? undefined : {jsonrpc: '2.0', id, ...fields});
+  if (!request || request.jsonrpc !== '2.0' || typeof method !== 'string' || !Array.isArray(params)) {
+    return {jsonrpc: '2.0', id: id === undefined ? null : id, error: {code: codes.invalidRequest, message: 'invalid request'}};
+  }
+
+  // Only traced methods report what sol-trace logs; everything else gets an array of its own
+  // that nothing reads.
+  const traced = tracedMethods.has(method);
+  const trace = [];
+  const run = f => (revertTrace === 'true' && (traced || runsCode.has(method)) ? withTrace(trace, f) : f());
   try {
-    // Simple RPC endpoint: requests are JSON-formatted as {"method": <method>, "data": <arbitrary JSON argument for method>}.
-    const content = await readFull(request);
-    const {method, data} = JSON.parse(content);
-    // Our RPCs are synchronous, so await the results.
-    response.end(JSON.stringify(await rpcs[method](data)));
+    let result;
+    if (rpcs.hasOwnProperty(method)) {
+      result = await run(() => rpcs[method](...params));
+    } else if (passThrough.test(method)) {
+      result = await run(() => send(method, params));
+    } else {
+      throw new RPCError(codes.methodNotFound, `no method ${method}`);
+    }
 
+    // Reverts that sol-trace traced are errors, even if the node didn't report one.
+    if (traced && trace.length > 0) {
+      const message = method === 'sendTransaction' ? `transaction ${result} reverted` : 'execution reverted';
+      return respond({error: {code: codes.reverted, message, data: trace}});
+    }
+    return respond({result: result === undefined ? null : result});
   }
   catch(error) {
-    response.statusCode = 500;
-    response.end(JSON.stringify(error));
-  }
-});
-server.listen(port, (err) => {
-  if (err) {
-    return console.log('server error', err)
+    const failure = {code: error.code || codes.evmError, message: error.message || String(error)};
+    if (traced && trace.length > 0) {
+      failure.code = codes.reverted;
+      failure.data = trace;
+    } else if (error.data !== undefined) {
+      failure.data = error.data;
+    }
+    return respond({error: failure});
   }
-  console.log(`javascript web3 server listening on port ${port}`)
-});
+}
+
+// serve answers the JSON-RPC requests, and batches of requests, that it reads from input, one per
+// line, on output. Requests are handled concurrently, except for those that are traced, and
+// answered as they finish.
+function serve(input, output) {
+  const lines = readline.createInterface({input, crlfDelay: Infinity});
+  lines.on('line', async line => {
+    if (line.trim() === '') {
+      return;
+    }
+    let response;
+    try {
+      const message = JSON.parse(line);
+      if (Array.isArray(message)) {
+        if (message.length === 0) {
+          response = {jsonrpc: '2.0', id: null, error: {code: codes.invalidRequest, message: 'empty batch'}};
+        } else {
+          response = (await Promise.all(message.map(handle))).filter(r => r !== undefined);
+          if (response.length === 0) {
+            return;
+          }
+        }
+      } else {
+        response = await handle(message);
+      }
+    } catch (error) {
+      response = {jsonrpc: '2.0', id: null, error: {code: codes.parseError, message: error.message}};
+    }
+    if (response !== undefined) {
+      output.write(JSON.stringify(response) + '\n');
+    }
+  });
+}
+
+// Serve over stdio, or listen for connections, on the loopback interface only.
+let server = null;
+if (port === 'stdio') {
+  serve(process.stdin, process.stdout);
+} else {
+  server = net.createServer(socket => serve(socket, socket));
+  server.on('error', (err) => {
+    console.log('server error', err);
+    process.exit(1);
+  });
+  server.listen(Number(port), '127.0.0.1', () => {
+    // The Go end reads the port from this line, so keep its format in sync with bridge.go.
+    console.log(`javascript web3 server listening on port ${server.address().port}`)
+  });
+}
@@ -0,0 +1,365 @@
+package soltools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNode writes a shell script that stands in for the node binary, running script, and returns
+// Options that start it.
+func fakeNode(t *testing.T, dir, script string) Options {
+	node := filepath.Join(dir, "node")
+	require.NoError(t, ioutil.WriteFile(node, []byte("#!/bin/sh\n"+script+"\n"), 0755))
+	return Options{
+		NodeURL:      "http://localhost:8545",
+		BridgeScript: node,
+		ArtifactsDir: dir,
+		ContractsDir: dir,
+		NodeBinary:   node,
+	}
+}
+
+func TestNewBackendWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soltools")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bridge := newBridgeServer(map[string]string{"ping": "true"})
+	defer bridge.Close()
+
+	// The bridge is served on the port it reports, once it answers a health check, and its
+	// output goes to Stdout and Stderr.
+	var logged []string
+	opts := fakeNode(t, dir, `echo starting >&2; echo "$4"; echo "javascript web3 server listening on port `+bridge.port()+`"; exec sleep 10`)
+	opts.Stdout = LogWriter(func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	})
+	opts.Stderr = opts.Stdout
+	backend, err := NewBackendWithOptions(context.Background(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, "[]", bridge.request("ping"))
+	stop(backend)
+	assert.ElementsMatch(t, []string{"starting", "http://localhost:8545", "javascript web3 server listening on port " + bridge.port()}, logged)
+
+	// A bridge that fails its health check is killed.
+	bridge.remove("ping")
+	opts = fakeNode(t, dir, `echo "javascript web3 server listening on port `+bridge.port()+`"; exec sleep 10`)
+	opts.Stdout = ioutil.Discard
+	_, err = NewBackendWithOptions(context.Background(), opts)
+	assert.EqualError(t, err, "checking the health of the Node.js bridge: no ping")
+
+	// A bridge that never starts listening is killed once StartupTimeout passes, or ctx is done.
+	opts = fakeNode(t, dir, "exec sleep 10")
+	opts.StartupTimeout = 50 * time.Millisecond
+	start := time.Now()
+	_, err = NewBackendWithOptions(context.Background(), opts)
+	assert.EqualError(t, err, "waiting for the Node.js bridge to start: context deadline exceeded")
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts.StartupTimeout = 0
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = NewBackendWithOptions(ctx, opts)
+	assert.EqualError(t, err, "waiting for the Node.js bridge to start: context canceled")
+
+	opts = fakeNode(t, dir, "exit 1")
+	_, err = NewBackendWithOptions(context.Background(), opts)
+	assert.EqualError(t, err, "the Node.js bridge exited before it started listening")
+}
+
+func TestOptionsValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soltools")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	valid := fakeNode(t, dir, "")
+
+	for _, test := range []struct {
+		change func(*Options)
+		err    string
+	}{
+		{func(o *Options) {}, ""},
+		{func(o *Options) { o.NodeURL = "" }, "soltools: Options.NodeURL is required"},
+		{func(o *Options) { o.NodeURL = "localhost" }, `soltools: Options.NodeURL "localhost" is not a URL`},
+		{func(o *Options) { o.StartupTimeout = -time.Second }, "soltools: Options.StartupTimeout -1s is negative"},
+		{func(o *Options) { o.GasPolicy = GasEstimateOrFixed }, ""},
+		{func(o *Options) { o.GasPolicy = 3 }, "soltools: Options.GasPolicy GasPolicy(3) is not a GasPolicy"},
+		{func(o *Options) { o.PollInterval = -time.Second }, "soltools: Options.PollInterval -1s is negative"},
+		{func(o *Options) { o.Transport = TransportStdio }, ""},
+		{func(o *Options) { o.Transport = 2 }, "soltools: Options.Transport Transport(2) is not a Transport"},
+		{func(o *Options) { o.CallTimeout = -time.Second }, "soltools: Options.CallTimeout -1s is negative"},
+		{func(o *Options) { o.HealthCheckInterval = -time.Second }, "soltools: Options.HealthCheckInterval -1s is negative"},
+		{func(o *Options) { o.MaxRestarts = -1 }, ""},
+		{func(o *Options) { o.JournalLimit = -1 }, "soltools: Options.JournalLimit -1 is negative"},
+		{func(o *Options) { o.BridgeScript = "" }, "soltools: Options.BridgeScript is required"},
+		{func(o *Options) { o.BridgeScript = dir }, "soltools: Options.BridgeScript " + dir + " is not a file"},
+		{func(o *Options) { o.ArtifactsDir = valid.NodeBinary }, "soltools: Options.ArtifactsDir " + valid.NodeBinary + " is not a directory"},
+		{func(o *Options) { o.ContractsDir = filepath.Join(dir, "missing") }, "soltools: Options.ContractsDir: stat"},
+		{func(o *Options) { o.NodeBinary = filepath.Join(dir, "missing") }, "soltools: Options.NodeBinary: exec:"},
+	} {
+		opts := valid
+		test.change(&opts)
+		err := opts.withDefaults().validate()
+		if test.err == "" {
+			assert.NoError(t, err)
+		} else if assert.Error(t, err) {
+			assert.True(t, strings.HasPrefix(err.Error(), test.err), err.Error())
+		}
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	var lines []string
+	w := LogWriter(func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	})
+	fmt.Fprint(w, "one\ntw")
+	fmt.Fprint(w, "o\n\nthree")
+	assert.Equal(t, []string{"one", "two", ""}, lines)
+}
+
+// bridgeServer is a JSON-RPC server, on a port of its own, that stands in for the Node.js bridge.
+// It answers each method with the JSON result in responses, failing with an EVM error for methods
+// that aren't there, and never answering methods whose result is "hang". It records the params
+// of the latest request for each method in requests.
+type bridgeServer struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	responses map[string]string
+	requests  map[string]string
+	conns     []net.Conn
+}
+
+func newBridgeServer(responses map[string]string) *bridgeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := &bridgeServer{listener: listener, responses: responses, requests: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// serve answers the requests, and batches of requests, that it reads from conn.
+func (s *bridgeServer) serve(conn net.Conn) {
+	decoder := json.NewDecoder(conn)
+	for {
+		var message json.RawMessage
+		if err := decoder.Decode(&message); err != nil {
+			return
+		}
+		var requests []map[string]json.RawMessage
+		batch := message[0] == '['
+		if batch {
+			json.Unmarshal(message, &requests)
+		} else {
+			var request map[string]json.RawMessage
+			json.Unmarshal(message, &request)
+			requests = append(requests, request)
+		}
+		var responses []string
+		for _, request := range requests {
+			var method string
+			json.Unmarshal(request["method"], &method)
+			s.mu.Lock()
+			s.requests[method] = string(request["params"])
+			response, ok := s.responses[method]
+			s.mu.Unlock()
+			switch {
+			case !ok:
+				responses = append(responses, fmt.Sprintf(`{"jsonrpc": "2.0", "id": %s, "error": {"code": -32000, "message": "no %v"}}`, request["id"], method))
+			case response != "hang":
+				responses = append(responses, fmt.Sprintf(`{"jsonrpc": "2.0", "id": %s, "result": %v}`, request["id"], response))
+			}
+		}
+		if len(responses) == 0 {
+			continue
+		}
+		if batch {
+			fmt.Fprintf(conn, "[%v]\n", strings.Join(responses, ", "))
+		} else {
+			fmt.Fprintln(conn, responses[0])
+		}
+	}
+}
+
+// Close stops the server, and closes every connection to it.
+func (s *bridgeServer) Close() {
+	s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *bridgeServer) respond(method, response string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[method] = response
+}
+
+func (s *bridgeServer) remove(method string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, method)
+}
+
+func (s *bridgeServer) request(method string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method]
+}
+
+// port returns the port that s listens on.
+func (s *bridgeServer) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+// backend returns a Backend, with the default Options, that is served by s, without a process.
+func (s *bridgeServer) backend() *Backend {
+	client, err := DialRPC(context.Background(), s.listener.Addr().String())
+	if err != nil {
+		panic(err)
+	}
+	opts := Options{}.withDefaults()
+	return &Backend{
+		opts:         opts,
+		process:      &bridgeProcess{client: client, exited: make(chan struct{})},
+		gasPolicy:    opts.GasPolicy,
+		fixedGas:     opts.FixedGas,
+		pollInterval: 10 * time.Millisecond,
+	}
+}
+
+func TestBackendBridgeMethods(t *testing.T) {
+	ctx := context.Background()
+	account := common.HexToAddress("0x5409ed021d9299bf6814279a6a1411a7e866a631")
+	bridge := newBridgeServer(map[string]string{
+		"call":                      `"0x2a"`,
+		"eth_getTransactionCount":   `"0x7"`,
+		"eth_gasPrice":              `"0x4a817c800"`,
+		"eth_getTransactionReceipt": `null`,
+		"eth_getLogs":               `[]`,
+	})
+	defer bridge.Close()
+	backend := bridge.backend()
+
+	output, err := backend.PendingCallContract(ctx, ethereum.CallMsg{To: &account, Gas: 100})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{42}, output)
+	assert.JSONEq(t, `[{"to": "0x5409ed021d9299bf6814279a6a1411a7e866a631", "data": "0x", "gas": 100}, "pending"]`, bridge.request("call"))
+
+	nonce, err := backend.PendingNonceAt(ctx, account)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), nonce)
+	assert.JSONEq(t, `["0x5409ed021d9299bf6814279a6a1411a7e866a631", "pending"]`, bridge.request("eth_getTransactionCount"))
+
+	price, err := backend.SuggestGasPrice(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "20000000000", price.String())
+
+	_, err = backend.TransactionReceipt(ctx, common.Hash{})
+	assert.Equal(t, ethereum.NotFound, err)
+
+	_, err = backend.FilterLogs(ctx, ethereum.FilterQuery{FromBlock: big.NewInt(16), Addresses: []common.Address{account}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"address": ["0x5409ed021d9299bf6814279a6a1411a7e866a631"], "topics": null, "fromBlock": "0x10", "toBlock": "latest"}]`, bridge.request("eth_getLogs"))
+
+	hash := common.Hash{1}
+	_, err = backend.FilterLogs(ctx, ethereum.FilterQuery{BlockHash: &hash, ToBlock: big.NewInt(1)})
+	assert.EqualError(t, err, "cannot specify both BlockHash and FromBlock/ToBlock")
+}
+
+func TestBackendEstimateGas(t *testing.T) {
+	for _, test := range []struct {
+		policy   GasPolicy
+		estimate string // The bridge's estimate, or "" if it fails.
+		gas      uint64
+		err      string
+	}{
+		{GasFixed, "21000", DefaultFixedGas, ""},
+		{GasEstimate, "21000", 21000, ""},
+		{GasEstimate, "", 0, "estimating gas: no estimateGas"},
+		{GasEstimateOrFixed, "21000", 21000, ""},
+		{GasEstimateOrFixed, "", DefaultFixedGas, ""},
+	} {
+		responses := make(map[string]string)
+		if test.estimate != "" {
+			responses["estimateGas"] = test.estimate
+		}
+		bridge := newBridgeServer(responses)
+		backend := bridge.backend()
+		backend.gasPolicy = test.policy
+		gas, err := backend.EstimateGas(context.Background(), ethereum.CallMsg{})
+		bridge.Close()
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, "%v", test.policy)
+			continue
+		}
+		assert.NoError(t, err, "%v", test.policy)
+		assert.Equal(t, test.gas, gas, "%v", test.policy)
+	}
+}
+
+func TestBackendSubscribeFilterLogs(t *testing.T) {
+	bridge := newBridgeServer(map[string]string{
+		"eth_blockNumber": `"0x5"`,
+		"eth_getLogs": `[{
+			"address": "0x5409ed021d9299bf6814279a6a1411a7e866a631",
+			"topics": [],
+			"data": "0x",
+			"blockNumber": "0x6",
+			"transactionHash": "0x0000000000000000000000000000000000000000000000000000000000000001",
+			"transactionIndex": "0x0",
+			"blockHash": "0x0000000000000000000000000000000000000000000000000000000000000002",
+			"logIndex": "0x0",
+			"removed": false
+		}]`,
+	})
+	defer bridge.Close()
+
+	logs := make(chan types.Log)
+	sub, err := bridge.backend().SubscribeFilterLogs(context.Background(), ethereum.FilterQuery{}, logs)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// Mine block 6. The next poll fetches its logs.
+	bridge.respond("eth_blockNumber", `"0x6"`)
+	select {
+	case log := <-logs:
+		assert.Equal(t, uint64(6), log.BlockNumber)
+	case err := <-sub.Err():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no log")
+	}
+	assert.JSONEq(t, `[{"address": null, "topics": null, "fromBlock": "0x6", "toBlock": "0x6"}]`, bridge.request("eth_getLogs"))
+}
@@ -0,0 +1,262 @@
+package soltools
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+	"github.com/reserve-protocol/rsv-beta/soltools/istanbul"
+)
+
+// Coverage collects coverage of Solidity contracts in Go, without Node.js or sol-coverage. It is
+// a vm.Tracer that counts how often each instruction of the contracts it knows is executed, and
+// maps those counts back to Solidity source through the contracts' srcmap-runtime.
+//
+// A solc source map doesn't say what kind of code each source range is, and there's no AST to
+// ask, so Coverage reads the source: ranges that start with a function, modifier, or constructor
+// declaration are functions, ranges that span a whole contract are ignored, and every other range
+// is a statement. There's no branch coverage, and constructors aren't covered, since only the
+// runtime bytecode is mapped.
+//
+// Use a SimulatedCoverage to trace the transactions and calls of a *backends.SimulatedBackend.
+type Coverage struct {
+	sourceDir string
+	contracts map[common.Hash]map[uint64]bindutil.Position // Code hash -> PC -> source position.
+	files     map[string]*sourceFile                       // Keyed by file name, as solc names it.
+
+	mu   sync.Mutex
+	hits map[common.Hash]map[uint64]uint64 // Code hash -> PC -> executions.
+}
+
+// sourceFile is a Solidity source file that covered contracts are compiled from.
+type sourceFile struct {
+	source []byte // The file's contents, or nil if it couldn't be read.
+	lines  []int  // The byte offset at which each line starts.
+}
+
+// sourceRange is a range of a source file, as a source map entry gives it.
+type sourceRange struct {
+	offset, length int
+}
+
+// NewCoverage returns a Coverage of the contracts that maps describe, such as the SourceMap of
+// each entry of abi.Contracts. Source files are read from sourceDir, which solc's source names
+// are relative to. Contracts without runtime bytecode, such as interfaces, are skipped.
+func NewCoverage(sourceDir string, maps ...*bindutil.SourceMap) (*Coverage, error) {
+	c := &Coverage{
+		sourceDir: sourceDir,
+		contracts: make(map[common.Hash]map[uint64]bindutil.Position),
+		files:     make(map[string]*sourceFile),
+		hits:      make(map[common.Hash]map[uint64]uint64),
+	}
+	for _, m := range maps {
+		if m == nil || strings.TrimPrefix(m.Bytecode, "0x") == "" {
+			continue
+		}
+		code, err := hex.DecodeString(strings.TrimPrefix(m.Bytecode, "0x"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "soltools: %v: runtime bytecode", m.Contract)
+		}
+		positions, err := m.Positions()
+		if err != nil {
+			return nil, errors.Wrap(err, "soltools")
+		}
+		hash := crypto.Keccak256Hash(code)
+		c.contracts[hash] = positions
+		c.hits[hash] = make(map[uint64]uint64)
+
+		for i, name := range m.Sources {
+			if c.files[name] != nil {
+				continue
+			}
+			file := new(sourceFile)
+			if i < len(m.Lines) {
+				file.lines = m.Lines[i]
+			}
+			if source, err := ioutil.ReadFile(filepath.Join(sourceDir, name)); err == nil {
+				file.source = source
+				file.lines = bindutil.LineStarts(source)
+			}
+			c.files[name] = file
+		}
+	}
+	return c, nil
+}
+
+// CaptureStart implements vm.Tracer.
+func (c *Coverage) CaptureStart(from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureState implements vm.Tracer, counting the execution of the instruction at pc.
+func (c *Coverage) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if hits, ok := c.hits[contract.CodeHash]; ok {
+		c.mu.Lock()
+		hits[pc]++
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// CaptureFault implements vm.Tracer.
+func (c *Coverage) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements vm.Tracer.
+func (c *Coverage) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	return nil
+}
+
+// WriteCoverage writes the coverage collected so far in Istanbul format to
+// $PWD/coverage/coverage.json, like Backend.WriteCoverage.
+func (c *Coverage) WriteCoverage() error {
+	files, err := c.istanbul()
+	if err != nil {
+		return err
+	}
+	return files.WriteFile(filepath.Join("coverage", "coverage.json"))
+}
+
+// istanbul returns the coverage collected so far in Istanbul format, keyed by the absolute path
+// of each source file, which is what `istanbul report` needs to find them.
+func (c *Coverage) istanbul() (istanbul.Coverage, error) {
+	// Count the executions of each source range: within a contract, a range has run as often as
+	// its most-run instruction; across contracts, such as a contract and one that inherits from
+	// it, the counts add up.
+	counts := make(map[string]map[sourceRange]uint64)
+	c.mu.Lock()
+	for hash, positions := range c.contracts {
+		ranges := make(map[string]map[sourceRange]uint64)
+		for pc, position := range positions {
+			if position.File == "" {
+				continue
+			}
+			if ranges[position.File] == nil {
+				ranges[position.File] = make(map[sourceRange]uint64)
+			}
+			r := sourceRange{position.Offset, position.Length}
+			if hits := c.hits[hash][pc]; hits >= ranges[position.File][r] {
+				ranges[position.File][r] = hits
+			}
+		}
+		for file, fileRanges := range ranges {
+			if counts[file] == nil {
+				counts[file] = make(map[sourceRange]uint64)
+			}
+			for r, hits := range fileRanges {
+				counts[file][r] += hits
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	result := make(istanbul.Coverage)
+	for name, fileCounts := range counts {
+		file := c.files[name]
+		if file == nil || file.lines == nil {
+			continue // Without line offsets, there's nowhere to report the ranges.
+		}
+		path, err := filepath.Abs(filepath.Join(c.sourceDir, name))
+		if err != nil {
+			return nil, errors.Wrap(err, "soltools")
+		}
+		result[path] = file.istanbul(path, fileCounts)
+	}
+	return result, nil
+}
+
+// istanbul returns the Istanbul coverage of f, which is at path, given the executions of each of
+// its source ranges.
+func (f *sourceFile) istanbul(path string, counts map[sourceRange]uint64) *istanbul.File {
+	result := &istanbul.File{
+		Path:         path,
+		StatementMap: make(map[string]istanbul.Range),
+		FnMap:        make(map[string]istanbul.Function),
+		BranchMap:    make(map[string]istanbul.Branch),
+		S:            make(map[string]uint64),
+		F:            make(map[string]uint64),
+		B:            make(map[string][]uint64),
+		L:            make(map[string]uint64),
+	}
+
+	ranges := make([]sourceRange, 0, len(counts))
+	for r := range counts {
+		ranges = append(ranges, r)
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].offset != ranges[j].offset {
+			return ranges[i].offset < ranges[j].offset
+		}
+		return ranges[i].length < ranges[j].length
+	})
+
+	for _, r := range ranges {
+		loc := istanbul.Range{Start: f.position(r.offset), End: f.position(r.offset + r.length)}
+		hits := counts[r]
+		kind, name := f.declaration(r)
+		switch kind {
+		case "contract":
+			// The dispatcher and other contract-wide code; not a statement.
+		case "function":
+			id := strconv.Itoa(len(result.FnMap) + 1)
+			result.FnMap[id] = istanbul.Function{Name: name, Line: loc.Start.Line, Loc: loc}
+			result.F[id] = hits
+		default:
+			id := strconv.Itoa(len(result.StatementMap) + 1)
+			result.StatementMap[id] = loc
+			result.S[id] = hits
+			line := strconv.Itoa(loc.Start.Line)
+			if hits >= result.L[line] {
+				result.L[line] = hits
+			}
+		}
+	}
+	return result
+}
+
+// position returns the Istanbul position of offset in f.
+func (f *sourceFile) position(offset int) istanbul.Position {
+	line := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset })
+	if line == 0 {
+		return istanbul.Position{Line: 1, Column: offset}
+	}
+	return istanbul.Position{Line: line, Column: offset - f.lines[line-1]}
+}
+
+// declaration reports whether r is a "contract" or "function" declaration, and the function's
+// name, by reading the start of its source. It returns "" for everything else, including every
+// range of a file that couldn't be read.
+func (f *sourceFile) declaration(r sourceRange) (kind, name string) {
+	if r.offset < 0 || r.offset >= len(f.source) {
+		return "", ""
+	}
+	end := r.offset + r.length
+	if end > len(f.source) {
+		end = len(f.source)
+	}
+	source := string(f.source[r.offset:end])
+	if contractDeclaration.MatchString(source) {
+		return "contract", ""
+	}
+	if match := functionDeclaration.FindStringSubmatch(source); match != nil {
+		name = match[1] + match[2] + match[3]
+		if name == "" {
+			name = "fallback"
+		}
+		return "function", name
+	}
+	return "", ""
+}
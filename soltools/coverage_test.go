@@ -0,0 +1,171 @@
+package soltools
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+)
+
+const counterSource = `pragma solidity 0.5.7;
+
+contract Counter {
+    uint256 n;
+
+    function set() external {
+        n = 1;
+    }
+
+    function unset() external {
+        n = 2;
+    }
+}
+`
+
+// counterRuntime is hand-assembled "Counter" runtime bytecode: the code of set, which is run, then
+// the code of unset, which is never reached.
+const counterRuntime = "600160005500" + // PUSH1 1, PUSH1 0, SSTORE, STOP
+	"600260005500" // PUSH1 2, PUSH1 0, SSTORE, STOP
+
+// counterSourceMap maps counterRuntime's instructions to counterSource.
+func counterSourceMap() *bindutil.SourceMap {
+	entry := func(text string) string {
+		offset := strings.Index(counterSource, text)
+		return fmt.Sprintf("%v:%v:0:-", offset, len(text))
+	}
+	set := "function set() external {\n        n = 1;\n    }"
+	unset := "function unset() external {\n        n = 2;\n    }"
+	return &bindutil.SourceMap{
+		Contract: "Counter",
+		Bytecode: counterRuntime,
+		Srcmap: strings.Join([]string{
+			entry(set), entry("n = 1"), entry("n = 1"), entry(set),
+			entry(unset), entry("n = 2"), entry("n = 2"), "0:0:-1:-",
+		}, ";"),
+		Sources: []string{"Counter.sol"},
+	}
+}
+
+func TestSimulatedCoverage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soltools")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Counter.sol"), []byte(counterSource), 0644))
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	alloc := core.GenesisAlloc{from: {Balance: big.NewInt(1e18)}}
+	sim := backends.NewSimulatedBackend(alloc, 8e6)
+
+	// The traced chain starts from the same genesis.
+	coverage, err := NewCoverage(dir, counterSourceMap(), &bindutil.SourceMap{Contract: "IERC20"})
+	require.NoError(t, err)
+	db := ethdb.NewMemDatabase()
+	genesis := core.Genesis{Config: params.AllEthashProtocolChanges, GasLimit: 8e6, Alloc: alloc}
+	genesis.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, ethash.NewFaker(), vm.Config{}, nil)
+	require.NoError(t, err)
+	covered := NewSimulatedCoverage(db, chain, coverage)
+
+	// Deploy Counter, with init code that returns counterRuntime, and a contract that returns the
+	// time, and call Counter in a transaction, after moving time ahead.
+	initCode := "600c80600b6000396000f3" + counterRuntime
+	deploy := sendTx(t, sim, covered, key, 0, nil, initCode)
+	receipt, err := sim.TransactionReceipt(context.Background(), deploy.Hash())
+	require.NoError(t, err)
+	deployed := receipt.ContractAddress
+	deploy = sendTx(t, sim, covered, key, 1, nil, "6009600c60003960096000f3"+"4260005260206000f3")
+	receipt, err = sim.TransactionReceipt(context.Background(), deploy.Hash())
+	require.NoError(t, err)
+	clock := receipt.ContractAddress
+	require.NoError(t, sim.AdjustTime(time.Hour))
+	covered.AdjustTime(time.Hour)
+	sim.Commit()
+	require.NoError(t, covered.Commit())
+	sendTx(t, sim, covered, key, 2, &deployed, "")
+
+	// The traced chain mined the same blocks.
+	now, err := sim.CallContract(context.Background(), ethereum.CallMsg{To: &clock}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), covered.CurrentBlock().NumberU64())
+	assert.Equal(t, new(big.Int).SetBytes(now).Uint64(), covered.CurrentBlock().Time())
+	assert.Equal(t, uint64(10+10+(10+3600)+10), covered.CurrentBlock().Time())
+
+	// And call it.
+	call := ethereum.CallMsg{From: from, To: &deployed}
+	require.NoError(t, covered.TraceCall(context.Background(), call, nil))
+
+	files, err := coverage.istanbul()
+	require.NoError(t, err)
+	path, err := filepath.Abs(filepath.Join(dir, "Counter.sol"))
+	require.NoError(t, err)
+	require.Contains(t, files, path)
+	encoded, err := json.Marshal(files[path])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"path": `+quote(path)+`,
+		"statementMap": {
+			"1": {"start": {"line": 7, "column": 8}, "end": {"line": 7, "column": 13}},
+			"2": {"start": {"line": 11, "column": 8}, "end": {"line": 11, "column": 13}}
+		},
+		"fnMap": {
+			"1": {"name": "set", "line": 6, "loc": {"start": {"line": 6, "column": 4}, "end": {"line": 8, "column": 5}}},
+			"2": {"name": "unset", "line": 10, "loc": {"start": {"line": 10, "column": 4}, "end": {"line": 12, "column": 5}}}
+		},
+		"branchMap": {},
+		"s": {"1": 2, "2": 0},
+		"f": {"1": 2, "2": 0},
+		"b": {},
+		"l": {"7": 2, "11": 0}
+	}`, string(encoded))
+}
+
+// sendTx sends a transaction from key to to, or creates a contract if to is nil, and commits it,
+// on both sim and covered.
+func sendTx(t *testing.T, sim *backends.SimulatedBackend, covered *SimulatedCoverage, key *ecdsa.PrivateKey, nonce uint64, to *common.Address, data string) *types.Transaction {
+	code, err := hex.DecodeString(data)
+	require.NoError(t, err)
+	var tx *types.Transaction
+	if to == nil {
+		tx = types.NewContractCreation(nonce, new(big.Int), 1e6, big.NewInt(1), code)
+	} else {
+		tx = types.NewTransaction(nonce, *to, new(big.Int), 1e6, big.NewInt(1), code)
+	}
+	tx, err = bind.NewKeyedTransactor(key).Signer(types.HomesteadSigner{}, crypto.PubkeyToAddress(key.PublicKey), tx)
+	require.NoError(t, err)
+	require.NoError(t, sim.SendTransaction(context.Background(), tx))
+	covered.SendTransaction(tx)
+	sim.Commit()
+	require.NoError(t, covered.Commit())
+	return tx
+}
+
+func quote(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
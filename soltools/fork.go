@@ -0,0 +1,489 @@
+package soltools
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethmath "github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/pkg/errors"
+)
+
+// ForkOptions configures a Fork made by NewFork.
+type ForkOptions struct {
+	// Source is the state to fork, such as a Snapshot loaded with LoadSnapshot, or an RPCSource.
+	// It is required.
+	Source StateSource
+
+	// Config is the chain configuration to run transactions with. It defaults to
+	// params.MainnetChainConfig.
+	Config *params.ChainConfig
+
+	// Alloc overrides accounts of the forked state, such as to fund the accounts that tests
+	// send transactions from. The balance and nonce of each account in Alloc replace the forked
+	// account's, as do its code and storage slots, if given.
+	Alloc core.GenesisAlloc
+
+	// GasLimit is the gas limit of the blocks that the Fork mines. It defaults to the gas limit
+	// of the forked block.
+	GasLimit uint64
+}
+
+// Fork is an in-process Ethereum node that runs on top of another chain's state, as of a block:
+// production state, say, as recorded in a Snapshot or served by an archive node. It fetches each
+// account and storage slot from its StateSource the first time it's used, and keeps every change
+// in memory, so tests can replay transactions against real state without changing it.
+//
+// Fork implements bind.ContractBackend, and TransactionReceipt, like *backends.SimulatedBackend,
+// except that it mines a block for every transaction it is sent. Calls and gas estimates only run
+// on the latest block, and FilterLogs only finds logs of the blocks that the Fork mined.
+type Fork struct {
+	config   *params.ChainConfig
+	gasLimit uint64
+	logsFeed event.Feed
+
+	mu         sync.Mutex
+	state      *forkState
+	forkedHash common.Hash     // The forked block's real hash.
+	headers    []*types.Header // The forked block, then each block mined since.
+	byHash     map[common.Hash]*types.Header
+	logs       [][]*types.Log // Logs of each of headers.
+	receipts   map[common.Hash]*types.Receipt
+}
+
+// NewFork returns a Fork of the state of opts.Source.
+func NewFork(ctx context.Context, opts ForkOptions) (*Fork, error) {
+	if opts.Source == nil {
+		return nil, errors.New("soltools: ForkOptions.Source is required")
+	}
+	if opts.Config == nil {
+		opts.Config = params.MainnetChainConfig
+	}
+	block, err := opts.Source.Block(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "soltools: getting the block to fork")
+	}
+	if opts.GasLimit == 0 {
+		opts.GasLimit = block.GasLimit
+	}
+
+	// The forked block's header only has what a Fork uses, so it doesn't hash to the real block's
+	// hash. The real one is kept for the first block that the Fork mines to refer to.
+	forked := &types.Header{
+		Number:     new(big.Int).SetUint64(block.Number),
+		Time:       block.Time,
+		GasLimit:   opts.GasLimit,
+		Difficulty: big.NewInt(1),
+	}
+	f := &Fork{
+		config:     opts.Config,
+		gasLimit:   opts.GasLimit,
+		state:      newForkState(opts.Source),
+		forkedHash: block.Hash,
+		headers:    []*types.Header{forked},
+		byHash:     map[common.Hash]*types.Header{block.Hash: forked},
+		logs:       [][]*types.Log{nil},
+		receipts:   make(map[common.Hash]*types.Receipt),
+	}
+	f.state.ctx = ctx
+	for address, account := range opts.Alloc {
+		f.alloc(address, account)
+	}
+	if err := f.state.err; err != nil {
+		return nil, err
+	}
+	f.state.finalise()
+	return f, nil
+}
+
+// alloc overrides the account at address with account.
+func (f *Fork) alloc(address common.Address, account core.GenesisAccount) {
+	if account.Balance != nil {
+		f.state.setBalance(address, new(big.Int).Set(account.Balance))
+	}
+	f.state.SetNonce(address, account.Nonce)
+	if account.Code != nil {
+		f.state.SetCode(address, account.Code)
+	}
+	for key, value := range account.Storage {
+		f.state.SetState(address, key, value)
+	}
+}
+
+// latest returns the latest block's header.
+func (f *Fork) latest() *types.Header {
+	return f.headers[len(f.headers)-1]
+}
+
+// forkChain is the core.ChainContext of a Fork's EVM, which looks up the hashes of the blocks it
+// mined, for the BLOCKHASH opcode. The hashes of blocks before the fork are zero.
+type forkChain struct {
+	*Fork
+}
+
+func (c forkChain) Engine() consensus.Engine { return nil }
+
+func (c forkChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.byHash[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+// newEVM returns an EVM to run msg at header. f.mu must be held.
+func (f *Fork) newEVM(ctx context.Context, msg core.Message, header *types.Header) *vm.EVM {
+	f.state.ctx = ctx
+	coinbase := header.Coinbase
+	return vm.NewEVM(core.NewEVMContext(msg, header, forkChain{f}, &coinbase), f.state, f.config, vm.Config{})
+}
+
+// SendTransaction implements bind.ContractTransactor. It mines a block for tx.
+func (f *Fork) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	f.mu.Lock()
+	logs, err := f.mine(ctx, tx, 0)
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if len(logs) > 0 {
+		f.logsFeed.Send(logs)
+	}
+	return nil
+}
+
+// AdjustTime mines an empty block, delta after the latest one, like
+// *backends.SimulatedBackend.AdjustTime followed by Commit.
+func (f *Fork) AdjustTime(delta time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := f.mine(context.Background(), nil, uint64(delta/time.Second))
+	return err
+}
+
+// mine mines a block with tx, if it isn't nil, at least 10 seconds (like
+// *backends.SimulatedBackend) plus delay after the latest block, and returns tx's logs. f.mu must
+// be held.
+func (f *Fork) mine(ctx context.Context, tx *types.Transaction, delay uint64) ([]*types.Log, error) {
+	parent := f.latest()
+	parentHash := parent.Hash()
+	if len(f.headers) == 1 {
+		parentHash = f.forkedHash
+	}
+	header := &types.Header{
+		ParentHash: parentHash,
+		Number:     new(big.Int).Add(parent.Number, big.NewInt(1)),
+		Time:       parent.Time + 10 + delay,
+		GasLimit:   f.gasLimit,
+		Difficulty: big.NewInt(1),
+	}
+	hash := header.Hash()
+
+	var logs []*types.Log
+	if tx != nil {
+		msg, err := tx.AsMessage(types.MakeSigner(f.config, header.Number))
+		if err != nil {
+			return nil, err
+		}
+		_, gas, failed, err := core.ApplyMessage(f.newEVM(ctx, msg, header), msg, new(core.GasPool).AddGas(header.GasLimit))
+		if err == nil {
+			err = f.state.err
+		}
+		if err != nil {
+			f.state.RevertToSnapshot(0)
+			f.state.finalise()
+			f.state.err = nil
+			return nil, err
+		}
+		logs = f.state.finalise()
+		for i, log := range logs {
+			log.BlockNumber = header.Number.Uint64()
+			log.BlockHash = hash
+			log.TxHash = tx.Hash()
+			log.TxIndex = 0
+			log.Index = uint(i)
+		}
+
+		receipt := types.NewReceipt(nil, failed, gas)
+		receipt.TxHash = tx.Hash()
+		receipt.GasUsed = gas
+		receipt.Logs = logs
+		if tx.To() == nil {
+			receipt.ContractAddress = crypto.CreateAddress(msg.From(), tx.Nonce())
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		f.receipts[tx.Hash()] = receipt
+	}
+
+	f.headers = append(f.headers, header)
+	f.byHash[hash] = header
+	f.logs = append(f.logs, logs)
+	return logs, nil
+}
+
+// TransactionReceipt returns the receipt of a transaction that f mined, or ethereum.NotFound.
+func (f *Fork) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if receipt, ok := f.receipts[txHash]; ok {
+		return receipt, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+// errNotLatest is returned for requests about blocks other than the latest, whose state a Fork
+// doesn't keep.
+var errNotLatest = errors.New("soltools: a Fork only has the state of its latest block")
+
+// CodeAt implements bind.ContractCaller.
+func (f *Fork) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if blockNumber != nil && blockNumber.Cmp(f.latest().Number) != 0 {
+		return nil, errNotLatest
+	}
+	return f.code(ctx, contract)
+}
+
+// PendingCodeAt implements bind.ContractTransactor. A Fork has no pending block, so it is
+// CodeAt the latest block.
+func (f *Fork) PendingCodeAt(ctx context.Context, contract common.Address) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.code(ctx, contract)
+}
+
+// code returns the code at contract. f.mu must be held.
+func (f *Fork) code(ctx context.Context, contract common.Address) ([]byte, error) {
+	f.state.ctx = ctx
+	code := f.state.GetCode(contract)
+	return code, f.takeError()
+}
+
+// PendingNonceAt implements bind.ContractTransactor.
+func (f *Fork) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.state.ctx = ctx
+	nonce := f.state.GetNonce(account)
+	return nonce, f.takeError()
+}
+
+// takeError returns and clears any error getting state from the source. f.mu must be held.
+func (f *Fork) takeError() error {
+	err := f.state.err
+	f.state.err = nil
+	return err
+}
+
+// SuggestGasPrice implements bind.ContractTransactor. It suggests 1 wei, like
+// *backends.SimulatedBackend.
+func (f *Fork) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(1), nil
+}
+
+// CallContract implements bind.ContractCaller.
+func (f *Fork) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if blockNumber != nil && blockNumber.Cmp(f.latest().Number) != 0 {
+		return nil, errNotLatest
+	}
+	output, _, _, err := f.call(ctx, call)
+	return output, err
+}
+
+// PendingCallContract implements bind.PendingContractCaller. A Fork has no pending block, so it
+// is CallContract on the latest block.
+func (f *Fork) PendingCallContract(ctx context.Context, call ethereum.CallMsg) ([]byte, error) {
+	return f.CallContract(ctx, call, nil)
+}
+
+// EstimateGas implements bind.ContractTransactor, searching for the least gas that call succeeds
+// with, like *backends.SimulatedBackend.
+func (f *Fork) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lo, hi := params.TxGas-1, f.gasLimit
+	if call.Gas >= params.TxGas {
+		hi = call.Gas
+	}
+	limit := hi
+	executable := func(gas uint64) (bool, error) {
+		call.Gas = gas
+		_, _, failed, err := f.call(ctx, call)
+		if err != nil {
+			if _, fetching := errors.Cause(err).(fetchError); fetching {
+				return false, err
+			}
+			return false, nil
+		}
+		return !failed, nil
+	}
+	for lo+1 < hi {
+		mid := (hi + lo) / 2
+		ok, err := executable(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	if hi == limit {
+		ok, err := executable(hi)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, errors.New("gas required exceeds allowance or always failing transaction")
+		}
+	}
+	return hi, nil
+}
+
+// fetchError wraps an error getting state from a Fork's source, to tell it apart from the EVM's
+// errors.
+type fetchError struct {
+	error
+}
+
+// call runs call on the latest block, and reverts its changes. f.mu must be held.
+func (f *Fork) call(ctx context.Context, call ethereum.CallMsg) (output []byte, gas uint64, failed bool, err error) {
+	if call.GasPrice == nil {
+		call.GasPrice = big.NewInt(1)
+	}
+	if call.Gas == 0 {
+		call.Gas = 50000000
+	}
+	if call.Value == nil {
+		call.Value = new(big.Int)
+	}
+	defer func() {
+		f.state.RevertToSnapshot(0)
+		f.state.finalise()
+	}()
+
+	f.state.ctx = ctx
+	f.state.setBalance(call.From, ethmath.MaxBig256)
+	msg := callMessage{call}
+	output, gas, failed, err = core.ApplyMessage(
+		f.newEVM(ctx, msg, f.latest()), msg, new(core.GasPool).AddGas(math.MaxUint64),
+	)
+	if fetchErr := f.takeError(); fetchErr != nil {
+		return nil, 0, false, fetchError{fetchErr}
+	}
+	return output, gas, failed, err
+}
+
+// FilterLogs implements bind.ContractFilterer, for the blocks that f mined. Logs of earlier blocks
+// aren't available.
+func (f *Fork) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var blocks [][]*types.Log
+	if q.BlockHash != nil {
+		header := f.byHash[*q.BlockHash]
+		if header == nil {
+			return nil, errors.Errorf("soltools: unknown block %v", q.BlockHash.Hex())
+		}
+		blocks = [][]*types.Log{f.logs[header.Number.Uint64()-f.headers[0].Number.Uint64()]}
+	} else {
+		first, latest := f.headers[0].Number.Uint64(), f.latest().Number.Uint64()
+		from, to := first, latest
+		if q.FromBlock != nil && q.FromBlock.Uint64() > from {
+			from = q.FromBlock.Uint64()
+		}
+		if q.ToBlock != nil && q.ToBlock.Uint64() < to {
+			to = q.ToBlock.Uint64()
+		}
+		if from <= to {
+			blocks = f.logs[from-first : to-first+1]
+		}
+	}
+
+	var result []types.Log
+	for _, logs := range blocks {
+		for _, log := range logs {
+			if matchesFilter(log, q) {
+				result = append(result, *log)
+			}
+		}
+	}
+	return result, nil
+}
+
+// SubscribeFilterLogs implements bind.ContractFilterer, sending the logs that match q of each
+// block that f mines from now on. SendTransaction waits for every subscription to take the logs
+// of its block, so ch must be read from until the subscription is unsubscribed.
+func (f *Fork) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	mined := make(chan []*types.Log)
+	sub := f.logsFeed.Subscribe(mined)
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case logs := <-mined:
+				for _, log := range logs {
+					if !matchesFilter(log, q) {
+						continue
+					}
+					select {
+					case ch <- *log:
+					case err := <-sub.Err():
+						return err
+					case <-quit:
+						return nil
+					}
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// matchesFilter reports whether log matches the addresses and topics of q.
+func matchesFilter(log *types.Log, q ethereum.FilterQuery) bool {
+	if len(q.Addresses) > 0 {
+		found := false
+		for _, address := range q.Addresses {
+			found = found || log.Address == address
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(q.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, topics := range q.Topics {
+		if len(topics) == 0 {
+			continue // Any topic matches.
+		}
+		found := false
+		for _, topic := range topics {
+			found = found || log.Topics[i] == topic
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
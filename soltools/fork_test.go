@@ -0,0 +1,158 @@
+package soltools
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registerCode is hand-assembled bytecode of a contract with one register, in storage slot 0.
+// Called with no data, it returns the register. Called with a word of data, it stores the word in
+// the register and emits an empty LOG0.
+const registerCode = "3615601157" + // CALLDATASIZE, ISZERO, PUSH1 get, JUMPI
+	"600035600055" + // PUSH1 0, CALLDATALOAD, PUSH1 0, SSTORE
+	"60006000a000" + // PUSH1 0, PUSH1 0, LOG0, STOP
+	"5b60005460005260206000f3" // get: JUMPDEST, PUSH1 0, SLOAD, PUSH1 0, MSTORE, PUSH1 32, PUSH1 0, RETURN
+
+var registerAddress = common.HexToAddress("0x4922a3ba6d9f1b9be9e4bb7e6b1ea8c4c8ac3f0f")
+
+// registerSnapshot returns a Snapshot, of a block after Petersburg, in which the register holds 7.
+func registerSnapshot() *Snapshot {
+	code, _ := hex.DecodeString(registerCode)
+	return &Snapshot{
+		ForkBlock: ForkBlock{Number: 8000000, Time: 1560000000, Hash: common.Hash{8}, GasLimit: 8000000},
+		Accounts: map[common.Address]SnapshotAccount{
+			registerAddress: {
+				Balance: (*hexutil.Big)(new(big.Int)),
+				Nonce:   1,
+				Code:    code,
+				Storage: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(7))},
+			},
+		},
+	}
+}
+
+func TestFork(t *testing.T) {
+	ctx := context.Background()
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+
+	recorder := NewRecorder(registerSnapshot())
+	fork, err := NewFork(ctx, ForkOptions{
+		Source: recorder,
+		Alloc:  core.GenesisAlloc{from: {Balance: big.NewInt(1e18)}},
+	})
+	require.NoError(t, err)
+
+	// The register holds what the snapshot says.
+	register := func() int64 {
+		output, err := fork.CallContract(ctx, ethereum.CallMsg{From: from, To: &registerAddress}, nil)
+		require.NoError(t, err)
+		return new(big.Int).SetBytes(output).Int64()
+	}
+	assert.EqualValues(t, 7, register())
+
+	logs := make(chan types.Log, 1)
+	sub, err := fork.SubscribeFilterLogs(ctx, ethereum.FilterQuery{Addresses: []common.Address{registerAddress}}, logs)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// Set it to 9, in a block on top of the forked one.
+	data := common.BigToHash(big.NewInt(9)).Bytes()
+	gas, err := fork.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &registerAddress, Data: data})
+	require.NoError(t, err)
+	assert.True(t, gas > 21000 && gas < 100000, "gas %v", gas)
+	tx, err := types.SignTx(types.NewTransaction(0, registerAddress, new(big.Int), gas, big.NewInt(1), data), types.HomesteadSigner{}, key)
+	require.NoError(t, err)
+	require.NoError(t, fork.SendTransaction(ctx, tx))
+
+	receipt, err := fork.TransactionReceipt(ctx, tx.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, types.ReceiptStatusSuccessful, receipt.Status)
+	require.Len(t, receipt.Logs, 1)
+	assert.EqualValues(t, 8000001, receipt.Logs[0].BlockNumber)
+	assert.EqualValues(t, 9, register())
+
+	select {
+	case log := <-logs:
+		assert.Equal(t, tx.Hash(), log.TxHash)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no log")
+	}
+	filtered, err := fork.FilterLogs(ctx, ethereum.FilterQuery{FromBlock: big.NewInt(8000001)})
+	require.NoError(t, err)
+	assert.Len(t, filtered, 1)
+	filtered, err = fork.FilterLogs(ctx, ethereum.FilterQuery{Topics: [][]common.Hash{{{1}}}})
+	require.NoError(t, err)
+	assert.Len(t, filtered, 0)
+
+	// Replaying the transaction fails, and changes nothing.
+	assert.Error(t, fork.SendTransaction(ctx, tx))
+	_, err = fork.TransactionReceipt(ctx, common.Hash{})
+	assert.Equal(t, ethereum.NotFound, err)
+
+	// The recording has the state that was used, as it was before the fork changed it.
+	recorded := recorder.Snapshot()
+	assert.Equal(t, registerSnapshot().ForkBlock, recorded.ForkBlock)
+	assert.Equal(t, registerSnapshot().Accounts[registerAddress], recorded.Accounts[registerAddress])
+	assert.Contains(t, recorded.Accounts, from)
+
+	// And it can be saved, and loaded to fork again.
+	dir, err := ioutil.TempDir("", "soltools")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+	require.NoError(t, recorded.WriteFile(path))
+	loaded, err := LoadSnapshot(path)
+	require.NoError(t, err)
+	want, err := json.Marshal(recorded)
+	require.NoError(t, err)
+	got, err := json.Marshal(loaded)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), string(got))
+
+	// Time moves on.
+	require.NoError(t, fork.AdjustTime(time.Hour))
+	assert.EqualValues(t, 1560000000+10+10+3600, fork.latest().Time)
+}
+
+// failingSource is a StateSource whose accounts can't be found.
+type failingSource struct {
+	*Snapshot
+}
+
+func (failingSource) Account(ctx context.Context, address common.Address) (ForkAccount, error) {
+	return ForkAccount{}, errors.New("no such account")
+}
+
+func TestForkSourceError(t *testing.T) {
+	ctx := context.Background()
+	fork, err := NewFork(ctx, ForkOptions{Source: failingSource{registerSnapshot()}})
+	require.NoError(t, err)
+
+	_, err = fork.CallContract(ctx, ethereum.CallMsg{To: &registerAddress}, nil)
+	assert.EqualError(t, err, "soltools: fork: getting account "+common.Address{}.Hex()+": no such account")
+	_, err = fork.EstimateGas(ctx, ethereum.CallMsg{To: &registerAddress})
+	assert.Error(t, err)
+	_, err = fork.CodeAt(ctx, registerAddress, nil)
+	assert.EqualError(t, err, "soltools: fork: getting account "+registerAddress.Hex()+": no such account")
+	_, err = fork.CodeAt(ctx, registerAddress, big.NewInt(1))
+	assert.Equal(t, errNotLatest, err)
+}
@@ -0,0 +1,258 @@
+package soltools
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/pkg/errors"
+)
+
+// StateSource is the state that a Fork forks: the accounts and storage of a chain as of some
+// block. A Fork only asks for the accounts and storage slots that its transactions and calls use,
+// when they first use them.
+type StateSource interface {
+	// Block returns the block whose state is forked.
+	Block(ctx context.Context) (ForkBlock, error)
+
+	// Account returns the balance, nonce, and code of address. Accounts that don't exist are
+	// empty.
+	Account(ctx context.Context, address common.Address) (ForkAccount, error)
+
+	// Storage returns the value at key in the storage of address.
+	Storage(ctx context.Context, address common.Address, key common.Hash) (common.Hash, error)
+}
+
+// ForkBlock is the block whose state a Fork forks. The Fork mines its own blocks on top of it.
+type ForkBlock struct {
+	Number   uint64      `json:"number"`
+	Time     uint64      `json:"time"`
+	Hash     common.Hash `json:"hash"`
+	GasLimit uint64      `json:"gasLimit"`
+}
+
+// ForkAccount is an account, without its storage, as a StateSource reports it.
+type ForkAccount struct {
+	Balance *big.Int
+	Nonce   uint64
+	Code    []byte
+}
+
+// Snapshot is a StateSource of recorded state, such as a Recorder records, that a Fork can run
+// on offline. Accounts and storage slots that aren't in it are empty.
+//
+// Snapshots are stored as JSON:
+//
+//	{
+//		"block": {"number": 7900000, "time": 1559000000, "hash": "0x...", "gasLimit": 8000000},
+//		"accounts": {
+//			"0x196f...": {"balance": "0x0", "nonce": 1, "code": "0x6080...", "storage": {"0x00...": "0x00..."}}
+//		}
+//	}
+type Snapshot struct {
+	ForkBlock ForkBlock                          `json:"block"`
+	Accounts  map[common.Address]SnapshotAccount `json:"accounts"`
+}
+
+// SnapshotAccount is an account in a Snapshot, with the storage slots that were recorded.
+type SnapshotAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// LoadSnapshot reads a Snapshot from the JSON file at path.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	encoded, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "soltools: loading snapshot")
+	}
+	snapshot := new(Snapshot)
+	if err := json.Unmarshal(encoded, snapshot); err != nil {
+		return nil, errors.Wrapf(err, "soltools: loading snapshot %v", path)
+	}
+	return snapshot, nil
+}
+
+// WriteFile writes s to the file at path as JSON.
+func (s *Snapshot) WriteFile(path string) error {
+	encoded, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, encoded, 0644)
+}
+
+// Block implements StateSource.
+func (s *Snapshot) Block(ctx context.Context) (ForkBlock, error) {
+	return s.ForkBlock, nil
+}
+
+// Account implements StateSource.
+func (s *Snapshot) Account(ctx context.Context, address common.Address) (ForkAccount, error) {
+	account := s.Accounts[address]
+	result := ForkAccount{Balance: new(big.Int), Nonce: account.Nonce, Code: account.Code}
+	if account.Balance != nil {
+		result.Balance.Set(account.Balance.ToInt())
+	}
+	return result, nil
+}
+
+// Storage implements StateSource.
+func (s *Snapshot) Storage(ctx context.Context, address common.Address, key common.Hash) (common.Hash, error) {
+	return s.Accounts[address].Storage[key], nil
+}
+
+// RPCSource is a StateSource that asks an Ethereum node, such as a local archive node or a
+// stand-in for one, for the state as of a given block.
+type RPCSource struct {
+	client *ethclient.Client
+	block  ForkBlock
+}
+
+// NewRPCSource dials the node at url and returns an RPCSource of its state as of blockNumber, or
+// as of its latest block when NewRPCSource is called if blockNumber is nil. The caller is
+// responsible for calling Close.
+func NewRPCSource(ctx context.Context, url string, blockNumber *big.Int) (*RPCSource, error) {
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "dialing %v", url)
+	}
+	header, err := client.HeaderByNumber(ctx, blockNumber)
+	if err != nil {
+		client.Close()
+		return nil, errors.Wrap(err, "soltools: getting the block to fork")
+	}
+	return &RPCSource{
+		client: client,
+		block: ForkBlock{
+			Number:   header.Number.Uint64(),
+			Time:     header.Time,
+			Hash:     header.Hash(),
+			GasLimit: header.GasLimit,
+		},
+	}, nil
+}
+
+// Close closes the connection to the node.
+func (s *RPCSource) Close() {
+	s.client.Close()
+}
+
+// Block implements StateSource.
+func (s *RPCSource) Block(ctx context.Context) (ForkBlock, error) {
+	return s.block, nil
+}
+
+// Account implements StateSource.
+func (s *RPCSource) Account(ctx context.Context, address common.Address) (ForkAccount, error) {
+	number := new(big.Int).SetUint64(s.block.Number)
+	balance, err := s.client.BalanceAt(ctx, address, number)
+	if err != nil {
+		return ForkAccount{}, err
+	}
+	nonce, err := s.client.NonceAt(ctx, address, number)
+	if err != nil {
+		return ForkAccount{}, err
+	}
+	code, err := s.client.CodeAt(ctx, address, number)
+	if err != nil {
+		return ForkAccount{}, err
+	}
+	return ForkAccount{Balance: balance, Nonce: nonce, Code: code}, nil
+}
+
+// Storage implements StateSource.
+func (s *RPCSource) Storage(ctx context.Context, address common.Address, key common.Hash) (common.Hash, error) {
+	value, err := s.client.StorageAt(ctx, address, key, new(big.Int).SetUint64(s.block.Number))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(value), nil
+}
+
+// Recorder is a StateSource that passes requests through to another, and records what it
+// returns, so that a run against a node can be saved as a Snapshot and repeated offline.
+type Recorder struct {
+	source StateSource
+
+	mu       sync.Mutex
+	snapshot Snapshot
+}
+
+// NewRecorder returns a Recorder of source.
+func NewRecorder(source StateSource) *Recorder {
+	return &Recorder{
+		source:   source,
+		snapshot: Snapshot{Accounts: make(map[common.Address]SnapshotAccount)},
+	}
+}
+
+// Snapshot returns everything recorded so far.
+func (r *Recorder) Snapshot() *Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot := &Snapshot{ForkBlock: r.snapshot.ForkBlock, Accounts: make(map[common.Address]SnapshotAccount)}
+	for address, account := range r.snapshot.Accounts {
+		if account.Storage != nil {
+			storage := make(map[common.Hash]common.Hash, len(account.Storage))
+			for key, value := range account.Storage {
+				storage[key] = value
+			}
+			account.Storage = storage
+		}
+		snapshot.Accounts[address] = account
+	}
+	return snapshot
+}
+
+// Block implements StateSource.
+func (r *Recorder) Block(ctx context.Context) (ForkBlock, error) {
+	block, err := r.source.Block(ctx)
+	if err != nil {
+		return ForkBlock{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.snapshot.ForkBlock = block
+	return block, nil
+}
+
+// Account implements StateSource.
+func (r *Recorder) Account(ctx context.Context, address common.Address) (ForkAccount, error) {
+	account, err := r.source.Account(ctx, address)
+	if err != nil {
+		return ForkAccount{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recorded := r.snapshot.Accounts[address]
+	recorded.Balance = (*hexutil.Big)(new(big.Int).Set(account.Balance))
+	recorded.Nonce = account.Nonce
+	recorded.Code = common.CopyBytes(account.Code)
+	r.snapshot.Accounts[address] = recorded
+	return account, nil
+}
+
+// Storage implements StateSource.
+func (r *Recorder) Storage(ctx context.Context, address common.Address, key common.Hash) (common.Hash, error) {
+	value, err := r.source.Storage(ctx, address, key)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	recorded := r.snapshot.Accounts[address]
+	if recorded.Storage == nil {
+		recorded.Storage = make(map[common.Hash]common.Hash)
+	}
+	recorded.Storage[key] = value
+	r.snapshot.Accounts[address] = recorded
+	return value, nil
+}
@@ -0,0 +1,321 @@
+package soltools
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// forkState implements vm.StateDB on top of a StateSource, which it asks for each account and
+// storage slot the first time it is used, keeping every change in memory.
+//
+// vm.StateDB can't fail, so when the source does, forkState acts as if the account or slot were
+// empty, and records the error in err. Whoever runs the EVM must check err afterward, and throw
+// away the result if it is set.
+type forkState struct {
+	ctx    context.Context // Context of requests to source; set for each operation.
+	source StateSource
+	err    error
+
+	accounts map[common.Address]*forkAccount
+	touched  map[common.Address]bool // Accounts changed by the current transaction.
+	journal  []func()                // Undoes each change made by the current transaction.
+	refund   uint64
+	logs     []*types.Log // Logs of the current transaction.
+}
+
+// forkAccount is an account of a forkState.
+type forkAccount struct {
+	exists   bool
+	balance  *big.Int
+	nonce    uint64
+	code     []byte
+	codeHash common.Hash
+	suicided bool
+
+	// created is set for accounts created since the fork, whose storage started out empty
+	// rather than in the source.
+	created bool
+
+	storage   map[common.Hash]common.Hash // Every slot read or written so far.
+	committed map[common.Hash]common.Hash // Slots written by the current transaction, as they were before it.
+}
+
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+func newForkState(source StateSource) *forkState {
+	return &forkState{
+		ctx:      context.Background(),
+		source:   source,
+		accounts: make(map[common.Address]*forkAccount),
+		touched:  make(map[common.Address]bool),
+	}
+}
+
+// newAccount returns an empty account that was created since the fork.
+func newAccount() *forkAccount {
+	return &forkAccount{
+		balance:   new(big.Int),
+		codeHash:  emptyCodeHash,
+		created:   true,
+		storage:   make(map[common.Hash]common.Hash),
+		committed: make(map[common.Hash]common.Hash),
+	}
+}
+
+// account returns the account at address, asking the source for it if it hasn't been used yet.
+func (s *forkState) account(address common.Address) *forkAccount {
+	if account, ok := s.accounts[address]; ok {
+		return account
+	}
+	account := newAccount()
+	account.created = false
+	fetched, err := s.source.Account(s.ctx, address)
+	if err != nil {
+		// Don't keep the empty stand-in, so the account is asked for again next time.
+		s.fail(errors.Wrapf(err, "getting account %v", address.Hex()))
+		return account
+	}
+	if fetched.Balance != nil {
+		account.balance.Set(fetched.Balance)
+	}
+	account.nonce = fetched.Nonce
+	account.code = fetched.Code
+	account.codeHash = crypto.Keccak256Hash(fetched.Code)
+	account.exists = !account.empty()
+	s.accounts[address] = account
+	return account
+}
+
+func (s *forkState) fail(err error) {
+	if s.err == nil {
+		s.err = errors.Wrap(err, "soltools: fork")
+	}
+}
+
+func (a *forkAccount) empty() bool {
+	return a.nonce == 0 && a.balance.Sign() == 0 && len(a.code) == 0
+}
+
+// change records undo, which reverts a change to the account at address.
+func (s *forkState) change(address common.Address, undo func()) {
+	s.touched[address] = true
+	s.journal = append(s.journal, undo)
+}
+
+// CreateAccount implements vm.StateDB. The new account keeps the balance of any account it
+// replaces.
+func (s *forkState) CreateAccount(address common.Address) {
+	previous := s.account(address)
+	account := newAccount()
+	account.exists = true
+	account.balance.Set(previous.balance)
+	s.accounts[address] = account
+	s.change(address, func() { s.accounts[address] = previous })
+}
+
+// SubBalance implements vm.StateDB.
+func (s *forkState) SubBalance(address common.Address, amount *big.Int) {
+	s.AddBalance(address, new(big.Int).Neg(amount))
+}
+
+// AddBalance implements vm.StateDB.
+func (s *forkState) AddBalance(address common.Address, amount *big.Int) {
+	s.setBalance(address, new(big.Int).Add(s.account(address).balance, amount))
+}
+
+// setBalance sets the balance of the account at address, creating it if need be.
+func (s *forkState) setBalance(address common.Address, balance *big.Int) {
+	account := s.account(address)
+	previous, existed := account.balance, account.exists
+	account.balance, account.exists = balance, true
+	s.change(address, func() { account.balance, account.exists = previous, existed })
+}
+
+// GetBalance implements vm.StateDB.
+func (s *forkState) GetBalance(address common.Address) *big.Int {
+	return new(big.Int).Set(s.account(address).balance)
+}
+
+// GetNonce implements vm.StateDB.
+func (s *forkState) GetNonce(address common.Address) uint64 {
+	return s.account(address).nonce
+}
+
+// SetNonce implements vm.StateDB.
+func (s *forkState) SetNonce(address common.Address, nonce uint64) {
+	account := s.account(address)
+	previous, existed := account.nonce, account.exists
+	account.nonce, account.exists = nonce, true
+	s.change(address, func() { account.nonce, account.exists = previous, existed })
+}
+
+// GetCodeHash implements vm.StateDB. It is zero for accounts that don't exist.
+func (s *forkState) GetCodeHash(address common.Address) common.Hash {
+	account := s.account(address)
+	if !account.exists {
+		return common.Hash{}
+	}
+	return account.codeHash
+}
+
+// GetCode implements vm.StateDB.
+func (s *forkState) GetCode(address common.Address) []byte {
+	return s.account(address).code
+}
+
+// SetCode implements vm.StateDB.
+func (s *forkState) SetCode(address common.Address, code []byte) {
+	account := s.account(address)
+	previous, previousHash, existed := account.code, account.codeHash, account.exists
+	account.code, account.codeHash, account.exists = code, crypto.Keccak256Hash(code), true
+	s.change(address, func() { account.code, account.codeHash, account.exists = previous, previousHash, existed })
+}
+
+// GetCodeSize implements vm.StateDB.
+func (s *forkState) GetCodeSize(address common.Address) int {
+	return len(s.account(address).code)
+}
+
+// AddRefund implements vm.StateDB.
+func (s *forkState) AddRefund(gas uint64) {
+	previous := s.refund
+	s.refund += gas
+	s.journal = append(s.journal, func() { s.refund = previous })
+}
+
+// SubRefund implements vm.StateDB.
+func (s *forkState) SubRefund(gas uint64) {
+	previous := s.refund
+	if gas > s.refund {
+		panic("refund counter below zero")
+	}
+	s.refund -= gas
+	s.journal = append(s.journal, func() { s.refund = previous })
+}
+
+// GetRefund implements vm.StateDB.
+func (s *forkState) GetRefund() uint64 {
+	return s.refund
+}
+
+// GetCommittedState implements vm.StateDB.
+func (s *forkState) GetCommittedState(address common.Address, key common.Hash) common.Hash {
+	if value, ok := s.account(address).committed[key]; ok {
+		return value
+	}
+	return s.GetState(address, key)
+}
+
+// GetState implements vm.StateDB.
+func (s *forkState) GetState(address common.Address, key common.Hash) common.Hash {
+	account := s.account(address)
+	if value, ok := account.storage[key]; ok || account.created {
+		return value
+	}
+	value, err := s.source.Storage(s.ctx, address, key)
+	if err != nil {
+		s.fail(errors.Wrapf(err, "getting storage %v of %v", key.Hex(), address.Hex()))
+		return common.Hash{}
+	}
+	account.storage[key] = value
+	return value
+}
+
+// SetState implements vm.StateDB.
+func (s *forkState) SetState(address common.Address, key, value common.Hash) {
+	previous := s.GetState(address, key)
+	account := s.account(address)
+	if _, ok := account.committed[key]; !ok {
+		account.committed[key] = previous
+	}
+	account.storage[key] = value
+	s.change(address, func() { account.storage[key] = previous })
+}
+
+// Suicide implements vm.StateDB.
+func (s *forkState) Suicide(address common.Address) bool {
+	account := s.account(address)
+	if !account.exists {
+		return false
+	}
+	previous, suicided := account.balance, account.suicided
+	account.balance, account.suicided = new(big.Int), true
+	s.change(address, func() { account.balance, account.suicided = previous, suicided })
+	return true
+}
+
+// HasSuicided implements vm.StateDB.
+func (s *forkState) HasSuicided(address common.Address) bool {
+	return s.account(address).suicided
+}
+
+// Exist implements vm.StateDB.
+func (s *forkState) Exist(address common.Address) bool {
+	account := s.account(address)
+	return account.exists || account.suicided
+}
+
+// Empty implements vm.StateDB.
+func (s *forkState) Empty(address common.Address) bool {
+	account := s.account(address)
+	return !account.exists || account.empty()
+}
+
+// RevertToSnapshot implements vm.StateDB.
+func (s *forkState) RevertToSnapshot(id int) {
+	for i := len(s.journal) - 1; i >= id; i-- {
+		s.journal[i]()
+	}
+	s.journal = s.journal[:id]
+}
+
+// Snapshot implements vm.StateDB.
+func (s *forkState) Snapshot() int {
+	return len(s.journal)
+}
+
+// AddLog implements vm.StateDB.
+func (s *forkState) AddLog(log *types.Log) {
+	s.logs = append(s.logs, log)
+	n := len(s.logs) - 1
+	s.journal = append(s.journal, func() { s.logs = s.logs[:n] })
+}
+
+// AddPreimage implements vm.StateDB. Preimages aren't kept.
+func (s *forkState) AddPreimage(hash common.Hash, preimage []byte) {}
+
+// ForEachStorage implements vm.StateDB, for the storage slots that have been used so far.
+func (s *forkState) ForEachStorage(address common.Address, f func(key, value common.Hash) bool) {
+	for key, value := range s.account(address).storage {
+		if !f(key, value) {
+			return
+		}
+	}
+}
+
+// finalise ends the current transaction: it removes accounts that self-destructed or were left
+// empty, and returns the transaction's logs. The transaction can't be reverted after this.
+func (s *forkState) finalise() []*types.Log {
+	for address := range s.touched {
+		account := s.accounts[address]
+		if account == nil {
+			continue // The source failed to return it; nothing was kept.
+		}
+		if account.suicided || account.empty() {
+			s.accounts[address] = newAccount()
+		} else {
+			account.committed = make(map[common.Hash]common.Hash)
+		}
+	}
+	logs := s.logs
+	s.touched = make(map[common.Address]bool)
+	s.journal = nil
+	s.refund = 0
+	s.logs = nil
+	return logs
+}
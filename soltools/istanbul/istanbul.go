@@ -0,0 +1,224 @@
+// Package istanbul reads, merges, and reports on code coverage in Istanbul's format, which is
+// what soltools' Coverage and 0x's sol-coverage write, and checks it against thresholds.
+package istanbul
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Coverage is the coverage of a set of source files, keyed by the path of each.
+type Coverage map[string]*File
+
+// File is the coverage of a source file: the statements, functions, and branches in it, keyed
+// by IDs, and how many times each ran. sol-profiler writes its gas profiles in the same format,
+// with gas in place of hit counts.
+type File struct {
+	Path         string              `json:"path"`
+	StatementMap map[string]Range    `json:"statementMap"`
+	FnMap        map[string]Function `json:"fnMap"`
+	BranchMap    map[string]Branch   `json:"branchMap"`
+	S            map[string]uint64   `json:"s"`
+	F            map[string]uint64   `json:"f"`
+	B            map[string][]uint64 `json:"b"`
+
+	// L is the hits of each line, keyed by its line number. It is optional; without it, a line
+	// has run as often as the statement that starts on it which ran the most.
+	L map[string]uint64 `json:"l,omitempty"`
+}
+
+// Function is a function in a File.
+type Function struct {
+	Name string `json:"name"`
+	Line int    `json:"line"`
+	Loc  Range  `json:"loc"`
+}
+
+// Branch is a branch point in a File, such as an if statement, with the location of each of
+// its branches.
+type Branch struct {
+	Line      int     `json:"line"`
+	Type      string  `json:"type"`
+	Locations []Range `json:"locations"`
+}
+
+// Range is a range of a source file.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Position is a position in a source file. Lines count from 1 and columns from 0.
+type Position struct {
+	Line int `json:"line"`
+	// Column is 0-based on purpose, unlike bindutil.Position.Column: that is Istanbul's format,
+	// and what sol-coverage writes.
+	Column int `json:"column"`
+}
+
+// NewFile returns a File at path with no coverage.
+func NewFile(path string) *File {
+	return &File{
+		Path:         path,
+		StatementMap: make(map[string]Range),
+		FnMap:        make(map[string]Function),
+		BranchMap:    make(map[string]Branch),
+		S:            make(map[string]uint64),
+		F:            make(map[string]uint64),
+		B:            make(map[string][]uint64),
+		L:            make(map[string]uint64),
+	}
+}
+
+// Load reads Coverage from the JSON file at path, such as coverage/coverage.json.
+func Load(path string) (Coverage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "istanbul: loading coverage")
+	}
+	defer f.Close()
+	coverage, err := decode(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "istanbul: loading coverage %v", path)
+	}
+	return coverage, nil
+}
+
+// Parse reads Coverage in JSON from r.
+func Parse(r io.Reader) (Coverage, error) {
+	coverage, err := decode(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "istanbul: parsing coverage")
+	}
+	return coverage, nil
+}
+
+func decode(r io.Reader) (Coverage, error) {
+	var coverage Coverage
+	if err := json.NewDecoder(r).Decode(&coverage); err != nil {
+		return nil, err
+	}
+	for path, file := range coverage {
+		if file == nil {
+			return nil, errors.Errorf("%v has no coverage", path)
+		}
+	}
+	return coverage, nil
+}
+
+// WriteFile writes c to the file at path as JSON, creating its directory if need be.
+func (c Coverage) WriteFile(path string) error {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, encoded, 0644)
+}
+
+// Merge returns the coverage of every run in runs together: the hits of each statement,
+// function, branch, and line add up across runs. Statements, functions, and branches are
+// matched by their locations rather than their IDs, since different runs, such as runs that
+// deployed different contracts, may number the same file differently.
+func Merge(runs ...Coverage) Coverage {
+	result := make(Coverage)
+	for _, run := range runs {
+		for path, file := range run {
+			if result[path] == nil {
+				result[path] = NewFile(file.Path)
+			}
+			result[path].merge(file)
+		}
+	}
+	return result
+}
+
+// merge adds the hits of other, a run of the same file, to f, which Merge made, so that its
+// IDs count from 1 with no gaps.
+func (f *File) merge(other *File) {
+	statements := make(map[Range]string)
+	for id, r := range f.StatementMap {
+		statements[r] = id
+	}
+	for id, r := range other.StatementMap {
+		key, ok := statements[r]
+		if !ok {
+			key = strconv.Itoa(len(f.StatementMap) + 1)
+			f.StatementMap[key] = r
+			statements[r] = key
+		}
+		f.S[key] += other.S[id]
+	}
+
+	type function struct {
+		name string
+		loc  Range
+	}
+	functions := make(map[function]string)
+	for id, fn := range f.FnMap {
+		functions[function{fn.Name, fn.Loc}] = id
+	}
+	for id, fn := range other.FnMap {
+		key, ok := functions[function{fn.Name, fn.Loc}]
+		if !ok {
+			key = strconv.Itoa(len(f.FnMap) + 1)
+			f.FnMap[key] = fn
+			functions[function{fn.Name, fn.Loc}] = key
+		}
+		f.F[key] += other.F[id]
+	}
+
+	// Branches have lists of locations, so they're matched by their encodings.
+	branches := make(map[string]string)
+	for id, branch := range f.BranchMap {
+		encoded, _ := json.Marshal(branch)
+		branches[string(encoded)] = id
+	}
+	for id, branch := range other.BranchMap {
+		encoded, _ := json.Marshal(branch)
+		key, ok := branches[string(encoded)]
+		if !ok {
+			key = strconv.Itoa(len(f.BranchMap) + 1)
+			f.BranchMap[key] = branch
+			branches[string(encoded)] = key
+			f.B[key] = make([]uint64, len(branch.Locations))
+		}
+		for i, hits := range other.B[id] {
+			if i < len(f.B[key]) {
+				f.B[key][i] += hits
+			}
+		}
+	}
+
+	for line, hits := range other.lines() {
+		f.L[strconv.Itoa(line)] += hits
+	}
+}
+
+// lines returns the hits of each line of f that has statements, keyed by its line number.
+func (f *File) lines() map[int]uint64 {
+	result := make(map[int]uint64)
+	if len(f.L) > 0 {
+		for key, hits := range f.L {
+			if line, err := strconv.Atoi(key); err == nil {
+				result[line] = hits
+			}
+		}
+		return result
+	}
+	for id, r := range f.StatementMap {
+		hits, line := f.S[id], r.Start.Line
+		if _, ok := result[line]; !ok || hits > result[line] {
+			result[line] = hits
+		}
+	}
+	return result
+}
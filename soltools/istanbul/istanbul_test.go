@@ -0,0 +1,111 @@
+package istanbul
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func span(line, start, end int) Range {
+	return Range{Start: Position{Line: line, Column: start}, End: Position{Line: line, Column: end}}
+}
+
+// run is a run that covered Token.sol, numbering its statements and branches one way.
+const run = `{
+	"/contracts/Token.sol": {
+		"path": "/contracts/Token.sol",
+		"statementMap": {
+			"1": {"start": {"line": 4, "column": 8}, "end": {"line": 4, "column": 20}},
+			"2": {"start": {"line": 5, "column": 8}, "end": {"line": 5, "column": 20}}
+		},
+		"fnMap": {"1": {"name": "mint", "line": 3, "loc": {"start": {"line": 3, "column": 4}, "end": {"line": 6, "column": 5}}}},
+		"branchMap": {"1": {"line": 4, "type": "if", "locations": [
+			{"start": {"line": 4, "column": 8}, "end": {"line": 4, "column": 20}},
+			{"start": {"line": 4, "column": 8}, "end": {"line": 4, "column": 20}}
+		]}},
+		"s": {"1": 2, "2": 0},
+		"f": {"1": 2},
+		"b": {"1": [2, 0]}
+	}
+}`
+
+func TestParse(t *testing.T) {
+	coverage, err := Parse(strings.NewReader(run))
+	require.NoError(t, err)
+	file := coverage["/contracts/Token.sol"]
+	require.NotNil(t, file)
+	assert.Equal(t, span(5, 8, 20), file.StatementMap["2"])
+	assert.Equal(t, Function{Name: "mint", Line: 3, Loc: Range{Start: Position{3, 4}, End: Position{6, 5}}}, file.FnMap["1"])
+	assert.Equal(t, Branch{Line: 4, Type: "if", Locations: []Range{span(4, 8, 20), span(4, 8, 20)}}, file.BranchMap["1"])
+	assert.Equal(t, []uint64{2, 0}, file.B["1"])
+	assert.Equal(t, map[int]uint64{4: 2, 5: 0}, file.lines())
+
+	_, err = Parse(strings.NewReader(`{"a.sol": null}`))
+	assert.EqualError(t, err, "istanbul: parsing coverage: a.sol has no coverage")
+	_, err = Parse(strings.NewReader(`[]`))
+	assert.Error(t, err)
+}
+
+func TestMerge(t *testing.T) {
+	first, err := Parse(strings.NewReader(run))
+	require.NoError(t, err)
+
+	// A second run numbers the same statements differently, covers a statement that the first
+	// didn't, and has a line that the first didn't, as well as another file.
+	second := Coverage{
+		"/contracts/Token.sol": &File{
+			Path:         "/contracts/Token.sol",
+			StatementMap: map[string]Range{"1": span(5, 8, 20), "2": span(4, 8, 20), "3": span(9, 8, 12)},
+			FnMap:        map[string]Function{"1": {Name: "mint", Line: 3, Loc: Range{Start: Position{3, 4}, End: Position{6, 5}}}},
+			BranchMap:    map[string]Branch{"1": {Line: 4, Type: "if", Locations: []Range{span(4, 8, 20), span(4, 8, 20)}}},
+			S:            map[string]uint64{"1": 1, "2": 1, "3": 0},
+			F:            map[string]uint64{"1": 1},
+			B:            map[string][]uint64{"1": {0, 1}},
+		},
+		"/contracts/Other.sol": NewFile("/contracts/Other.sol"),
+	}
+
+	merged := Merge(first, second)
+	require.Len(t, merged, 2)
+	file := merged["/contracts/Token.sol"]
+	hits := make(map[Range]uint64)
+	for id, r := range file.StatementMap {
+		hits[r] = file.S[id]
+	}
+	assert.Equal(t, map[Range]uint64{span(4, 8, 20): 3, span(5, 8, 20): 1, span(9, 8, 12): 0}, hits)
+	assert.Equal(t, map[string]uint64{"1": 3}, file.F)
+	assert.Equal(t, map[string][]uint64{"1": {2, 1}}, file.B)
+	assert.Equal(t, map[string]uint64{"4": 3, "5": 1, "9": 0}, file.L)
+
+	// Merging leaves the runs as they were.
+	assert.Equal(t, uint64(2), first["/contracts/Token.sol"].S["1"])
+	assert.Len(t, second["/contracts/Token.sol"].L, 0)
+
+	// And merging the merged coverage again counts it again.
+	assert.Equal(t, map[string]uint64{"1": 6}, Merge(merged, merged)["/contracts/Token.sol"].F)
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "istanbul")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	coverage, err := Parse(strings.NewReader(run))
+	require.NoError(t, err)
+	path := filepath.Join(dir, "coverage", "coverage.json")
+	require.NoError(t, coverage.WriteFile(path))
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, coverage, loaded)
+
+	_, err = Load(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+	require.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	_, err = Load(path)
+	assert.EqualError(t, err, "istanbul: loading coverage "+path+": unexpected EOF")
+}
@@ -0,0 +1,224 @@
+package istanbul
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Metric is how many of a kind of thing, such as lines, a contract has, and how many of them
+// ran at least once.
+type Metric struct {
+	Covered int `json:"covered"`
+	Total   int `json:"total"`
+}
+
+// Percent returns the percentage of m that is covered. Like Istanbul, it counts nothing at all
+// as fully covered.
+func (m Metric) Percent() float64 {
+	if m.Total == 0 {
+		return 100
+	}
+	return 100 * float64(m.Covered) / float64(m.Total)
+}
+
+func (m Metric) String() string {
+	return fmt.Sprintf("%.2f%% (%v/%v)", m.Percent(), m.Covered, m.Total)
+}
+
+func (m *Metric) add(hits uint64) {
+	m.Total++
+	if hits > 0 {
+		m.Covered++
+	}
+}
+
+func (m *Metric) addMetric(other Metric) {
+	m.Covered += other.Covered
+	m.Total += other.Total
+}
+
+// Summary is the coverage of a contract.
+type Summary struct {
+	Contract  string `json:"contract"`
+	File      string `json:"file"`
+	Lines     Metric `json:"lines"`
+	Branches  Metric `json:"branches"`
+	Functions Metric `json:"functions"`
+}
+
+// Report is the coverage of each contract in some Coverage.
+type Report struct {
+	Contracts []Summary `json:"contracts"` // Sorted by contract name, then file.
+	Total     Summary   `json:"total"`     // The coverage of every contract together.
+}
+
+// contractDeclaration matches the first line of the declaration of a contract, library, or
+// interface.
+var contractDeclaration = regexp.MustCompile(`^\s*(?:contract|library|interface)\s+(\w+)`)
+
+// NewReport sums up c by contract. It reads each source file to find the contracts in it, and
+// each contract's lines, functions, and branches are those that start between its declaration
+// and the next. The coverage of a file that can't be read is that of a contract named after the
+// file, as is that of anything above the first declaration in a file. Contracts with nothing to
+// cover, such as interfaces, are left out.
+func NewReport(c Coverage) *Report {
+	contracts := make(map[string]*Summary) // keyed by file and contract name
+	for path, file := range c {
+		if file.Path != "" {
+			path = file.Path
+		}
+		declarations := readDeclarations(path)
+		contractOf := func(line int) *Summary {
+			name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			for _, d := range declarations {
+				if d.line > line {
+					break
+				}
+				name = d.name
+			}
+			key := path + ":" + name
+			if contracts[key] == nil {
+				contracts[key] = &Summary{Contract: name, File: path}
+			}
+			return contracts[key]
+		}
+
+		for line, hits := range file.lines() {
+			contractOf(line).Lines.add(hits)
+		}
+		for id, fn := range file.FnMap {
+			line := fn.Line
+			if line == 0 {
+				line = fn.Loc.Start.Line
+			}
+			contractOf(line).Functions.add(file.F[id])
+		}
+		for id, branch := range file.BranchMap {
+			hits := file.B[id]
+			for i := range branch.Locations {
+				var h uint64
+				if i < len(hits) {
+					h = hits[i]
+				}
+				contractOf(branch.Line).Branches.add(h)
+			}
+		}
+	}
+
+	report := &Report{Total: Summary{Contract: "Total"}}
+	for _, summary := range contracts {
+		report.Contracts = append(report.Contracts, *summary)
+		report.Total.Lines.addMetric(summary.Lines)
+		report.Total.Branches.addMetric(summary.Branches)
+		report.Total.Functions.addMetric(summary.Functions)
+	}
+	sort.Slice(report.Contracts, func(i, j int) bool {
+		a, b := report.Contracts[i], report.Contracts[j]
+		if a.Contract != b.Contract {
+			return a.Contract < b.Contract
+		}
+		return a.File < b.File
+	})
+	return report
+}
+
+type declaration struct {
+	name string
+	line int
+}
+
+// readDeclarations returns the contracts, libraries, and interfaces declared in the source file
+// at path, in order, or nothing if it can't be read. It doesn't parse Solidity, so it can be
+// fooled by declarations in comments or strings.
+func readDeclarations(path string) []declaration {
+	source, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var result []declaration
+	for i, line := range strings.Split(string(source), "\n") {
+		if match := contractDeclaration.FindStringSubmatch(line); match != nil {
+			result = append(result, declaration{name: match[1], line: i + 1})
+		}
+	}
+	return result
+}
+
+// Find returns the summaries of the contracts named contract. There may be several, in
+// different files.
+func (r *Report) Find(contract string) []Summary {
+	var result []Summary
+	for _, summary := range r.Contracts {
+		if summary.Contract == contract {
+			result = append(result, summary)
+		}
+	}
+	return result
+}
+
+// WriteText writes r to w as a table, with a row for each contract and one for the total.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Contract\tFile\tLines\tBranches\tFunctions")
+	for _, s := range r.Contracts {
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", s.Contract, filepath.Base(s.File), s.Lines, s.Branches, s.Functions)
+	}
+	fmt.Fprintf(tw, "%v\t\t%v\t%v\t%v\n", r.Total.Contract, r.Total.Lines, r.Total.Branches, r.Total.Functions)
+	return tw.Flush()
+}
+
+// WriteHTML writes r to w as an HTML page, with the same table as WriteText, shaded the way
+// Istanbul's own reports are: green for 80% or more, yellow for 50% or more, and red below.
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlReport.Execute(w, r)
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"base": filepath.Base,
+	"level": func(m Metric) string {
+		switch percent := m.Percent(); {
+		case percent >= 80:
+			return "high"
+		case percent >= 50:
+			return "medium"
+		}
+		return "low"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.3em 1em; border-bottom: 1px solid #ddd; text-align: left; }
+td.metric { text-align: right; font-family: monospace; }
+.high { background: #c8f0c8; }
+.medium { background: #f6f0b8; }
+.low { background: #f6c8c8; }
+tr.total { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Coverage</h1>
+<table>
+<tr><th>Contract</th><th>File</th><th>Lines</th><th>Branches</th><th>Functions</th></tr>
+{{- range .Contracts}}
+<tr><td>{{.Contract}}</td><td title="{{.File}}">{{base .File}}</td>
+{{- template "metrics" .}}</tr>
+{{- end}}
+<tr class="total"><td>{{.Total.Contract}}</td><td></td>{{template "metrics" .Total}}</tr>
+</table>
+</body>
+</html>
+{{define "metrics" -}}
+<td class="metric {{level .Lines}}">{{.Lines}}</td><td class="metric {{level .Branches}}">{{.Branches}}</td><td class="metric {{level .Functions}}">{{.Functions}}</td>
+{{- end}}`))
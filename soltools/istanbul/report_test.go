@@ -0,0 +1,149 @@
+package istanbul
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const source = `pragma solidity 0.5.7;
+
+interface IToken {
+    function mint() external;
+}
+
+contract Token is IToken {
+    function mint() external {
+        if (x) {
+            y();
+        }
+    }
+
+    function burn() external {
+        z();
+    }
+}
+
+library Math {
+    function add() internal {
+        w();
+    }
+}
+`
+
+// report returns the report of a run of source, in dir, which covered mint, but not burn, and
+// only one side of mint's branch, and which didn't run Math at all.
+func report(t *testing.T, dir string) *Report {
+	path := filepath.Join(dir, "Token.sol")
+	require.NoError(t, ioutil.WriteFile(path, []byte(source), 0644))
+	fn := func(name string, line int) Function {
+		return Function{Name: name, Line: line, Loc: Range{Start: Position{line, 4}, End: Position{line + 2, 5}}}
+	}
+	return NewReport(Coverage{path: &File{
+		Path:         path,
+		StatementMap: map[string]Range{"1": span(9, 8, 14), "2": span(10, 12, 16), "3": span(15, 8, 12), "4": span(21, 8, 12)},
+		FnMap:        map[string]Function{"1": fn("mint", 8), "2": fn("burn", 14), "3": fn("add", 20)},
+		BranchMap:    map[string]Branch{"1": {Line: 9, Type: "if", Locations: []Range{span(9, 8, 14), span(9, 8, 14)}}},
+		S:            map[string]uint64{"1": 4, "2": 3, "3": 0, "4": 0},
+		F:            map[string]uint64{"1": 4, "2": 0, "3": 0},
+		B:            map[string][]uint64{"1": {3, 0}},
+	}})
+}
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "istanbul")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	r := report(t, dir)
+
+	path := filepath.Join(dir, "Token.sol")
+	assert.Equal(t, []Summary{
+		{Contract: "Math", File: path, Lines: Metric{0, 1}, Functions: Metric{0, 1}},
+		{Contract: "Token", File: path, Lines: Metric{2, 3}, Branches: Metric{1, 2}, Functions: Metric{1, 2}},
+	}, r.Contracts)
+	assert.Equal(t, Summary{Contract: "Total", Lines: Metric{2, 4}, Branches: Metric{1, 2}, Functions: Metric{1, 3}}, r.Total)
+	assert.Equal(t, 100.0, r.Contracts[0].Branches.Percent())
+	assert.Len(t, r.Find("Token"), 1)
+	assert.Len(t, r.Find("IToken"), 0)
+
+	var text bytes.Buffer
+	require.NoError(t, r.WriteText(&text))
+	assert.Equal(t, ""+
+		"Contract  File       Lines         Branches       Functions\n"+
+		"Math      Token.sol  0.00% (0/1)   100.00% (0/0)  0.00% (0/1)\n"+
+		"Token     Token.sol  66.67% (2/3)  50.00% (1/2)   50.00% (1/2)\n"+
+		"Total                50.00% (2/4)  50.00% (1/2)   33.33% (1/3)\n",
+		text.String())
+
+	var html bytes.Buffer
+	require.NoError(t, r.WriteHTML(&html))
+	assert.Contains(t, html.String(), `<tr><td>Token</td><td title="`+path+`">Token.sol</td>`+
+		`<td class="metric medium">66.67% (2/3)</td><td class="metric medium">50.00% (1/2)</td><td class="metric medium">50.00% (1/2)</td></tr>`)
+	assert.Contains(t, html.String(), `<td class="metric low">0.00% (0/1)</td><td class="metric high">100.00% (0/0)</td>`)
+
+	// Without its source, a file's coverage is all that of a contract named after it.
+	require.NoError(t, os.Remove(path))
+	missing := NewReport(Coverage{path: &File{Path: path, StatementMap: map[string]Range{"1": span(9, 8, 14)}, S: map[string]uint64{"1": 1}}})
+	assert.Equal(t, []Summary{{Contract: "Token", File: path, Lines: Metric{1, 1}}}, missing.Contracts)
+}
+
+func TestThresholds(t *testing.T) {
+	thresholds, err := ParseThresholds("Token.lines=90, lines=60,functions=50,Math.branches=10")
+	require.NoError(t, err)
+	assert.Equal(t, Thresholds{
+		Default: Threshold{Lines: 60, Functions: 50},
+		Contracts: map[string]Threshold{
+			"Token": {Lines: 90, Functions: 50},
+			"Math":  {Lines: 60, Branches: 10, Functions: 50},
+		},
+	}, thresholds)
+	assert.Equal(t, Threshold{Lines: 60, Functions: 50}, thresholds.Of("Vault"))
+
+	empty, err := ParseThresholds("")
+	require.NoError(t, err)
+	assert.Equal(t, Thresholds{}, empty)
+
+	for s, msg := range map[string]string{
+		"lines":              `istanbul: threshold "lines" has no =`,
+		"lines=ninety":       `istanbul: threshold "lines=ninety" isn't a percentage`,
+		"lines=101":          `istanbul: threshold "lines=101" isn't a percentage`,
+		"statements=90":      `istanbul: threshold "statements=90" isn't of lines, branches, or functions`,
+		"Token.statements=1": `istanbul: threshold "Token.statements=1" isn't of lines, branches, or functions`,
+		".lines=90":          `istanbul: threshold ".lines=90" has no contract name`,
+	} {
+		_, err := ParseThresholds(s)
+		assert.EqualError(t, err, msg)
+	}
+
+	dir, err := ioutil.TempDir("", "istanbul")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	r := report(t, dir)
+	path := filepath.Join(dir, "Token.sol")
+
+	// Token's lines are below its own threshold, and Math's below the default. Math has no
+	// branches, so it can't meet its branches threshold. Vault never ran. IToken has nothing to
+	// cover, and no threshold, so it isn't checked.
+	err = thresholds.Check(r, "Token", "Math", "Vault")
+	assert.Equal(t, ThresholdError{
+		{Contract: "Token", File: path, Metric: "lines", Percent: 200.0 / 3, Threshold: 90},
+		{Contract: "Math", File: path, Metric: "lines", Percent: 0, Threshold: 60},
+		{Contract: "Math", File: path, Metric: "branches", Percent: 0, Threshold: 10, Unmeasured: true},
+		{Contract: "Math", File: path, Metric: "functions", Percent: 0, Threshold: 50},
+		{Contract: "Vault", Metric: "lines", Percent: 0, Threshold: 60},
+		{Contract: "Vault", Metric: "functions", Percent: 0, Threshold: 50},
+	}, err)
+	assert.Contains(t, err.Error(), "istanbul: coverage is below its thresholds:\n\tToken ("+path+") has 66.67% lines coverage, below its threshold of 90.00%\n")
+	assert.Contains(t, err.Error(), "\n\tVault has no coverage, below its lines threshold of 60.00%")
+	assert.Contains(t, err.Error(), "\n\tMath ("+path+") has no branches coverage measured, so it can't meet its threshold of 10.00%\n")
+
+	// Contracts that meet their thresholds, or have none, pass.
+	assert.NoError(t, Thresholds{Default: Threshold{Lines: 60, Branches: 50}}.Check(r, "Token"))
+	assert.NoError(t, Thresholds{Contracts: map[string]Threshold{"Token": {Lines: 99}}}.Check(r, "Math", "IToken"))
+	assert.NoError(t, thresholds.Check(r))
+}
@@ -0,0 +1,185 @@
+package istanbul
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Threshold is the minimum coverage of a contract, as percentages. A threshold of 0 is no
+// minimum at all.
+type Threshold struct {
+	Lines     float64
+	Branches  float64
+	Functions float64
+}
+
+// Thresholds is the minimum coverage of each contract.
+type Thresholds struct {
+	// Default is the threshold of contracts that aren't in Contracts.
+	Default Threshold
+
+	// Contracts is the threshold of particular contracts, by name, which replaces Default.
+	Contracts map[string]Threshold
+}
+
+// ParseThresholds parses thresholds from a comma-separated list of settings such as
+//
+//	lines=90,branches=75,functions=90,Manager.lines=95,Vault.branches=100
+//
+// Each setting is a metric, which is lines, branches, or functions, optionally prefixed with a
+// contract name, and a percentage. Settings without a contract name are the default. Those with
+// one are that contract's threshold, which is the default for the metrics it doesn't set. The
+// empty string is no thresholds at all.
+func ParseThresholds(s string) (Thresholds, error) {
+	var result Thresholds
+	contracts := make(map[string]map[string]float64)
+	for _, setting := range strings.Split(s, ",") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+		parts := strings.SplitN(setting, "=", 2)
+		if len(parts) != 2 {
+			return Thresholds{}, errors.Errorf("istanbul: threshold %q has no =", setting)
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return Thresholds{}, errors.Errorf("istanbul: threshold %q isn't a percentage", setting)
+		}
+		contract, metric := "", strings.TrimSpace(parts[0])
+		if i := strings.LastIndex(metric, "."); i >= 0 {
+			contract, metric = metric[:i], metric[i+1:]
+		}
+		if contract == "" && strings.Contains(parts[0], ".") {
+			return Thresholds{}, errors.Errorf("istanbul: threshold %q has no contract name", setting)
+		}
+		if set(&Threshold{}, metric, percent) != nil {
+			return Thresholds{}, errors.Errorf("istanbul: threshold %q isn't of lines, branches, or functions", setting)
+		}
+		if contract == "" {
+			set(&result.Default, metric, percent)
+			continue
+		}
+		if contracts[contract] == nil {
+			contracts[contract] = make(map[string]float64)
+		}
+		contracts[contract][metric] = percent
+	}
+
+	// Contracts' thresholds are filled in from the default once it is known, wherever in the list
+	// it was set.
+	for contract, metrics := range contracts {
+		if result.Contracts == nil {
+			result.Contracts = make(map[string]Threshold)
+		}
+		threshold := result.Default
+		for metric, percent := range metrics {
+			set(&threshold, metric, percent)
+		}
+		result.Contracts[contract] = threshold
+	}
+	return result, nil
+}
+
+// set sets the metric of t named metric to percent.
+func set(t *Threshold, metric string, percent float64) error {
+	switch metric {
+	case "lines":
+		t.Lines = percent
+	case "branches":
+		t.Branches = percent
+	case "functions":
+		t.Functions = percent
+	default:
+		return errors.Errorf("unknown metric %v", metric)
+	}
+	return nil
+}
+
+// Of returns the threshold of contract.
+func (t Thresholds) Of(contract string) Threshold {
+	if threshold, ok := t.Contracts[contract]; ok {
+		return threshold
+	}
+	return t.Default
+}
+
+// Shortfall is a metric of a contract whose coverage is below its threshold.
+type Shortfall struct {
+	Contract  string
+	File      string // Empty if the contract wasn't covered at all.
+	Metric    string // "lines", "branches", or "functions".
+	Percent   float64
+	Threshold float64
+
+	// Unmeasured is set if the contract has none of Metric at all, as when the tool that
+	// collected its coverage doesn't measure it. Percent is then 0.
+	Unmeasured bool
+}
+
+func (s Shortfall) String() string {
+	if s.File == "" {
+		return fmt.Sprintf("%v has no coverage, below its %v threshold of %.2f%%", s.Contract, s.Metric, s.Threshold)
+	}
+	if s.Unmeasured {
+		return fmt.Sprintf("%v (%v) has no %v coverage measured, so it can't meet its threshold of %.2f%%", s.Contract, s.File, s.Metric, s.Threshold)
+	}
+	return fmt.Sprintf("%v (%v) has %.2f%% %v coverage, below its threshold of %.2f%%", s.Contract, s.File, s.Percent, s.Metric, s.Threshold)
+}
+
+// ThresholdError is the error of a Check that found coverage below its thresholds.
+type ThresholdError []Shortfall
+
+func (e ThresholdError) Error() string {
+	lines := []string{"istanbul: coverage is below its thresholds:"}
+	for _, shortfall := range e {
+		lines = append(lines, "\t"+shortfall.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Check checks the coverage of each of contracts in r against its threshold, and returns a
+// ThresholdError if any is below it. A contract that isn't in r at all, because it never ran,
+// is below every threshold but 0. So is every contract in r of the same name, if there are
+// several.
+//
+// A metric that a contract has none of, such as branches in coverage that doesn't measure them,
+// counts as fully covered in a Report, but not here: it is below every threshold but 0, since
+// there is nothing to meet the threshold with.
+func (t Thresholds) Check(r *Report, contracts ...string) error {
+	var err ThresholdError
+	for _, contract := range contracts {
+		threshold := t.Of(contract)
+		if threshold == (Threshold{}) {
+			continue
+		}
+		summaries := r.Find(contract)
+		if len(summaries) == 0 {
+			summaries = []Summary{{Contract: contract}}
+		}
+		for _, s := range summaries {
+			check := func(metric string, m Metric, minimum float64) {
+				percent, unmeasured := m.Percent(), s.File != "" && m.Total == 0
+				if s.File == "" || unmeasured {
+					percent = 0
+				}
+				if percent < minimum {
+					err = append(err, Shortfall{
+						Contract: contract, File: s.File, Metric: metric, Percent: percent, Threshold: minimum,
+						Unmeasured: unmeasured,
+					})
+				}
+			}
+			check("lines", s.Lines, threshold.Lines)
+			check("branches", s.Branches, threshold.Branches)
+			check("functions", s.Functions, threshold.Functions)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
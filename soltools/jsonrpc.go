@@ -0,0 +1,269 @@
+package soltools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Error codes of the bridge's JSON-RPC errors. The first five are JSON-RPC 2.0's own; the rest
+// are the bridge's, in the range that JSON-RPC 2.0 sets aside for servers.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	// CodeEVMError is the code of errors that the node or the EVM reported, such as for a
+	// transaction with the wrong nonce, or a call that reverted. Data is the node's error data,
+	// if it had any.
+	CodeEVMError = -32000
+
+	// CodeReverted is the code of errors of transactions and calls that reverted, when the bridge
+	// traces reverts. Data is what sol-trace logged: a list of strings, which describe the
+	// Solidity stack trace of the revert.
+	CodeReverted = -32001
+)
+
+// RPCError is the error of a JSON-RPC request that the server answered with an error.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// BatchElem is a request in a batch sent by RPCClient.BatchCall.
+type BatchElem struct {
+	Method string
+	Params []interface{}
+
+	// Result is where to decode the request's result, as by json.Unmarshal. It may be nil to
+	// ignore the result.
+	Result interface{}
+
+	// Error is set by BatchCall to the request's error, if it failed.
+	Error error
+}
+
+// RPCClient is a JSON-RPC 2.0 client, over a connection that carries one JSON message per line,
+// such as the bridge's socket or standard input and output.
+//
+// RPCClient is safe for concurrent use. Each request has an ID of its own, so requests may be
+// answered in any order, and a request whose context is done returns without waiting for its
+// answer.
+type RPCClient struct {
+	w      io.Writer
+	closer io.Closer
+
+	writeMu sync.Mutex // Serializes writes to w.
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *rpcResponse
+	err     error         // Why the connection ended, once it has.
+	done    chan struct{} // Closed once the connection has ended.
+}
+
+type rpcRequest struct {
+	Version string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      *uint64         `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RPCError       `json:"error"`
+}
+
+// errClosed is the error of requests made after an RPCClient has been closed.
+var errClosed = errors.New("soltools: the JSON-RPC connection is closed")
+
+// DialRPC connects to the JSON-RPC server listening at address, a TCP host:port.
+func DialRPC(ctx context.Context, address string) (*RPCClient, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "dialing %v", address)
+	}
+	return NewRPCClient(conn, conn, conn), nil
+}
+
+// NewRPCClient returns an RPCClient that writes requests to w, and reads responses from r.
+// Closing the client closes closer, which should make reads from r fail.
+func NewRPCClient(r io.Reader, w io.Writer, closer io.Closer) *RPCClient {
+	c := &RPCClient{
+		w:       w,
+		closer:  closer,
+		pending: make(map[uint64]chan *rpcResponse),
+		done:    make(chan struct{}),
+	}
+	go c.read(r)
+	return c
+}
+
+// read reads responses from r, and passes each to its request, until r fails.
+func (c *RPCClient) read(r io.Reader) {
+	decoder := json.NewDecoder(bufio.NewReader(r))
+	var err error
+	for {
+		var message json.RawMessage
+		if err = decoder.Decode(&message); err != nil {
+			break
+		}
+		var responses []*rpcResponse
+		if len(message) > 0 && message[0] == '[' {
+			err = json.Unmarshal(message, &responses)
+		} else {
+			response := new(rpcResponse)
+			err = json.Unmarshal(message, response)
+			responses = append(responses, response)
+		}
+		if err != nil {
+			break
+		}
+		c.mu.Lock()
+		for _, response := range responses {
+			// Responses without an ID are errors that the server couldn't attribute to a request,
+			// such as for requests that it couldn't parse. Their requests fail when the
+			// connection does, or when their contexts are done.
+			if response.ID == nil {
+				continue
+			}
+			if ch, ok := c.pending[*response.ID]; ok {
+				ch <- response
+				delete(c.pending, *response.ID)
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		c.err = errors.Wrap(err, "soltools: the JSON-RPC connection failed")
+	}
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	close(c.done)
+}
+
+// Close closes the connection. Requests that are waiting for their answers fail.
+func (c *RPCClient) Close() error {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = errClosed
+	}
+	c.mu.Unlock()
+	err := c.closer.Close()
+	<-c.done
+	return err
+}
+
+// Done returns a channel that is closed once the connection has ended, because it was closed or
+// failed.
+func (c *RPCClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Call calls method with params, and decodes its result into result, which may be nil to ignore
+// the result. If the server answers with an error, it is an *RPCError. If ctx is done first,
+// Call returns ctx.Err().
+func (c *RPCClient) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	batch := []BatchElem{{Method: method, Params: params, Result: result}}
+	if err := c.BatchCall(ctx, batch); err != nil {
+		return err
+	}
+	return batch[0].Error
+}
+
+// BatchCall sends every request in batch at once, and waits for all of their answers. The error
+// of each request goes in its BatchElem; BatchCall itself fails only if it can't send the batch,
+// the connection fails, or ctx is done first.
+func (c *RPCClient) BatchCall(ctx context.Context, batch []BatchElem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	requests := make([]rpcRequest, len(batch))
+	answers := make([]chan *rpcResponse, len(batch))
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	for i, elem := range batch {
+		c.nextID++
+		params := elem.Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		requests[i] = rpcRequest{Version: "2.0", ID: c.nextID, Method: elem.Method, Params: params}
+		answers[i] = make(chan *rpcResponse, 1)
+		c.pending[c.nextID] = answers[i]
+	}
+	c.mu.Unlock()
+	forget := func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, request := range requests {
+			delete(c.pending, request.ID)
+		}
+	}
+
+	var message interface{} = requests
+	if len(requests) == 1 {
+		message = requests[0]
+	}
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		forget()
+		return err
+	}
+	c.writeMu.Lock()
+	_, err = c.w.Write(append(encoded, '\n'))
+	c.writeMu.Unlock()
+	if err != nil {
+		forget()
+		return errors.Wrap(err, "soltools: sending a JSON-RPC request")
+	}
+
+	for i, answer := range answers {
+		select {
+		case response, ok := <-answer:
+			if !ok {
+				c.mu.Lock()
+				err := c.err
+				c.mu.Unlock()
+				return err
+			}
+			if response.Error != nil {
+				batch[i].Error = response.Error
+			} else if batch[i].Result != nil {
+				if err := json.Unmarshal(response.Result, batch[i].Result); err != nil {
+					batch[i].Error = errors.Wrapf(err, "decoding the result of %v", batch[i].Method)
+				}
+			}
+		case <-ctx.Done():
+			forget()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package soltools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPCClientBatchCall(t *testing.T) {
+	server := newBridgeServer(map[string]string{
+		"ping":    "true",
+		"echo":    `{"a": [1, 2]}`,
+		"ignored": `"ignored"`,
+	})
+	defer server.Close()
+	client, err := DialRPC(context.Background(), server.listener.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	var pong bool
+	var echo struct{ A []int }
+	batch := []BatchElem{
+		{Method: "ping", Result: &pong},
+		{Method: "echo", Params: []interface{}{1, "two"}, Result: &echo},
+		{Method: "missing"},
+		{Method: "ignored"},
+	}
+	require.NoError(t, client.BatchCall(context.Background(), batch))
+	assert.True(t, pong)
+	assert.Equal(t, []int{1, 2}, echo.A)
+	assert.Equal(t, &RPCError{Code: CodeEVMError, Message: "no missing"}, batch[2].Error)
+	assert.NoError(t, batch[0].Error)
+	assert.NoError(t, batch[3].Error)
+	assert.Equal(t, "[]", server.request("ping"))
+	assert.JSONEq(t, `[1, "two"]`, server.request("echo"))
+
+	// A result of the wrong type fails its own request.
+	var wrong int
+	err = client.Call(context.Background(), &wrong, "echo")
+	assert.EqualError(t, err, "decoding the result of echo: json: cannot unmarshal object into Go value of type int")
+}
+
+// reversingServer answers the requests that it reads from conn in batches of n, last first, with
+// their own params, or with an error with data for requests with no params.
+func reversingServer(conn net.Conn, n int) {
+	lines := bufio.NewScanner(conn)
+	for {
+		var requests []rpcRequest
+		for len(requests) < n {
+			if !lines.Scan() {
+				return
+			}
+			var request rpcRequest
+			json.Unmarshal(lines.Bytes(), &request)
+			requests = append(requests, request)
+		}
+		for i := len(requests) - 1; i >= 0; i-- {
+			request := requests[i]
+			if len(request.Params) == 0 {
+				fmt.Fprintf(conn, `{"jsonrpc": "2.0", "id": %v, "error": {"code": %v, "message": "no params", "data": ["trace"]}}`+"\n", request.ID, CodeReverted)
+				continue
+			}
+			params, _ := json.Marshal(request.Params[0])
+			fmt.Fprintf(conn, `{"jsonrpc": "2.0", "id": %v, "result": %s}`+"\n", request.ID, params)
+		}
+	}
+}
+
+func TestRPCClientConcurrency(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	go reversingServer(serverConn, 4)
+	client := NewRPCClient(clientConn, clientConn, clientConn)
+	defer client.Close()
+
+	// Four requests at once, which are answered in reverse order.
+	var wg sync.WaitGroup
+	results := make([]int, 3)
+	errs := make([]error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 3 {
+				errs[i] = client.Call(context.Background(), nil, "fail")
+				return
+			}
+			errs[i] = client.Call(context.Background(), &results[i], "echo", i*10)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, []int{0, 10, 20}, results)
+	assert.Equal(t, []error{nil, nil, nil, &RPCError{Code: CodeReverted, Message: "no params", Data: json.RawMessage(`["trace"]`)}}, errs)
+}
+
+func TestRPCClientCancellation(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	go reversingServer(serverConn, 2)
+	client := NewRPCClient(clientConn, clientConn, clientConn)
+
+	// The first request isn't answered until there's a second, so it times out.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := client.Call(ctx, nil, "echo", 1)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// Its late answer is dropped, and doesn't get in the way of the next request's.
+	var result int
+	require.NoError(t, client.Call(context.Background(), &result, "echo", 2))
+	assert.Equal(t, 2, result)
+
+	// Requests fail once the connection does, including those that are waiting.
+	done := make(chan error)
+	go func() { done <- client.Call(context.Background(), nil, "echo", 3) }()
+	time.Sleep(10 * time.Millisecond)
+	serverConn.Close()
+	assert.EqualError(t, <-done, "soltools: the JSON-RPC connection failed: unexpected EOF")
+	<-client.Done()
+	assert.EqualError(t, client.Call(context.Background(), nil, "echo", 4), "soltools: the JSON-RPC connection failed: unexpected EOF")
+	client.Close()
+	assert.EqualError(t, client.Call(context.Background(), nil, "echo", 4), "soltools: the JSON-RPC connection failed: unexpected EOF")
+}
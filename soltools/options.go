@@ -0,0 +1,302 @@
+package soltools
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultStartupTimeout is how long NewBackendWithOptions waits for the Node.js process to
+	// start, unless Options.StartupTimeout says otherwise.
+	DefaultStartupTimeout = 30 * time.Second
+
+	// DefaultFixedGas is the gas that Backend.EstimateGas estimates under GasFixed, unless
+	// Options.FixedGas says otherwise.
+	DefaultFixedGas = 8000000000
+
+	// DefaultPollInterval is how often a Backend polls for new logs for SubscribeFilterLogs,
+	// unless Options.PollInterval says otherwise.
+	DefaultPollInterval = time.Second
+
+	// DefaultCallTimeout bounds each request to the Node.js process, unless Options.CallTimeout
+	// says otherwise.
+	DefaultCallTimeout = 2 * time.Minute
+
+	// DefaultHealthCheckInterval is how often a Backend checks the health of the Node.js
+	// process, unless Options.HealthCheckInterval says otherwise.
+	DefaultHealthCheckInterval = 10 * time.Second
+
+	// DefaultMaxRestarts is how many times a Backend restarts the Node.js process if it crashes,
+	// unless Options.MaxRestarts says otherwise.
+	DefaultMaxRestarts = 3
+
+	// DefaultJournalLimit is how many transactions and calls a Backend keeps to trace again if
+	// the Node.js process crashes, unless Options.JournalLimit says otherwise.
+	DefaultJournalLimit = 1000
+)
+
+// GasPolicy is how Backend.EstimateGas estimates the gas that transactions need.
+type GasPolicy int
+
+const (
+	// GasFixed estimates Options.FixedGas for every transaction, so that transactions that
+	// revert fail when they are mined rather than in gas estimation. They still run, so the code
+	// that they run is covered. GasFixed is the default.
+	GasFixed GasPolicy = iota
+
+	// GasEstimate asks the node for an estimate, like *ethclient.Client does, so that
+	// transactions that would revert are never sent.
+	GasEstimate
+
+	// GasEstimateOrFixed asks the node for an estimate, and falls back to Options.FixedGas if the
+	// node can't make one, as for transactions that would revert.
+	GasEstimateOrFixed
+)
+
+// String returns the name of p's constant, e.g. "GasFixed".
+func (p GasPolicy) String() string {
+	switch p {
+	case GasFixed:
+		return "GasFixed"
+	case GasEstimate:
+		return "GasEstimate"
+	case GasEstimateOrFixed:
+		return "GasEstimateOrFixed"
+	}
+	return fmt.Sprintf("GasPolicy(%d)", int(p))
+}
+
+// Transport is how a Backend talks to its Node.js process.
+type Transport int
+
+const (
+	// TransportSocket talks over a TCP connection to a port on the loopback interface that the
+	// process listens on. The process's standard output goes to Options.Stdout. TransportSocket
+	// is the default.
+	TransportSocket Transport = iota
+
+	// TransportStdio talks over the process's standard input and output. Everything the process
+	// logs goes to Options.Stderr.
+	TransportStdio
+)
+
+// String returns the name of t's constant, e.g. "TransportSocket".
+func (t Transport) String() string {
+	switch t {
+	case TransportSocket:
+		return "TransportSocket"
+	case TransportStdio:
+		return "TransportStdio"
+	}
+	return fmt.Sprintf("Transport(%d)", int(t))
+}
+
+// Options configures a Backend made by NewBackendWithOptions.
+type Options struct {
+	// NodeURL is the URL of the Ethereum node to send calls and transactions to, such as
+	// "http://localhost:8545". It is required.
+	NodeURL string
+
+	// BridgeScript is the path to this package's bridge.js. It is required.
+	BridgeScript string
+
+	// ArtifactsDir and ContractsDir hold the sol-compiler artifacts and the Solidity sources
+	// that traces are mapped back to, for coverage reports. Both are required.
+	ArtifactsDir string
+	ContractsDir string
+
+	// Stdout and Stderr receive the Node.js process's output. They default to os.Stdout and
+	// os.Stderr; use LogWriter to send the output to a test's log instead.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Transport is how the Backend talks to the Node.js process, which it does in JSON-RPC 2.0.
+	// It defaults to TransportSocket.
+	Transport Transport
+
+	// NodeBinary is the Node.js executable to run, either a path or a name to look up in $PATH.
+	// It defaults to "node".
+	NodeBinary string
+
+	// RevertTrace enables sol-trace's RevertTraceSubprovider, so that SendTransaction and
+	// CallContract return a *RevertTraceError, with the Solidity call stack, when they revert.
+	// It slows down every transaction and call, since each is traced, and they are handled one at
+	// a time, so that each gets the trace of its own revert.
+	RevertTrace bool
+
+	// Profile enables sol-profiler's ProfilerSubprovider, which attributes the gas used by every
+	// transaction and call to the source lines that used it, for Backend.Profile and
+	// Backend.WriteProfile. Like RevertTrace, it traces every transaction and call.
+	Profile bool
+
+	// StartupTimeout bounds how long to wait for the Node.js process to start serving the
+	// Backend. It defaults to DefaultStartupTimeout.
+	StartupTimeout time.Duration
+
+	// GasPolicy is how EstimateGas estimates the gas that transactions need. FixedGas is the
+	// estimate under GasFixed, and the fallback under GasEstimateOrFixed; it defaults to
+	// DefaultFixedGas.
+	GasPolicy GasPolicy
+	FixedGas  uint64
+
+	// PollInterval is how often SubscribeFilterLogs polls for new logs, since the bridge can't
+	// push them. It defaults to DefaultPollInterval.
+	PollInterval time.Duration
+
+	// CallTimeout bounds each request to the Node.js process, on top of any deadline of the
+	// request's context. It defaults to DefaultCallTimeout.
+	CallTimeout time.Duration
+
+	// HealthCheckInterval is how often the Backend checks that the Node.js process still
+	// answers. A process that doesn't answer within CallTimeout is killed and restarted. It
+	// defaults to DefaultHealthCheckInterval.
+	HealthCheckInterval time.Duration
+
+	// MaxRestarts is how many times the Backend restarts the Node.js process if it exits or
+	// stops answering, after which requests fail with a *BridgeError. It defaults to
+	// DefaultMaxRestarts; a negative MaxRestarts turns restarting off.
+	MaxRestarts int
+
+	// JournalLimit is how many transactions and calls the Backend keeps, to trace again in the
+	// Node.js process that replaces one that crashes. Once it has kept that many, it takes the
+	// coverage and profile of the process so far, and keeps those instead. It defaults to
+	// DefaultJournalLimit.
+	JournalLimit int
+}
+
+// withDefaults returns opts with each unset field set to its default.
+func (opts Options) withDefaults() Options {
+	if opts.Stdout == nil {
+		opts.Stdout = os.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = os.Stderr
+	}
+	if opts.NodeBinary == "" {
+		opts.NodeBinary = "node"
+	}
+	if opts.StartupTimeout == 0 {
+		opts.StartupTimeout = DefaultStartupTimeout
+	}
+	if opts.FixedGas == 0 {
+		opts.FixedGas = DefaultFixedGas
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.CallTimeout == 0 {
+		opts.CallTimeout = DefaultCallTimeout
+	}
+	if opts.HealthCheckInterval == 0 {
+		opts.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	if opts.MaxRestarts == 0 {
+		opts.MaxRestarts = DefaultMaxRestarts
+	}
+	if opts.JournalLimit == 0 {
+		opts.JournalLimit = DefaultJournalLimit
+	}
+	return opts
+}
+
+// validate checks that opts describes a Backend that can be started, and that every file it
+// refers to exists.
+func (opts Options) validate() error {
+	if opts.NodeURL == "" {
+		return errors.New("soltools: Options.NodeURL is required")
+	}
+	if u, err := url.Parse(opts.NodeURL); err != nil || u.Scheme == "" {
+		return errors.Errorf("soltools: Options.NodeURL %q is not a URL", opts.NodeURL)
+	}
+	if opts.StartupTimeout < 0 {
+		return errors.Errorf("soltools: Options.StartupTimeout %v is negative", opts.StartupTimeout)
+	}
+	if opts.GasPolicy < GasFixed || opts.GasPolicy > GasEstimateOrFixed {
+		return errors.Errorf("soltools: Options.GasPolicy %v is not a GasPolicy", opts.GasPolicy)
+	}
+	if opts.PollInterval < 0 {
+		return errors.Errorf("soltools: Options.PollInterval %v is negative", opts.PollInterval)
+	}
+	if opts.Transport < TransportSocket || opts.Transport > TransportStdio {
+		return errors.Errorf("soltools: Options.Transport %v is not a Transport", opts.Transport)
+	}
+	if opts.CallTimeout < 0 {
+		return errors.Errorf("soltools: Options.CallTimeout %v is negative", opts.CallTimeout)
+	}
+	if opts.HealthCheckInterval < 0 {
+		return errors.Errorf("soltools: Options.HealthCheckInterval %v is negative", opts.HealthCheckInterval)
+	}
+	if opts.JournalLimit < 0 {
+		return errors.Errorf("soltools: Options.JournalLimit %v is negative", opts.JournalLimit)
+	}
+	for _, path := range []struct {
+		field, path string
+		dir         bool
+	}{
+		{"BridgeScript", opts.BridgeScript, false},
+		{"ArtifactsDir", opts.ArtifactsDir, true},
+		{"ContractsDir", opts.ContractsDir, true},
+	} {
+		if path.path == "" {
+			return errors.Errorf("soltools: Options.%v is required", path.field)
+		}
+		info, err := os.Stat(path.path)
+		if err != nil {
+			return errors.Wrapf(err, "soltools: Options.%v", path.field)
+		}
+		if info.IsDir() != path.dir {
+			kind := "a file"
+			if path.dir {
+				kind = "a directory"
+			}
+			return errors.Errorf("soltools: Options.%v %v is not %v", path.field, path.path, kind)
+		}
+	}
+	if _, err := exec.LookPath(opts.NodeBinary); err != nil {
+		return errors.Wrap(err, "soltools: Options.NodeBinary")
+	}
+	return nil
+}
+
+// LogWriter returns a Writer that passes each line written to it to logf, without its trailing
+// newline. It can capture a Backend's output in a test's log:
+//
+//	backend, err := NewBackendWithOptions(ctx, Options{
+//		...
+//		Stdout: LogWriter(t.Logf),
+//		Stderr: LogWriter(t.Logf),
+//	})
+//
+// The Writer is safe for concurrent use.
+func LogWriter(logf func(format string, args ...interface{})) io.Writer {
+	return &logWriter{logf: logf}
+}
+
+type logWriter struct {
+	logf func(format string, args ...interface{})
+
+	mu      sync.Mutex
+	partial []byte // The start of a line that hasn't been ended yet.
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.logf("%s", w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+}
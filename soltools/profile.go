@@ -0,0 +1,175 @@
+package soltools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/reserve-protocol/rsv-beta/soltools/istanbul"
+)
+
+// Profile is a gas profile: how much gas each contract, function, and source line used, over
+// every transaction and call made through a Backend made with Options.Profile.
+//
+// Gas is attributed to source code by sol-profiler. A function's gas includes the gas of the
+// statements in its body, and a line's is that of the statements that start on it.
+type Profile struct {
+	Contracts []ContractProfile `json:"contracts"` // Sorted by gas, most first.
+}
+
+// ContractProfile is the gas profile of a single contract.
+type ContractProfile struct {
+	Contract  string            `json:"contract"` // e.g. "Manager".
+	File      string            `json:"file"`     // Source file, as sol-profiler names it.
+	Gas       uint64            `json:"gas"`      // Total gas of Lines.
+	Functions []FunctionProfile `json:"functions"`
+	Lines     []LineProfile     `json:"lines"`
+}
+
+// FunctionProfile is the gas used by a function or modifier.
+type FunctionProfile struct {
+	Name string `json:"name"` // e.g. "issue".
+	Line int    `json:"line"` // Line it is declared on.
+	Gas  uint64 `json:"gas"`
+}
+
+// LineProfile is the gas used by a source line.
+type LineProfile struct {
+	Line   int    `json:"line"`
+	Gas    uint64 `json:"gas"`
+	Source string `json:"source"` // The line itself, trimmed, if the file could be read.
+}
+
+// Profile returns the gas profile of every transaction and call made through b so far. b must
+// have been made with Options.Profile.
+func (b *Backend) Profile() (*Profile, error) {
+	var files istanbul.Coverage
+	if err := b.Call(context.Background(), &files, "profile"); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	saved := b.saved.Profile
+	b.mu.Unlock()
+	if len(saved) > 0 {
+		files = istanbul.Merge(saved, files)
+	}
+	return newProfile(files, b.contractsDir), nil
+}
+
+// WriteProfile writes the gas profile of every transaction and call made through b so far to
+// $PWD/profile/profile.json, and a summary of it to $PWD/profile/profile.txt. b must have been
+// made with Options.Profile.
+func (b *Backend) WriteProfile() error {
+	profile, err := b.Profile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll("profile", 0755); err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join("profile", "profile.json"), encoded, 0644); err != nil {
+		return err
+	}
+	summary, err := os.Create(filepath.Join("profile", "profile.txt"))
+	if err != nil {
+		return err
+	}
+	profile.WriteSummary(summary, 10)
+	return summary.Close()
+}
+
+// newProfile builds a Profile from the Istanbul-format output of sol-profiler, reading source
+// files from contractsDir to find the contract each function and line belongs to.
+func newProfile(files istanbul.Coverage, contractsDir string) *Profile {
+	contracts := make(map[string]*ContractProfile) // keyed by file and contract name
+	contractOf := func(file string, lines []string, line int) *ContractProfile {
+		name, _ := enclosingDeclarations(lines, line)
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		key := file + ":" + name
+		if contracts[key] == nil {
+			contracts[key] = &ContractProfile{Contract: name, File: file}
+		}
+		return contracts[key]
+	}
+
+	for _, file := range files {
+		lines := readSourceLines(file.Path, contractsDir)
+		for id, fn := range file.FnMap {
+			if gas := file.F[id]; gas > 0 {
+				c := contractOf(file.Path, lines, fn.Line)
+				c.Functions = append(c.Functions, FunctionProfile{Name: fn.Name, Line: fn.Line, Gas: gas})
+			}
+		}
+
+		lineGas := make(map[int]uint64)
+		for id, statement := range file.StatementMap {
+			lineGas[statement.Start.Line] += file.S[id]
+		}
+		for line, gas := range lineGas {
+			if gas == 0 {
+				continue
+			}
+			c := contractOf(file.Path, lines, line)
+			source := ""
+			if line >= 1 && line <= len(lines) {
+				source = strings.TrimSpace(lines[line-1])
+			}
+			c.Lines = append(c.Lines, LineProfile{Line: line, Gas: gas, Source: source})
+			c.Gas += gas
+		}
+	}
+
+	profile := new(Profile)
+	for _, c := range contracts {
+		sort.Slice(c.Functions, func(i, j int) bool {
+			if c.Functions[i].Gas != c.Functions[j].Gas {
+				return c.Functions[i].Gas > c.Functions[j].Gas
+			}
+			return c.Functions[i].Line < c.Functions[j].Line
+		})
+		sort.Slice(c.Lines, func(i, j int) bool {
+			if c.Lines[i].Gas != c.Lines[j].Gas {
+				return c.Lines[i].Gas > c.Lines[j].Gas
+			}
+			return c.Lines[i].Line < c.Lines[j].Line
+		})
+		profile.Contracts = append(profile.Contracts, *c)
+	}
+	sort.Slice(profile.Contracts, func(i, j int) bool {
+		a, b := profile.Contracts[i], profile.Contracts[j]
+		if a.Gas != b.Gas {
+			return a.Gas > b.Gas
+		}
+		return a.File+":"+a.Contract < b.File+":"+b.Contract
+	})
+	return profile
+}
+
+// WriteSummary writes a summary of p to w: the gas used by each contract and each of its
+// functions, and by its topLines most expensive lines.
+func (p *Profile) WriteSummary(w io.Writer, topLines int) {
+	for _, c := range p.Contracts {
+		fmt.Fprintf(w, "%v (%v): %v gas\n", c.Contract, c.File, c.Gas)
+		for _, fn := range c.Functions {
+			fmt.Fprintf(w, "    %-32v %12v  line %v\n", "function "+fn.Name, fn.Gas, fn.Line)
+		}
+		for i, line := range c.Lines {
+			if i == topLines {
+				break
+			}
+			fmt.Fprintf(w, "    %-32v %12v  %v\n", fmt.Sprintf("line %v", line.Line), line.Gas, line.Source)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package soltools
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/reserve-protocol/rsv-beta/soltools/istanbul"
+)
+
+// managerProfile is sol-profiler output for managerSource.
+const managerProfile = `{
+	"Manager.sol": {
+		"path": "Manager.sol",
+		"statementMap": {
+			"1": {"start": {"line": 7, "column": 8}, "end": {"line": 7, "column": 46}},
+			"2": {"start": {"line": 12, "column": 8}, "end": {"line": 12, "column": 54}},
+			"3": {"start": {"line": 12, "column": 16}, "end": {"line": 12, "column": 26}},
+			"4": {"start": {"line": 4, "column": 4}, "end": {"line": 4, "column": 22}}
+		},
+		"fnMap": {
+			"1": {"name": "notPaused", "line": 6},
+			"2": {"name": "issue", "line": 11},
+			"3": {"name": "paused", "line": 4}
+		},
+		"s": {"1": 900, "2": 300, "3": 40, "4": 0},
+		"f": {"1": 950, "2": 400, "3": 0}
+	}
+}`
+
+func TestNewProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soltools")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Manager.sol"), []byte(managerSource), 0644))
+
+	var files istanbul.Coverage
+	require.NoError(t, json.Unmarshal([]byte(managerProfile), &files))
+	profile := newProfile(files, dir)
+	assert.Equal(t, &Profile{Contracts: []ContractProfile{{
+		Contract: "Manager",
+		File:     "Manager.sol",
+		Gas:      1240,
+		Functions: []FunctionProfile{
+			{Name: "notPaused", Line: 6, Gas: 950},
+			{Name: "issue", Line: 11, Gas: 400},
+		},
+		Lines: []LineProfile{
+			{Line: 7, Gas: 900, Source: `require(!paused, "contract is paused");`},
+			{Line: 12, Gas: 340, Source: `require(amount > 0, "cannot issue zero RSV");`},
+		},
+	}}}, profile)
+
+	var summary strings.Builder
+	profile.WriteSummary(&summary, 1)
+	assert.Equal(t, `Manager (Manager.sol): 1240 gas
+    function notPaused                        950  line 6
+    function issue                            400  line 11
+    line 7                                    900  require(!paused, "contract is paused");
+`, summary.String())
+}
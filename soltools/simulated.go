@@ -0,0 +1,163 @@
+package soltools
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethmath "github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/pkg/errors"
+)
+
+// SimulatedCoverage collects the Coverage of the transactions and calls made through a
+// *backends.SimulatedBackend, so that tests running against the in-process node can report
+// coverage without Node.js or a geth node.
+//
+// The SimulatedBackend runs the EVM without a tracer, and keeps its chain to itself, so
+// SimulatedCoverage runs each transaction and call again, traced, on a chain of its own. That
+// chain must start from the same genesis as the SimulatedBackend's, and SimulatedCoverage must be
+// told of every transaction that the SimulatedBackend accepts, with SendTransaction, of every
+// AdjustTime, and of every Commit, so that it mines the same blocks. TraceCall traces a call.
+//
+// SimulatedCoverage is safe for concurrent use.
+type SimulatedCoverage struct {
+	*Coverage
+
+	mu      sync.Mutex
+	db      ethdb.Database
+	chain   *core.BlockChain
+	pending []*types.Transaction // Transactions of the block that Commit mines.
+	offset  int64                // Seconds that AdjustTime has moved the pending block's time.
+}
+
+// NewSimulatedCoverage returns a SimulatedCoverage that collects coverage into coverage, tracing
+// transactions and calls on chain, whose database is db. Make chain as NewSimulatedBackend makes
+// its own, from the same genesis:
+//
+//	genesis := core.Genesis{Config: params.AllEthashProtocolChanges, GasLimit: gasLimit, Alloc: alloc}
+//	genesis.MustCommit(db)
+//	chain, err := core.NewBlockChain(db, nil, genesis.Config, ethash.NewFaker(), vm.Config{}, nil)
+func NewSimulatedCoverage(db ethdb.Database, chain *core.BlockChain, coverage *Coverage) *SimulatedCoverage {
+	return &SimulatedCoverage{Coverage: coverage, db: db, chain: chain}
+}
+
+// SendTransaction adds tx, which the SimulatedBackend has accepted, to the pending block. Like
+// SimulatedBackend.SendTransaction, it undoes any AdjustTime since the last Commit.
+func (c *SimulatedCoverage) SendTransaction(tx *types.Transaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = append(c.pending, tx)
+	c.offset = 0
+}
+
+// AdjustTime moves the pending block's time delta ahead, as SimulatedBackend.AdjustTime does.
+func (c *SimulatedCoverage) AdjustTime(delta time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = int64(delta.Seconds())
+}
+
+// Commit mines the pending block, as SimulatedBackend.Commit does, and traces its transactions.
+func (c *SimulatedCoverage) Commit() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	parent := c.chain.CurrentBlock()
+	blocks, _ := core.GenerateChain(c.chain.Config(), parent, ethash.NewFaker(), c.db, 1, func(_ int, block *core.BlockGen) {
+		for _, tx := range c.pending {
+			block.AddTxWithChain(c.chain, tx)
+		}
+		block.OffsetTime(c.offset)
+	})
+	c.pending, c.offset = nil, 0
+	if _, err := c.chain.InsertChain(blocks); err != nil {
+		return errors.Wrap(err, "soltools: mining the traced chain")
+	}
+
+	block := blocks[0]
+	state, err := c.chain.StateAt(parent.Root())
+	if err != nil {
+		return errors.Wrapf(err, "soltools: tracing block %v", block.Number())
+	}
+	config := vm.Config{Debug: true, Tracer: c.Coverage}
+	gasPool := new(core.GasPool).AddGas(block.GasLimit())
+	var usedGas uint64
+	for i, tx := range block.Transactions() {
+		state.Prepare(tx.Hash(), block.Hash(), i)
+		_, _, err := core.ApplyTransaction(
+			c.chain.Config(), c.chain, nil, gasPool, state, block.Header(), tx, &usedGas, config,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "soltools: tracing transaction %v", tx.Hash().Hex())
+		}
+	}
+	return nil
+}
+
+// CurrentBlock returns the latest block that Commit mined, which should be the
+// SimulatedBackend's latest block too.
+func (c *SimulatedCoverage) CurrentBlock() *types.Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chain.CurrentBlock()
+}
+
+// TraceCall traces call on the state of the latest block, as sim.CallContract runs it. Calls at
+// any other block, which SimulatedBackend doesn't support, are not traced.
+func (c *SimulatedCoverage) TraceCall(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	block := c.chain.CurrentBlock()
+	if blockNumber != nil && blockNumber.Cmp(block.Number()) != 0 {
+		return nil
+	}
+	state, err := c.chain.StateAt(block.Root())
+	if err != nil {
+		return errors.Wrap(err, "soltools: tracing call")
+	}
+
+	// Fill in the call the way SimulatedBackend does.
+	if call.GasPrice == nil {
+		call.GasPrice = big.NewInt(1)
+	}
+	if call.Gas == 0 {
+		call.Gas = 50000000
+	}
+	if call.Value == nil {
+		call.Value = new(big.Int)
+	}
+	state.GetOrNewStateObject(call.From).SetBalance(ethmath.MaxBig256)
+
+	msg := callMessage{call}
+	evm := vm.NewEVM(
+		core.NewEVMContext(msg, block.Header(), c.chain, nil),
+		state,
+		c.chain.Config(),
+		vm.Config{Debug: true, Tracer: c.Coverage},
+	)
+	// A call that fails still ran, and is covered; its error is the SimulatedBackend's to report.
+	_, _, _, _ = core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(math.MaxUint64)).TransitionDb()
+	return nil
+}
+
+// callMessage implements core.Message for an ethereum.CallMsg.
+type callMessage struct {
+	ethereum.CallMsg
+}
+
+func (m callMessage) From() common.Address { return m.CallMsg.From }
+func (m callMessage) To() *common.Address  { return m.CallMsg.To }
+func (m callMessage) GasPrice() *big.Int   { return m.CallMsg.GasPrice }
+func (m callMessage) Gas() uint64          { return m.CallMsg.Gas }
+func (m callMessage) Value() *big.Int      { return m.CallMsg.Value }
+func (m callMessage) Nonce() uint64        { return 0 }
+func (m callMessage) CheckNonce() bool     { return false }
+func (m callMessage) Data() []byte         { return m.CallMsg.Data }
@@ -0,0 +1,405 @@
+package soltools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+
+	"github.com/reserve-protocol/rsv-beta/soltools/istanbul"
+)
+
+// BridgeError is the error of a request that failed because of the bridge itself, rather than
+// because of the node or the EVM: the Node.js process crashed, hung, or took longer than
+// Options.CallTimeout, or answered with something other than a result or an error.
+//
+// A Backend restarts a bridge that crashes or hangs, but it doesn't retry the request that
+// failed, since the request may have taken effect, as a transaction may have been mined.
+type BridgeError struct {
+	Method string // The bridge method that was requested, e.g. "sendTransaction".
+	Err    error
+}
+
+func (e *BridgeError) Error() string {
+	return fmt.Sprintf("soltools: bridge %v: %v", e.Method, e.Err)
+}
+
+// EVMError is the error of a request that the bridge handled, but that the node rejected, or
+// that reverted, as the node reported it. Requests that revert when the Backend was made with
+// Options.RevertTrace fail with a *RevertTraceError instead.
+type EVMError struct {
+	Method  string          // The bridge method that was requested, e.g. "sendTransaction".
+	Message string          // The node's error message.
+	Data    json.RawMessage // The node's error data, if it had any.
+}
+
+func (e *EVMError) Error() string {
+	return e.Message
+}
+
+// IsBridgeError reports whether err, or the error that it wraps, is a *BridgeError.
+func IsBridgeError(err error) bool {
+	_, ok := errors.Cause(err).(*BridgeError)
+	return ok
+}
+
+// bridgeProcess is a running Node.js bridge process.
+type bridgeProcess struct {
+	cmd    *exec.Cmd
+	client *RPCClient
+
+	exited chan struct{} // Closed once the process has exited.
+	err    error         // Why the process exited; set before exited is closed.
+}
+
+// startBridge starts a bridge process as opts says, and returns it once it passes a health
+// check. If that doesn't happen before ctx is done, the process is killed.
+func startBridge(ctx context.Context, opts Options) (*bridgeProcess, error) {
+	// Port 0 lets the OS pick a free port for the bridge, which it reports on stdout once it is
+	// listening. Over stdio, the bridge doesn't listen at all.
+	port := "0"
+	if opts.Transport == TransportStdio {
+		port = "stdio"
+	}
+	cmd := exec.Command(
+		opts.NodeBinary, opts.BridgeScript, opts.ArtifactsDir, opts.ContractsDir, opts.NodeURL, port,
+		strconv.FormatBool(opts.RevertTrace), strconv.FormatBool(opts.Profile),
+	)
+	cmd.Stderr = opts.Stderr
+	p := &bridgeProcess{cmd: cmd, exited: make(chan struct{})}
+
+	// Over a socket, stdout is copied to opts.Stdout, and watched for the line that says which
+	// port the bridge is listening on. listening is closed without a port if the process exits
+	// first. Over stdio, stdout is the connection.
+	listening := make(chan string, 1)
+	var waitForStdout sync.WaitGroup
+	if opts.Transport == TransportStdio {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		// Not cmd.StdoutPipe, which cmd.Wait would close while the client may be reading it.
+		stdout, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdout = w
+		if err := cmd.Start(); err != nil {
+			stdout.Close()
+			w.Close()
+			return nil, errors.Wrapf(err, "starting %v", opts.NodeBinary)
+		}
+		w.Close()
+		p.client = NewRPCClient(stdout, stdin, closers{stdin, stdout})
+	} else {
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, errors.Wrapf(err, "starting %v", opts.NodeBinary)
+		}
+		waitForStdout.Add(1)
+		go func() {
+			defer waitForStdout.Done()
+			defer close(listening)
+			bufferedStdout := bufio.NewReader(stdout)
+			found := false
+			for {
+				line, err := bufferedStdout.ReadString('\n')
+				io.WriteString(opts.Stdout, line)
+				if err != nil {
+					return
+				}
+				if match := listeningLine.FindStringSubmatch(line); match != nil && !found {
+					found = true
+					listening <- match[1]
+				}
+			}
+		}()
+	}
+	go func() {
+		// Wait must not be called until stdout has been read to the end.
+		waitForStdout.Wait()
+		p.err = cmd.Wait()
+		close(p.exited)
+	}()
+
+	fail := func(err error) (*bridgeProcess, error) {
+		p.kill()
+		return nil, err
+	}
+	if p.client == nil {
+		select {
+		case port, ok := <-listening:
+			if !ok {
+				return fail(errors.New("the Node.js bridge exited before it started listening"))
+			}
+			client, err := DialRPC(ctx, "127.0.0.1:"+port)
+			if err != nil {
+				return fail(err)
+			}
+			p.client = client
+		case <-ctx.Done():
+			return fail(errors.Wrap(ctx.Err(), "waiting for the Node.js bridge to start"))
+		}
+	}
+	if err := p.call(ctx, new(bool), "ping", ""); err != nil {
+		return fail(errors.Wrap(err, "checking the health of the Node.js bridge"))
+	}
+	return p, nil
+}
+
+// closers is an io.Closer that closes each of its elements.
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var err error
+	for _, closer := range c {
+		if e := closer.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// kill kills p, and waits for it to exit.
+func (p *bridgeProcess) kill() {
+	p.cmd.Process.Kill()
+	<-p.exited
+	if p.client != nil {
+		p.client.Close()
+	}
+}
+
+// call calls method on p, with params, and decodes its result into out. Errors of the node or
+// the EVM are *EVMErrors, or *RevertTraceErrors, whose frames are resolved in contractsDir;
+// other failures are *BridgeErrors.
+func (p *bridgeProcess) call(ctx context.Context, out interface{}, method, contractsDir string, params ...interface{}) error {
+	err := p.client.Call(ctx, out, method, params...)
+	if err == nil {
+		return nil
+	}
+	rpcErr, ok := err.(*RPCError)
+	if !ok {
+		return &BridgeError{Method: method, Err: err}
+	}
+	switch rpcErr.Code {
+	case CodeEVMError:
+		return &EVMError{Method: method, Message: rpcErr.Message, Data: rpcErr.Data}
+	case CodeReverted:
+		var logged []string
+		if err := json.Unmarshal(rpcErr.Data, &logged); err != nil {
+			return &BridgeError{Method: method, Err: errors.Wrap(err, "decoding the revert trace")}
+		}
+		return newRevertTraceError(method, rpcErr.Message, logged, contractsDir)
+	}
+	return &BridgeError{Method: method, Err: rpcErr}
+}
+
+// traced is a transaction or call that the bridge traced, which a Backend traces again in the
+// bridge that replaces it if it crashes, so that the coverage and profile that it collected
+// aren't lost.
+type traced struct {
+	// Transactions are traced again by hash, as they were mined.
+	TxHash *common.Hash    `json:"txHash,omitempty"`
+	To     *common.Address `json:"to,omitempty"`
+	Data   string          `json:"data,omitempty"`
+
+	// Calls are run again, on the latest state, from their call objects.
+	Call map[string]interface{} `json:"call,omitempty"`
+}
+
+// replayBatch is how many journal entries a restarted bridge is asked to trace again at once,
+// each batch within Options.CallTimeout.
+const replayBatch = 100
+
+// snapshot is the coverage, and the gas profile, if it is enabled, that a bridge has collected.
+type snapshot struct {
+	Coverage istanbul.Coverage `json:"coverage"`
+	Profile  istanbul.Coverage `json:"profile"`
+}
+
+// supervise restarts b's bridge whenever it exits, or fails a health check, until quit is
+// closed or b runs out of restarts.
+func (b *Backend) supervise(quit <-chan struct{}) {
+	defer close(b.supervised)
+	ticker := time.NewTicker(b.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		b.mu.Lock()
+		p := b.process
+		b.mu.Unlock()
+
+		select {
+		case <-quit:
+			return
+		case <-p.exited:
+			fmt.Fprintf(b.opts.Stderr, "soltools: the Node.js bridge exited (%v)\n", p.err)
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), b.opts.CallTimeout)
+			err := p.call(ctx, new(bool), "ping", "")
+			cancel()
+			// A bridge that answers, even with an error, is alive.
+			if _, dead := err.(*BridgeError); !dead {
+				continue
+			}
+			select {
+			case <-quit:
+				return // The bridge was closed during the health check.
+			default:
+			}
+			fmt.Fprintf(b.opts.Stderr, "soltools: the Node.js bridge failed a health check (%v)\n", err)
+			p.kill()
+		}
+		if b.restart() != nil {
+			return
+		}
+	}
+}
+
+// restart replaces b's bridge, which has exited, with a new one, and traces everything that
+// the old one traced again in it. If the new one fails to start, restart tries again, until b
+// runs out of restarts, after which every request to the bridge fails.
+func (b *Backend) restart() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// What the bridge collected up to its checkpoint is saved; the journal has the rest.
+	if b.checkpoint != nil {
+		b.saved.Coverage = istanbul.Merge(b.saved.Coverage, b.checkpoint.Coverage)
+		if b.opts.Profile {
+			b.saved.Profile = istanbul.Merge(b.saved.Profile, b.checkpoint.Profile)
+		}
+		b.checkpoint = nil
+	}
+	err := errors.Errorf("the Node.js bridge exited, and has been restarted %v times already", b.restarts)
+	for b.restarts < b.opts.MaxRestarts {
+		b.restarts++
+		fmt.Fprintf(b.opts.Stderr, "soltools: restarting the Node.js bridge (restart %v of %v)\n", b.restarts, b.opts.MaxRestarts)
+		var p *bridgeProcess
+		if p, err = b.startReplacement(); err == nil {
+			b.process = p
+			return nil
+		}
+		fmt.Fprintf(b.opts.Stderr, "soltools: %v\n", err)
+	}
+	b.down = err
+	return err
+}
+
+// startReplacement starts a bridge to replace b's, and traces everything that b's traced again
+// in it.
+func (b *Backend) startReplacement() (*bridgeProcess, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.opts.StartupTimeout)
+	defer cancel()
+	p, err := startBridge(ctx, b.opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "restarting the Node.js bridge")
+	}
+	for start := 0; start < len(b.journal); start += replayBatch {
+		end := start + replayBatch
+		if end > len(b.journal) {
+			end = len(b.journal)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.opts.CallTimeout)
+		err := p.call(ctx, new(bool), "replay", b.contractsDir, b.journal[start:end])
+		cancel()
+		if err != nil {
+			p.kill()
+			return nil, errors.Wrap(err, "tracing transactions and calls again in the restarted Node.js bridge")
+		}
+	}
+	return p, nil
+}
+
+// Ping checks the health of the bridge, by asking it to answer.
+func (b *Backend) Ping(ctx context.Context) error {
+	return b.Call(ctx, new(bool), "ping")
+}
+
+// Call calls method on the bridge, with params, and decodes its result into result, which may
+// be nil to ignore the result. The bridge's methods are its own, such as "ping", as well as every
+// method of the node's JSON-RPC API whose namespace is eth, net, web3, evm, or debug, such as
+// "eth_getBalance", which the bridge sends through 0x's library.
+//
+// Call fails if the request takes longer than Options.CallTimeout, or ctx is done first. If the
+// bridge is being restarted, Call waits until it has been.
+func (b *Backend) Call(ctx context.Context, result interface{}, method string, params ...interface{}) error {
+	if b.opts.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.opts.CallTimeout)
+		defer cancel()
+	}
+	b.mu.Lock()
+	p, down := b.process, b.down
+	b.mu.Unlock()
+	if down != nil {
+		return &BridgeError{Method: method, Err: down}
+	}
+	return p.call(ctx, result, method, b.contractsDir, params...)
+}
+
+// record adds what the bridge traced for a request, which ended with err, to the journal to
+// trace again if the bridge crashes. Requests that revert are traced as well. Once the journal
+// holds Options.JournalLimit entries, record empties it; see checkpointJournal.
+func (b *Backend) record(t traced, err error) {
+	if b.opts.MaxRestarts <= 0 {
+		return
+	}
+	if _, reverted := err.(*RevertTraceError); err != nil && !reverted {
+		return
+	}
+	b.mu.Lock()
+	b.journal = append(b.journal, t)
+	full := len(b.journal) >= b.opts.JournalLimit && len(b.journal) >= b.retryCheckpointAt && !b.checkpointing
+	if full {
+		b.checkpointing = true
+	}
+	b.mu.Unlock()
+	if full {
+		b.checkpointJournal()
+	}
+}
+
+// checkpointJournal takes the coverage and profile that the bridge has collected so far as its
+// checkpoint, and empties the journal of what that covers, so that the journal doesn't grow
+// without bound. If the bridge crashes, its checkpoint is kept, and only the journal is traced
+// again. If the checkpoint can't be taken, the journal is kept whole, to try again once another
+// Options.JournalLimit entries have been added to it.
+//
+// Requests that were handled while the checkpoint was taken may be both in it and in the
+// journal, so if the bridge crashes, they count twice.
+func (b *Backend) checkpointJournal() {
+	b.mu.Lock()
+	p, n := b.process, len(b.journal)
+	b.mu.Unlock()
+
+	var checkpoint snapshot
+	ctx, cancel := context.WithTimeout(context.Background(), b.opts.CallTimeout)
+	err := p.call(ctx, &checkpoint, "snapshot", b.contractsDir)
+	cancel()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkpointing = false
+	if err != nil {
+		fmt.Fprintf(b.opts.Stderr, "soltools: checkpointing the Node.js bridge's coverage (%v)\n", err)
+		b.retryCheckpointAt = len(b.journal) + b.opts.JournalLimit
+		return
+	}
+	if b.process != p {
+		return // The bridge was restarted, and everything in the journal traced again.
+	}
+	b.checkpoint, b.retryCheckpointAt = &checkpoint, 0
+	b.journal = append([]traced(nil), b.journal[n:]...)
+}
@@ -0,0 +1,190 @@
+package soltools
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stop stops supervising b, and kills its bridge process, without asking the bridge to close.
+func stop(b *Backend) {
+	close(b.quit)
+	<-b.supervised
+	b.Client.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.process.kill()
+}
+
+// eventually waits up to five seconds for condition to hold.
+func eventually(t *testing.T, condition func() bool, msg string) {
+	for deadline := time.Now().Add(5 * time.Second); !condition(); {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBackendRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soltools")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bridge := newBridgeServer(map[string]string{
+		"ping":            "true",
+		"sendTransaction": `"0x01"`,
+		"call":            `"0x"`,
+		"replay":          "true",
+	})
+	defer bridge.Close()
+
+	opts := fakeNode(t, dir, `echo "javascript web3 server listening on port `+bridge.port()+`"; exec sleep 10`)
+	opts.Stdout = ioutil.Discard
+	opts.Stderr = ioutil.Discard
+	opts.HealthCheckInterval = 10 * time.Millisecond
+	opts.CallTimeout = 50 * time.Millisecond
+	opts.StartupTimeout = time.Second
+	backend, err := NewBackendWithOptions(context.Background(), opts)
+	require.NoError(t, err)
+	defer stop(backend)
+
+	// Trace a transaction and a call.
+	to := common.HexToAddress("0x5409ed021d9299bf6814279a6a1411a7e866a631")
+	tx := types.NewTransaction(0, to, new(big.Int), 21000, big.NewInt(1), []byte{1, 2})
+	require.NoError(t, backend.SendTransaction(context.Background(), tx))
+	_, err = backend.CallContract(context.Background(), ethereum.CallMsg{To: &to}, nil)
+	require.NoError(t, err)
+
+	// Crash the bridge. It's restarted, and traces them again.
+	backend.mu.Lock()
+	crashed := backend.process
+	backend.mu.Unlock()
+	crashed.cmd.Process.Kill()
+	eventually(t, func() bool {
+		backend.mu.Lock()
+		defer backend.mu.Unlock()
+		return backend.process != crashed
+	}, "the bridge wasn't restarted")
+	assert.JSONEq(t, `[[
+		{"txHash": "`+tx.Hash().Hex()+`", "to": "0x5409ed021d9299bf6814279a6a1411a7e866a631", "data": "0x0102"},
+		{"call": {"to": "0x5409ed021d9299bf6814279a6a1411a7e866a631", "data": "0x"}}
+	]]`, bridge.request("replay"))
+	assert.NoError(t, backend.Ping(context.Background()))
+
+	// A bridge that answers health checks with an error is alive, so it isn't restarted.
+	bridge.remove("ping")
+	time.Sleep(100 * time.Millisecond)
+	backend.mu.Lock()
+	assert.Equal(t, 1, backend.restarts)
+	backend.mu.Unlock()
+
+	// A bridge that stops answering health checks is restarted, until it runs out of restarts,
+	// after which the bridge is down.
+	bridge.respond("ping", "hang")
+	eventually(t, func() bool {
+		backend.mu.Lock()
+		defer backend.mu.Unlock()
+		return backend.down != nil
+	}, "the bridge wasn't given up on")
+	err = backend.Ping(context.Background())
+	assert.True(t, IsBridgeError(err), "%v", err)
+	assert.EqualError(t, err, "soltools: bridge ping: restarting the Node.js bridge: checking the health of the Node.js bridge: soltools: bridge ping: context deadline exceeded")
+	assert.Equal(t, DefaultMaxRestarts, backend.restarts)
+}
+
+func TestBackendJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soltools")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bridge := newBridgeServer(map[string]string{
+		"ping":   "true",
+		"call":   `"0x"`,
+		"replay": "true",
+		"snapshot": `{"coverage": {"/contracts/Vault.sol": {
+			"path": "/contracts/Vault.sol",
+			"statementMap": {"1": {"start": {"line": 9, "column": 8}, "end": {"line": 9, "column": 30}}},
+			"fnMap": {}, "branchMap": {}, "s": {"1": 150}, "f": {}, "b": {}
+		}}, "profile": null}`,
+	})
+	defer bridge.Close()
+
+	opts := fakeNode(t, dir, `echo "javascript web3 server listening on port `+bridge.port()+`"; exec sleep 10`)
+	opts.Stdout = ioutil.Discard
+	opts.Stderr = ioutil.Discard
+	opts.HealthCheckInterval = time.Hour
+	opts.JournalLimit = 150
+	backend, err := NewBackendWithOptions(context.Background(), opts)
+	require.NoError(t, err)
+	defer stop(backend)
+	calls := func(n int) {
+		for i := 0; i < n; i++ {
+			_, err := backend.CallContract(context.Background(), ethereum.CallMsg{Data: []byte{byte(i)}}, nil)
+			require.NoError(t, err)
+		}
+	}
+
+	// Once the journal is full, the bridge's coverage so far is taken instead.
+	calls(150)
+	backend.mu.Lock()
+	assert.Empty(t, backend.journal)
+	require.NotNil(t, backend.checkpoint)
+	backend.mu.Unlock()
+
+	// If the bridge crashes, its checkpoint is saved, and only the rest of the journal is
+	// traced again, in batches.
+	calls(120)
+	backend.mu.Lock()
+	crashed := backend.process
+	backend.mu.Unlock()
+	crashed.cmd.Process.Kill()
+	eventually(t, func() bool {
+		backend.mu.Lock()
+		defer backend.mu.Unlock()
+		return backend.process != crashed
+	}, "the bridge wasn't restarted")
+
+	var replayed [][]traced
+	require.NoError(t, json.Unmarshal([]byte(bridge.request("replay")), &replayed))
+	require.Len(t, replayed, 1)
+	assert.Len(t, replayed[0], 120-replayBatch)
+	assert.Equal(t, map[string]interface{}{"data": "0x77"}, replayed[0][len(replayed[0])-1].Call)
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	assert.Nil(t, backend.checkpoint)
+	assert.Len(t, backend.journal, 120)
+	assert.Equal(t, uint64(150), backend.saved.Coverage["/contracts/Vault.sol"].S["1"])
+	assert.Nil(t, backend.saved.Profile)
+}
+
+func TestBackendErrors(t *testing.T) {
+	// Requests that the bridge answers with an error fail with an *EVMError.
+	bridge := newBridgeServer(map[string]string{})
+	defer bridge.Close()
+	_, err := bridge.backend().CallContract(context.Background(), ethereum.CallMsg{}, nil)
+	assert.Equal(t, &EVMError{Method: "call", Message: "no call"}, err)
+	assert.False(t, IsBridgeError(err))
+
+	// Requests that the bridge doesn't answer in time fail with a *BridgeError.
+	bridge.respond("eth_getTransactionCount", "hang")
+	backend := bridge.backend()
+	backend.opts.CallTimeout = 50 * time.Millisecond
+	_, err = backend.PendingNonceAt(context.Background(), common.Address{})
+	assert.Equal(t, &BridgeError{Method: "eth_getTransactionCount", Err: context.DeadlineExceeded}, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = backend.Ping(ctx)
+	assert.Equal(t, &BridgeError{Method: "ping", Err: context.Canceled}, err)
+	assert.True(t, IsBridgeError(errors.Wrap(err, "pinging")))
+}
@@ -0,0 +1,126 @@
+package soltools
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StackFrame is one frame of the Solidity call stack of a revert, as reported by sol-trace.
+type StackFrame struct {
+	Contract string // Contract the frame is in, e.g. "Manager", or "" if it couldn't be found.
+	Function string // Function or modifier the frame is in, e.g. "issue", or "" if it couldn't be found.
+	File     string // Source file, as sol-trace names it, e.g. "Manager.sol".
+	Line     int    // Line number, starting from 1.
+	Column   int    // Column number, starting from 0.
+	Source   string // Source of the statement, e.g. `require(!paused, "contract is paused")`.
+}
+
+// String formats f like "Manager.issue (Manager.sol:123): require(...)".
+func (f StackFrame) String() string {
+	location := fmt.Sprintf("%v:%v", f.File, f.Line)
+	if f.Function != "" {
+		location = fmt.Sprintf("%v.%v (%v)", f.Contract, f.Function, location)
+	} else if f.Contract != "" {
+		location = fmt.Sprintf("%v (%v)", f.Contract, location)
+	}
+	if f.Source == "" {
+		return location
+	}
+	return location + ": " + f.Source
+}
+
+// RevertTraceError is returned for transactions and calls that revert, by a Backend that was made
+// with Options.RevertTrace set. It carries the Solidity call stack that led to the revert, so that
+// test failures can show which require tripped.
+type RevertTraceError struct {
+	Method  string       // Bridge method that reverted: "sendTransaction" or "call".
+	Message string       // Error message, if the node reported one.
+	Stack   []StackFrame // Frames in the order sol-trace reports them. Empty if it couldn't tell.
+}
+
+func (e *RevertTraceError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = "execution reverted"
+	}
+	msg = e.Method + ": " + msg
+	if len(e.Stack) == 0 {
+		return msg + " (no Solidity stack trace available)"
+	}
+	for _, frame := range e.Stack {
+		msg += "\n\tat " + frame.String()
+	}
+	return msg
+}
+
+// traceFrame matches a frame as sol-trace logs it: "<file>:<line>:<column>", optionally followed
+// by ":" and the source of the statement on the following lines.
+var traceFrame = regexp.MustCompile(`^(\S+?):(\d+):(\d+)(?::\s*([\s\S]*))?$`)
+
+// newRevertTraceError builds a RevertTraceError from the messages that sol-trace logged while
+// the bridge handled method. Frames are resolved to contracts and functions by reading their
+// source files, which are looked for in contractsDir.
+func newRevertTraceError(method, message string, logged []string, contractsDir string) *RevertTraceError {
+	result := &RevertTraceError{Method: method, Message: message}
+	sources := make(map[string][]string) // file -> lines, or nil if it couldn't be read
+	for _, entry := range logged {
+		match := traceFrame.FindStringSubmatch(strings.TrimSpace(entry))
+		if match == nil {
+			continue
+		}
+		frame := StackFrame{File: match[1], Source: strings.Join(strings.Fields(match[4]), " ")}
+		frame.Line, _ = strconv.Atoi(match[2])
+		frame.Column, _ = strconv.Atoi(match[3])
+
+		lines, ok := sources[frame.File]
+		if !ok {
+			lines = readSourceLines(frame.File, contractsDir)
+			sources[frame.File] = lines
+		}
+		frame.Contract, frame.Function = enclosingDeclarations(lines, frame.Line)
+		result.Stack = append(result.Stack, frame)
+	}
+	return result
+}
+
+// readSourceLines reads the lines of a source file that sol-trace named file, which is either
+// absolute or relative to contractsDir or the working directory. It returns nil if neither
+// exists.
+func readSourceLines(file, contractsDir string) []string {
+	candidates := []string{file}
+	if !filepath.IsAbs(file) {
+		candidates = []string{filepath.Join(contractsDir, file), file}
+	}
+	for _, path := range candidates {
+		if source, err := ioutil.ReadFile(path); err == nil {
+			return strings.Split(string(source), "\n")
+		}
+	}
+	return nil
+}
+
+var (
+	contractDeclaration = regexp.MustCompile(`^\s*(?:contract|library|interface)\s+(\w+)`)
+	functionDeclaration = regexp.MustCompile(`^\s*(?:function\s+(\w+)|modifier\s+(\w+)|(constructor)\b|function\s*\()`)
+)
+
+// enclosingDeclarations finds the contract and function that line, counting from 1, is in, by
+// looking for the nearest declarations above it. It doesn't parse Solidity, so it can be fooled
+// by declarations in comments or strings.
+func enclosingDeclarations(lines []string, line int) (contract, function string) {
+	for i := 0; i < line && i < len(lines); i++ {
+		if match := contractDeclaration.FindStringSubmatch(lines[i]); match != nil {
+			contract, function = match[1], ""
+		} else if match := functionDeclaration.FindStringSubmatch(lines[i]); match != nil {
+			function = match[1] + match[2] + match[3]
+			if function == "" {
+				function = "fallback"
+			}
+		}
+	}
+	return contract, function
+}
@@ -0,0 +1,57 @@
+package soltools
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const managerSource = `pragma solidity 0.5.7;
+
+contract Manager {
+    bool public paused;
+
+    modifier notPaused() {
+        require(!paused, "contract is paused");
+        _;
+    }
+
+    function issue(uint256 amount) external notPaused {
+        require(amount > 0, "cannot issue zero RSV");
+    }
+}
+`
+
+func TestNewRevertTraceError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soltools")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Manager.sol"), []byte(managerSource), 0644))
+
+	// This is how sol-trace logs a revert.
+	logged := []string{
+		"\n\nStack trace for REVERT:\n",
+		"Manager.sol:12:8:\n    require(amount > 0, \"cannot issue zero RSV\")",
+		"Manager.sol:7:8",
+		"Missing.sol:3:0:\n    revert()",
+		"\n",
+	}
+	err = newRevertTraceError("call", "", logged, dir)
+	assert.Equal(t, &RevertTraceError{Method: "call", Stack: []StackFrame{
+		{"Manager", "issue", "Manager.sol", 12, 8, `require(amount > 0, "cannot issue zero RSV")`},
+		{"Manager", "notPaused", "Manager.sol", 7, 8, ""},
+		{"", "", "Missing.sol", 3, 0, "revert()"},
+	}}, err)
+	assert.EqualError(t, err, `call: execution reverted
+	at Manager.issue (Manager.sol:12): require(amount > 0, "cannot issue zero RSV")
+	at Manager.notPaused (Manager.sol:7)
+	at Missing.sol:3: revert()`)
+
+	err = newRevertTraceError("sendTransaction", "transaction 0x12 reverted",
+		[]string{"REVERT detected but could not determine stack trace"}, dir)
+	assert.EqualError(t, err, "sendTransaction: transaction 0x12 reverted (no Solidity stack trace available)")
+}
@@ -10,29 +10,32 @@ import (
 	"math"
 	"math/big"
 	"os"
-
-	"os/exec"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
 
+	ethereum "github.com/ethereum/go-ethereum"
 	ethabi "github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/reserve-protocol/rsv-beta/abi"
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+	"github.com/reserve-protocol/rsv-beta/rsvtest"
 	"github.com/reserve-protocol/rsv-beta/soltools"
+	"github.com/reserve-protocol/rsv-beta/soltools/istanbul"
 )
 
-type logParser interface {
-	ParseLog(*types.Log) (fmt.Stringer, error)
-}
-
 // TestSuite holds functionality common between our two test suites.
 //
 // It knows how to create a connection to an Ethereum node, it holds a list of accounts
@@ -64,15 +67,89 @@ type TestSuite struct {
 
 	utilContract *bind.BoundContract
 
-	logParsers map[common.Address]logParser
+	// multicall makes batched reads through the Multicall contract that setup deploys.
+	multicall *bindutil.Multicall
+
+	router *bindutil.Router
+
+	// forkSource is the state that the fork node forks, when forking a node.
+	forkSource *soltools.RPCSource
+	// forkRecorder records the state that the suite used, when forking a node.
+	forkRecorder *soltools.Recorder
 
 	operator account
 	proposer account
 	weights  []*big.Int
+
+	// covers is the contracts that the suite tests, whose coverage is checked against
+	// COVERAGE_THRESHOLDS after the suite.
+	covers []string
 }
 
+// coverageEnabled makes the suites write a coverage report after each suite. On its own, it has
+// the fast node collect coverage in Go, which, unlike the Node.js coverage node's sol-coverage
+// that it replaced, has no branch coverage: only lines and functions.
 var coverageEnabled = os.Getenv("COVERAGE_ENABLED") != ""
 
+// revertTraceEnabled makes the coverage node report the Solidity stack trace of reverts, in the
+// errors of transactions and calls that revert. It only has an effect when coverage is enabled,
+// and makes the suites use the Node.js coverage node, which needs a local geth node.
+var revertTraceEnabled = os.Getenv("REVERT_TRACE_ENABLED") != ""
+
+// profileEnabled makes the coverage node profile gas usage, and write the profile to profile/
+// after each suite. Like revertTraceEnabled, it needs coverage enabled and the Node.js coverage
+// node.
+var profileEnabled = os.Getenv("PROFILE_ENABLED") != ""
+
+// forkSnapshot, if set, is the path of a soltools.Snapshot to run the suites on top of, in a
+// soltools.Fork, instead of on an empty chain. A fork doesn't collect coverage, so it can't be
+// combined with coverageEnabled, nor can forkURL.
+var forkSnapshot = os.Getenv("FORK_SNAPSHOT")
+
+// forkURL, if set, is the URL of a node, such as a local archive node, whose state as of block
+// FORK_BLOCK (or its latest block) the suites run on top of, in a soltools.Fork. With FORK_RECORD
+// set to a path, the state that the suites used is saved there as a snapshot after each suite,
+// to run on again offline with FORK_SNAPSHOT.
+var forkURL = os.Getenv("FORK_URL")
+
+// forkReserve and forkManager, if set, are the addresses of Reserve and the Manager as deployed on
+// the forked chain, for the fork suite to bind to, with rsvtest.BindSystem, and check the forked
+// state of. forkHolders is a comma-separated list of RSV holders whose forked balances it checks,
+// on top of Reserve's owner and fee recipient.
+var (
+	forkReserve = os.Getenv("FORK_RESERVE")
+	forkManager = os.Getenv("FORK_MANAGER")
+	forkHolders = os.Getenv("FORK_HOLDERS")
+)
+
+// coverageThresholds is the minimum coverage of the contracts that each suite tests, as
+// istanbul.ParseThresholds parses it, such as "lines=90,branches=70,Manager.functions=100". When
+// coverage is enabled, a suite whose contracts' coverage is below it fails. Contracts in
+// jointCovers are only checked in runs of all of the suites that test them.
+//
+// The Go coverage of plain COVERAGE_ENABLED has no branches, so any branches threshold fails
+// there; branches need the Node.js coverage node.
+var coverageThresholds = os.Getenv("COVERAGE_THRESHOLDS")
+
+// jointCovers is the contracts that no one suite tests, with the contracts of the suites that do.
+// Proposal, which WeightProposal and SwapProposal inherit from, is tested by both of their
+// suites, so it is checked against COVERAGE_THRESHOLDS after whichever of them runs last.
+var jointCovers = map[string][]string{
+	"Proposal": {"WeightProposal", "SwapProposal"},
+}
+
+// covered is the contracts of the suites that have run so far, and checked is the contracts of
+// jointCovers that have been checked.
+var covered, checked = make(map[string]bool), make(map[string]bool)
+
+// coverageMerge is a list of coverage files from other runs, such as a fuzz run's, separated like
+// $PATH, to merge into this run's. They are read after the first suite, which overwrites
+// coverage/coverage.json, so they should be saved somewhere else.
+var coverageMerge = os.Getenv("COVERAGE_MERGE")
+
+// runCoverage is the coverage of the suites that have run so far, merged with COVERAGE_MERGE.
+var runCoverage istanbul.Coverage
+
 // requireTxWithStrictEvents(tx, err)(events...) requires that a transaction is successfully mined,
 // does not revert, and that err is nil. The result of requireTxWithStrictEvents takes a
 // variable-length list error arguments, and requires that exactly that set of events was thrown
@@ -94,12 +171,9 @@ func (s *TestSuite) requireTxWithStrictEvents(tx *types.Transaction, err error)
 	return func(assertEvent ...fmt.Stringer) {
 		if s.Equal(len(assertEvent), len(receipt.Logs), "did not get the expected number of events") {
 			for i, wantEvent := range assertEvent {
-				parser := s.logParsers[receipt.Logs[i].Address]
-				if s.NotNil(parser, "got an event from an unexpected contract address: "+receipt.Logs[i].Address.Hex()) {
-					gotEvent, err := parser.ParseLog(receipt.Logs[i])
-					if s.NoErrorf(err, "parsing event %v", i) {
-						s.Equal(wantEvent.String(), gotEvent.String())
-					}
+				gotEvent, err := s.router.ParseLog(*receipt.Logs[i])
+				if s.NoErrorf(err, "parsing event %v", i) {
+					s.Equal(wantEvent.String(), gotEvent.String())
 				}
 			}
 		}
@@ -128,12 +202,9 @@ func (s *TestSuite) requireTx(tx *types.Transaction, err error) func(assertEvent
 		for _, wantEvent := range assertEvent {
 			found := false
 			for _, log := range receipt.Logs {
-				parser := s.logParsers[log.Address]
-				if parser != nil {
-					gotEvent, err := parser.ParseLog(log)
-					if err == nil && wantEvent.String() == gotEvent.String() {
-						found = true
-					}
+				gotEvent, err := s.router.ParseLog(*log)
+				if err == nil && wantEvent.String() == gotEvent.String() {
+					found = true
 				}
 			}
 			s.Truef(found, "event not found: %v", wantEvent)
@@ -143,12 +214,19 @@ func (s *TestSuite) requireTx(tx *types.Transaction, err error) func(assertEvent
 
 // requireTxFails is like requireTxWithEvents, but it requires that the transaction either
 // reverts or is not successfully made in the first place due to gas estimation
-// failing.
+// failing, or due to a checked binding (abi.<Contract>Checked) detecting the revert.
+// With REVERT_TRACE_ENABLED, reverted transactions fail with a *soltools.RevertTraceError.
 func (s *TestSuite) requireTxFails(tx *types.Transaction, err error) {
 	if err != nil && err.Error() ==
 		"failed to estimate gas needed: gas required exceeds allowance or always failing transaction" {
 		return
 	}
+	if _, reverted := bindutil.RevertReason(err); reverted {
+		return
+	}
+	if _, reverted := err.(*soltools.RevertTraceError); reverted {
+		return
+	}
 
 	receipt := s._requireTxStatus(tx, err, types.ReceiptStatusFailed)
 	s.Equal(0, len(receipt.Logs), "Zero logs should be generated for a failed transaction")
@@ -224,8 +302,18 @@ func (s *TestSuite) createSlowCoverageNode() {
 	fmt.Fprintln(os.Stderr, "If one is not already running, start one in a new terminal with:")
 	fmt.Fprintln(os.Stderr, "\n\tmake run-geth")
 
+	dir := repoDir()
 	var err error
-	s.node, err = soltools.NewBackend("http://localhost:8545")
+	s.node, err = soltools.NewBackendWithOptions(context.Background(), soltools.Options{
+		NodeURL:      "http://localhost:8545",
+		BridgeScript: filepath.Join(dir, "soltools", "bridge.js"),
+		ArtifactsDir: filepath.Join(dir, "artifacts"),
+		ContractsDir: filepath.Join(dir, "contracts"),
+		Stdout:       soltools.LogWriter(s.T().Logf),
+		Stderr:       soltools.LogWriter(s.T().Logf),
+		RevertTrace:  revertTraceEnabled,
+		Profile:      profileEnabled,
+	})
 	s.Require().NoError(err)
 
 	// Throwaway initial transaction.
@@ -251,6 +339,9 @@ func (s *TestSuite) createSlowCoverageNode() {
 }
 
 // createFastNode creates a fast in-process Ethereum node. It is then available as `s.node`.
+//
+// With coverage enabled, the node traces every transaction and call for the coverage report,
+// in Go, so that coverage doesn't need a geth node or Node.js.
 func (s *TestSuite) createFastNode() {
 	genesisAlloc := core.GenesisAlloc{}
 	for _, account := range s.account {
@@ -258,19 +349,92 @@ func (s *TestSuite) createFastNode() {
 			Balance: big.NewInt(math.MaxInt64),
 		}
 	}
-	s.node = backend{
-		backends.NewSimulatedBackend(
-			genesisAlloc,
-			// Block gas limit. Needs to be more than 7e6, which is about the cost
-			// of the ReserveV2 constructor. But we still want it about the
-			// same order of magnitude as mainnet.
-			//
-			// The Reserve constructor is edging close to the mainnet block limit.
-			// We'll probably stay under it without any problem. If not, we can split
-			// the Eternal Storage contract deployment into a different transaction.
-			8e6,
-		),
+	// Block gas limit. Needs to be more than 7e6, which is about the cost
+	// of the ReserveV2 constructor. But we still want it about the
+	// same order of magnitude as mainnet.
+	//
+	// The Reserve constructor is edging close to the mainnet block limit.
+	// We'll probably stay under it without any problem. If not, we can split
+	// the Eternal Storage contract deployment into a different transaction.
+	const gasLimit = 8e6
+	node := backend{
+		SimulatedBackend: backends.NewSimulatedBackend(genesisAlloc, gasLimit),
+	}
+	if coverageEnabled {
+		var sourceMaps []*bindutil.SourceMap
+		for _, contract := range abi.Contracts {
+			sourceMaps = append(sourceMaps, contract.SourceMap)
+		}
+		coverage, err := soltools.NewCoverage(repoDir(), sourceMaps...)
+		s.Require().NoError(err)
+
+		// The coverage is traced on a chain of its own, made just like the SimulatedBackend's,
+		// which mines the same blocks.
+		db := ethdb.NewMemDatabase()
+		genesis := core.Genesis{Config: params.AllEthashProtocolChanges, GasLimit: gasLimit, Alloc: genesisAlloc}
+		genesis.MustCommit(db)
+		chain, err := core.NewBlockChain(db, nil, genesis.Config, ethash.NewFaker(), vm.Config{}, nil)
+		s.Require().NoError(err)
+		node.coverage = soltools.NewSimulatedCoverage(db, chain, coverage)
+	}
+	s.node = node
+}
+
+// createForkNode creates an in-process Ethereum node on top of the state in FORK_SNAPSHOT, or of
+// the node at FORK_URL, with s.account funded. It is then available as `s.node`.
+func (s *TestSuite) createForkNode() {
+	var source soltools.StateSource
+	if forkSnapshot != "" {
+		snapshot, err := soltools.LoadSnapshot(forkSnapshot)
+		s.Require().NoError(err)
+		source = snapshot
+	} else {
+		var blockNumber *big.Int
+		if block := os.Getenv("FORK_BLOCK"); block != "" {
+			var ok bool
+			blockNumber, ok = new(big.Int).SetString(block, 10)
+			s.Require().True(ok, "FORK_BLOCK %q is not a block number", block)
+		}
+		var err error
+		s.forkSource, err = soltools.NewRPCSource(context.Background(), forkURL, blockNumber)
+		s.Require().NoError(err)
+		s.forkRecorder = soltools.NewRecorder(s.forkSource)
+		source = s.forkRecorder
+	}
+
+	alloc := core.GenesisAlloc{}
+	for _, account := range s.account {
+		alloc[account.address()] = core.GenesisAccount{
+			Balance: big.NewInt(math.MaxInt64),
+		}
+	}
+	var err error
+	s.node, err = soltools.NewFork(context.Background(), soltools.ForkOptions{
+		Source: source,
+		Alloc:  alloc,
+		// The forked block's gas limit may be too low to deploy the Reserve; see createFastNode.
+		GasLimit: 8e6,
+	})
+	s.Require().NoError(err)
+}
+
+// adjustTime moves the node's clock delta ahead, mining a block, on nodes that can.
+func (s *TestSuite) adjustTime(delta time.Duration) {
+	node, ok := s.node.(interface {
+		AdjustTime(delta time.Duration) error
+	})
+	s.Require().True(ok, "the node can't adjust time")
+	s.Require().NoError(node.AdjustTime(delta))
+}
+
+// repoDir returns the repository root, which holds the bridge script and the artifacts and
+// sources to report coverage of. `make test` sets REPO_DIR to it; `go test` runs in tests/, just
+// below it.
+func repoDir() string {
+	if dir := os.Getenv("REPO_DIR"); dir != "" {
+		return dir
 	}
+	return ".."
 }
 
 // setup sets up the TestSuite. It must be called before using s.account or s.signer.
@@ -295,7 +459,18 @@ func (s *TestSuite) setup() {
 	s.signer = signer(s.account[0])
 	s.owner = s.account[0]
 
-	s.createFastNode()
+	// Only the fast node and the Node.js coverage node collect coverage, and neither forks.
+	s.Require().False(coverageEnabled && (forkSnapshot != "" || forkURL != ""),
+		"COVERAGE_ENABLED can't be combined with FORK_SNAPSHOT or FORK_URL: a fork node doesn't collect coverage")
+
+	// The Node.js coverage node is only needed for what the fast node can't do in Go.
+	if coverageEnabled && (revertTraceEnabled || profileEnabled) {
+		s.createSlowCoverageNode()
+	} else if forkSnapshot != "" || forkURL != "" {
+		s.createForkNode()
+	} else {
+		s.createFastNode()
+	}
 
 	// Deploy utility contract just for reading block time
 	bytecode := "0x6080604052348015600f57600080fd5b5060918061001e6000396000f3fe6080604052348015600f57600080fd5b50600436106044577c0100000000000000000000000000000000000000000000000000000000600035046316ada54781146049575b600080fd5b604f6061565b60408051918252519081900360200190f35b429056fea165627a7a723058205524d6a0c4d80ea5535c2ea64615c2619a21518e242cb929275cbd678b04468f0029"
@@ -310,49 +485,157 @@ func (s *TestSuite) setup() {
 	_, tx, utilContract, err := bind.DeployContract(s.signer, utilABI, code, s.node)
 	s.requireTx(tx, err)( /* assert zero events */ )
 	s.utilContract = utilContract
+
+	// Deploy the Multicall contract, for batched reads.
+	multicallAddress, tx, _, err := abi.DeployMulticall(s.signer, s.node)
+	s.requireTx(tx, err)( /* assert zero events */ )
+	s.multicall = bindutil.NewMulticall(s.node, multicallAddress)
 }
 
 // TearDownSuite runs once, after all of the tests in the suite.
 func (s *TestSuite) TearDownSuite() {
+	if s.forkSource != nil {
+		if path := os.Getenv("FORK_RECORD"); path != "" {
+			s.Assert().NoError(s.forkRecorder.Snapshot().WriteFile(path))
+		}
+		s.forkSource.Close()
+	}
+
 	if coverageEnabled {
-		// Write coverage profile to disk.
-		s.Assert().NoError(s.node.(*soltools.Backend).WriteCoverage())
-
-		// Close the node.js process.
-		s.Assert().NoError(s.node.(*soltools.Backend).Close())
-
-		// Process coverage profile into an HTML report.
-		if out, err := exec.Command("npx", "istanbul", "report", "html").CombinedOutput(); err != nil {
-			fmt.Println()
-			fmt.Println("I generated coverage information in coverage/coverage.json.")
-			fmt.Println("I tried to process it with `istanbul` to turn it into a readable report, but failed.")
-			fmt.Println("The error I got when running istanbul was:", err)
-			fmt.Println("Istanbul's output was:\n" + string(out))
+		switch node := s.node.(type) {
+		case *soltools.Backend:
+			// Write coverage profile to disk.
+			s.Assert().NoError(node.WriteCoverage())
+
+			// Write gas profile to disk.
+			if profileEnabled {
+				s.Assert().NoError(node.WriteProfile())
+			}
+
+			// Close the node.js process.
+			s.Assert().NoError(node.Close())
+		case backend:
+			// Write coverage profile to disk.
+			s.Assert().NoError(node.coverage.WriteCoverage())
+		default:
+			// Nothing wrote this suite's coverage, so don't report, or check, an earlier run's.
+			s.Failf("no coverage", "a %T node doesn't collect coverage", node)
+			return
 		}
+
+		s.reportCoverage()
 	}
 }
 
+// reportCoverage merges the coverage that the suite wrote into that of the suites before it,
+// writes the result back to coverage/coverage.json, with summaries of it in
+// coverage/summary.txt and coverage/summary.html, and checks the suite's contracts against
+// COVERAGE_THRESHOLDS.
+func (s *TestSuite) reportCoverage() {
+	path := filepath.Join("coverage", "coverage.json")
+	coverage, err := istanbul.Load(path)
+	s.Require().NoError(err)
+	if runCoverage == nil {
+		runCoverage = make(istanbul.Coverage)
+		for _, earlier := range filepath.SplitList(coverageMerge) {
+			run, err := istanbul.Load(earlier)
+			s.Require().NoError(err)
+			runCoverage = istanbul.Merge(runCoverage, run)
+		}
+	}
+	runCoverage = istanbul.Merge(runCoverage, coverage)
+	s.Require().NoError(runCoverage.WriteFile(path))
+
+	report := istanbul.NewReport(runCoverage)
+	text, err := os.Create(filepath.Join("coverage", "summary.txt"))
+	s.Require().NoError(err)
+	s.Assert().NoError(report.WriteText(text))
+	s.Assert().NoError(text.Close())
+	html, err := os.Create(filepath.Join("coverage", "summary.html"))
+	s.Require().NoError(err)
+	s.Assert().NoError(report.WriteHTML(html))
+	s.Assert().NoError(html.Close())
+
+	// Check the suite's contracts, and those of jointCovers whose suites have all run now.
+	contracts := append([]string(nil), s.covers...)
+	for _, contract := range s.covers {
+		covered[contract] = true
+	}
+	for contract, others := range jointCovers {
+		ran := !checked[contract]
+		for _, other := range others {
+			ran = ran && covered[other]
+		}
+		if ran {
+			checked[contract] = true
+			contracts = append(contracts, contract)
+		}
+	}
+	thresholds, err := istanbul.ParseThresholds(coverageThresholds)
+	s.Require().NoError(err)
+	s.Assert().NoError(thresholds.Check(report, contracts...))
+}
+
 // backend is a wrapper around *backends.SimulatedBackend.
 //
 // *backends.SimulatedBackend requires blocks to be mined manually -- they are not automatically
 // mined on every transaction. We want them to be automatically mined on every transaction, though,
 // so we use this wrapper to do so.
+//
+// With coverage enabled, it also traces each transaction and call into coverage, which it keeps
+// in step with the SimulatedBackend.
 type backend struct {
 	*backends.SimulatedBackend
+
+	coverage *soltools.SimulatedCoverage
 }
 
 // SendTransaction overrides the function by the same name in *backends.SimulatedBackend,
 // adding auto-mining for each transaction.
 func (b backend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
-	defer b.Commit()
-	return b.SimulatedBackend.SendTransaction(ctx, tx)
+	defer b.commit()
+	if err := b.SimulatedBackend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	if b.coverage != nil {
+		b.coverage.SendTransaction(tx)
+	}
+	return nil
 }
 
 // AdjustTime overrides the function by the same name in *backends.SimulatedBackend,
 // adding auto-committing.
 func (b backend) AdjustTime(delta time.Duration) error {
-	defer b.Commit()
-	return b.SimulatedBackend.AdjustTime(delta)
+	defer b.commit()
+	if err := b.SimulatedBackend.AdjustTime(delta); err != nil {
+		return err
+	}
+	if b.coverage != nil {
+		b.coverage.AdjustTime(delta)
+	}
+	return nil
+}
+
+// CallContract overrides the function by the same name in *backends.SimulatedBackend,
+// tracing the call for coverage.
+func (b backend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if b.coverage != nil {
+		if err := b.coverage.TraceCall(ctx, call, blockNumber); err != nil {
+			return nil, err
+		}
+	}
+	return b.SimulatedBackend.CallContract(ctx, call, blockNumber)
+}
+
+// commit mines the pending block, and traces it for coverage. Like *backends.SimulatedBackend,
+// it panics if it can't.
+func (b backend) commit() {
+	b.Commit()
+	if b.coverage != nil {
+		if err := b.coverage.Commit(); err != nil {
+			panic(err)
+		}
+	}
 }
 
 // signer returns a *bind.TransactOpts that uses a's private key to sign transactions.
@@ -434,6 +717,28 @@ func containsAddress(a []common.Address, x common.Address) bool {
 
 // TestSuite Helpers
 
+// systemOptions returns the options to deploy an rsvtest.System with, as s.owner, with s.operator
+// as the Manager's operator, registering its contracts in s.router.
+func (s *TestSuite) systemOptions() rsvtest.Options {
+	return rsvtest.Options{
+		Owner:    rsvtest.Account{Key: s.owner.key},
+		Operator: rsvtest.Account{Key: s.operator.key},
+		Router:   s.router,
+	}
+}
+
+// useSystem points s at the contracts of sys that have been deployed, and at its router.
+func (s *TestSuite) useSystem(sys *rsvtest.System) {
+	s.router = sys.Router
+	s.reserve, s.reserveAddress = sys.Reserve, sys.ReserveAddress
+	s.eternalStorage, s.eternalStorageAddress = sys.EternalStorage, sys.EternalStorageAddress
+	s.vault, s.vaultAddress = sys.Vault, sys.VaultAddress
+	s.proposalFactory, s.proposalFactoryAddress = sys.ProposalFactory, sys.ProposalFactoryAddress
+	s.erc20s, s.erc20Addresses = sys.ERC20s, sys.ERC20Addresses
+	s.basket, s.basketAddress, s.weights = sys.Basket, sys.BasketAddress, sys.Weights
+	s.manager, s.managerAddress = sys.Manager, sys.ManagerAddress
+}
+
 func (s *TestSuite) fundAccountWithErc20sAndApprove(acc account, amounts []*big.Int) {
 	// Transfer all of the ERC20 tokens to `proposer`.
 	for i, amount := range amounts {
@@ -466,7 +771,7 @@ func (s *TestSuite) changeBasketUsingWeightProposal(tokens []common.Address, wei
 	proposal, err := abi.NewWeightProposal(proposalAddress, s.node)
 	s.Require().NoError(err)
 
-	s.logParsers[proposalAddress] = proposal
+	s.router.Register(proposalAddress, abi.WeightProposalKind)
 
 	// Get Proposal Basket.
 	proposalBasketAddress, err := proposal.TrustedBasket(nil)
@@ -478,7 +783,7 @@ func (s *TestSuite) changeBasketUsingWeightProposal(tokens []common.Address, wei
 	s.Require().NoError(err)
 	s.basket = basket
 
-	s.logParsers[proposalBasketAddress] = basket
+	s.router.Register(proposalBasketAddress, abi.BasketKind)
 
 	// Check Basket has correct fields
 	// Tokens
@@ -509,7 +814,7 @@ func (s *TestSuite) changeBasketUsingWeightProposal(tokens []common.Address, wei
 	s.requireTxFails(s.manager.ExecuteProposal(signer(s.operator), proposalID))
 
 	// Advance 24h.
-	s.Require().NoError(s.node.(backend).AdjustTime(24 * time.Hour))
+	s.adjustTime(24 * time.Hour)
 
 	// Confirm that non-operators cannot execute the proposal.
 	s.requireTxFails(s.manager.ExecuteProposal(signer(s.account[3]), proposalID))
@@ -534,13 +839,11 @@ func (s *TestSuite) changeBasketUsingSwapProposal(tokens []common.Address, amoun
 	s.Require().NoError(err)
 	proposalID := bigInt(0).Sub(proposalsLength, bigInt(1))
 
-	// Construct Proposal binding.
+	// Register the Proposal's events.
 	proposalAddress, err := s.manager.TrustedProposals(nil, proposalID)
 	s.Require().NoError(err)
-	proposal, err := abi.NewSwapProposal(proposalAddress, s.node)
-	s.Require().NoError(err)
 
-	s.logParsers[proposalAddress] = proposal
+	s.router.Register(proposalAddress, abi.SwapProposalKind)
 
 	// Accept the Proposal.
 	s.requireTx(s.manager.AcceptProposal(signer(s.operator), proposalID))(
@@ -553,7 +856,7 @@ func (s *TestSuite) changeBasketUsingSwapProposal(tokens []common.Address, amoun
 	s.requireTxFails(s.manager.ExecuteProposal(signer(s.operator), proposalID))
 
 	// Advance 24h.
-	s.Require().NoError(s.node.(backend).AdjustTime(24 * time.Hour))
+	s.adjustTime(24 * time.Hour)
 
 	// Confirm that non-operators cannot execute the proposal.
 	s.requireTxFails(s.manager.ExecuteProposal(signer(s.account[3]), proposalID))
@@ -568,27 +871,51 @@ func (s *TestSuite) changeBasketUsingSwapProposal(tokens []common.Address, amoun
 	s.assertManagerCollateralized()
 }
 
-func (s *TestSuite) computeExpectedIssueAmounts(
-	seigniorage *big.Int, rsvSupply *big.Int,
-) []*big.Int {
-	BPS_FACTOR := bigInt(10000)
+// basketState is the Manager's basket and collateral, as read by readBasket.
+type basketState struct {
+	Manager       *abi.ManagerSnapshot
+	Basket        *abi.BasketSnapshot
+	Weights       []*big.Int // Weights[i] is the weight of Basket.GetTokens[i].
+	VaultBalances []*big.Int // VaultBalances[i] is the Vault's balance of Basket.GetTokens[i].
+}
 
-	// Get current basket.
-	basketAddress, err := s.manager.TrustedBasket(nil)
+// readBasket reads the Manager's state, its current basket, the basket's weights, and the Vault's
+// balance of each basket token, all from the same block, in three eth_calls through the
+// Multicall contract.
+func (s *TestSuite) readBasket() basketState {
+	ctx := context.Background()
+	manager, err := abi.ReadManagerSnapshot(ctx, s.multicall, s.managerAddress, nil)
 	s.Require().NoError(err)
-	basket, err := abi.NewBasket(basketAddress, s.node)
+	basket, err := abi.ReadBasketSnapshot(ctx, s.multicall, manager.TrustedBasket, manager.BlockNumber)
 	s.Require().NoError(err)
-	size, err := basket.Size(nil)
+
+	state := basketState{
+		Manager:       manager,
+		Basket:        basket,
+		Weights:       make([]*big.Int, len(basket.GetTokens)),
+		VaultBalances: make([]*big.Int, len(basket.GetTokens)),
+	}
+	basketBatch, err := abi.NewBasketBatch(manager.TrustedBasket, s.multicall)
 	s.Require().NoError(err)
+	for i, token := range basket.GetTokens {
+		s.Require().NoError(basketBatch.Weights(&state.Weights[i], token))
+		tokenBatch, err := abi.NewBasicERC20Batch(token, s.multicall)
+		s.Require().NoError(err)
+		s.Require().NoError(tokenBatch.BalanceOf(&state.VaultBalances[i], manager.TrustedVault))
+	}
+	_, err = s.multicall.Do(ctx, manager.BlockNumber)
+	s.Require().NoError(err)
+	return state
+}
+
+func (s *TestSuite) computeExpectedIssueAmounts(
+	seigniorage *big.Int, rsvSupply *big.Int,
+) []*big.Int {
+	BPS_FACTOR := bigInt(10000)
 
 	// Compute expected amounts.
 	var expectedAmounts []*big.Int
-	for i := bigInt(0); i.Cmp(size) == -1; i.Add(i, bigInt(1)) {
-		token, err := basket.Tokens(nil, i)
-		s.Require().NoError(err)
-		weight, err := basket.Weights(nil, token)
-		s.Require().NoError(err)
-
+	for _, weight := range s.readBasket().Weights {
 		// Compute expectedAmount.
 		sum := bigInt(0).Add(BPS_FACTOR, seigniorage)
 		effectiveAmount := bigInt(0).Div(bigInt(0).Mul(rsvSupply, sum), BPS_FACTOR)
@@ -600,22 +927,9 @@ func (s *TestSuite) computeExpectedIssueAmounts(
 }
 
 func (s *TestSuite) computeExpectedRedeemAmounts(rsvSupply *big.Int) []*big.Int {
-	// Get current basket.
-	basketAddress, err := s.manager.TrustedBasket(nil)
-	s.Require().NoError(err)
-	basket, err := abi.NewBasket(basketAddress, s.node)
-	s.Require().NoError(err)
-	size, err := basket.Size(nil)
-	s.Require().NoError(err)
-
 	// Compute expected amounts.
 	var expectedAmounts []*big.Int
-	for i := bigInt(0); i.Cmp(size) == -1; i.Add(i, bigInt(1)) {
-		token, err := basket.Tokens(nil, i)
-		s.Require().NoError(err)
-		weight, err := basket.Weights(nil, token)
-		s.Require().NoError(err)
-
+	for _, weight := range s.readBasket().Weights {
 		// Compute expectedAmount.
 		expectedAmount := bigInt(0).Div(bigInt(0).Mul(rsvSupply, weight), shiftLeft(1, 36))
 		expectedAmounts = append(expectedAmounts, expectedAmount)
@@ -3,6 +3,7 @@
 package tests
 
 import (
+	"context"
 	"math/big"
 	"reflect"
 	"testing"
@@ -33,6 +34,7 @@ var (
 
 // SetupSuite runs once, before all of the tests in the suite.
 func (s *BasketSuite) SetupSuite() {
+	s.covers = []string{"Basket"}
 	s.setup()
 }
 
@@ -100,6 +102,47 @@ func (s *BasketSuite) TestViews() {
 	s.Equal(false, foundHas)
 }
 
+// TestSnapshot checks that batched reads through the Multicall contract return the same values
+// as the view functions.
+func (s *BasketSuite) TestSnapshot() {
+	ctx := context.Background()
+	snapshot, err := abi.ReadBasketSnapshot(ctx, s.multicall, s.basketAddress, nil)
+	s.Require().NoError(err)
+	s.Equal(s.erc20Addresses, snapshot.GetTokens)
+	s.Equal(bigInt(uint32(len(s.erc20Addresses))).String(), snapshot.Size.String())
+
+	// Batch the view functions that take arguments, reading the snapshot's block.
+	batch, err := abi.NewBasketBatch(s.basketAddress, s.multicall)
+	s.Require().NoError(err)
+	weights := make([]*big.Int, len(s.erc20Addresses))
+	has := make([]bool, len(s.erc20Addresses))
+	for i, token := range s.erc20Addresses {
+		s.Require().NoError(batch.Weights(&weights[i], token))
+		s.Require().NoError(batch.Has(&has[i], token))
+	}
+	s.Equal(2*len(s.erc20Addresses), s.multicall.Len())
+
+	blockNumber, err := s.multicall.Do(ctx, snapshot.BlockNumber)
+	s.Require().NoError(err)
+	s.Equal(snapshot.BlockNumber.String(), blockNumber.String())
+	s.Equal(0, s.multicall.Len())
+	for i := range s.erc20Addresses {
+		s.Equal(s.weights[i].String(), weights[i].String())
+		s.True(has[i])
+	}
+
+	// A call that reverts fails the batch, but the other calls still get their results.
+	var token common.Address
+	var size *big.Int
+	s.Require().NoError(batch.Tokens(&token, bigInt(uint32(len(s.erc20Addresses)))))
+	s.Require().NoError(batch.Size(&size))
+	_, err = s.multicall.Do(ctx, nil)
+	if s.Error(err) {
+		s.Contains(err.Error(), "calling Basket.tokens")
+	}
+	s.Equal(snapshot.Size.String(), size.String())
+}
+
 // TestSuccessiveBasketWithEmptyParams tries deploying a second basket from a different account.
 // This basket has no tokens, so should carry over tokens from the first basket.
 func (s *BasketSuite) TestSuccessiveBasketWithEmptyParams() {
@@ -0,0 +1,119 @@
+// +build all
+
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/reserve-protocol/rsv-beta/rsvtest"
+)
+
+func TestFork(t *testing.T) {
+	suite.Run(t, new(ForkSuite))
+}
+
+// ForkSuite checks the state of the system as deployed on a forked chain, at FORK_RESERVE and
+// FORK_MANAGER. It is skipped unless FORK_RESERVE is set.
+type ForkSuite struct {
+	TestSuite
+}
+
+var (
+	// Compile-time check that ForkSuite implements the interfaces we think it does.
+	// If it does not implement these interfaces, then the corresponding setup and teardown
+	// functions will not actually run.
+	_ suite.SetupAllSuite    = &ForkSuite{}
+	_ suite.TearDownAllSuite = &ForkSuite{}
+)
+
+// SetupSuite runs once, before all of the tests in the suite.
+func (s *ForkSuite) SetupSuite() {
+	if forkReserve == "" {
+		s.T().Skip("FORK_RESERVE is not set")
+	}
+	s.Require().True(forkSnapshot != "" || forkURL != "", "FORK_RESERVE needs FORK_URL or FORK_SNAPSHOT to fork")
+	s.Require().True(common.IsHexAddress(forkReserve), "FORK_RESERVE %q is not an address", forkReserve)
+	var managerAddress common.Address
+	if forkManager != "" {
+		s.Require().True(common.IsHexAddress(forkManager), "FORK_MANAGER %q is not an address", forkManager)
+		managerAddress = common.HexToAddress(forkManager)
+	}
+	s.setup()
+
+	sys, err := rsvtest.BindSystem(
+		context.Background(), s.node, rsvtest.Options{}, common.HexToAddress(forkReserve), managerAddress,
+	)
+	s.Require().NoError(err)
+	s.useSystem(sys)
+}
+
+// holders returns the RSV holders to check the balances of: Reserve's owner and fee recipient,
+// and FORK_HOLDERS.
+func (s *ForkSuite) holders() []common.Address {
+	owner, err := s.reserve.Owner(nil)
+	s.Require().NoError(err)
+	feeRecipient, err := s.reserve.FeeRecipient(nil)
+	s.Require().NoError(err)
+	holders := []common.Address{owner, feeRecipient}
+	for _, holder := range strings.Split(forkHolders, ",") {
+		if holder = strings.TrimSpace(holder); holder == "" {
+			continue
+		}
+		s.Require().True(common.IsHexAddress(holder), "FORK_HOLDERS entry %q is not an address", holder)
+		holders = append(holders, common.HexToAddress(holder))
+	}
+	return holders
+}
+
+// TestEternalStorageBalances checks that Reserve's balances are the ones in its forked eternal
+// storage, and that they fit in its total supply.
+func (s *ForkSuite) TestEternalStorageBalances() {
+	totalSupply, err := s.reserve.TotalSupply(nil)
+	s.Require().NoError(err)
+
+	sum := bigInt(0)
+	seen := make(map[common.Address]bool)
+	for _, holder := range s.holders() {
+		if seen[holder] {
+			continue
+		}
+		seen[holder] = true
+
+		stored, err := s.eternalStorage.Balance(nil, holder)
+		s.Require().NoError(err)
+		s.assertRSVBalance(holder, stored)
+		sum.Add(sum, stored)
+	}
+	s.True(sum.Cmp(totalSupply) <= 0, "the holders' %v RSV is more than the total supply of %v", sum, totalSupply)
+	if forkHolders != "" {
+		s.True(sum.Sign() > 0, "none of FORK_HOLDERS holds any RSV on the fork")
+	}
+}
+
+// TestCollateralized checks that the forked Vault holds enough collateral to redeem all of the
+// RSV in circulation.
+func (s *ForkSuite) TestCollateralized() {
+	if s.manager == nil {
+		s.T().Skip("FORK_MANAGER is not set")
+	}
+	collateralized, err := s.manager.IsFullyCollateralized(nil)
+	s.Require().NoError(err)
+	s.True(collateralized)
+
+	totalSupply, err := s.reserve.TotalSupply(nil)
+	s.Require().NoError(err)
+	needed, err := s.manager.ToRedeem(nil, totalSupply)
+	s.Require().NoError(err)
+	s.Require().Len(needed, len(s.erc20s))
+	for i, erc20 := range s.erc20s {
+		held, err := erc20.BalanceOf(nil, s.vaultAddress)
+		s.Require().NoError(err)
+		s.True(held.Cmp(needed[i]) >= 0, "the Vault holds %v of %v, not the %v needed",
+			held, s.erc20Addresses[i].Hex(), needed[i])
+	}
+}
@@ -20,6 +20,8 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/reserve-protocol/rsv-beta/abi"
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+	"github.com/reserve-protocol/rsv-beta/rsvtest"
 )
 
 func TestManagerFuzz(t *testing.T) {
@@ -66,166 +68,21 @@ func (s *ManagerFuzzSuite) BeforeTest(suiteName, testName string) {
 	s.operator = s.account[1]
 	s.proposer = s.account[5]
 
-	// Deploy PreviousReserve to set up for upgrade.
-	oldReserveAddress, tx, oldReserve, err := abi.DeployPreviousReserve(s.signer, s.node)
-
-	s.logParsers = map[common.Address]logParser{
-		oldReserveAddress: oldReserve,
-	}
-
-	s.requireTx(tx, err)(
-		abi.PreviousReserveOwnershipTransferred{PreviousOwner: zeroAddress(), NewOwner: s.owner.address()},
-	)
-
-	oldMaxSupply, err := oldReserve.MaxSupply(nil)
-	s.Require().NoError(err)
-
-	// Get the Go binding and contract address for the new ReserveEternalStorage contract.
-	s.eternalStorageAddress, err = oldReserve.GetEternalStorageAddress(nil)
-	s.Require().NoError(err)
-	s.eternalStorage, err = abi.NewReserveEternalStorage(s.eternalStorageAddress, s.node)
-	s.Require().NoError(err)
-
-	s.logParsers[s.eternalStorageAddress] = s.eternalStorage
-
-	// Deploy Reserve and store a handle to the Go binding and the contract address.
-	reserveAddress, tx, reserve, err := abi.DeployReserve(s.signer, s.node)
-
-	s.logParsers[reserveAddress] = reserve
-
-	s.requireTx(tx, err)
-	s.reserve = reserve
-	s.reserveAddress = reserveAddress
-
-	// Confirm it begins paused.
-	paused, err := reserve.Paused(nil)
-	s.Require().NoError(err)
-	s.Equal(true, paused)
-
-	// Upgrade PreviousReserve to Reserve.
-	s.requireTxWithStrictEvents(oldReserve.NominateNewOwner(s.signer, reserveAddress))(
-		abi.PreviousReserveNewOwnerNominated{
-			PreviousOwner: s.owner.address(), Nominee: reserveAddress,
-		},
-	)
-	s.requireTxWithStrictEvents(s.reserve.AcceptUpgrade(s.signer, oldReserveAddress))(
-		abi.ReserveMaxSupplyChanged{NewMaxSupply: oldMaxSupply},
-		abi.ReserveUnpaused{Account: s.owner.address()},
-		abi.PreviousReserveOwnershipTransferred{
-			PreviousOwner: s.owner.address(), NewOwner: reserveAddress,
-		},
-		abi.PreviousReservePauserChanged{NewPauser: reserveAddress},
-		abi.PreviousReservePaused{Account: reserveAddress},
-		abi.PreviousReserveEternalStorageTransferred{NewReserveAddress: reserveAddress},
-		abi.ReserveEternalStorageReserveAddressTransferred{
-			OldReserveAddress: oldReserveAddress,
-			NewReserveAddress: reserveAddress,
-		},
-		abi.PreviousReserveMinterChanged{NewMinter: zeroAddress()},
-		abi.PreviousReservePauserChanged{NewPauser: zeroAddress()},
-		abi.PreviousReserveOwnershipTransferred{
-			PreviousOwner: reserveAddress, NewOwner: zeroAddress(),
-		},
-	)
-
-	// Accept ownership.
-	s.requireTxWithStrictEvents(s.eternalStorage.AcceptOwnership(s.signer))(
-		abi.ReserveEternalStorageOwnershipTransferred{
-			PreviousOwner: oldReserveAddress, NewOwner: s.owner.address(),
-		},
-	)
-
-	// Vault.
-	vaultAddress, tx, vault, err := abi.DeployVault(s.signer, s.node)
-
-	s.logParsers[vaultAddress] = vault
-	s.requireTxWithStrictEvents(tx, err)(
-		abi.VaultOwnershipTransferred{
-			PreviousOwner: zeroAddress(), NewOwner: s.owner.address(),
-		},
-		abi.VaultManagerTransferred{
-			PreviousManager: zeroAddress(), NewManager: s.owner.address(),
-		},
-	)
-	s.vault = vault
-	s.vaultAddress = vaultAddress
-
-	// ProposalFactory.
-	propFactoryAddress, tx, propFactory, err := abi.DeployProposalFactory(s.signer, s.node)
-	s.logParsers[propFactoryAddress] = propFactory
-	s.requireTx(tx, err)
-
-	// Deploy collateral ERC20s.
-	s.erc20s = make([]*abi.BasicERC20, s.numTokens)
-	s.erc20Addresses = make([]common.Address, s.numTokens)
-	for i := 0; i < s.numTokens; i++ {
-		erc20Address, _, erc20, err := abi.DeployBasicERC20(s.signer, s.node)
-		s.Require().NoError(err)
-
+	// Deploy the system, with a basket of s.numTokens tokens with random weights.
+	s.router = bindutil.NewRouter()
+	sys := rsvtest.NewSystem(s.node, s.systemOptions())
+	ctx := context.Background()
+	s.Require().NoError(sys.DeployReserve(ctx))
+	s.Require().NoError(sys.DeployVault(ctx))
+	s.Require().NoError(sys.DeployProposalFactory(ctx))
+	s.Require().NoError(sys.DeployCollateral(ctx, s.numTokens))
+	for i, erc20Address := range sys.ERC20Addresses {
 		s.addressToDecimals[erc20Address] = s.decimals[i]
-		s.erc20s[i] = erc20
-		s.erc20Addresses[i] = erc20Address
-		s.logParsers[erc20Address] = erc20
 	}
-
-	// Make a simple basket
-	weights := s.generateWeights(s.erc20Addresses)
-	basketAddress, tx, basket, err := abi.DeployBasket(
-		s.signer,
-		s.node,
-		zeroAddress(),
-		s.erc20Addresses,
-		weights,
-	)
-
-	s.requireTxWithStrictEvents(tx, err)()
-	s.basketAddress = basketAddress
-	s.basket = basket
-
-	// Manager.
-	managerAddress, tx, manager, err := abi.DeployManager(
-		s.signer,
-		s.node,
-		vaultAddress,
-		reserveAddress,
-		propFactoryAddress,
-		basketAddress,
-		s.operator.address(),
-		bigInt(0),
-	)
-
-	s.logParsers[managerAddress] = manager
-	s.requireTx(tx, err)(abi.ManagerOwnershipTransferred{
-		PreviousOwner: zeroAddress(), NewOwner: s.owner.address(),
-	})
-	s.manager = manager
-	s.managerAddress = managerAddress
-
-	// Confirm we start in emergency state.
-	emergency, err := s.manager.Emergency(nil)
-	s.Require().NoError(err)
-	s.Require().Equal(true, emergency)
-
-	// Unpause from emergency.
-	s.requireTxWithStrictEvents(s.manager.SetEmergency(signer(s.operator), false))(
-		abi.ManagerEmergencyChanged{OldVal: true, NewVal: false},
-	)
-
-	// Confirm we are unpaused from emergency.
-	emergency, err = s.manager.Emergency(nil)
-	s.Require().NoError(err)
-	s.Require().Equal(false, emergency)
-
-	// Set all auths to Manager.
-	s.requireTxWithStrictEvents(s.reserve.ChangeMinter(s.signer, managerAddress))(
-		abi.ReserveMinterChanged{NewMinter: managerAddress},
-	)
-	s.requireTxWithStrictEvents(s.reserve.ChangePauser(s.signer, managerAddress))(
-		abi.ReservePauserChanged{NewPauser: managerAddress},
-	)
-	s.requireTxWithStrictEvents(s.vault.ChangeManager(s.signer, managerAddress))(
-		abi.VaultManagerTransferred{PreviousManager: s.owner.address(), NewManager: managerAddress},
-	)
+	s.Require().NoError(sys.DeployBasket(ctx, s.generateWeights(sys.ERC20Addresses)))
+	s.Require().NoError(sys.DeployManager(ctx, bigInt(0)))
+	s.Require().NoError(sys.HandOverToManager(ctx))
+	s.useSystem(sys)
 
 	// Fund and set allowances.
 	var amounts []*big.Int
@@ -438,7 +295,7 @@ func (s *ManagerFuzzSuite) tryWeightProposal(tokens []common.Address, weights []
 	proposal, err := abi.NewWeightProposal(proposalAddress, s.node)
 	s.Require().NoError(err)
 
-	s.logParsers[proposalAddress] = proposal
+	s.router.Register(proposalAddress, abi.WeightProposalKind)
 
 	// Get Proposal Basket.
 	proposalBasketAddress, err := proposal.TrustedBasket(nil)
@@ -448,7 +305,7 @@ func (s *ManagerFuzzSuite) tryWeightProposal(tokens []common.Address, weights []
 	basket, err := abi.NewBasket(proposalBasketAddress, s.node)
 	s.Require().NoError(err)
 
-	s.logParsers[proposalBasketAddress] = basket
+	s.router.Register(proposalBasketAddress, abi.BasketKind)
 
 	// Check Basket has correct fields
 	// Tokens
@@ -479,7 +336,7 @@ func (s *ManagerFuzzSuite) tryWeightProposal(tokens []common.Address, weights []
 	s.requireTxFails(s.manager.ExecuteProposal(signer(s.operator), proposalID))
 
 	// Advance 24h.
-	s.Require().NoError(s.node.(backend).AdjustTime(24 * time.Hour))
+	s.adjustTime(24 * time.Hour)
 
 	// Try to execute the Proposal, but it's okay if it fails.
 	s.displayTxResult(s.manager.ExecuteProposal(signer(s.operator), proposalID))
@@ -499,13 +356,11 @@ func (s *ManagerFuzzSuite) trySwapProposal(tokens []common.Address, amounts []*b
 	s.Require().NoError(err)
 	proposalID := bigInt(0).Sub(proposalsLength, bigInt(1))
 
-	// Construct Proposal binding.
+	// Register the Proposal's events.
 	proposalAddress, err := s.manager.TrustedProposals(nil, proposalID)
 	s.Require().NoError(err)
-	proposal, err := abi.NewSwapProposal(proposalAddress, s.node)
-	s.Require().NoError(err)
 
-	s.logParsers[proposalAddress] = proposal
+	s.router.Register(proposalAddress, abi.SwapProposalKind)
 
 	// Accept the Proposal.
 	s.requireTx(s.manager.AcceptProposal(signer(s.operator), proposalID))(
@@ -518,45 +373,27 @@ func (s *ManagerFuzzSuite) trySwapProposal(tokens []common.Address, amounts []*b
 	s.requireTxFails(s.manager.ExecuteProposal(signer(s.operator), proposalID))
 
 	// Advance 24h.
-	s.Require().NoError(s.node.(backend).AdjustTime(24 * time.Hour))
+	s.adjustTime(24 * time.Hour)
 
 	// Try to execute the Proposal.
 	s.displayTxResult(s.manager.ExecuteProposal(signer(s.operator), proposalID))
 }
 
-// printMetrics prints the current RSV supply in scientific notation.
+// printMetrics prints the current RSV supply in scientific notation, and the basket weights.
 func (s *ManagerFuzzSuite) printMetrics() {
-	rsvSupply, err := s.reserve.TotalSupply(nil)
+	state := s.readBasket()
+	reserve, err := abi.ReadReserveSnapshot(context.Background(), s.multicall, s.reserveAddress, state.Manager.BlockNumber)
 	s.Require().NoError(err)
 
-	fmt.Printf(" | RSV: %v", toScientificNotation(rsvSupply))
-
-	basketAddress, err := s.manager.TrustedBasket(nil)
-	s.Require().NoError(err)
-
-	basket, err := abi.NewBasket(basketAddress, s.node)
-	s.Require().NoError(err)
-
-	tokens, err := basket.GetTokens(nil)
-	s.Require().NoError(err)
+	fmt.Printf(" | RSV: %v", toScientificNotation(reserve.TotalSupply))
 
 	weights := make([]*big.Int, len(s.erc20s))
-	balances := make([]*big.Int, len(s.erc20s))
 	for i, token := range s.erc20Addresses {
-		tokenErc20, err := abi.NewBasicERC20(token, s.node)
-		s.Require().NoError(err)
-
-		tokBal, err := tokenErc20.BalanceOf(nil, s.vaultAddress)
-		s.Require().NoError(err)
-
-		balances[i] = tokBal
-
-		if hasAddress(tokens, token) {
-			tokenWeight, err := basket.Weights(nil, token)
-			s.Require().NoError(err)
-			weights[i] = tokenWeight
-		} else {
-			weights[i] = bigInt(0)
+		weights[i] = bigInt(0)
+		for j, basketToken := range state.Basket.GetTokens {
+			if basketToken == token {
+				weights[i] = state.Weights[j]
+			}
 		}
 	}
 
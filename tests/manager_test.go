@@ -3,13 +3,15 @@
 package tests
 
 import (
+	"context"
 	"math/big"
 	"testing"
 
-	"github.com/ethereum/go-ethereum/common"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/reserve-protocol/rsv-beta/abi"
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+	"github.com/reserve-protocol/rsv-beta/rsvtest"
 )
 
 func TestManager(t *testing.T) {
@@ -31,6 +33,7 @@ var (
 
 // SetupSuite runs once, before all of the tests in the suite.
 func (s *ManagerSuite) SetupSuite() {
+	s.covers = []string{"Manager"}
 	s.setup()
 }
 
@@ -40,159 +43,11 @@ func (s *ManagerSuite) BeforeTest(suiteName, testName string) {
 	s.operator = s.account[1]
 	s.proposer = s.account[5]
 
-	// Deploy PreviousReserve to set up for upgrade.
-	oldReserveAddress, tx, oldReserve, err := abi.DeployPreviousReserve(s.signer, s.node)
-
-	s.logParsers = map[common.Address]logParser{
-		oldReserveAddress: oldReserve,
-	}
-
-	s.requireTx(tx, err)(
-		abi.PreviousReserveOwnershipTransferred{PreviousOwner: zeroAddress(), NewOwner: s.owner.address()},
-	)
-
-	oldMaxSupply, err := oldReserve.MaxSupply(nil)
-	s.Require().NoError(err)
-
-	// Get the Go binding and contract address for the new ReserveEternalStorage contract.
-	s.eternalStorageAddress, err = oldReserve.GetEternalStorageAddress(nil)
-	s.Require().NoError(err)
-	s.eternalStorage, err = abi.NewReserveEternalStorage(s.eternalStorageAddress, s.node)
+	// Deploy the whole system, with the Manager in charge.
+	s.router = bindutil.NewRouter()
+	sys, err := rsvtest.DeployFullSystem(context.Background(), s.node, s.systemOptions())
 	s.Require().NoError(err)
-
-	s.logParsers[s.eternalStorageAddress] = s.eternalStorage
-
-	// Deploy Reserve and store a handle to the Go binding and the contract address.
-	reserveAddress, tx, reserve, err := abi.DeployReserve(s.signer, s.node)
-
-	s.logParsers[reserveAddress] = reserve
-
-	s.requireTx(tx, err)
-	s.reserve = reserve
-	s.reserveAddress = reserveAddress
-
-	// Confirm it begins paused.
-	paused, err := reserve.Paused(nil)
-	s.Require().NoError(err)
-	s.Equal(true, paused)
-
-	// Upgrade PreviousReserve to Reserve.
-	s.requireTxWithStrictEvents(oldReserve.NominateNewOwner(s.signer, reserveAddress))(
-		abi.PreviousReserveNewOwnerNominated{
-			PreviousOwner: s.owner.address(), Nominee: reserveAddress,
-		},
-	)
-	s.requireTxWithStrictEvents(s.reserve.AcceptUpgrade(s.signer, oldReserveAddress))(
-		abi.ReserveMaxSupplyChanged{NewMaxSupply: oldMaxSupply},
-		abi.ReserveUnpaused{Account: s.owner.address()},
-		abi.PreviousReserveOwnershipTransferred{
-			PreviousOwner: s.owner.address(), NewOwner: reserveAddress,
-		},
-		abi.PreviousReservePauserChanged{NewPauser: reserveAddress},
-		abi.PreviousReservePaused{Account: reserveAddress},
-		abi.PreviousReserveEternalStorageTransferred{NewReserveAddress: reserveAddress},
-		abi.ReserveEternalStorageReserveAddressTransferred{
-			OldReserveAddress: oldReserveAddress,
-			NewReserveAddress: reserveAddress,
-		},
-		abi.PreviousReserveMinterChanged{NewMinter: zeroAddress()},
-		abi.PreviousReservePauserChanged{NewPauser: zeroAddress()},
-		abi.PreviousReserveOwnershipTransferred{
-			PreviousOwner: reserveAddress, NewOwner: zeroAddress(),
-		},
-	)
-
-	// Accept ownership.
-	s.requireTxWithStrictEvents(s.eternalStorage.AcceptOwnership(s.signer))(
-		abi.ReserveEternalStorageOwnershipTransferred{
-			PreviousOwner: oldReserveAddress, NewOwner: s.owner.address(),
-		},
-	)
-
-	// Vault.
-	vaultAddress, tx, vault, err := abi.DeployVault(s.signer, s.node)
-
-	s.logParsers[vaultAddress] = vault
-	s.requireTxWithStrictEvents(tx, err)(
-		abi.VaultOwnershipTransferred{
-			PreviousOwner: zeroAddress(), NewOwner: s.owner.address(),
-		},
-		abi.VaultManagerTransferred{
-			PreviousManager: zeroAddress(), NewManager: s.owner.address(),
-		},
-	)
-	s.vault = vault
-	s.vaultAddress = vaultAddress
-
-	// ProposalFactory.
-	propFactoryAddress, tx, propFactory, err := abi.DeployProposalFactory(s.signer, s.node)
-	s.logParsers[propFactoryAddress] = propFactory
-	s.requireTx(tx, err)
-
-	s.proposalFactory = propFactory
-	s.proposalFactoryAddress = propFactoryAddress
-
-	// Deploy collateral ERC20s.
-	s.erc20s = make([]*abi.BasicERC20, 3)
-	s.erc20Addresses = make([]common.Address, 3)
-	for i := 0; i < 3; i++ {
-		erc20Address, _, erc20, err := abi.DeployBasicERC20(s.signer, s.node)
-		s.Require().NoError(err)
-
-		s.erc20s[i] = erc20
-		s.erc20Addresses[i] = erc20Address
-		s.logParsers[erc20Address] = erc20
-	}
-
-	// Basket.
-	s.weights = []*big.Int{shiftLeft(1, 36), shiftLeft(2, 36), shiftLeft(3, 36)}
-
-	// Make a simple basket
-	basketAddress, tx, basket, err := abi.DeployBasket(
-		s.signer, s.node, zeroAddress(), s.erc20Addresses, s.weights,
-	)
-	s.requireTxWithStrictEvents(tx, err)
-	s.NotEqual(zeroAddress(), basketAddress)
-	s.basketAddress, s.basket = basketAddress, basket
-
-	// Manager.
-	managerAddress, tx, manager, err := abi.DeployManager(
-		s.signer, s.node,
-		vaultAddress, reserveAddress, propFactoryAddress, basketAddress, s.operator.address(), bigInt(0),
-	)
-
-	s.logParsers[managerAddress] = manager
-	s.requireTx(tx, err)(abi.ManagerOwnershipTransferred{
-		PreviousOwner: zeroAddress(), NewOwner: s.owner.address(),
-	})
-	s.manager = manager
-	s.managerAddress = managerAddress
-
-	// Confirm we start in emergency state.
-	emergency, err := s.manager.Emergency(nil)
-	s.Require().NoError(err)
-	s.Equal(true, emergency)
-
-	// Unpause from emergency.
-	s.requireTxWithStrictEvents(s.manager.SetEmergency(signer(s.operator), false))(
-		abi.ManagerEmergencyChanged{OldVal: true, NewVal: false},
-	)
-
-	// Confirm we are unpaused from emergency.
-	emergency, err = s.manager.Emergency(nil)
-	s.Require().NoError(err)
-	s.Equal(false, emergency)
-
-	// Set all auths to Manager.
-	s.requireTxWithStrictEvents(s.reserve.ChangeMinter(s.signer, managerAddress))(
-		abi.ReserveMinterChanged{NewMinter: managerAddress},
-	)
-	s.requireTxWithStrictEvents(s.reserve.ChangePauser(s.signer, managerAddress))(
-		abi.ReservePauserChanged{NewPauser: managerAddress},
-	)
-	s.requireTxWithStrictEvents(s.vault.ChangeManager(s.signer, managerAddress))(
-		abi.VaultManagerTransferred{PreviousManager: s.owner.address(), NewManager: managerAddress},
-	)
+	s.useSystem(sys)
 
 	// Fund and set allowances.
 	amounts := []*big.Int{shiftLeft(1, 46), shiftLeft(1, 46), shiftLeft(1, 46)}
@@ -227,7 +82,30 @@ func (s *ManagerSuite) TestConstructor() {
 	s.Require().NoError(err)
 	s.Equal(bigInt(0).String(), seigniorage.String())
 
-	// `emergency` is tested in `BeforeTest`
+	// `emergency` is tested by rsvtest, which deploys the Manager in `BeforeTest`
+}
+
+// TestReadBasket tests that readBasket, which reads through the Multicall contract, agrees with
+// the individual view functions.
+func (s *ManagerSuite) TestReadBasket() {
+	state := s.readBasket()
+	s.Equal(s.basketAddress, state.Manager.TrustedBasket)
+	s.Equal(s.vaultAddress, state.Manager.TrustedVault)
+	s.Equal(s.operator.address(), state.Manager.Operator)
+	s.True(state.Manager.IsFullyCollateralized)
+
+	tokens, err := s.basket.GetTokens(nil)
+	s.Require().NoError(err)
+	s.Equal(tokens, state.Basket.GetTokens)
+	for i, token := range tokens {
+		weight, err := s.basket.Weights(nil, token)
+		s.Require().NoError(err)
+		s.Equal(weight.String(), state.Weights[i].String())
+
+		balance, err := s.erc20s[i].BalanceOf(nil, s.vaultAddress)
+		s.Require().NoError(err)
+		s.Equal(balance.String(), state.VaultBalances[i].String())
+	}
 }
 
 // TestSetIssuancePaused tests that `setIssuancePaused` changes the state as expected.
@@ -511,6 +389,49 @@ func (s *ManagerSuite) TestIssueIsProtected() {
 
 }
 
+// TestIssueChecked tests that the checked Manager binding doesn't send an `issue` that would
+// revert, but returns its revert reason instead, and sends one that wouldn't.
+func (s *ManagerSuite) TestIssueChecked() {
+	amount := bigInt(1)
+	checked, err := abi.NewManagerChecked(s.managerAddress, s.node)
+	s.Require().NoError(err)
+	nonce := func() uint64 {
+		nonce, err := s.node.PendingNonceAt(context.Background(), s.proposer.address())
+		s.Require().NoError(err)
+		return nonce
+	}
+
+	// In an emergency, issue reverts with "contract is paused", so it isn't sent.
+	s.requireTxWithStrictEvents(s.manager.SetEmergency(signer(s.operator), true))(
+		abi.ManagerEmergencyChanged{OldVal: false, NewVal: true},
+	)
+	before := nonce()
+	tx, err := checked.Issue(signer(s.proposer), amount)
+	s.Nil(tx)
+	s.Equal(&bindutil.RevertError{Contract: "Manager", Reason: "contract is paused"}, err)
+	s.Equal(before, nonce())
+	s.requireTxWithStrictEvents(s.manager.SetEmergency(signer(s.operator), false))(
+		abi.ManagerEmergencyChanged{OldVal: true, NewVal: false},
+	)
+
+	// With just issuance paused, it reverts with its own reason.
+	s.requireTxWithStrictEvents(s.manager.SetIssuancePaused(signer(s.operator), true))(
+		abi.ManagerIssuancePausedChanged{OldVal: false, NewVal: true},
+	)
+	_, err = checked.Issue(signer(s.proposer), amount)
+	reason, ok := bindutil.RevertReason(err)
+	s.True(ok)
+	s.Equal("issuance is paused", reason)
+	s.Equal(before, nonce())
+	s.requireTxWithStrictEvents(s.manager.SetIssuancePaused(signer(s.operator), false))(
+		abi.ManagerIssuancePausedChanged{OldVal: true, NewVal: false},
+	)
+
+	// Otherwise, it is sent.
+	s.requireTx(checked.Issue(signer(s.proposer), amount))
+	s.Equal(before+1, nonce())
+}
+
 // TestIssueRequireStatements tests that `issue` reverts when Paused.
 func (s *ManagerSuite) TestIssueRequireStatements() {
 	amount := bigInt(1)
@@ -741,7 +662,7 @@ func (s *ManagerSuite) TestUpgrade() {
 		seigniorage,
 	)
 
-	s.logParsers[v2Address] = v2
+	s.router.Register(v2Address, abi.ManagerV2Kind)
 
 	s.requireTxWithStrictEvents(tx, err)(
 		abi.ManagerV2OwnershipTransferred{
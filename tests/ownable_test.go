@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/reserve-protocol/rsv-beta/abi"
+	"github.com/reserve-protocol/rsv-beta/bindutil"
 )
 
 func TestOwnable(t *testing.T) {
@@ -43,9 +44,8 @@ func (s *OwnableSuite) BeforeTest(suiteName, testName string) {
 	// Deploy BasicOwnable.
 	ownableAddress, tx, ownable, err := abi.DeployBasicOwnable(s.signer, s.node)
 
-	s.logParsers = map[common.Address]logParser{
-		ownableAddress: ownable,
-	}
+	s.router = bindutil.NewRouter()
+	s.router.Register(ownableAddress, abi.BasicOwnableKind)
 	s.ownable = ownable
 	s.ownableAddress = ownableAddress
 
@@ -3,6 +3,7 @@
 package tests
 
 import (
+	"context"
 	"math/big"
 	"testing"
 	"time"
@@ -11,6 +12,8 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/reserve-protocol/rsv-beta/abi"
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+	"github.com/reserve-protocol/rsv-beta/rsvtest"
 )
 
 func TestProposal(t *testing.T) {
@@ -54,11 +57,13 @@ var (
 
 // SetupSuite runs once, before all of the tests in the suite.
 func (s *WeightProposalSuite) SetupSuite() {
+	s.covers = []string{"WeightProposal"}
 	s.setup()
 }
 
 // SetupSuite runs once, before all of the tests in the suite.
 func (s *SwapProposalSuite) SetupSuite() {
+	s.covers = []string{"SwapProposal"}
 	s.setup()
 }
 
@@ -69,7 +74,7 @@ func (s *WeightProposalSuite) BeforeTest(suiteName, testName string) {
 	s.owner = s.account[0]
 	s.proposer = s.account[1]
 
-	s.logParsers = map[common.Address]logParser{}
+	s.router = bindutil.NewRouter()
 
 	// Deploy collateral ERC20s for a basket.
 	s.erc20s = make([]*abi.BasicERC20, 3)
@@ -81,7 +86,7 @@ func (s *WeightProposalSuite) BeforeTest(suiteName, testName string) {
 		s.erc20s[i] = erc20
 		s.erc20Addresses[i] = erc20Address
 		s.weights[i] = bigInt(uint32(i + 1))
-		s.logParsers[erc20Address] = erc20
+		s.router.Register(erc20Address, abi.BasicERC20Kind)
 	}
 
 	// Make a non-empty basket
@@ -100,7 +105,7 @@ func (s *WeightProposalSuite) BeforeTest(suiteName, testName string) {
 	// Deploy a Weight Proposal.
 	proposalAddress, tx, proposal, err := abi.DeployWeightProposal(s.signer, s.node, s.proposer.address(), s.basketAddress)
 
-	s.logParsers[proposalAddress] = proposal
+	s.router.Register(proposalAddress, abi.WeightProposalKind)
 
 	s.requireTxWithStrictEvents(tx, err)(
 		abi.WeightProposalOwnershipTransferred{
@@ -334,7 +339,7 @@ func (s *WeightProposalSuite) TestCompleteCannotHappenBeforeNow() {
 	s.requireTxFails(s.proposal.Complete(s.signer, s.reserveAddress, s.basketAddress))
 
 	// Advance the time.
-	s.node.(backend).AdjustTime(100 * time.Second)
+	s.adjustTime(100 * time.Second)
 
 	// Now the proposal can be completed.
 	s.requireTxWithStrictEvents(s.proposal.Complete(s.signer, s.reserveAddress, s.basketAddress))(
@@ -357,9 +362,8 @@ func (s *SwapProposalSuite) BeforeTest(suiteName, testName string) {
 	proposalAddress, tx, proposal, err := abi.DeploySwapProposal(
 		s.signer, s.node, s.proposer.address(), s.tokens, s.amounts, s.toVault)
 
-	s.logParsers = map[common.Address]logParser{
-		proposalAddress: proposal,
-	}
+	s.router = bindutil.NewRouter()
+	s.router.Register(proposalAddress, abi.SwapProposalKind)
 
 	s.requireTxWithStrictEvents(tx, err)(
 		abi.SwapProposalOwnershipTransferred{
@@ -406,72 +410,10 @@ func (s *SwapProposalSuite) BeforeTest(suiteName, testName string) {
 	s.proposal = proposal
 	s.proposalAddress = proposalAddress
 
-	// Deploy PreviousReserve to set up for upgrade.
-	oldReserveAddress, tx, oldReserve, err := abi.DeployPreviousReserve(s.signer, s.node)
-
-	s.logParsers[oldReserveAddress] = oldReserve
-
-	s.requireTx(tx, err)(
-		abi.PreviousReserveOwnershipTransferred{PreviousOwner: zeroAddress(), NewOwner: s.owner.address()},
-	)
-
-	oldMaxSupply, err := oldReserve.MaxSupply(nil)
-	s.Require().NoError(err)
-
-	// Get the Go binding and contract address for the new ReserveEternalStorage contract.
-	s.eternalStorageAddress, err = oldReserve.GetEternalStorageAddress(nil)
-	s.Require().NoError(err)
-	s.eternalStorage, err = abi.NewReserveEternalStorage(s.eternalStorageAddress, s.node)
-	s.Require().NoError(err)
-
-	s.logParsers[s.eternalStorageAddress] = s.eternalStorage
-
-	// Deploy Reserve and store a handle to the Go binding and the contract address.
-	reserveAddress, tx, reserve, err := abi.DeployReserve(s.signer, s.node)
-
-	s.logParsers[reserveAddress] = reserve
-
-	s.requireTx(tx, err)
-	s.reserve = reserve
-	s.reserveAddress = reserveAddress
-
-	// Confirm it begins paused.
-	paused, err := reserve.Paused(nil)
-	s.Require().NoError(err)
-	s.Equal(true, paused)
-
-	// Upgrade PreviousReserve to Reserve.
-	s.requireTxWithStrictEvents(oldReserve.NominateNewOwner(s.signer, reserveAddress))(
-		abi.PreviousReserveNewOwnerNominated{
-			PreviousOwner: s.owner.address(), Nominee: reserveAddress,
-		},
-	)
-	s.requireTxWithStrictEvents(s.reserve.AcceptUpgrade(s.signer, oldReserveAddress))(
-		abi.ReserveMaxSupplyChanged{NewMaxSupply: oldMaxSupply},
-		abi.ReserveUnpaused{Account: s.owner.address()},
-		abi.PreviousReserveOwnershipTransferred{
-			PreviousOwner: s.owner.address(), NewOwner: reserveAddress,
-		},
-		abi.PreviousReservePauserChanged{NewPauser: reserveAddress},
-		abi.PreviousReservePaused{Account: reserveAddress},
-		abi.PreviousReserveEternalStorageTransferred{NewReserveAddress: reserveAddress},
-		abi.ReserveEternalStorageReserveAddressTransferred{
-			OldReserveAddress: oldReserveAddress,
-			NewReserveAddress: reserveAddress,
-		},
-		abi.PreviousReserveMinterChanged{NewMinter: zeroAddress()},
-		abi.PreviousReservePauserChanged{NewPauser: zeroAddress()},
-		abi.PreviousReserveOwnershipTransferred{
-			PreviousOwner: reserveAddress, NewOwner: zeroAddress(),
-		},
-	)
-
-	// Accept ownership.
-	s.requireTxWithStrictEvents(s.eternalStorage.AcceptOwnership(s.signer))(
-		abi.ReserveEternalStorageOwnershipTransferred{
-			PreviousOwner: oldReserveAddress, NewOwner: s.owner.address(),
-		},
-	)
+	// Deploy Reserve, upgraded from PreviousReserve.
+	sys := rsvtest.NewSystem(s.node, s.systemOptions())
+	s.Require().NoError(sys.DeployReserve(context.Background()))
+	s.useSystem(sys)
 
 	// Make RSV supply nonzero so weights can be calculated.
 	s.requireTxWithStrictEvents(s.reserve.ChangeMinter(s.signer, s.owner.address()))(
@@ -491,7 +433,7 @@ func (s *SwapProposalSuite) BeforeTest(suiteName, testName string) {
 		s.erc20s[i] = erc20
 		s.erc20Addresses[i] = erc20Address
 		s.weights[i] = bigInt(uint32(i + 1))
-		s.logParsers[erc20Address] = erc20
+		s.router.Register(erc20Address, abi.BasicERC20Kind)
 	}
 
 	// Finally, deploy a basket.
@@ -704,7 +646,7 @@ func (s *SwapProposalSuite) TestCompleteCannotHappenBeforeNow() {
 	s.requireTxFails(s.proposal.Complete(s.signer, s.reserveAddress, s.basketAddress))
 
 	// Advance the time.
-	s.node.(backend).AdjustTime(100 * time.Second)
+	s.adjustTime(100 * time.Second)
 
 	// Now the proposal can be completed.
 	s.requireTx(s.proposal.Complete(s.signer, s.reserveAddress, s.basketAddress))
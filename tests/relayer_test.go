@@ -14,6 +14,8 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/reserve-protocol/rsv-beta/abi"
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+	"github.com/reserve-protocol/rsv-beta/rsvtest"
 )
 
 func TestRelayer(t *testing.T) {
@@ -38,79 +40,18 @@ var (
 
 // SetupSuite runs once, before all of the tests in the suite.
 func (s *RelayerSuite) SetupSuite() {
+	s.covers = []string{"Relayer"}
 	s.setup()
 }
 
 // BeforeTest runs before each test in the suite.
 func (s *RelayerSuite) BeforeTest(suiteName, testName string) {
-	// Deploy PreviousReserve to set up for upgrade.
-	oldReserveAddress, tx, oldReserve, err := abi.DeployPreviousReserve(s.signer, s.node)
-
-	s.logParsers = map[common.Address]logParser{
-		oldReserveAddress: oldReserve,
-	}
-
-	s.requireTx(tx, err)(
-		abi.PreviousReserveOwnershipTransferred{PreviousOwner: zeroAddress(), NewOwner: s.owner.address()},
-	)
-
-	oldMaxSupply, err := oldReserve.MaxSupply(nil)
-	s.Require().NoError(err)
-
-	// Get the Go binding and contract address for the new ReserveEternalStorage contract.
-	s.eternalStorageAddress, err = oldReserve.GetEternalStorageAddress(nil)
-	s.Require().NoError(err)
-	s.eternalStorage, err = abi.NewReserveEternalStorage(s.eternalStorageAddress, s.node)
-	s.Require().NoError(err)
-
-	s.logParsers[s.eternalStorageAddress] = s.eternalStorage
-
-	// Deploy Reserve and store a handle to the Go binding and the contract address.
-	reserveAddress, tx, reserve, err := abi.DeployReserve(s.signer, s.node)
-
-	s.logParsers[reserveAddress] = reserve
-
-	s.requireTx(tx, err)
-	s.reserve = reserve
-	s.reserveAddress = reserveAddress
-
-	// Confirm it begins paused.
-	paused, err := reserve.Paused(nil)
-	s.Require().NoError(err)
-	s.Equal(true, paused)
-
-	// Upgrade PreviousReserve to Reserve.
-	s.requireTxWithStrictEvents(oldReserve.NominateNewOwner(s.signer, reserveAddress))(
-		abi.PreviousReserveNewOwnerNominated{
-			PreviousOwner: s.owner.address(), Nominee: reserveAddress,
-		},
-	)
-	s.requireTxWithStrictEvents(s.reserve.AcceptUpgrade(s.signer, oldReserveAddress))(
-		abi.ReserveMaxSupplyChanged{NewMaxSupply: oldMaxSupply},
-		abi.ReserveUnpaused{Account: s.owner.address()},
-		abi.PreviousReserveOwnershipTransferred{
-			PreviousOwner: s.owner.address(), NewOwner: reserveAddress,
-		},
-		abi.PreviousReservePauserChanged{NewPauser: reserveAddress},
-		abi.PreviousReservePaused{Account: reserveAddress},
-		abi.PreviousReserveEternalStorageTransferred{NewReserveAddress: reserveAddress},
-		abi.ReserveEternalStorageReserveAddressTransferred{
-			OldReserveAddress: oldReserveAddress,
-			NewReserveAddress: reserveAddress,
-		},
-		abi.PreviousReserveMinterChanged{NewMinter: zeroAddress()},
-		abi.PreviousReservePauserChanged{NewPauser: zeroAddress()},
-		abi.PreviousReserveOwnershipTransferred{
-			PreviousOwner: reserveAddress, NewOwner: zeroAddress(),
-		},
-	)
-
-	// Accept ownership.
-	s.requireTxWithStrictEvents(s.eternalStorage.AcceptOwnership(s.signer))(
-		abi.ReserveEternalStorageOwnershipTransferred{
-			PreviousOwner: oldReserveAddress, NewOwner: s.owner.address(),
-		},
-	)
+	// Deploy Reserve, upgraded from PreviousReserve.
+	s.router = bindutil.NewRouter()
+	sys := rsvtest.NewSystem(s.node, s.systemOptions())
+	ctx := context.Background()
+	s.Require().NoError(sys.DeployReserve(ctx))
+	s.useSystem(sys)
 
 	deployerAddress := s.owner.address()
 
@@ -127,37 +68,23 @@ func (s *RelayerSuite) BeforeTest(suiteName, testName string) {
 		abi.ReserveFeeRecipientChanged{NewFeeRecipient: deployerAddress},
 	)
 
-	relayerAddress, tx, relayer, err := abi.DeployRelayer(s.signer, s.node, s.reserveAddress)
-
-	s.requireTx(tx, err)()
-
-	s.relayer = relayer
-	s.relayerAddress = relayerAddress
-
-	s.logParsers[s.relayerAddress] = s.relayer
-
-	// Make sure Reserve address set correctly.
-	deployedRSVAddress, err := s.relayer.TrustedRSV(nil)
-	s.Require().NoError(err)
-	s.Equal(deployedRSVAddress, s.reserveAddress)
-
-	// Set Reserve's trusted relayer address correctly.
-	s.requireTxWithStrictEvents(s.reserve.ChangeRelayer(s.signer, s.relayerAddress))(
-		abi.ReserveTrustedRelayerChanged{NewTrustedRelayer: s.relayerAddress},
-	)
+	// Deploy the Relayer, as Reserve's trusted relayer.
+	s.Require().NoError(sys.DeployRelayer(ctx))
+	s.relayer = sys.Relayer
+	s.relayerAddress = sys.RelayerAddress
 
 	// Apparently `ecrecover` is only available on private blockchains after
 	// sending wei to its address, which is address `1`.
 	// See here: https://solidity.readthedocs.io/en/v0.6.4/units-and-global-variables.html
-	nonce, err := s.node.PendingNonceAt(context.Background(), s.account[0].address())
+	nonce, err := s.node.PendingNonceAt(ctx, s.account[0].address())
 	s.Require().NoError(err)
 
-	tx, err = types.SignTx(
+	tx, err := types.SignTx(
 		types.NewTransaction(nonce, common.BytesToAddress([]byte{1}), bigInt(1), 210000, bigInt(1), nil),
 		types.HomesteadSigner{},
 		s.account[0].key,
 	)
-	s.node.SendTransaction(context.Background(), tx)
+	s.node.SendTransaction(ctx, tx)
 	s.requireTx(tx, err)
 }
 
@@ -3,6 +3,7 @@
 package tests
 
 import (
+	"context"
 	"math/big"
 	"testing"
 
@@ -10,6 +11,8 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/reserve-protocol/rsv-beta/abi"
+	"github.com/reserve-protocol/rsv-beta/bindutil"
+	"github.com/reserve-protocol/rsv-beta/rsvtest"
 )
 
 func TestReserve(t *testing.T) {
@@ -31,79 +34,17 @@ var (
 
 // SetupSuite runs once, before all of the tests in the suite.
 func (s *ReserveSuite) SetupSuite() {
+	s.covers = []string{"Reserve"}
 	s.setup()
 }
 
 // BeforeTest runs before each test in the suite.
 func (s *ReserveSuite) BeforeTest(suiteName, testName string) {
-	// Deploy PreviousReserve to set up for upgrade.
-	oldReserveAddress, tx, oldReserve, err := abi.DeployPreviousReserve(s.signer, s.node)
-
-	s.logParsers = map[common.Address]logParser{
-		oldReserveAddress: oldReserve,
-	}
-
-	s.requireTx(tx, err)(
-		abi.PreviousReserveOwnershipTransferred{PreviousOwner: zeroAddress(), NewOwner: s.owner.address()},
-	)
-
-	oldMaxSupply, err := oldReserve.MaxSupply(nil)
-	s.Require().NoError(err)
-
-	// Get the Go binding and contract address for the new ReserveEternalStorage contract.
-	s.eternalStorageAddress, err = oldReserve.GetEternalStorageAddress(nil)
-	s.Require().NoError(err)
-	s.eternalStorage, err = abi.NewReserveEternalStorage(s.eternalStorageAddress, s.node)
-	s.Require().NoError(err)
-
-	s.logParsers[s.eternalStorageAddress] = s.eternalStorage
-
-	// Deploy Reserve and store a handle to the Go binding and the contract address.
-	reserveAddress, tx, reserve, err := abi.DeployReserve(s.signer, s.node)
-
-	s.logParsers[reserveAddress] = reserve
-
-	s.requireTx(tx, err)
-	s.reserve = reserve
-	s.reserveAddress = reserveAddress
-
-	// Confirm it begins paused.
-	paused, err := reserve.Paused(nil)
-	s.Require().NoError(err)
-	s.Equal(true, paused)
-
-	// Upgrade PreviousReserve to Reserve.
-	s.requireTxWithStrictEvents(oldReserve.NominateNewOwner(s.signer, reserveAddress))(
-		abi.PreviousReserveNewOwnerNominated{
-			PreviousOwner: s.owner.address(), Nominee: reserveAddress,
-		},
-	)
-	s.requireTxWithStrictEvents(s.reserve.AcceptUpgrade(s.signer, oldReserveAddress))(
-		abi.ReserveMaxSupplyChanged{NewMaxSupply: oldMaxSupply},
-		abi.ReserveUnpaused{Account: s.owner.address()},
-		abi.PreviousReserveOwnershipTransferred{
-			PreviousOwner: s.owner.address(), NewOwner: reserveAddress,
-		},
-		abi.PreviousReservePauserChanged{NewPauser: reserveAddress},
-		abi.PreviousReservePaused{Account: reserveAddress},
-		abi.PreviousReserveEternalStorageTransferred{NewReserveAddress: reserveAddress},
-		abi.ReserveEternalStorageReserveAddressTransferred{
-			OldReserveAddress: oldReserveAddress,
-			NewReserveAddress: reserveAddress,
-		},
-		abi.PreviousReserveMinterChanged{NewMinter: zeroAddress()},
-		abi.PreviousReservePauserChanged{NewPauser: zeroAddress()},
-		abi.PreviousReserveOwnershipTransferred{
-			PreviousOwner: reserveAddress, NewOwner: zeroAddress(),
-		},
-	)
-
-	// Accept ownership.
-	s.requireTxWithStrictEvents(s.eternalStorage.AcceptOwnership(s.signer))(
-		abi.ReserveEternalStorageOwnershipTransferred{
-			PreviousOwner: oldReserveAddress, NewOwner: s.owner.address(),
-		},
-	)
+	// Deploy Reserve, upgraded from PreviousReserve.
+	s.router = bindutil.NewRouter()
+	sys := rsvtest.NewSystem(s.node, s.systemOptions())
+	s.Require().NoError(sys.DeployReserve(context.Background()))
+	s.useSystem(sys)
 
 	deployerAddress := s.owner.address()
 
@@ -139,7 +80,7 @@ func (s *ReserveSuite) TestConstructor() {
 	s.Require().NoError(err)
 	s.Equal(maxUint256().String(), maxSupply.String())
 
-	// `paused` is tested by BeforeTest
+	// `paused` is tested by rsvtest, which deploys Reserve in BeforeTest
 
 	// `trustedTxFee`
 	trustedTxFee, err := s.reserve.TrustedTxFee(nil)
@@ -818,7 +759,7 @@ func (s *ReserveSuite) TestUpgrade() {
 	// Deploy new contract.
 	newKey := s.account[2]
 	newTokenAddress, tx, newToken, err := abi.DeployReserveV2(signer(newKey), s.node)
-	s.logParsers[newTokenAddress] = newToken
+	s.router.Register(newTokenAddress, abi.ReserveV2Kind)
 	s.requireTx(tx, err)(
 		abi.ReserveV2OwnershipTransferred{PreviousOwner: zeroAddress(), NewOwner: newKey.address()},
 	)
@@ -974,6 +915,54 @@ func (s *ReserveSuite) TestEternalStorageSetBalance() {
 	s.Equal(amount.String(), balance.String())
 }
 
+// TestEternalStorageLayout reads balances and allowances straight out of the eternal storage's
+// storage, at the slots that its checked-in storage layout locates them in.
+func (s *ReserveSuite) TestEternalStorageLayout() {
+	reader, ok := s.node.(bindutil.StorageReader)
+	if !ok {
+		s.T().Skip("the node can't read storage")
+	}
+	holder, spender := s.account[1], s.account[2]
+	amount, allowance := bigInt(1300), bigInt(53)
+	s.requireTxWithStrictEvents(s.reserve.Mint(s.signer, holder.address(), amount))(
+		mintingTransfer(holder.address(), amount),
+	)
+	s.requireTxWithStrictEvents(s.reserve.Approve(signer(holder), spender.address(), allowance))(
+		abi.ReserveApproval{Owner: holder.address(), Spender: spender.address(), Value: allowance},
+	)
+
+	// Read each slot with StorageAt, and through the layout.
+	layout := abi.ReserveEternalStorageStorageLayout
+	for _, entry := range []struct {
+		label string
+		keys  []interface{}
+		want  *big.Int
+	}{
+		{"balance", []interface{}{holder.address()}, amount},
+		{"balance", []interface{}{spender.address()}, bigInt(0)},
+		{"allowed", []interface{}{holder.address(), spender.address()}, allowance},
+		{"allowed", []interface{}{spender.address(), holder.address()}, bigInt(0)},
+	} {
+		slot, _, err := layout.Slot(entry.label, entry.keys...)
+		s.Require().NoError(err)
+		word, err := reader.StorageAt(context.Background(), s.eternalStorageAddress, slot, nil)
+		s.Require().NoError(err)
+		s.Equal(entry.want.String(), new(big.Int).SetBytes(word).String(), "%v%v", entry.label, entry.keys)
+
+		read, err := layout.Read(context.Background(), reader, s.eternalStorageAddress, nil, entry.label, entry.keys...)
+		s.Require().NoError(err)
+		s.Equal(entry.want.String(), read.String(), "%v%v", entry.label, entry.keys)
+	}
+
+	// Reserve's own layout finds its eternal storage and total supply.
+	trustedData, err := abi.ReserveStorageLayout.Read(context.Background(), reader, s.reserveAddress, nil, "trustedData")
+	s.Require().NoError(err)
+	s.Equal(s.eternalStorageAddress, common.BigToAddress(trustedData))
+	totalSupply, err := abi.ReserveStorageLayout.Read(context.Background(), reader, s.reserveAddress, nil, "totalSupply")
+	s.Require().NoError(err)
+	s.Equal(amount.String(), totalSupply.String())
+}
+
 // TestEternalStorageFunctionsAreProtected makes sure that all the functions cannot be called by anyone
 // other than the allowed accounts.
 func (s *ReserveSuite) TestEternalStorageFunctionsAreProtected() {
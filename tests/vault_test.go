@@ -3,16 +3,14 @@
 package tests
 
 import (
-	"fmt"
 	"math/big"
-	"os/exec"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/reserve-protocol/rsv-beta/abi"
-	"github.com/reserve-protocol/rsv-beta/soltools"
+	"github.com/reserve-protocol/rsv-beta/bindutil"
 )
 
 func TestVault(t *testing.T) {
@@ -34,27 +32,13 @@ var (
 
 // SetupSuite runs once, before all of the tests in the suite.
 func (s *VaultSuite) SetupSuite() {
+	s.covers = []string{"Vault"}
 	s.setup()
 }
 
 // TearDownSuite runs once, after all of the tests in the suite.
 func (s *VaultSuite) TearDownSuite() {
-	if coverageEnabled {
-		// Write coverage profile to disk.
-		s.Assert().NoError(s.node.(*soltools.Backend).WriteCoverage())
-
-		// Close the node.js process.
-		s.Assert().NoError(s.node.(*soltools.Backend).Close())
-
-		// Process coverage profile into an HTML report.
-		if out, err := exec.Command("npx", "istanbul", "report", "html").CombinedOutput(); err != nil {
-			fmt.Println()
-			fmt.Println("I generated coverage information in coverage/coverage.json.")
-			fmt.Println("I tried to process it with `istanbul` to turn it into a readable report, but failed.")
-			fmt.Println("The error I got when running istanbul was:", err)
-			fmt.Println("Istanbul's output was:\n" + string(out))
-		}
-	}
+	s.TestSuite.TearDownSuite()
 }
 
 // BeforeTest runs before each test in the suite.
@@ -64,9 +48,8 @@ func (s *VaultSuite) BeforeTest(suiteName, testName string) {
 	// Vault
 	vaultAddress, tx, vault, err := abi.DeployVault(s.signer, s.node)
 
-	s.logParsers = map[common.Address]logParser{
-		vaultAddress: vault,
-	}
+	s.router = bindutil.NewRouter()
+	s.router.Register(vaultAddress, abi.VaultKind)
 	s.requireTxWithStrictEvents(tx, err)(
 		abi.VaultOwnershipTransferred{
 			PreviousOwner: zeroAddress(), NewOwner: s.owner.address(),
@@ -86,7 +69,7 @@ func (s *VaultSuite) BeforeTest(suiteName, testName string) {
 		s.Require().NoError(err)
 		s.erc20s[i] = erc20
 		s.erc20Addresses[i] = erc20Address
-		s.logParsers[erc20Address] = erc20
+		s.router.Register(erc20Address, abi.BasicERC20Kind)
 
 		val := bigInt(1000)
 		s.requireTxWithStrictEvents(erc20.Transfer(s.signer, vaultAddress, val))(
@@ -278,14 +261,14 @@ func (s *VaultSuite) TestUpgrade() {
 		basketAddress, s.account[2].address(), bigInt(0),
 	)
 
-	s.logParsers[managerAddress] = manager
+	s.router.Register(managerAddress, abi.ManagerKind)
 	s.requireTx(tx, err)(abi.ManagerOwnershipTransferred{
 		PreviousOwner: zeroAddress(), NewOwner: s.owner.address(),
 	})
 
 	// Deploy the new vault.
 	newVaultAddress, tx, newVault, err := abi.DeployVaultV2(signer(newKey), s.node)
-	s.logParsers[newVaultAddress] = newVault
+	s.router.Register(newVaultAddress, abi.VaultV2Kind)
 	s.requireTx(tx, err)(
 		abi.VaultV2OwnershipTransferred{PreviousOwner: zeroAddress(), NewOwner: newKey.address()},
 	)